@@ -0,0 +1,795 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// AlertRule decides when an incoming event should notify someone and how
+type AlertRule struct {
+	ID               string           `json:"id"`
+	ProjectID        string           `json:"project_id"`
+	Name             string           `json:"name"`
+	Enabled          bool             `json:"enabled"`
+	ActionMatch      string           `json:"action_match"` // any, all: how conditions combine
+	Conditions       []AlertCondition `json:"conditions"`
+	Filters          AlertFilters     `json:"filters"`
+	Actions          []AlertAction    `json:"actions"`
+	FrequencyMinutes int              `json:"frequency_minutes"` // minimum gap between firings per issue
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// AlertCondition is one trigger of a rule
+type AlertCondition struct {
+	Type            string `json:"type"`                       // every_event, new_issue, regression, event_frequency, user_frequency
+	Value           int    `json:"value,omitempty"`            // N for the frequency conditions
+	IntervalMinutes int    `json:"interval_minutes,omitempty"` // M for the frequency conditions; 0 means all time
+}
+
+// AlertFilters must all match before any condition is evaluated
+type AlertFilters struct {
+	Levels       []string          `json:"levels,omitempty"`
+	Environments []string          `json:"environments,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// AlertAction is a notification channel a rule delivers to
+type AlertAction struct {
+	Type   string `json:"type"`             // slack, webhook, email, integration
+	Target string `json:"target,omitempty"` // channel URL, addresses or integration ID; empty uses the configured default
+}
+
+// AlertNotification carries everything a channel needs to render an alert
+type AlertNotification struct {
+	Project    *Project    `json:"project"`
+	Event      *ErrorEvent `json:"event"`
+	Rule       *AlertRule  `json:"rule"`
+	Triggers   []string    `json:"triggers"`
+	EventCount int         `json:"event_count"`
+	UserCount  int         `json:"user_count"`
+}
+
+// AlertHistoryEntry records a single rule firing
+type AlertHistoryEntry struct {
+	ID          string        `json:"id"`
+	RuleID      string        `json:"rule_id"`
+	RuleName    string        `json:"rule_name"`
+	ProjectID   string        `json:"project_id"`
+	Fingerprint string        `json:"fingerprint"`
+	EventID     string        `json:"event_id"`
+	Triggers    []string      `json:"triggers"`
+	Actions     []AlertAction `json:"actions"`
+	Status      string        `json:"status"` // sent, partial, failed, digested
+	Error       string        `json:"error,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+var validAlertConditions = map[string]bool{
+	"every_event":     true,
+	"new_issue":       true,
+	"regression":      true,
+	"event_frequency": true,
+	"user_frequency":  true,
+}
+
+var validAlertActions = map[string]bool{
+	"slack":       true,
+	"webhook":     true,
+	"email":       true,
+	"integration": true,
+}
+
+// evaluateAlertRules runs every enabled rule of the event's project against it
+func evaluateAlertRules(db *sql.DB, project *Project, event *ErrorEvent) {
+	if project == nil || event == nil {
+		return
+	}
+
+	settings, err := GetProjectSettings(db, project.ID)
+	if err != nil {
+		log.Printf("[Alerts] Failed to get project settings for %s: %v", project.ID, err)
+		return
+	}
+	if !settings.NotificationEnabled {
+		return
+	}
+
+	rules, err := GetAlertRules(db, project.ID)
+	if err != nil {
+		log.Printf("[Alerts] Failed to load alert rules for %s: %v", project.ID, err)
+		return
+	}
+	if len(rules) == 0 {
+		if rule := defaultAlertRule(db, project.ID, settings); rule != nil {
+			rules = []AlertRule{*rule}
+		}
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !rule.Filters.matches(event) {
+			continue
+		}
+
+		triggers, err := rule.triggers(db, event)
+		if err != nil {
+			log.Printf("[Alerts] Failed to evaluate rule %s: %v", rule.ID, err)
+			continue
+		}
+		if len(triggers) == 0 {
+			continue
+		}
+
+		acquired, err := acquireAlertRuleSlot(db, rule, event.Fingerprint)
+		if err != nil {
+			log.Printf("[Alerts] Failed to check frequency for rule %s: %v", rule.ID, err)
+			continue
+		}
+		if !acquired {
+			log.Printf("[Alerts] Rule '%s' already fired for issue %s within %d minutes, skipping", rule.Name, event.Fingerprint, rule.FrequencyMinutes)
+			continue
+		}
+
+		fireAlertRule(db, project, event, rule, triggers, settings.NotificationFrequency)
+	}
+}
+
+// defaultAlertRule mirrors the project notification settings for projects without rules
+func defaultAlertRule(db *sql.DB, projectID string, settings *ProjectSettings) *AlertRule {
+	actions := projectNotificationActions(db, projectID, settings)
+	if len(actions) == 0 {
+		return nil
+	}
+
+	var levels []string
+	for _, level := range strings.Split(settings.NotificationLevels, ",") {
+		if level = strings.TrimSpace(level); level != "" {
+			levels = append(levels, level)
+		}
+	}
+
+	return &AlertRule{
+		ID:               "default:" + projectID,
+		ProjectID:        projectID,
+		Name:             "Default notifications",
+		Enabled:          true,
+		ActionMatch:      "any",
+		Conditions:       []AlertCondition{{Type: "every_event"}},
+		Filters:          AlertFilters{Levels: levels},
+		Actions:          actions,
+		FrequencyMinutes: settings.NotificationRateLimit,
+	}
+}
+
+// projectNotificationActions lists every channel configured for the project
+func projectNotificationActions(db *sql.DB, projectID string, settings *ProjectSettings) []AlertAction {
+	globalSettings, _ := GetAllSettings(db)
+
+	var actions []AlertAction
+	if webhook := globalSettings["slack_webhook"]; webhook != "" {
+		actions = append(actions, AlertAction{Type: "slack", Target: webhook})
+	}
+	if settings.NotificationWebhookURL != "" {
+		actions = append(actions, AlertAction{Type: "webhook", Target: settings.NotificationWebhookURL})
+	}
+	if webhook := globalSettings["generic_webhook"]; webhook != "" {
+		actions = append(actions, AlertAction{Type: "webhook", Target: webhook})
+	}
+	if settings.NotificationEmail != "" {
+		actions = append(actions, AlertAction{Type: "email", Target: settings.NotificationEmail})
+	}
+	integrations, _ := GetProjectIntegrations(db, projectID)
+	for _, integ := range integrations {
+		if integ.Enabled {
+			actions = append(actions, AlertAction{Type: "integration", Target: integ.ID})
+		}
+	}
+	return actions
+}
+
+func (f AlertFilters) matches(event *ErrorEvent) bool {
+	if len(f.Levels) > 0 && !containsFold(f.Levels, event.Level) {
+		return false
+	}
+	if len(f.Environments) > 0 && !containsFold(f.Environments, event.Environment) {
+		return false
+	}
+	if len(f.Tags) > 0 {
+		var tags map[string]interface{}
+		json.Unmarshal([]byte(event.Tags), &tags)
+		for key, want := range f.Tags {
+			got, ok := tags[key]
+			if !ok || fmt.Sprint(got) != want {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// triggers returns the condition types that matched, honouring ActionMatch
+func (rule *AlertRule) triggers(db *sql.DB, event *ErrorEvent) ([]string, error) {
+	var matched []string
+	for _, cond := range rule.Conditions {
+		ok, err := cond.matches(db, event)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, cond.Type)
+		} else if rule.ActionMatch == "all" {
+			return nil, nil
+		}
+	}
+	return matched, nil
+}
+
+func (c AlertCondition) matches(db *sql.DB, event *ErrorEvent) (bool, error) {
+	switch c.Type {
+	case "every_event":
+		return true, nil
+	case "new_issue":
+		var prior int
+		err := db.QueryRow(
+			"SELECT COUNT(*) FROM errors WHERE project_id = ? AND fingerprint = ? AND id != ? AND created_at < ?",
+			event.ProjectID, event.Fingerprint, event.ID, event.CreatedAt,
+		).Scan(&prior)
+		return prior == 0, err
+	case "regression":
+		var status string
+		err := db.QueryRow(
+			"SELECT status FROM errors WHERE project_id = ? AND fingerprint = ? AND id != ? AND created_at < ? ORDER BY created_at DESC LIMIT 1",
+			event.ProjectID, event.Fingerprint, event.ID, event.CreatedAt,
+		).Scan(&status)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return status == "resolved", err
+	case "event_frequency":
+		count, err := countIssueEvents(db, event, c.IntervalMinutes)
+		return count > c.Value, err
+	case "user_frequency":
+		count, err := countIssueUsers(db, event, c.IntervalMinutes)
+		return count > c.Value, err
+	}
+	return false, fmt.Errorf("unknown condition type %q", c.Type)
+}
+
+func countIssueEvents(db *sql.DB, event *ErrorEvent, intervalMinutes int) (int, error) {
+	query := "SELECT COUNT(*) FROM errors WHERE project_id = ? AND fingerprint = ?"
+	args := []interface{}{event.ProjectID, event.Fingerprint}
+	if intervalMinutes > 0 {
+		query += " AND created_at >= ?"
+		args = append(args, time.Now().Add(-time.Duration(intervalMinutes)*time.Minute))
+	}
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+func countIssueUsers(db *sql.DB, event *ErrorEvent, intervalMinutes int) (int, error) {
+	query := `SELECT COUNT(DISTINCT user) FROM errors WHERE project_id = ? AND fingerprint = ?
+		AND user IS NOT NULL AND user != '' AND user != '{}' AND user != 'null'`
+	args := []interface{}{event.ProjectID, event.Fingerprint}
+	if intervalMinutes > 0 {
+		query += " AND created_at >= ?"
+		args = append(args, time.Now().Add(-time.Duration(intervalMinutes)*time.Minute))
+	}
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// acquireAlertRuleSlot atomically records a firing unless the rule already fired for
+// this issue within its frequency window. State lives in the database so restarts
+// don't reset throttling.
+func acquireAlertRuleSlot(db *sql.DB, rule *AlertRule, fingerprint string) (bool, error) {
+	now := time.Now()
+	cutoff := now.Add(-time.Duration(rule.FrequencyMinutes) * time.Minute)
+	res, err := db.Exec(`
+		INSERT INTO alert_rule_state (rule_id, fingerprint, last_fired_at) VALUES (?, ?, ?)
+		ON CONFLICT(rule_id, fingerprint) DO UPDATE SET last_fired_at = excluded.last_fired_at
+		WHERE alert_rule_state.last_fired_at <= ?`,
+		rule.ID, fingerprint, now, cutoff,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// fireAlertRule delivers the alert to every action of the rule, or buffers it for
+// the next digest when the project receives hourly or daily summaries
+func fireAlertRule(db *sql.DB, project *Project, event *ErrorEvent, rule *AlertRule, triggers []string, frequency string) {
+	n := &AlertNotification{
+		Project:  project,
+		Event:    event,
+		Rule:     rule,
+		Triggers: triggers,
+	}
+	n.EventCount, _ = countIssueEvents(db, event, 0)
+	n.UserCount, _ = countIssueUsers(db, event, 0)
+
+	log.Printf("[Alerts] Rule '%s' fired for '%s' in project '%s' (%s)",
+		rule.Name, event.Message, project.Name, strings.Join(triggers, ", "))
+
+	var failures []string
+	status := "sent"
+	immediate := rule.Actions
+	if isDigestFrequency(frequency) {
+		// Incident tools page on-call and track incident state themselves, so they
+		// are never held back for a digest
+		var buffered []AlertAction
+		immediate = nil
+		for _, action := range rule.Actions {
+			if isIncidentAction(db, n.Project.ID, action) {
+				immediate = append(immediate, action)
+			} else {
+				buffered = append(buffered, action)
+			}
+		}
+		if len(buffered) > 0 {
+			status = "digested"
+			if err := bufferDigestItems(db, buffered, n); err != nil {
+				log.Printf("[Alerts] Failed to buffer digest items for rule %s: %v", rule.ID, err)
+				failures = append(failures, "digest: "+err.Error())
+			}
+		}
+	}
+	for _, action := range immediate {
+		if err := sendAlertAction(db, action, n); err != nil {
+			log.Printf("[Alerts] %s action failed for rule %s: %v", action.Type, rule.ID, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", action.Type, err))
+		}
+	}
+	if len(failures) > 0 && len(failures) >= len(rule.Actions) {
+		status = "failed"
+	} else if len(failures) > 0 {
+		status = "partial"
+	}
+
+	entry := &AlertHistoryEntry{
+		ID:          uuid.New().String(),
+		RuleID:      rule.ID,
+		RuleName:    rule.Name,
+		ProjectID:   project.ID,
+		Fingerprint: event.Fingerprint,
+		EventID:     event.ID,
+		Triggers:    triggers,
+		Actions:     rule.Actions,
+		Status:      status,
+		Error:       strings.Join(failures, "; "),
+		CreatedAt:   time.Now(),
+	}
+	if err := InsertAlertHistory(db, entry); err != nil {
+		log.Printf("[Alerts] Failed to record alert history for rule %s: %v", rule.ID, err)
+	}
+}
+
+// sendAlertAction delivers n through a single channel
+func sendAlertAction(db *sql.DB, action AlertAction, n *AlertNotification) error {
+	switch action.Type {
+	case "slack":
+		target := action.Target
+		if target == "" {
+			target, _ = GetSetting(db, "slack_webhook")
+		}
+		if target == "" {
+			return errors.New("no Slack webhook configured")
+		}
+		link := fmt.Sprintf("%s/errors/%s", getPublicURL(db), n.Event.ID)
+		_, err := enqueueWebhook(db, n.Project.ID, target, "alert", slackAlertPayload(n, link, renderNotification(db, "slack", n)))
+		return err
+	case "webhook":
+		target := action.Target
+		if target == "" {
+			if settings, err := GetProjectSettings(db, n.Project.ID); err == nil {
+				target = settings.NotificationWebhookURL
+			}
+		}
+		if target == "" {
+			return errors.New("no webhook URL configured")
+		}
+		if custom := renderNotification(db, "webhook", n); custom != "" {
+			_, err := enqueueWebhook(db, n.Project.ID, target, "alert", json.RawMessage(custom))
+			return err
+		}
+		_, err := enqueueWebhook(db, n.Project.ID, target, "alert", map[string]interface{}{
+			"event":       n.Event,
+			"project":     n.Project,
+			"event_count": n.EventCount,
+			"user_count":  n.UserCount,
+			"rule":        n.Rule.Name,
+			"triggers":    n.Triggers,
+			"timestamp":   time.Now(),
+		})
+		return err
+	case "email":
+		target := action.Target
+		if target == "" {
+			if settings, err := GetProjectSettings(db, n.Project.ID); err == nil {
+				target = settings.NotificationEmail
+			}
+		}
+		to := splitEmailList(target)
+		if len(to) == 0 {
+			return errors.New("no notification email configured")
+		}
+		return sendEmailMessage(db, buildAlertEmail(db, n, to))
+	case "integration":
+		integ, err := GetProjectIntegration(db, n.Project.ID, action.Target)
+		if err != nil {
+			return fmt.Errorf("integration %s not found", action.Target)
+		}
+		if !integ.Enabled {
+			return nil
+		}
+		return sendIntegrationAlert(db, integ, n)
+	}
+	return fmt.Errorf("unknown action type %q", action.Type)
+}
+
+// isIncidentAction reports whether action targets a PagerDuty or Opsgenie integration
+func isIncidentAction(db *sql.DB, projectID string, action AlertAction) bool {
+	if action.Type != "integration" {
+		return false
+	}
+	integ, err := GetProjectIntegration(db, projectID, action.Target)
+	return err == nil && isIncidentIntegration(integ.Type)
+}
+
+// validate normalises defaults and rejects malformed rules
+func (rule *AlertRule) validate() error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return errors.New("name is required")
+	}
+	if rule.ActionMatch == "" {
+		rule.ActionMatch = "any"
+	}
+	if rule.ActionMatch != "any" && rule.ActionMatch != "all" {
+		return errors.New("action_match must be 'any' or 'all'")
+	}
+	if len(rule.Conditions) == 0 {
+		return errors.New("at least one condition is required")
+	}
+	for _, c := range rule.Conditions {
+		if !validAlertConditions[c.Type] {
+			return fmt.Errorf("unsupported condition type %q", c.Type)
+		}
+		if (c.Type == "event_frequency" || c.Type == "user_frequency") && c.Value < 0 {
+			return fmt.Errorf("%s value must be non-negative", c.Type)
+		}
+		if c.IntervalMinutes < 0 {
+			return errors.New("interval_minutes must be non-negative")
+		}
+	}
+	if len(rule.Actions) == 0 {
+		return errors.New("at least one action is required")
+	}
+	for _, a := range rule.Actions {
+		if !validAlertActions[a.Type] {
+			return fmt.Errorf("unsupported action type %q", a.Type)
+		}
+		if a.Type == "integration" && a.Target == "" {
+			return errors.New("integration actions require a target integration ID")
+		}
+	}
+	if rule.FrequencyMinutes <= 0 {
+		rule.FrequencyMinutes = 30
+	}
+	return nil
+}
+
+// Alert rule database functions
+
+func GetAlertRules(db *sql.DB, projectID string) ([]AlertRule, error) {
+	rows, err := db.Query(`SELECT id, project_id, name, enabled, action_match, conditions, filters, actions, frequency_minutes, created_at, updated_at
+		FROM alert_rules WHERE project_id = ? ORDER BY created_at ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []AlertRule
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+func GetAlertRule(db *sql.DB, projectID, ruleID string) (*AlertRule, error) {
+	rows, err := db.Query(`SELECT id, project_id, name, enabled, action_match, conditions, filters, actions, frequency_minutes, created_at, updated_at
+		FROM alert_rules WHERE project_id = ? AND id = ?`, projectID, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	return scanAlertRule(rows)
+}
+
+func scanAlertRule(rows *sql.Rows) (*AlertRule, error) {
+	var rule AlertRule
+	var conditions, filters, actions string
+	err := rows.Scan(&rule.ID, &rule.ProjectID, &rule.Name, &rule.Enabled, &rule.ActionMatch,
+		&conditions, &filters, &actions, &rule.FrequencyMinutes, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(conditions), &rule.Conditions)
+	json.Unmarshal([]byte(filters), &rule.Filters)
+	json.Unmarshal([]byte(actions), &rule.Actions)
+	return &rule, nil
+}
+
+func SaveAlertRule(db *sql.DB, rule *AlertRule) error {
+	conditions, _ := json.Marshal(rule.Conditions)
+	filters, _ := json.Marshal(rule.Filters)
+	actions, _ := json.Marshal(rule.Actions)
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO alert_rules (id, project_id, name, enabled, action_match, conditions, filters, actions, frequency_minutes, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.ID, rule.ProjectID, rule.Name, rule.Enabled, rule.ActionMatch,
+		string(conditions), string(filters), string(actions), rule.FrequencyMinutes, rule.CreatedAt, rule.UpdatedAt,
+	)
+	return err
+}
+
+func DeleteAlertRule(db *sql.DB, projectID, ruleID string) error {
+	res, err := db.Exec("DELETE FROM alert_rules WHERE project_id = ? AND id = ?", projectID, ruleID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	db.Exec("DELETE FROM alert_rule_state WHERE rule_id = ?", ruleID)
+	return nil
+}
+
+func InsertAlertHistory(db *sql.DB, e *AlertHistoryEntry) error {
+	triggers, _ := json.Marshal(e.Triggers)
+	actions, _ := json.Marshal(e.Actions)
+	_, err := db.Exec(`
+		INSERT INTO alert_history (id, rule_id, rule_name, project_id, fingerprint, event_id, triggers, actions, status, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.RuleID, e.RuleName, e.ProjectID, e.Fingerprint, e.EventID,
+		string(triggers), string(actions), e.Status, e.Error, e.CreatedAt,
+	)
+	return err
+}
+
+func GetAlertHistory(db *sql.DB, projectID, ruleID string, limit, offset int) ([]AlertHistoryEntry, int, error) {
+	where := " WHERE project_id = ?"
+	args := []interface{}{projectID}
+	if ruleID != "" {
+		where += " AND rule_id = ?"
+		args = append(args, ruleID)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM alert_history"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`SELECT id, rule_id, rule_name, project_id, fingerprint, event_id, triggers, actions, status, error, created_at
+		FROM alert_history`+where+" ORDER BY created_at DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var history []AlertHistoryEntry
+	for rows.Next() {
+		var e AlertHistoryEntry
+		var triggers, actions string
+		if err := rows.Scan(&e.ID, &e.RuleID, &e.RuleName, &e.ProjectID, &e.Fingerprint, &e.EventID,
+			&triggers, &actions, &e.Status, &e.Error, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		json.Unmarshal([]byte(triggers), &e.Triggers)
+		json.Unmarshal([]byte(actions), &e.Actions)
+		history = append(history, e)
+	}
+	return history, total, rows.Err()
+}
+
+// Alert rule handlers
+
+func getAlertRules(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	rules, err := GetAlertRules(db, projectID)
+	if err != nil {
+		log.Printf("Error fetching alert rules: %v", err)
+		http.Error(w, "Failed to fetch alert rules", http.StatusInternalServerError)
+		return
+	}
+	if rules == nil {
+		rules = []AlertRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func getAlertRule(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	rule, err := GetAlertRule(db, vars["id"], vars["ruleId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Alert rule not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch alert rule", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func createAlertRule(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	if _, err := GetProject(db, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	rule := AlertRule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := rule.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.ID = uuid.New().String()
+	rule.ProjectID = projectID
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = rule.CreatedAt
+
+	if err := SaveAlertRule(db, &rule); err != nil {
+		log.Printf("Error creating alert rule: %v", err)
+		http.Error(w, "Failed to create alert rule", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "alert_rule.create", "alert_rule", rule.ID, nil, &rule)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func updateAlertRule(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	existing, err := GetAlertRule(db, projectID, vars["ruleId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Alert rule not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch alert rule", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rule := *existing
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := rule.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.ID = existing.ID
+	rule.ProjectID = existing.ProjectID
+	rule.CreatedAt = existing.CreatedAt
+	rule.UpdatedAt = time.Now()
+
+	if err := SaveAlertRule(db, &rule); err != nil {
+		log.Printf("Error updating alert rule: %v", err)
+		http.Error(w, "Failed to update alert rule", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "alert_rule.update", "alert_rule", rule.ID, existing, &rule)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func deleteAlertRule(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	ruleID := vars["ruleId"]
+
+	existing, _ := GetAlertRule(db, projectID, ruleID)
+
+	if err := DeleteAlertRule(db, projectID, ruleID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Alert rule not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete alert rule", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(db, r, "alert_rule.delete", "alert_rule", ruleID, existing, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getAlertHistory(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	history, total, err := GetAlertHistory(db, projectID, r.URL.Query().Get("rule_id"), limit, offset)
+	if err != nil {
+		log.Printf("Error fetching alert history: %v", err)
+		http.Error(w, "Failed to fetch alert history", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []AlertHistoryEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"history": history,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWebhookAlertPayload(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	stub := newWebhookStub(t)
+	action := AlertAction{Type: "webhook", Target: stub.URL + "/hook"}
+
+	send := func() map[string]interface{} {
+		t.Helper()
+		before := len(stub.received())
+		if err := sendAlertAction(db, action, newTestNotification(project)); err != nil {
+			t.Fatalf("sendAlertAction: %v", err)
+		}
+		deliverQueuedWebhooks(t, db)
+		got := stub.received()
+		if len(got) != before+1 {
+			t.Fatalf("stub received %d new requests, want 1", len(got)-before)
+		}
+		checkSignature(t, webhookSecret(t, db, action.Target), got[before])
+		return got[before].json(t)
+	}
+	checkBuiltIn := func(body map[string]interface{}) {
+		t.Helper()
+		event, _ := body["event"].(map[string]interface{})
+		proj, _ := body["project"].(map[string]interface{})
+		if event["message"] != "TypeError: cart is undefined" || proj["id"] != project.ID || body["rule"] != "New issues" {
+			t.Errorf("built-in payload = %v", body)
+		}
+		if body["event_count"] != float64(3) || body["user_count"] != float64(2) {
+			t.Errorf("counts = %v, %v", body["event_count"], body["user_count"])
+		}
+	}
+
+	// No custom template: the built-in JSON payload
+	checkBuiltIn(send())
+
+	// A custom template replaces it
+	SaveNotificationTemplate(db, &NotificationTemplate{
+		ProjectID: project.ID, Channel: "webhook", UpdatedAt: time.Now(),
+		Template: `{"text": {{json .Issue.Title}}, "project": {{json .Project.Name}}}`,
+	})
+	if body := send(); body["text"] != "TypeError: cart is undefined" || body["project"] != "checkout" {
+		t.Errorf("custom payload = %v", body)
+	}
+
+	// A template that stops rendering valid JSON falls back to the built-in payload
+	SaveNotificationTemplate(db, &NotificationTemplate{
+		ProjectID: project.ID, Channel: "webhook", UpdatedAt: time.Now(),
+		Template: `{{.Event.Message}}`,
+	})
+	checkBuiltIn(send())
+}
+
+func TestAlertConditions(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	insert := func(user string, age time.Duration) *ErrorEvent {
+		t.Helper()
+		event := newTestNotification(project).Event
+		event.User, event.Status, event.CreatedAt = user, "unresolved", time.Now().Add(-age)
+		if err := InsertError(db, event); err != nil {
+			t.Fatalf("InsertError: %v", err)
+		}
+		return event
+	}
+	matches := func(event *ErrorEvent, cond AlertCondition) bool {
+		t.Helper()
+		ok, err := cond.matches(db, event)
+		if err != nil {
+			t.Fatalf("%s: %v", cond.Type, err)
+		}
+		return ok
+	}
+
+	first := insert(`{"id":"u1"}`, 2*time.Hour)
+	if !matches(first, AlertCondition{Type: "new_issue"}) {
+		t.Error("the first event of an issue isn't a new issue")
+	}
+	if matches(first, AlertCondition{Type: "regression"}) {
+		t.Error("the first event of an issue is a regression")
+	}
+
+	second := insert(`{"id":"u2"}`, 30*time.Minute)
+	if matches(second, AlertCondition{Type: "new_issue"}) {
+		t.Error("the second event of an issue is a new issue")
+	}
+	if matches(second, AlertCondition{Type: "regression"}) {
+		t.Error("an event of an unresolved issue is a regression")
+	}
+
+	db.Exec("UPDATE errors SET status = 'resolved' WHERE fingerprint = ?", first.Fingerprint)
+	third := insert(`{"id":"u2"}`, 0)
+	if !matches(third, AlertCondition{Type: "regression"}) {
+		t.Error("an event after the issue was resolved isn't a regression")
+	}
+	insert(`{}`, 0)
+
+	// Four events by two users, three of them and one user within the hour
+	for _, tt := range []struct {
+		cond AlertCondition
+		want bool
+	}{
+		{AlertCondition{Type: "event_frequency", Value: 3}, true},
+		{AlertCondition{Type: "event_frequency", Value: 4}, false},
+		{AlertCondition{Type: "event_frequency", Value: 2, IntervalMinutes: 60}, true},
+		{AlertCondition{Type: "event_frequency", Value: 3, IntervalMinutes: 60}, false},
+		{AlertCondition{Type: "user_frequency", Value: 1}, true},
+		{AlertCondition{Type: "user_frequency", Value: 2}, false},
+		{AlertCondition{Type: "user_frequency", Value: 0, IntervalMinutes: 60}, true},
+		{AlertCondition{Type: "user_frequency", Value: 1, IntervalMinutes: 60}, false},
+	} {
+		if got := matches(third, tt.cond); got != tt.want {
+			t.Errorf("%+v matched = %t, want %t", tt.cond, got, tt.want)
+		}
+	}
+	if _, err := (AlertCondition{Type: "sometimes"}).matches(db, third); err == nil {
+		t.Error("an unknown condition type matched without an error")
+	}
+}
+
+func TestAlertRuleActionMatch(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	event := newTestNotification(project).Event
+	event.CreatedAt = time.Now()
+	if err := InsertError(db, event); err != nil {
+		t.Fatalf("InsertError: %v", err)
+	}
+
+	conditions := []AlertCondition{{Type: "new_issue"}, {Type: "event_frequency", Value: 5}, {Type: "every_event"}}
+	for _, tt := range []struct {
+		actionMatch string
+		want        string
+	}{
+		{"any", "new_issue,every_event"},
+		{"all", ""},
+	} {
+		rule := &AlertRule{ActionMatch: tt.actionMatch, Conditions: conditions}
+		triggers, err := rule.triggers(db, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(triggers, ","); got != tt.want {
+			t.Errorf("%s: triggers = %q, want %q", tt.actionMatch, got, tt.want)
+		}
+	}
+
+	rule := &AlertRule{ActionMatch: "all", Conditions: conditions[:1]}
+	if triggers, _ := rule.triggers(db, event); len(triggers) != 1 {
+		t.Errorf("all: triggers = %v, want new_issue", triggers)
+	}
+}
+
+func TestAlertRuleFrequencySurvivesRestart(t *testing.T) {
+	db := newTestDB(t)
+	rule := &AlertRule{ID: uuid.New().String(), FrequencyMinutes: 30}
+	acquire := func(db *sql.DB, fingerprint string) bool {
+		t.Helper()
+		ok, err := acquireAlertRuleSlot(db, rule, fingerprint)
+		if err != nil {
+			t.Fatalf("acquireAlertRuleSlot: %v", err)
+		}
+		return ok
+	}
+
+	if !acquire(db, "fp-cart") {
+		t.Fatal("the first firing was throttled")
+	}
+	if acquire(db, "fp-cart") {
+		t.Error("a second firing within the frequency wasn't throttled")
+	}
+	if !acquire(db, "fp-login") {
+		t.Error("another issue was throttled")
+	}
+
+	// A restart opens the same database afresh
+	db.Close()
+	db, err := InitDB()
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	if acquire(db, "fp-cart") {
+		t.Error("a firing within the frequency wasn't throttled after a restart")
+	}
+
+	db.Exec("UPDATE alert_rule_state SET last_fired_at = ? WHERE rule_id = ?", time.Now().Add(-31*time.Minute), rule.ID)
+	if !acquire(db, "fp-cart") {
+		t.Error("a firing after the frequency was throttled")
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry is a single append-only record of an administrative or security action
+type AuditEntry struct {
+	ID         string          `json:"id"`
+	ActorID    string          `json:"actor_id"`
+	ActorEmail string          `json:"actor_email"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+	IPAddress  string          `json:"ip_address"`
+	UserAgent  string          `json:"user_agent"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows audit log queries; zero values are ignored
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+// recordAudit writes an audit entry for the action performed by the caller of r.
+// before and after are snapshots of the target; either may be nil.
+func recordAudit(db *sql.DB, r *http.Request, action, targetType, targetID string, before, after interface{}) {
+	entry := &AuditEntry{
+		ID:         uuid.New().String(),
+		ActorID:    "anonymous",
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IPAddress:  clientIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  time.Now(),
+	}
+	if claims, err := claimsFromRequest(r); err == nil {
+		entry.ActorID = claims.UserID
+		entry.ActorEmail = claims.Email
+	}
+
+	beforeMap := auditSnapshot(before)
+	afterMap := auditSnapshot(after)
+	if beforeMap != nil {
+		entry.Before, _ = json.Marshal(beforeMap)
+	}
+	if afterMap != nil {
+		entry.After, _ = json.Marshal(afterMap)
+	}
+	if diff := auditDiff(beforeMap, afterMap); len(diff) > 0 {
+		entry.Diff, _ = json.Marshal(diff)
+	}
+
+	if err := InsertAuditEntry(db, entry); err != nil {
+		log.Printf("[Audit] Failed to record %s on %s %s: %v", action, targetType, targetID, err)
+	}
+}
+
+// trustedProxies are the networks in TRUSTED_PROXIES (comma-separated IPs or CIDRs)
+// whose forwarding headers are believed
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []*net.IPNet
+)
+
+func isTrustedProxy(ip net.IP) bool {
+	trustedProxiesOnce.Do(func() {
+		for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if !strings.Contains(entry, "/") {
+				if strings.Contains(entry, ":") {
+					entry += "/128"
+				} else {
+					entry += "/32"
+				}
+			}
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				log.Printf("[Audit] Ignoring invalid trusted proxy %q: %v", entry, err)
+				continue
+			}
+			trustedProxies = append(trustedProxies, network)
+		}
+	})
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the originating address. Proxy headers are only used when the
+// request came from a trusted proxy, as anyone else can set them.
+func clientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remote = host
+	}
+	if !isTrustedProxy(net.ParseIP(remote)) {
+		return remote
+	}
+
+	// The last address not added by a trusted proxy is the client
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if i == 0 || !isTrustedProxy(net.ParseIP(hop)) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return remote
+}
+
+// auditSnapshot converts v to a flat JSON object and masks sensitive values
+func auditSnapshot(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return map[string]interface{}{"value": v}
+	}
+	for k, val := range m {
+		if isSensitiveAuditKey(k) {
+			m[k] = redactAuditValue(val)
+		}
+	}
+	return m
+}
+
+func isSensitiveAuditKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, marker := range []string{"password", "secret", "token", "api_key", "webhook"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAuditValue hides a value while keeping changes detectable
+func redactAuditValue(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return v
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "[redacted:" + hex.EncodeToString(sum[:4]) + "]"
+}
+
+// auditDiff returns {"field": {"before": x, "after": y}} for every changed field.
+// Creations and deletions have no diff; their snapshot is stored on its own.
+func auditDiff(before, after map[string]interface{}) map[string]interface{} {
+	if before == nil || after == nil {
+		return nil
+	}
+	diff := make(map[string]interface{})
+	for k, b := range before {
+		if a := after[k]; !reflect.DeepEqual(a, b) {
+			diff[k] = map[string]interface{}{"before": b, "after": a}
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			diff[k] = map[string]interface{}{"before": nil, "after": a}
+		}
+	}
+	return diff
+}
+
+// Audit log database functions
+
+func InsertAuditEntry(db *sql.DB, e *AuditEntry) error {
+	_, err := db.Exec(
+		`INSERT INTO audit_log (id, actor_id, actor_email, action, target_type, target_id, before_state, after_state, diff, ip_address, user_agent, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.ActorID, e.ActorEmail, e.Action, e.TargetType, e.TargetID,
+		nullableJSON(e.Before), nullableJSON(e.After), nullableJSON(e.Diff),
+		e.IPAddress, e.UserAgent, e.CreatedAt,
+	)
+	return err
+}
+
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+func (f AuditFilter) where() (string, []interface{}) {
+	clauses := []string{"1=1"}
+	var args []interface{}
+	if f.ActorID != "" {
+		clauses = append(clauses, "(actor_id = ? OR actor_email = ?)")
+		args = append(args, f.ActorID, f.ActorID)
+	}
+	if f.Action != "" {
+		if strings.HasSuffix(f.Action, "*") {
+			clauses = append(clauses, "action LIKE ?")
+			args = append(args, strings.TrimSuffix(f.Action, "*")+"%")
+		} else {
+			clauses = append(clauses, "action = ?")
+			args = append(args, f.Action)
+		}
+	}
+	if f.TargetType != "" {
+		clauses = append(clauses, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		clauses = append(clauses, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.From != nil {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		clauses = append(clauses, "created_at <= ?")
+		args = append(args, *f.To)
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// QueryAuditLog returns matching entries newest first. A limit of 0 returns all rows.
+func QueryAuditLog(db *sql.DB, f AuditFilter, limit, offset int) ([]AuditEntry, int, error) {
+	where, args := f.where()
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, actor_id, actor_email, action, target_type, target_id, before_state, after_state, diff, ip_address, user_agent, created_at
+		FROM audit_log` + where + " ORDER BY created_at DESC"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, total, rows.Err()
+}
+
+func scanAuditEntry(rows *sql.Rows) (*AuditEntry, error) {
+	var e AuditEntry
+	var before, after, diff sql.NullString
+	err := rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Action, &e.TargetType, &e.TargetID,
+		&before, &after, &diff, &e.IPAddress, &e.UserAgent, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if before.Valid {
+		e.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		e.After = json.RawMessage(after.String)
+	}
+	if diff.Valid {
+		e.Diff = json.RawMessage(diff.String)
+	}
+	return &e, nil
+}
+
+// Audit log handlers
+
+func parseAuditFilter(r *http.Request) (AuditFilter, error) {
+	q := r.URL.Query()
+	f := AuditFilter{
+		ActorID:    q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, err
+		}
+		f.From = &t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, err
+		}
+		f.To = &t
+	}
+	return f, nil
+}
+
+func getAuditLog(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid from/to timestamp (expected RFC3339)", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	entries, total, err := QueryAuditLog(db, filter, limit, offset)
+	if err != nil {
+		log.Printf("Error fetching audit log: %v", err)
+		http.Error(w, "Failed to fetch audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// exportAuditLog streams matching entries as JSON Lines for SIEM ingestion
+func exportAuditLog(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid from/to timestamp (expected RFC3339)", http.StatusBadRequest)
+		return
+	}
+
+	where, args := filter.where()
+	rows, err := db.Query(`SELECT id, actor_id, actor_email, action, target_type, target_id, before_state, after_state, diff, ip_address, user_agent, created_at
+		FROM audit_log`+where+" ORDER BY created_at ASC", args...)
+	if err != nil {
+		log.Printf("Error exporting audit log: %v", err)
+		http.Error(w, "Failed to export audit log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"pulse-audit-"+time.Now().Format("20060102-150405")+".jsonl\"")
+
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			log.Printf("Error scanning audit entry during export: %v", err)
+			return
+		}
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"strings"
@@ -53,6 +54,23 @@ func generateToken(user *User) (string, error) {
 	return token.SignedString(getJWTSecret())
 }
 
+// claimsFromRequest parses the bearer token on r and returns its claims
+func claimsFromRequest(r *http.Request) (*Claims, error) {
+	tokenString := strings.Replace(r.Header.Get("Authorization"), "Bearer ", "", 1)
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return getJWTSecret(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
 func handleLogin(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -143,12 +161,16 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		path := r.URL.Path
 		if strings.HasPrefix(path, "/api/auth/login") ||
 			strings.HasPrefix(path, "/api/auth/mfa/verify") ||
+			strings.HasPrefix(path, "/api/auth/password/forgot") ||
+			strings.HasPrefix(path, "/api/auth/password/reset") ||
 			strings.Contains(path, "/store/") || // Allow error ingestion endpoints
 			strings.HasSuffix(path, "/store") ||
 			strings.Contains(path, "/envelope") || // Allow envelope endpoints
 			strings.Contains(path, "/coverage") || // Allow coverage endpoints (API key auth)
 			strings.HasPrefix(path, "/status/") || // Allow public status pages (frontend route)
 			strings.HasPrefix(path, "/api/status/") || // Allow public status page API endpoint
+			strings.HasPrefix(path, "/api/heartbeat/") || // Allow heartbeat pings (token in the URL)
+			strings.HasPrefix(path, "/api/0/") || // Allow sentry-cli release commands (project auth token)
 			(strings.HasPrefix(path, "/api/") && strings.HasSuffix(path, "/")) { // Allow project discovery endpoint
 			next.ServeHTTP(w, r)
 			return
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Project auth tokens authenticate the sentry-cli release API (/api/0/). The project
+// API key is part of the public DSN, so it only authenticates event ingestion. Tokens
+// are shown once when created; only their SHA-256 is stored.
+
+const authTokenPrefix = "pulse_at_"
+
+// ProjectAuthToken is a token as listed; the secret itself is never returned again
+type ProjectAuthToken struct {
+	ID         string     `json:"id"`
+	ProjectID  string     `json:"project_id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"` // last characters, to tell tokens apart
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func generateAuthToken() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return authTokenPrefix + hex.EncodeToString(buf)
+}
+
+// hashAuthToken returns the value stored in the database for a token
+func hashAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateProjectAuthToken stores a new token and returns it with its secret
+func CreateProjectAuthToken(db *sql.DB, projectID, name string) (*ProjectAuthToken, string, error) {
+	secret := generateAuthToken()
+	t := &ProjectAuthToken{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Name:      name,
+		Hint:      secret[len(secret)-4:],
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := db.Exec("INSERT INTO project_auth_tokens (id, project_id, name, token_hash, hint, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		t.ID, t.ProjectID, t.Name, hashAuthToken(secret), t.Hint, t.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, secret, nil
+}
+
+func GetProjectAuthTokens(db *sql.DB, projectID string) ([]ProjectAuthToken, error) {
+	rows, err := db.Query("SELECT id, project_id, name, hint, created_at, last_used_at FROM project_auth_tokens WHERE project_id = ? ORDER BY created_at DESC", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []ProjectAuthToken{}
+	for rows.Next() {
+		var t ProjectAuthToken
+		if err := rows.Scan(&t.ID, &t.ProjectID, &t.Name, &t.Hint, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func DeleteProjectAuthToken(db *sql.DB, projectID, id string) error {
+	res, err := db.Exec("DELETE FROM project_auth_tokens WHERE project_id = ? AND id = ?", projectID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetProjectByAuthToken returns the project a token belongs to and records its use
+func GetProjectByAuthToken(db *sql.DB, token string) (*Project, error) {
+	if !strings.HasPrefix(token, authTokenPrefix) {
+		return nil, sql.ErrNoRows
+	}
+	var id, projectID string
+	err := db.QueryRow("SELECT id, project_id FROM project_auth_tokens WHERE token_hash = ?", hashAuthToken(token)).Scan(&id, &projectID)
+	if err != nil {
+		return nil, err
+	}
+	db.Exec("UPDATE project_auth_tokens SET last_used_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return GetProject(db, projectID)
+}
+
+// HTTP Handlers
+
+func getProjectAuthTokens(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	tokens, err := GetProjectAuthTokens(db, vars["id"])
+	if err != nil {
+		log.Printf("Error fetching auth tokens: %v", err)
+		http.Error(w, "Failed to fetch auth tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// createProjectAuthToken answers with the token's secret, which can't be retrieved later
+func createProjectAuthToken(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	if _, err := GetProject(db, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = "sentry-cli"
+	}
+	if len(req.Name) > 100 {
+		http.Error(w, "name must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	t, secret, err := CreateProjectAuthToken(db, projectID, req.Name)
+	if err != nil {
+		log.Printf("Error creating auth token: %v", err)
+		http.Error(w, "Failed to create auth token", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "project.create_auth_token", "project", projectID, nil, t)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*ProjectAuthToken
+		Token string `json:"token"`
+	}{t, secret})
+}
+
+func deleteProjectAuthToken(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	id := vars["tokenId"]
+
+	if err := DeleteProjectAuthToken(db, projectID, id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Auth token not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete auth token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(db, r, "project.delete_auth_token", "project", projectID, map[string]string{"id": id}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
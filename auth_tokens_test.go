@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func sentryAPIRequest(t *testing.T, db *sql.DB, handler func(http.ResponseWriter, *http.Request, *sql.DB),
+	method, token, body string, vars map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/0/organizations/acme/releases/", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, mux.SetURLVars(req, vars), db)
+	return rec
+}
+
+func TestSentryAPIRequiresAuthToken(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	org := map[string]string{"org": "acme"}
+
+	// The DSN key doesn't authorize release writes
+	rec := sentryAPIRequest(t, db, sentryCreateRelease, http.MethodPost, project.APIKey, `{"version":"2.4.0"}`, org)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "auth token") {
+		t.Fatalf("create with DSN key: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := GetRelease(db, project.ID, "2.4.0"); err != sql.ErrNoRows {
+		t.Fatalf("release created with the DSN key: %v", err)
+	}
+	if rec := sentryAPIRequest(t, db, sentryListReleases, http.MethodGet, "", "", org); rec.Code != http.StatusUnauthorized {
+		t.Errorf("list without token: %d", rec.Code)
+	}
+	if rec := sentryAPIRequest(t, db, sentryListReleases, http.MethodGet, authTokenPrefix+"0000", "", org); rec.Code != http.StatusUnauthorized {
+		t.Errorf("list with unknown token: %d", rec.Code)
+	}
+
+	// Create a token the way the UI does
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"ci"}`)), map[string]string{"id": project.ID})
+	rec = httptest.NewRecorder()
+	createProjectAuthToken(rec, req, db)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create token: %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+		Hint  string `json:"hint"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Token, authTokenPrefix) || !strings.HasSuffix(created.Token, created.Hint) {
+		t.Fatalf("created token = %+v", created)
+	}
+
+	var stored string
+	db.QueryRow("SELECT token_hash FROM project_auth_tokens WHERE id = ?", created.ID).Scan(&stored)
+	if stored != hashAuthToken(created.Token) {
+		t.Errorf("stored %q, want the token's hash", stored)
+	}
+
+	version := map[string]string{"org": "acme", "version": "2.4.0"}
+	if rec := sentryAPIRequest(t, db, sentryCreateRelease, http.MethodPost, created.Token, `{"version":"2.4.0"}`, org); rec.Code != http.StatusCreated {
+		t.Fatalf("create with token: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := sentryAPIRequest(t, db, sentryUpdateRelease, http.MethodPut, created.Token, `{"dateReleased":"2026-10-19T10:00:00Z"}`, version); rec.Code != http.StatusOK {
+		t.Errorf("finalize with token: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := sentryAPIRequest(t, db, sentryCreateDeploy, http.MethodPost, created.Token, `{"environment":"production"}`, version); rec.Code != http.StatusCreated {
+		t.Errorf("deploy with token: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := sentryAPIRequest(t, db, sentryDeleteRelease, http.MethodDelete, project.APIKey, "", version); rec.Code != http.StatusUnauthorized {
+		t.Errorf("delete with DSN key: %d", rec.Code)
+	}
+
+	// Listing shows when it was used but never the secret
+	tokens, err := GetProjectAuthTokens(db, project.ID)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Fatalf("tokens = %+v, %v", tokens, err)
+	}
+	listed, _ := json.Marshal(tokens)
+	if strings.Contains(string(listed), created.Token) {
+		t.Errorf("token list exposes the secret: %s", listed)
+	}
+
+	// Revoked tokens stop working
+	if err := DeleteProjectAuthToken(db, project.ID, created.ID); err != nil {
+		t.Fatalf("DeleteProjectAuthToken: %v", err)
+	}
+	if rec := sentryAPIRequest(t, db, sentryDeleteRelease, http.MethodDelete, created.Token, "", version); rec.Code != http.StatusUnauthorized {
+		t.Errorf("delete with revoked token: %d", rec.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	valid := []struct {
+		expr string
+		want cronSchedule
+	}{
+		{"* * * * *", cronSchedule{minute: 1<<60 - 1, hour: cronEveryHour, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1<<7 - 1}},
+		{"5-10/2 0,12 1 jan,JUL mon-fri", cronSchedule{minute: 1<<5 | 1<<7 | 1<<9, hour: 1 | 1<<12, dom: 1 << 1, month: 1<<1 | 1<<7,
+			dow: 0b111110, domRestricted: true, dowRestricted: true}},
+		{"*/20 * * * 7", cronSchedule{minute: 1 | 1<<20 | 1<<40, hour: cronEveryHour, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1, dowRestricted: true}},
+		{"0 0 * * 5-7", cronSchedule{minute: 1, hour: 1, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1 | 1<<5 | 1<<6, dowRestricted: true}},
+		{"@daily", cronSchedule{minute: 1, hour: 1, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1<<7 - 1}},
+		{" @Weekly ", cronSchedule{minute: 1, hour: 1, dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1, dowRestricted: true}},
+	}
+	for _, tt := range valid {
+		got, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseCron(%q) = %+v, want %+v", tt.expr, *got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "1-2-3 * * * *", "@often"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) accepted", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	utc := func(s string) time.Time {
+		v, _ := time.Parse("2006-01-02 15:04", s)
+		return v
+	}
+	local := func(s string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", s, ny)
+		return v
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time // successive runs
+	}{
+		{"steps within a range", "5-10/2 * * * *", utc("2026-10-19 10:06"),
+			[]time.Time{utc("2026-10-19 10:07"), utc("2026-10-19 10:09"), utc("2026-10-19 11:05")}},
+		{"weekdays only", "*/15 9-17 * * mon-fri", utc("2026-10-16 17:50"),
+			[]time.Time{utc("2026-10-19 09:00"), utc("2026-10-19 09:15")}},
+		{"7 is Sunday", "0 12 * * 7", utc("2026-10-19 00:00"),
+			[]time.Time{utc("2026-10-25 12:00"), utc("2026-11-01 12:00")}},
+		{"month names", "0 6 1 jan,JUL *", utc("2026-10-19 00:00"),
+			[]time.Time{utc("2027-01-01 06:00"), utc("2027-07-01 06:00")}},
+		{"day of month or day of week", "0 0 13 * fri", utc("2026-10-19 00:00"),
+			[]time.Time{utc("2026-10-23 00:00"), utc("2026-10-30 00:00"), utc("2026-11-06 00:00"), utc("2026-11-13 00:00")}},
+		{"day of month alone", "0 0 13 * *", utc("2026-10-19 00:00"),
+			[]time.Time{utc("2026-11-13 00:00")}},
+		{"31st skips short months", "0 0 31 * *", utc("2026-10-31 00:00"),
+			[]time.Time{utc("2026-12-31 00:00"), utc("2027-01-31 00:00"), utc("2027-03-31 00:00")}},
+		{"never runs", "0 0 31 2 *", utc("2026-10-19 00:00"),
+			[]time.Time{{}}},
+		// 2026-03-08 02:00 EST jumps to 03:00 EDT: a time in the gap doesn't happen that day
+		{"spring forward skips the gap", "30 2 * * *", local("2026-03-07 12:00"),
+			[]time.Time{local("2026-03-09 02:30")}},
+		{"spring forward hourly", "0 * * * *", local("2026-03-08 00:30"),
+			[]time.Time{local("2026-03-08 01:00"), local("2026-03-08 03:00"), local("2026-03-08 04:00")}},
+		// 2026-11-01 02:00 EDT goes back to 01:00 EST: 01:30 happens twice
+		{"fall back runs a fixed time once", "30 1 * * *", local("2026-11-01 00:00"),
+			[]time.Time{utc("2026-11-01 05:30"), utc("2026-11-02 06:30")}},
+		{"fall back hourly runs every hour", "0 * * * *", local("2026-11-01 00:30"),
+			[]time.Time{utc("2026-11-01 05:00"), utc("2026-11-01 06:00"), utc("2026-11-01 07:00")}},
+		{"fall back every minute", "* * * * *", local("2026-11-01 01:59"),
+			[]time.Time{utc("2026-11-01 06:00"), utc("2026-11-01 06:01")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron: %v", err)
+			}
+			at := tt.from
+			for i, want := range tt.want {
+				got := s.next(at)
+				if !got.Equal(want) {
+					t.Fatalf("run %d after %s = %s, want %s", i+1, at, got, want)
+				}
+				if !got.IsZero() && got.Location() != at.Location() {
+					t.Errorf("run %d in %s, want %s", i+1, got.Location(), at.Location())
+				}
+				at = got
+			}
+		})
+	}
+}
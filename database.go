@@ -88,6 +88,51 @@ type Monitor struct {
 	Status        string     `json:"status"`
 	LastCheckedAt *time.Time `json:"last_checked_at"`
 	CreatedAt     time.Time  `json:"created_at"`
+
+	// Alerting: notify after FailureThreshold consecutive failed checks, and remind
+	// every RealertMinutes while still down (0 disables reminders)
+	FailureThreshold    int        `json:"failure_threshold"`
+	RealertMinutes      int        `json:"realert_minutes"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DownSince           *time.Time `json:"down_since,omitempty"`
+
+	// ICMP: echo requests sent per check, and the packet loss percentage at
+	// which the host counts as down
+	PingCount           int     `json:"ping_count"`
+	PacketLossThreshold float64 `json:"packet_loss_threshold"`
+
+	// HTTP holds request options and assertions; nil makes a plain GET expecting 2xx
+	HTTP *HTTPMonitorConfig `json:"http,omitempty"`
+
+	// SSLAlertDays are the days before certificate expiry at which SSL monitors alert
+	SSLAlertDays []int `json:"ssl_alert_days"`
+
+	// DNS selects the record type, resolver and expected values of DNS monitors
+	DNS *DNSMonitorConfig `json:"dns,omitempty"`
+
+	// Heartbeat monitors are checked in to at /api/heartbeat/<token> or with Sentry
+	// check-ins for Heartbeat.Slug, and expect the next run by NextCheckInAt
+	Heartbeat      *HeartbeatConfig `json:"heartbeat,omitempty"`
+	HeartbeatToken string           `json:"heartbeat_token,omitempty"`
+	NextCheckInAt  *time.Time       `json:"next_checkin_at,omitempty"`
+
+	// A failed check is retried Retries times, RetryInterval seconds apart, before it
+	// counts as down. Checks slower than DegradedResponseTime ms are degraded (0 disables).
+	Retries              int `json:"retries"`
+	RetryInterval        int `json:"retry_interval"`
+	DegradedResponseTime int `json:"degraded_response_time"`
+
+	// Connection holds the credentials of postgres, mysql and redis monitors
+	Connection *ConnectionMonitorConfig `json:"connection,omitempty"`
+
+	// GRPC selects the service and transport of gRPC health monitors
+	GRPC *GRPCMonitorConfig `json:"grpc,omitempty"`
+
+	// WebSocket holds the handshake headers, message and assertions of WebSocket monitors
+	WebSocket *WebSocketMonitorConfig `json:"websocket,omitempty"`
+
+	// MultiStep holds the steps and secrets of multi-step monitors
+	MultiStep *MultiStepMonitorConfig `json:"multistep,omitempty"`
 }
 
 // Database initialization
@@ -111,7 +156,15 @@ func InitDB() (*sql.DB, error) {
 		_ = os.MkdirAll(dataDir, 0755)
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	// Foreign keys are a per-connection setting, so they're enabled in the DSN to apply
+	// to every connection in the pool; ON DELETE CASCADE relies on them
+	dsn := dbPath
+	if strings.Contains(dsn, "?") {
+		dsn += "&_foreign_keys=on"
+	} else {
+		dsn += "?_foreign_keys=on"
+	}
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -171,6 +224,29 @@ func InitDB() (*sql.DB, error) {
 		status TEXT,
 		last_checked_at DATETIME,
 		created_at DATETIME,
+		failure_threshold INTEGER DEFAULT 2,
+		realert_minutes INTEGER DEFAULT 0,
+		consecutive_failures INTEGER DEFAULT 0,
+		alert_state TEXT DEFAULT 'up',
+		down_since DATETIME,
+		last_alerted_at DATETIME,
+		ping_count INTEGER DEFAULT 3,
+		packet_loss_threshold REAL DEFAULT 100,
+		http_config TEXT DEFAULT '',
+		ssl_alert_days TEXT DEFAULT '30,14,7,1',
+		cert_alert_days INTEGER DEFAULT 0,
+		dns_config TEXT DEFAULT '',
+		heartbeat_config TEXT DEFAULT '',
+		heartbeat_slug TEXT DEFAULT '',
+		heartbeat_token TEXT DEFAULT '',
+		next_checkin_at DATETIME,
+		retries INTEGER DEFAULT 0,
+		retry_interval INTEGER DEFAULT 10,
+		degraded_response_time INTEGER DEFAULT 0,
+		connection_config TEXT DEFAULT '',
+		grpc_config TEXT DEFAULT '',
+		websocket_config TEXT DEFAULT '',
+		multistep_config TEXT DEFAULT '',
 		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
 	);`
 
@@ -238,6 +314,20 @@ func InitDB() (*sql.DB, error) {
 		status_code INTEGER,
 		error_message TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		packets_sent INTEGER DEFAULT 0,
+		packets_received INTEGER DEFAULT 0,
+		packet_loss REAL DEFAULT 0,
+		rtt_min REAL DEFAULT 0,
+		rtt_avg REAL DEFAULT 0,
+		rtt_max REAL DEFAULT 0,
+		dns_ms REAL DEFAULT 0,
+		connect_ms REAL DEFAULT 0,
+		tls_ms REAL DEFAULT 0,
+		ttfb_ms REAL DEFAULT 0,
+		certificate TEXT DEFAULT '',
+		dns_result TEXT DEFAULT '',
+		attempts INTEGER DEFAULT 1,
+		steps TEXT DEFAULT '',
 		FOREIGN KEY(monitor_id) REFERENCES monitors(id) ON DELETE CASCADE
 	);`
 
@@ -258,6 +348,382 @@ func InitDB() (*sql.DB, error) {
 		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
 	);`
 
+	passwordResetTokensTable := `
+	CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	projectAuthTokensTable := `
+	CREATE TABLE IF NOT EXISTS project_auth_tokens (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		hint TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	auditLogTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id TEXT PRIMARY KEY,
+		actor_id TEXT NOT NULL,
+		actor_email TEXT DEFAULT '',
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id TEXT DEFAULT '',
+		before_state TEXT,
+		after_state TEXT,
+		diff TEXT,
+		ip_address TEXT DEFAULT '',
+		user_agent TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	alertRulesTable := `
+	CREATE TABLE IF NOT EXISTS alert_rules (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		enabled BOOLEAN DEFAULT 1,
+		action_match TEXT DEFAULT 'any',
+		conditions TEXT NOT NULL DEFAULT '[]',
+		filters TEXT NOT NULL DEFAULT '{}',
+		actions TEXT NOT NULL DEFAULT '[]',
+		frequency_minutes INTEGER DEFAULT 30,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	alertRuleStateTable := `
+	CREATE TABLE IF NOT EXISTS alert_rule_state (
+		rule_id TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		last_fired_at DATETIME NOT NULL,
+		PRIMARY KEY(rule_id, fingerprint)
+	);`
+
+	alertHistoryTable := `
+	CREATE TABLE IF NOT EXISTS alert_history (
+		id TEXT PRIMARY KEY,
+		rule_id TEXT NOT NULL,
+		rule_name TEXT DEFAULT '',
+		project_id TEXT NOT NULL,
+		fingerprint TEXT DEFAULT '',
+		event_id TEXT DEFAULT '',
+		triggers TEXT DEFAULT '[]',
+		actions TEXT DEFAULT '[]',
+		status TEXT NOT NULL,
+		error TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	notificationDigestItemsTable := `
+	CREATE TABLE IF NOT EXISTS notification_digest_items (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		channel_key TEXT NOT NULL,
+		action TEXT NOT NULL,
+		fingerprint TEXT DEFAULT '',
+		event_id TEXT DEFAULT '',
+		message TEXT DEFAULT '',
+		level TEXT DEFAULT '',
+		is_new BOOLEAN DEFAULT 0,
+		is_regression BOOLEAN DEFAULT 0,
+		kind TEXT DEFAULT 'issue',
+		attempts INTEGER DEFAULT 0,
+		next_attempt_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	webhookEndpointsTable := `
+	CREATE TABLE IF NOT EXISTS webhook_endpoints (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(project_id, url)
+	);`
+
+	webhookDeliveriesTable := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		endpoint_id TEXT NOT NULL,
+		project_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		headers TEXT DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER DEFAULT 0,
+		max_attempts INTEGER DEFAULT 8,
+		next_attempt_at DATETIME,
+		last_status_code INTEGER DEFAULT 0,
+		last_error TEXT DEFAULT '',
+		response_snippet TEXT DEFAULT '',
+		redelivery_of TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME,
+		FOREIGN KEY(endpoint_id) REFERENCES webhook_endpoints(id) ON DELETE CASCADE
+	);`
+
+	webhookDeliveryAttemptsTable := `
+	CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+		id TEXT PRIMARY KEY,
+		delivery_id TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER DEFAULT 0,
+		error TEXT DEFAULT '',
+		response_snippet TEXT DEFAULT '',
+		duration_ms INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+	);`
+
+	projectIntegrationsTable := `
+	CREATE TABLE IF NOT EXISTS project_integrations (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		name TEXT NOT NULL,
+		enabled BOOLEAN DEFAULT 1,
+		config TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	integrationAlertsTable := `
+	CREATE TABLE IF NOT EXISTS integration_alerts (
+		integration_id TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		dedup_key TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'open',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(integration_id, fingerprint),
+		FOREIGN KEY(integration_id) REFERENCES project_integrations(id) ON DELETE CASCADE
+	);`
+
+	notificationTemplatesTable := `
+	CREATE TABLE IF NOT EXISTS notification_templates (
+		project_id TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		template TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(project_id, channel),
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	monitorCheckInsTable := `
+	CREATE TABLE IF NOT EXISTS monitor_checkins (
+		id TEXT PRIMARY KEY,
+		monitor_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		source TEXT NOT NULL DEFAULT 'ping',
+		check_in_id TEXT DEFAULT '',
+		environment TEXT DEFAULT '',
+		message TEXT DEFAULT '',
+		duration_ms INTEGER DEFAULT 0,
+		expected_at DATETIME,
+		started_at DATETIME,
+		finished_at DATETIME,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(monitor_id) REFERENCES monitors(id) ON DELETE CASCADE
+	);`
+
+	maintenanceWindowsTable := `
+	CREATE TABLE IF NOT EXISTS maintenance_windows (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT DEFAULT '',
+		monitor_ids TEXT DEFAULT '[]',
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME NOT NULL,
+		recurrence TEXT DEFAULT '',
+		timezone TEXT DEFAULT 'UTC',
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	statusPagesTable := `
+	CREATE TABLE IF NOT EXISTS status_pages (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		slug TEXT NOT NULL UNIQUE,
+		title TEXT NOT NULL,
+		description TEXT DEFAULT '',
+		logo_url TEXT DEFAULT '',
+		components TEXT DEFAULT '[]',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	statusPageIncidentsTable := `
+	CREATE TABLE IF NOT EXISTS status_page_incidents (
+		id TEXT PRIMARY KEY,
+		status_page_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		status TEXT NOT NULL,
+		impact TEXT NOT NULL DEFAULT 'minor',
+		component_ids TEXT DEFAULT '[]',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		resolved_at DATETIME,
+		FOREIGN KEY(status_page_id) REFERENCES status_pages(id) ON DELETE CASCADE
+	);`
+
+	statusPageIncidentUpdatesTable := `
+	CREATE TABLE IF NOT EXISTS status_page_incident_updates (
+		id TEXT PRIMARY KEY,
+		incident_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(incident_id) REFERENCES status_page_incidents(id) ON DELETE CASCADE
+	);`
+
+	checkRollupsHourlyTable := `
+	CREATE TABLE IF NOT EXISTS monitor_check_rollups_hourly (
+		monitor_id TEXT NOT NULL,
+		bucket DATETIME NOT NULL,
+		checks INTEGER DEFAULT 0,
+		up INTEGER DEFAULT 0,
+		down INTEGER DEFAULT 0,
+		degraded INTEGER DEFAULT 0,
+		maintenance INTEGER DEFAULT 0,
+		avg_response_time REAL DEFAULT 0,
+		p95_response_time INTEGER DEFAULT 0,
+		PRIMARY KEY(monitor_id, bucket),
+		FOREIGN KEY(monitor_id) REFERENCES monitors(id) ON DELETE CASCADE
+	);`
+
+	checkRollupsDailyTable := `
+	CREATE TABLE IF NOT EXISTS monitor_check_rollups_daily (
+		monitor_id TEXT NOT NULL,
+		bucket DATETIME NOT NULL,
+		checks INTEGER DEFAULT 0,
+		up INTEGER DEFAULT 0,
+		down INTEGER DEFAULT 0,
+		degraded INTEGER DEFAULT 0,
+		maintenance INTEGER DEFAULT 0,
+		avg_response_time REAL DEFAULT 0,
+		p95_response_time INTEGER DEFAULT 0,
+		complete BOOLEAN DEFAULT 0,
+		PRIMARY KEY(monitor_id, bucket),
+		FOREIGN KEY(monitor_id) REFERENCES monitors(id) ON DELETE CASCADE
+	);`
+
+	releasesTable := `
+	CREATE TABLE IF NOT EXISTS releases (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		version TEXT NOT NULL,
+		ref TEXT DEFAULT '',
+		url TEXT DEFAULT '',
+		date_created DATETIME NOT NULL,
+		date_released DATETIME,
+		first_event DATETIME,
+		last_event DATETIME,
+		event_count INTEGER DEFAULT 0,
+		UNIQUE(project_id, version),
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	releaseDeploysTable := `
+	CREATE TABLE IF NOT EXISTS release_deploys (
+		id TEXT PRIMARY KEY,
+		release_id TEXT NOT NULL,
+		environment TEXT NOT NULL,
+		name TEXT DEFAULT '',
+		url TEXT DEFAULT '',
+		date_started DATETIME,
+		date_finished DATETIME NOT NULL,
+		FOREIGN KEY(release_id) REFERENCES releases(id) ON DELETE CASCADE
+	);`
+
+	releaseIssuesTable := `
+	CREATE TABLE IF NOT EXISTS release_issues (
+		release_id TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY(release_id, fingerprint, kind),
+		FOREIGN KEY(release_id) REFERENCES releases(id) ON DELETE CASCADE
+	);`
+
+	releaseSessionsTable := `
+	CREATE TABLE IF NOT EXISTS release_sessions (
+		project_id TEXT NOT NULL,
+		release TEXT NOT NULL,
+		environment TEXT NOT NULL DEFAULT '',
+		bucket DATETIME NOT NULL,
+		sessions INTEGER DEFAULT 0,
+		errored INTEGER DEFAULT 0,
+		crashed INTEGER DEFAULT 0,
+		abnormal INTEGER DEFAULT 0,
+		PRIMARY KEY(project_id, release, environment, bucket),
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	releaseSessionUsersTable := `
+	CREATE TABLE IF NOT EXISTS release_session_users (
+		project_id TEXT NOT NULL,
+		release TEXT NOT NULL,
+		environment TEXT NOT NULL DEFAULT '',
+		bucket DATETIME NOT NULL,
+		user TEXT NOT NULL,
+		crashed BOOLEAN DEFAULT 0,
+		PRIMARY KEY(project_id, release, environment, bucket, user),
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	sessionStatesTable := `
+	CREATE TABLE IF NOT EXISTS session_states (
+		project_id TEXT NOT NULL,
+		sid TEXT NOT NULL,
+		release TEXT NOT NULL,
+		environment TEXT NOT NULL DEFAULT '',
+		bucket DATETIME NOT NULL,
+		user TEXT DEFAULT '',
+		status TEXT DEFAULT 'ok',
+		errored BOOLEAN DEFAULT 0,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY(project_id, sid),
+		FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);`
+
+	incidentsTable := `
+	CREATE TABLE IF NOT EXISTS incidents (
+		id TEXT PRIMARY KEY,
+		monitor_id TEXT NOT NULL,
+		project_id TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'open',
+		root_error TEXT DEFAULT '',
+		root_status_code INTEGER DEFAULT 0,
+		started_at DATETIME NOT NULL,
+		confirmed_at DATETIME NOT NULL,
+		resolved_at DATETIME,
+		duration_seconds INTEGER DEFAULT 0,
+		failed_checks INTEGER DEFAULT 0,
+		acknowledged_at DATETIME,
+		acknowledged_by TEXT DEFAULT '',
+		FOREIGN KEY(monitor_id) REFERENCES monitors(id) ON DELETE CASCADE
+	);`
+
 	_, err = db.Exec(projectsTable)
 	if err != nil {
 		return nil, err
@@ -318,6 +784,145 @@ func InitDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	_, err = db.Exec(passwordResetTokensTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(projectAuthTokensTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(auditLogTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(alertRulesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(alertRuleStateTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(alertHistoryTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(notificationDigestItemsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(webhookEndpointsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(webhookDeliveriesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(webhookDeliveryAttemptsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(projectIntegrationsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(integrationAlertsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(notificationTemplatesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(incidentsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(monitorCheckInsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(maintenanceWindowsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(statusPagesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(statusPageIncidentsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(statusPageIncidentUpdatesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(checkRollupsHourlyTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(checkRollupsDailyTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(releasesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(releaseDeploysTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(releaseIssuesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(releaseSessionsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(releaseSessionUsersTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(sessionStatesTable)
+	if err != nil {
+		return nil, err
+	}
+
+	// The audit log is append-only: reject any attempt to rewrite history
+	db.Exec("CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;")
+	db.Exec("CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;")
+
 	// Migrations
 	db.Exec("ALTER TABLE errors ADD COLUMN status TEXT DEFAULT 'unresolved';")
 	db.Exec("ALTER TABLE projects ADD COLUMN max_events_per_month INTEGER DEFAULT 1000;")
@@ -329,6 +934,47 @@ func InitDB() (*sql.DB, error) {
 	db.Exec("ALTER TABLE monitors ADD COLUMN timeout INTEGER DEFAULT 30;")
 	db.Exec("ALTER TABLE errors ADD COLUMN trace_id TEXT;")
 	db.Exec("ALTER TABLE errors ADD COLUMN fingerprint TEXT;")
+	db.Exec("ALTER TABLE webhook_deliveries ADD COLUMN headers TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN failure_threshold INTEGER DEFAULT 2;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN realert_minutes INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN consecutive_failures INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN alert_state TEXT DEFAULT 'up';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN down_since DATETIME;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN last_alerted_at DATETIME;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN ping_count INTEGER DEFAULT 3;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN packet_loss_threshold REAL DEFAULT 100;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN packets_sent INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN packets_received INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN packet_loss REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN rtt_min REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN rtt_avg REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN rtt_max REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN http_config TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN dns_ms REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN connect_ms REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN tls_ms REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN ttfb_ms REAL DEFAULT 0;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN ssl_alert_days TEXT DEFAULT '30,14,7,1';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN cert_alert_days INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN certificate TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN dns_config TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN dns_result TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN heartbeat_config TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN heartbeat_slug TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN heartbeat_token TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN next_checkin_at DATETIME;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN retries INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN retry_interval INTEGER DEFAULT 10;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN degraded_response_time INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN attempts INTEGER DEFAULT 1;")
+	db.Exec("ALTER TABLE monitors ADD COLUMN connection_config TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN grpc_config TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN websocket_config TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitors ADD COLUMN multistep_config TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE monitor_checks ADD COLUMN steps TEXT DEFAULT '';")
+	db.Exec("ALTER TABLE notification_digest_items ADD COLUMN attempts INTEGER DEFAULT 0;")
+	db.Exec("ALTER TABLE notification_digest_items ADD COLUMN next_attempt_at DATETIME;")
+	db.Exec("ALTER TABLE notification_digest_items ADD COLUMN kind TEXT DEFAULT 'issue';")
 
 	// SQLite Performance Optimizations
 	db.Exec("PRAGMA journal_mode = WAL;")
@@ -336,7 +982,6 @@ func InitDB() (*sql.DB, error) {
 	db.Exec("PRAGMA cache_size = -64000;") // 64MB
 	db.Exec("PRAGMA temp_store = MEMORY;")
 	db.Exec("PRAGMA mmap_size = 268435456;") // 256MB
-	db.Exec("PRAGMA foreign_keys = ON;")
 
 	// Create indexes for performance
 	indexes := []string{
@@ -353,6 +998,33 @@ func InitDB() (*sql.DB, error) {
 		"CREATE INDEX IF NOT EXISTS idx_spans_start_timestamp ON spans(start_timestamp DESC);",
 		"CREATE INDEX IF NOT EXISTS idx_monitor_checks_monitor_created ON monitor_checks(monitor_id, created_at DESC);",
 		"CREATE INDEX IF NOT EXISTS idx_coverage_history_project_created ON coverage_history(project_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_alert_rules_project ON alert_rules(project_id);",
+		"CREATE INDEX IF NOT EXISTS idx_alert_history_project_created ON alert_history(project_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_digest_items_project_created ON notification_digest_items(project_id, created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_project_created ON webhook_deliveries(project_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id, attempt);",
+		"CREATE INDEX IF NOT EXISTS idx_project_integrations_project ON project_integrations(project_id);",
+		"CREATE INDEX IF NOT EXISTS idx_incidents_project_started ON incidents(project_id, started_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_incidents_monitor_started ON incidents(monitor_id, started_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_monitors_heartbeat_token ON monitors(heartbeat_token);",
+		"CREATE INDEX IF NOT EXISTS idx_monitors_heartbeat_slug ON monitors(project_id, heartbeat_slug);",
+		"CREATE INDEX IF NOT EXISTS idx_monitor_checkins_monitor_created ON monitor_checkins(monitor_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_maintenance_windows_project ON maintenance_windows(project_id);",
+		"CREATE INDEX IF NOT EXISTS idx_status_pages_project ON status_pages(project_id);",
+		"CREATE INDEX IF NOT EXISTS idx_status_page_incidents_page ON status_page_incidents(status_page_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_status_page_incident_updates_incident ON status_page_incident_updates(incident_id, created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_monitor_checks_created ON monitor_checks(created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_monitor_check_rollups_hourly_bucket ON monitor_check_rollups_hourly(bucket);",
+		"CREATE INDEX IF NOT EXISTS idx_monitor_check_rollups_daily_bucket ON monitor_check_rollups_daily(bucket, complete);",
+		"CREATE INDEX IF NOT EXISTS idx_errors_project_release ON errors(project_id, release, fingerprint);",
+		"CREATE INDEX IF NOT EXISTS idx_release_deploys_release ON release_deploys(release_id, date_finished DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_release_sessions_project_bucket ON release_sessions(project_id, bucket);",
+		"CREATE INDEX IF NOT EXISTS idx_release_session_users_bucket ON release_session_users(bucket);",
+		"CREATE INDEX IF NOT EXISTS idx_session_states_updated ON session_states(updated_at);",
 	}
 
 	for _, indexSQL := range indexes {
@@ -394,6 +1066,10 @@ func seedAdminUser(db *sql.DB) error {
 		return nil
 	}
 
+	if err := GetPasswordPolicy(db).Validate(password); err != nil {
+		return fmt.Errorf("ADMIN_PASSWORD rejected by password policy: %w", err)
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -437,6 +1113,68 @@ func UpdateUserMFA(db *sql.DB, userID string, enabled bool, secret string) error
 	return err
 }
 
+func UpdateUserPassword(db *sql.DB, userID, passwordHash string) error {
+	res, err := db.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func CreatePasswordResetToken(db *sql.DB, userID, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(
+		"INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		uuid.New().String(), userID, tokenHash, expiresAt, time.Now(),
+	)
+	return err
+}
+
+// ConsumePasswordResetToken marks an unused, unexpired token as used, sets its user's
+// password hash and returns the user. Any other outstanding tokens for that user are
+// invalidated as well. It all happens in one transaction, so a failed update leaves the
+// token usable.
+func ConsumePasswordResetToken(db *sql.DB, tokenHash, passwordHash string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec(
+		"UPDATE password_reset_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		now, tokenHash, now,
+	)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	var userID string
+	if err := tx.QueryRow("SELECT user_id FROM password_reset_tokens WHERE token_hash = ?", tokenHash).Scan(&userID); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID); err != nil {
+		return "", err
+	}
+
+	res, err = tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return userID, tx.Commit()
+}
+
 // Project functions
 func GetProjectByAPIKey(db *sql.DB, apiKey string) (*Project, error) {
 	var project Project
@@ -564,9 +1302,22 @@ func GetProjectFileCoverage(db *sql.DB, snapshotID string) ([]FileCoverage, erro
 	return files, nil
 }
 
+// DeleteProject deletes a project with its errors; everything else that belongs to it
+// is removed by ON DELETE CASCADE
 func DeleteProject(db *sql.DB, id string) error {
-	_, err := db.Exec("DELETE FROM projects WHERE id = ?", id)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM errors WHERE project_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM projects WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Error functions
@@ -593,6 +1344,10 @@ func InsertError(db *sql.DB, event *ErrorEvent) error {
 		return err
 	}
 
+	if err := recordReleaseEvent(tx, event); err != nil {
+		return err
+	}
+
 	_, err = tx.Exec("UPDATE projects SET current_month_events = current_month_events + 1 WHERE id = ?", event.ProjectID)
 	if err != nil {
 		return err
@@ -1604,8 +2359,111 @@ func GetErrorWithTraces(db *sql.DB, errorID string) (*ErrorEvent, []TraceSpan, e
 }
 
 // Monitor functions
+const monitorColumns = `id, project_id, name, type, url, interval, timeout, status, last_checked_at, created_at,
+	failure_threshold, realert_minutes, consecutive_failures, down_since, ping_count, packet_loss_threshold, http_config, ssl_alert_days, dns_config,
+	heartbeat_config, heartbeat_token, next_checkin_at, retries, retry_interval, degraded_response_time, connection_config,
+	grpc_config, websocket_config, multistep_config`
+
+// scanMonitor reads a row selected with monitorColumns
+func scanMonitor(row interface{ Scan(...interface{}) error }) (*Monitor, error) {
+	var m Monitor
+	var lastChecked, downSince, nextCheckIn sql.NullTime
+	var timeout, threshold, realert, failures, pingCount, retries, retryInterval, degradedTime sql.NullInt64
+	var lossThreshold sql.NullFloat64
+	var httpConfig, sslAlertDays, dnsConfig, heartbeatConfig, heartbeatToken, connectionConfig, grpcConfig, websocketConfig, multistepConfig sql.NullString
+	err := row.Scan(&m.ID, &m.ProjectID, &m.Name, &m.Type, &m.URL, &m.Interval, &timeout, &m.Status, &lastChecked, &m.CreatedAt,
+		&threshold, &realert, &failures, &downSince, &pingCount, &lossThreshold, &httpConfig, &sslAlertDays, &dnsConfig,
+		&heartbeatConfig, &heartbeatToken, &nextCheckIn, &retries, &retryInterval, &degradedTime, &connectionConfig,
+		&grpcConfig, &websocketConfig, &multistepConfig)
+	if err != nil {
+		return nil, err
+	}
+	if lastChecked.Valid {
+		m.LastCheckedAt = &lastChecked.Time
+	}
+	if timeout.Valid {
+		m.Timeout = int(timeout.Int64)
+	} else {
+		m.Timeout = 30
+	}
+	m.FailureThreshold = 2
+	if threshold.Valid && threshold.Int64 > 0 {
+		m.FailureThreshold = int(threshold.Int64)
+	}
+	m.RealertMinutes = int(realert.Int64)
+	m.ConsecutiveFailures = int(failures.Int64)
+	if downSince.Valid {
+		m.DownSince = &downSince.Time
+	}
+	m.PingCount = defaultPingCount
+	if pingCount.Valid && pingCount.Int64 > 0 {
+		m.PingCount = int(pingCount.Int64)
+	}
+	m.PacketLossThreshold = 100
+	if lossThreshold.Valid && lossThreshold.Float64 > 0 {
+		m.PacketLossThreshold = lossThreshold.Float64
+	}
+	if httpConfig.String != "" {
+		json.Unmarshal([]byte(httpConfig.String), &m.HTTP)
+		m.HTTP.open()
+	}
+	m.SSLAlertDays = parseSSLAlertDays(sslAlertDays.String)
+	if dnsConfig.String != "" {
+		json.Unmarshal([]byte(dnsConfig.String), &m.DNS)
+	}
+	if heartbeatConfig.String != "" {
+		json.Unmarshal([]byte(heartbeatConfig.String), &m.Heartbeat)
+	}
+	m.HeartbeatToken = heartbeatToken.String
+	if nextCheckIn.Valid {
+		m.NextCheckInAt = &nextCheckIn.Time
+	}
+	m.Retries = int(retries.Int64)
+	m.RetryInterval = defaultRetryInterval
+	if retryInterval.Valid && retryInterval.Int64 > 0 {
+		m.RetryInterval = int(retryInterval.Int64)
+	}
+	m.DegradedResponseTime = int(degradedTime.Int64)
+	if connectionConfig.String != "" {
+		json.Unmarshal([]byte(connectionConfig.String), &m.Connection)
+		m.Connection.open()
+	}
+	if grpcConfig.String != "" {
+		json.Unmarshal([]byte(grpcConfig.String), &m.GRPC)
+		m.GRPC.open()
+	}
+	if websocketConfig.String != "" {
+		json.Unmarshal([]byte(websocketConfig.String), &m.WebSocket)
+		m.WebSocket.open()
+	}
+	if multistepConfig.String != "" {
+		json.Unmarshal([]byte(multistepConfig.String), &m.MultiStep)
+		m.MultiStep.open()
+	}
+	return &m, nil
+}
+
+// encodeJSONColumn stores a value as JSON, and nil as an empty string
+func encodeJSONColumn[T any](c *T) string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// masked returns a copy safe to send to clients, hiding credentials in monitor options
+func (m Monitor) masked() Monitor {
+	m.HTTP = m.HTTP.masked()
+	m.Connection = m.Connection.masked()
+	m.GRPC = m.GRPC.masked()
+	m.WebSocket = m.WebSocket.masked()
+	m.MultiStep = m.MultiStep.masked()
+	return m
+}
+
 func GetAllActiveMonitors(db *sql.DB) ([]Monitor, error) {
-	rows, err := db.Query("SELECT id, project_id, name, type, url, interval, timeout, status, last_checked_at, created_at FROM monitors WHERE status != 'paused'")
+	rows, err := db.Query("SELECT " + monitorColumns + " FROM monitors WHERE status != 'paused'")
 	if err != nil {
 		return nil, err
 	}
@@ -1613,28 +2471,17 @@ func GetAllActiveMonitors(db *sql.DB) ([]Monitor, error) {
 
 	var monitors []Monitor
 	for rows.Next() {
-		var m Monitor
-		var lastChecked sql.NullTime
-		var timeout sql.NullInt64
-		err := rows.Scan(&m.ID, &m.ProjectID, &m.Name, &m.Type, &m.URL, &m.Interval, &timeout, &m.Status, &lastChecked, &m.CreatedAt)
+		m, err := scanMonitor(rows)
 		if err != nil {
 			return nil, err
 		}
-		if lastChecked.Valid {
-			m.LastCheckedAt = &lastChecked.Time
-		}
-		if timeout.Valid {
-			m.Timeout = int(timeout.Int64)
-		} else {
-			m.Timeout = 30
-		}
-		monitors = append(monitors, m)
+		monitors = append(monitors, *m)
 	}
 	return monitors, nil
 }
 
 func GetProjectMonitors(db *sql.DB, projectID string) ([]Monitor, error) {
-	rows, err := db.Query("SELECT id, project_id, name, type, url, interval, timeout, status, last_checked_at, created_at FROM monitors WHERE project_id = ? ORDER BY created_at DESC", projectID)
+	rows, err := db.Query("SELECT "+monitorColumns+" FROM monitors WHERE project_id = ? ORDER BY created_at DESC", projectID)
 	if err != nil {
 		return nil, err
 	}
@@ -1642,31 +2489,52 @@ func GetProjectMonitors(db *sql.DB, projectID string) ([]Monitor, error) {
 
 	var monitors []Monitor
 	for rows.Next() {
-		var m Monitor
-		var lastChecked sql.NullTime
-		var timeout sql.NullInt64
-		err := rows.Scan(&m.ID, &m.ProjectID, &m.Name, &m.Type, &m.URL, &m.Interval, &timeout, &m.Status, &lastChecked, &m.CreatedAt)
+		m, err := scanMonitor(rows)
 		if err != nil {
 			return nil, err
 		}
-		if lastChecked.Valid {
-			m.LastCheckedAt = &lastChecked.Time
-		}
-		if timeout.Valid {
-			m.Timeout = int(timeout.Int64)
-		} else {
-			m.Timeout = 30
-		}
-		monitors = append(monitors, m)
+		monitors = append(monitors, *m)
 	}
 	return monitors, nil
 }
 
+func GetMonitor(db *sql.DB, id string) (*Monitor, error) {
+	return scanMonitor(db.QueryRow("SELECT "+monitorColumns+" FROM monitors WHERE id = ?", id))
+}
+
 func CreateMonitor(db *sql.DB, monitor *Monitor) error {
-	_, err := db.Exec(`
-		INSERT INTO monitors (id, project_id, name, type, url, interval, timeout, status, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	connection, err := monitor.Connection.sealed()
+	if err != nil {
+		return err
+	}
+	multiStep, err := monitor.MultiStep.sealed()
+	if err != nil {
+		return err
+	}
+	httpConfig, err := monitor.HTTP.sealed()
+	if err != nil {
+		return err
+	}
+	grpcConfig, err := monitor.GRPC.sealed()
+	if err != nil {
+		return err
+	}
+	websocketConfig, err := monitor.WebSocket.sealed()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO monitors (id, project_id, name, type, url, interval, timeout, status, created_at, failure_threshold, realert_minutes,
+			ping_count, packet_loss_threshold, http_config, ssl_alert_days, dns_config, heartbeat_config, heartbeat_slug, heartbeat_token,
+			retries, retry_interval, degraded_response_time, connection_config, grpc_config, websocket_config,
+			multistep_config)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		monitor.ID, monitor.ProjectID, monitor.Name, monitor.Type, monitor.URL, monitor.Interval, monitor.Timeout, monitor.Status, monitor.CreatedAt,
+		monitor.FailureThreshold, monitor.RealertMinutes, monitor.PingCount, monitor.PacketLossThreshold, encodeJSONColumn(httpConfig),
+		formatSSLAlertDays(monitor.SSLAlertDays), encodeJSONColumn(monitor.DNS), encodeJSONColumn(monitor.Heartbeat),
+		heartbeatSlug(monitor.Heartbeat), monitor.HeartbeatToken, monitor.Retries, monitor.RetryInterval, monitor.DegradedResponseTime,
+		encodeJSONColumn(connection), encodeJSONColumn(grpcConfig), encodeJSONColumn(websocketConfig),
+		encodeJSONColumn(multiStep),
 	)
 	return err
 }
@@ -1679,13 +2547,92 @@ type MonitorCheck struct {
 	StatusCode   int       `json:"status_code"`
 	ErrorMessage string    `json:"error_message"`
 	CreatedAt    time.Time `json:"created_at"`
+	// Attempts counts the tries this result took, more than 1 when failures were retried
+	Attempts int `json:"attempts"`
+
+	// Ping holds the probe results of ICMP checks, Timings the phases of HTTP checks,
+	// Certificate what SSL checks were served, DNS the records DNS checks received and
+	// Steps the outcome of each step of multi-step checks
+	Ping        *PingResult      `json:"ping,omitempty"`
+	Timings     *HTTPTimings     `json:"timings,omitempty"`
+	Certificate *CertificateInfo `json:"certificate,omitempty"`
+	DNS         *DNSResult       `json:"dns,omitempty"`
+	Steps       []StepResult     `json:"steps,omitempty"`
+}
+
+// PingResult summarizes the echo requests of one ICMP check. RTTs are in milliseconds.
+type PingResult struct {
+	Sent       int     `json:"packets_sent"`
+	Received   int     `json:"packets_received"`
+	PacketLoss float64 `json:"packet_loss"`
+	RTTMin     float64 `json:"rtt_min_ms"`
+	RTTAvg     float64 `json:"rtt_avg_ms"`
+	RTTMax     float64 `json:"rtt_max_ms"`
+}
+
+const monitorCheckColumns = `id, monitor_id, status, response_time, status_code, error_message, created_at,
+	packets_sent, packets_received, packet_loss, rtt_min, rtt_avg, rtt_max, dns_ms, connect_ms, tls_ms, ttfb_ms, certificate, dns_result, attempts,
+	steps`
+
+// scanMonitorCheck reads a row selected with monitorCheckColumns
+func scanMonitorCheck(row interface{ Scan(...interface{}) error }) (*MonitorCheck, error) {
+	var c MonitorCheck
+	var sent, received, attempts sql.NullInt64
+	var loss, rttMin, rttAvg, rttMax, dns, connect, tlsMs, ttfb sql.NullFloat64
+	var certificate, dnsResult, steps sql.NullString
+	err := row.Scan(&c.ID, &c.MonitorID, &c.Status, &c.ResponseTime, &c.StatusCode, &c.ErrorMessage, &c.CreatedAt,
+		&sent, &received, &loss, &rttMin, &rttAvg, &rttMax, &dns, &connect, &tlsMs, &ttfb, &certificate, &dnsResult, &attempts,
+		&steps)
+	if err != nil {
+		return nil, err
+	}
+	if sent.Int64 > 0 {
+		c.Ping = &PingResult{
+			Sent:       int(sent.Int64),
+			Received:   int(received.Int64),
+			PacketLoss: loss.Float64,
+			RTTMin:     rttMin.Float64,
+			RTTAvg:     rttAvg.Float64,
+			RTTMax:     rttMax.Float64,
+		}
+	}
+	if connect.Float64 > 0 || ttfb.Float64 > 0 {
+		c.Timings = &HTTPTimings{DNS: dns.Float64, Connect: connect.Float64, TLS: tlsMs.Float64, TTFB: ttfb.Float64}
+	}
+	if certificate.String != "" {
+		json.Unmarshal([]byte(certificate.String), &c.Certificate)
+	}
+	if dnsResult.String != "" {
+		json.Unmarshal([]byte(dnsResult.String), &c.DNS)
+	}
+	if steps.String != "" {
+		json.Unmarshal([]byte(steps.String), &c.Steps)
+	}
+	c.Attempts = 1
+	if attempts.Int64 > 1 {
+		c.Attempts = int(attempts.Int64)
+	}
+	return &c, nil
 }
 
 func InsertMonitorCheck(db *sql.DB, check *MonitorCheck) error {
+	var ping PingResult
+	if check.Ping != nil {
+		ping = *check.Ping
+	}
+	var timings HTTPTimings
+	if check.Timings != nil {
+		timings = *check.Timings
+	}
 	_, err := db.Exec(`
-		INSERT INTO monitor_checks (id, monitor_id, status, response_time, status_code, error_message, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		INSERT INTO monitor_checks (id, monitor_id, status, response_time, status_code, error_message, created_at,
+			packets_sent, packets_received, packet_loss, rtt_min, rtt_avg, rtt_max, dns_ms, connect_ms, tls_ms, ttfb_ms, certificate, dns_result, attempts,
+			steps)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		check.ID, check.MonitorID, check.Status, check.ResponseTime, check.StatusCode, check.ErrorMessage, check.CreatedAt,
+		ping.Sent, ping.Received, ping.PacketLoss, ping.RTTMin, ping.RTTAvg, ping.RTTMax,
+		timings.DNS, timings.Connect, timings.TLS, timings.TTFB, encodeJSONColumn(check.Certificate),
+		encodeJSONColumn(check.DNS), max(check.Attempts, 1), encodeStepResults(check.Steps),
 	)
 	if err != nil {
 		return err
@@ -1696,7 +2643,7 @@ func InsertMonitorCheck(db *sql.DB, check *MonitorCheck) error {
 
 func GetMonitorChecks(db *sql.DB, monitorID string, limit int) ([]MonitorCheck, error) {
 	rows, err := db.Query(
-		"SELECT id, monitor_id, status, response_time, status_code, error_message, created_at FROM monitor_checks WHERE monitor_id = ? ORDER BY created_at DESC LIMIT ?",
+		"SELECT "+monitorCheckColumns+" FROM monitor_checks WHERE monitor_id = ? ORDER BY created_at DESC LIMIT ?",
 		monitorID, limit,
 	)
 	if err != nil {
@@ -1706,12 +2653,11 @@ func GetMonitorChecks(db *sql.DB, monitorID string, limit int) ([]MonitorCheck,
 
 	var checks []MonitorCheck
 	for rows.Next() {
-		var c MonitorCheck
-		err := rows.Scan(&c.ID, &c.MonitorID, &c.Status, &c.ResponseTime, &c.StatusCode, &c.ErrorMessage, &c.CreatedAt)
+		c, err := scanMonitorCheck(rows)
 		if err != nil {
 			return nil, err
 		}
-		checks = append(checks, c)
+		checks = append(checks, *c)
 	}
 	return checks, nil
 }
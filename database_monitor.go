@@ -0,0 +1,715 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Postgres, MySQL and Redis monitors connect to the server and speak its protocol far
+// enough to know it serves queries: Postgres logs in and runs SELECT 1, MySQL logs in
+// and pings, and Redis authenticates and answers PING. The handshakes work on any
+// io.ReadWriter, so they run the same against a server or an in-process stub.
+
+var connectionMonitorPorts = map[string]string{
+	"postgres": "5432",
+	"mysql":    "3306",
+	"redis":    "6379",
+}
+
+// maxProtocolMessage caps what a server may send in one message
+const maxProtocolMessage = 1 << 20
+
+// ConnectionMonitorConfig holds the credentials Postgres, MySQL and Redis monitors log
+// in with. The password is stored encrypted.
+type ConnectionMonitorConfig struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Database is the database to connect to, or for Redis the database number
+	Database string `json:"database,omitempty"`
+
+	// openErr is set when the stored password can't be decrypted
+	openErr error
+}
+
+func isConnectionMonitor(monitorType string) bool {
+	_, ok := connectionMonitorPorts[monitorType]
+	return ok
+}
+
+// validate normalises the config for a monitor of the given type
+func (c *ConnectionMonitorConfig) validate(monitorType string) error {
+	c.Username = strings.TrimSpace(c.Username)
+	c.Database = strings.TrimSpace(c.Database)
+	switch monitorType {
+	case "postgres", "mysql":
+		if c.Username == "" {
+			return errors.New("username is required")
+		}
+	case "redis":
+		if c.Database != "" {
+			if n, err := strconv.Atoi(c.Database); err != nil || n < 0 {
+				return errors.New("database must be a Redis database number")
+			}
+		}
+	}
+	return nil
+}
+
+// masked returns a copy safe to send to clients, hiding the password
+func (c *ConnectionMonitorConfig) masked() *ConnectionMonitorConfig {
+	if c == nil {
+		return nil
+	}
+	out := *c
+	out.Password = maskSecret(c.Password)
+	return &out
+}
+
+// keepMaskedSecrets restores a password that a client echoed back masked
+func (c *ConnectionMonitorConfig) keepMaskedSecrets(existing *ConnectionMonitorConfig) {
+	if existing != nil && strings.HasPrefix(c.Password, maskedSecretPrefix) {
+		c.Password = existing.Password
+	}
+}
+
+// sealed returns a copy for storage, with the password encrypted
+func (c *ConnectionMonitorConfig) sealed() (*ConnectionMonitorConfig, error) {
+	if c == nil {
+		return nil, nil
+	}
+	out := *c
+	password, err := sealSecret(c.Password)
+	if err != nil {
+		return nil, err
+	}
+	out.Password = password
+	return &out, nil
+}
+
+// open decrypts the stored password in place
+func (c *ConnectionMonitorConfig) open() {
+	if c == nil {
+		return
+	}
+	password, err := openSecret(c.Password)
+	c.Password, c.openErr = password, err
+}
+
+// connectionAddr returns host:port of a target given as host, host:port or a URL
+func connectionAddr(target, defaultPort string) string {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "://") {
+		if u, err := url.Parse(target); err == nil {
+			target = u.Host
+		}
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(strings.Trim(target, "[]"), defaultPort)
+}
+
+// checkConnection logs in to the monitor's Postgres, MySQL or Redis server
+func checkConnection(m *Monitor, timeout time.Duration) (status string, errMsg string) {
+	cfg := m.Connection
+	if cfg == nil {
+		cfg = &ConnectionMonitorConfig{}
+	}
+	if cfg.openErr != nil {
+		return "down", cfg.openErr.Error()
+	}
+
+	conn, err := net.DialTimeout("tcp", connectionAddr(m.URL, connectionMonitorPorts[m.Type]), timeout)
+	if err != nil {
+		return "down", err.Error()
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	switch m.Type {
+	case "postgres":
+		err = postgresHandshake(conn, cfg)
+	case "mysql":
+		err = mysqlHandshake(conn, cfg)
+	case "redis":
+		err = redisHandshake(conn, cfg)
+	default:
+		err = fmt.Errorf("unsupported monitor type %q", m.Type)
+	}
+	if err != nil {
+		return "down", err.Error()
+	}
+	return "up", ""
+}
+
+// Postgres
+
+// postgresHandshake logs in with the startup message and password, MD5 or SCRAM-SHA-256
+// authentication, runs SELECT 1 and says goodbye
+func postgresHandshake(rw io.ReadWriter, cfg *ConnectionMonitorConfig) error {
+	r := bufio.NewReader(rw)
+
+	var startup bytes.Buffer
+	binary.Write(&startup, binary.BigEndian, int32(196608)) // protocol 3.0
+	params := []string{"user", cfg.Username, "application_name", "pulse"}
+	if cfg.Database != "" {
+		params = append(params, "database", cfg.Database)
+	}
+	for _, p := range params {
+		startup.WriteString(p)
+		startup.WriteByte(0)
+	}
+	startup.WriteByte(0)
+	if err := writePostgresMessage(rw, 0, startup.Bytes()); err != nil {
+		return err
+	}
+
+	var scram *scramClient
+	for ready := false; !ready; {
+		kind, body, err := readPostgresMessage(r)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 'E':
+			return postgresError(body)
+		case 'Z':
+			ready = true
+		case 'R':
+			if len(body) < 4 {
+				return errors.New("postgres: malformed authentication request")
+			}
+			code, data := binary.BigEndian.Uint32(body), body[4:]
+			switch code {
+			case 0: // AuthenticationOk
+			case 3: // cleartext password
+				err = writePostgresMessage(rw, 'p', append([]byte(cfg.Password), 0))
+			case 5: // MD5 password
+				if len(data) < 4 {
+					return errors.New("postgres: malformed MD5 salt")
+				}
+				err = writePostgresMessage(rw, 'p', append([]byte(postgresMD5Password(cfg.Username, cfg.Password, data[:4])), 0))
+			case 10: // SASL
+				if !containsString(splitCStrings(data), "SCRAM-SHA-256") {
+					return errors.New("postgres: server offers no supported SASL mechanism")
+				}
+				scram = newSCRAMClient(cfg.Password)
+				first := scram.clientFirst()
+				var msg bytes.Buffer
+				msg.WriteString("SCRAM-SHA-256")
+				msg.WriteByte(0)
+				binary.Write(&msg, binary.BigEndian, int32(len(first)))
+				msg.WriteString(first)
+				err = writePostgresMessage(rw, 'p', msg.Bytes())
+			case 11: // SASL continue
+				if scram == nil {
+					return errors.New("postgres: unexpected SASL continue")
+				}
+				var final string
+				if final, err = scram.clientFinal(string(data)); err == nil {
+					err = writePostgresMessage(rw, 'p', []byte(final))
+				}
+			case 12: // SASL final
+				if scram == nil {
+					return errors.New("postgres: unexpected SASL final")
+				}
+				err = scram.verifyServerFinal(string(data))
+			default:
+				return fmt.Errorf("postgres: unsupported authentication method %d", code)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writePostgresMessage(rw, 'Q', []byte("SELECT 1\x00")); err != nil {
+		return err
+	}
+	for {
+		kind, body, err := readPostgresMessage(r)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 'E':
+			return postgresError(body)
+		case 'Z':
+			writePostgresMessage(rw, 'X', nil)
+			return nil
+		}
+	}
+}
+
+// writePostgresMessage writes a message of the given kind; kind 0 is the startup
+// message, which has none
+func writePostgresMessage(w io.Writer, kind byte, body []byte) error {
+	var msg []byte
+	if kind != 0 {
+		msg = append(msg, kind)
+	}
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(body)+4))
+	msg = append(msg, body...)
+	_, err := w.Write(msg)
+	return err
+}
+
+func readPostgresMessage(r *bufio.Reader) (kind byte, body []byte, err error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("postgres: %w", err)
+	}
+	size := int(binary.BigEndian.Uint32(header[1:])) - 4
+	if size < 0 || size > maxProtocolMessage {
+		return 0, nil, errors.New("postgres: malformed message from server")
+	}
+	body = make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, fmt.Errorf("postgres: %w", err)
+	}
+	return header[0], body, nil
+}
+
+// postgresError formats an ErrorResponse as its message and SQLSTATE
+func postgresError(body []byte) error {
+	fields := map[byte]string{}
+	for len(body) > 1 {
+		end := bytes.IndexByte(body[1:], 0)
+		if end < 0 {
+			break
+		}
+		fields[body[0]] = string(body[1 : end+1])
+		body = body[end+2:]
+	}
+	if fields['C'] != "" {
+		return fmt.Errorf("postgres: %s (SQLSTATE %s)", fields['M'], fields['C'])
+	}
+	return fmt.Errorf("postgres: %s", fields['M'])
+}
+
+// postgresMD5Password is "md5" followed by md5(md5(password + user) + salt) in hex
+func postgresMD5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+func splitCStrings(data []byte) []string {
+	var out []string
+	for _, s := range bytes.Split(data, []byte{0}) {
+		if len(s) > 0 {
+			out = append(out, string(s))
+		}
+	}
+	return out
+}
+
+// scramClient is the client side of SCRAM-SHA-256 (RFC 7677) without channel binding.
+// Postgres takes the user from the startup message, so the SCRAM user name is empty.
+type scramClient struct {
+	password    string
+	nonce       string
+	firstBare   string
+	authMessage string
+	salted      []byte
+}
+
+func newSCRAMClient(password string) *scramClient {
+	nonce := make([]byte, 18)
+	rand.Read(nonce)
+	return &scramClient{password: password, nonce: base64.StdEncoding.EncodeToString(nonce)}
+}
+
+func (s *scramClient) clientFirst() string {
+	s.firstBare = "n=,r=" + s.nonce
+	return "n,," + s.firstBare
+}
+
+func (s *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	iterations, _ := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 || !strings.HasPrefix(attrs["r"], s.nonce) {
+		return "", errors.New("postgres: malformed SCRAM challenge")
+	}
+	s.salted, err = pbkdf2.Key(sha256.New, s.password, salt, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+
+	withoutProof := "c=biws,r=" + attrs["r"]
+	s.authMessage = s.firstBare + "," + serverFirst + "," + withoutProof
+	clientKey := hmacSHA256(s.salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	proof := hmacSHA256(storedKey[:], s.authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// verifyServerFinal checks that the server knows the password too
+func (s *scramClient) verifyServerFinal(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if attrs["e"] != "" {
+		return fmt.Errorf("postgres: SCRAM authentication failed: %s", attrs["e"])
+	}
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	expected := hmacSHA256(hmacSHA256(s.salted, "Server Key"), s.authMessage)
+	if err != nil || !hmac.Equal(signature, expected) {
+		return errors.New("postgres: server SCRAM signature doesn't match")
+	}
+	return nil
+}
+
+func scramAttributes(msg string) map[string]string {
+	attrs := map[string]string{}
+	for _, part := range strings.Split(msg, ",") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// MySQL
+
+const (
+	mysqlClientLongPassword     = 0x1
+	mysqlClientConnectWithDB    = 0x8
+	mysqlClientProtocol41       = 0x200
+	mysqlClientTransactions     = 0x2000
+	mysqlClientSecureConnection = 0x8000
+	mysqlClientPluginAuth       = 0x80000
+
+	mysqlCharsetUTF8MB4 = 45
+	mysqlComQuit        = 0x01
+	mysqlComPing        = 0x0e
+)
+
+// mysqlHandshake logs in with mysql_native_password or caching_sha2_password, following
+// auth switches, then pings and quits
+func mysqlHandshake(rw io.ReadWriter, cfg *ConnectionMonitorConfig) error {
+	r := bufio.NewReader(rw)
+
+	seq, pkt, err := readMySQLPacket(r)
+	if err != nil {
+		return err
+	}
+	if len(pkt) > 0 && pkt[0] == 0xff {
+		return mysqlError(pkt)
+	}
+	plugin, scramble, serverCaps, err := parseMySQLHandshake(pkt)
+	if err != nil {
+		return err
+	}
+	if serverCaps&mysqlClientProtocol41 == 0 {
+		return errors.New("mysql: server doesn't support protocol 4.1")
+	}
+	if plugin == "" {
+		plugin = "mysql_native_password"
+	}
+	authResponse, err := mysqlAuthResponse(plugin, cfg.Password, scramble)
+	if err != nil {
+		return err
+	}
+
+	caps := uint32(mysqlClientLongPassword | mysqlClientProtocol41 | mysqlClientTransactions |
+		mysqlClientSecureConnection | mysqlClientPluginAuth)
+	if cfg.Database != "" {
+		caps |= mysqlClientConnectWithDB
+	}
+	var resp []byte
+	resp = binary.LittleEndian.AppendUint32(resp, caps)
+	resp = binary.LittleEndian.AppendUint32(resp, maxProtocolMessage)
+	resp = append(resp, mysqlCharsetUTF8MB4)
+	resp = append(resp, make([]byte, 23)...)
+	resp = append(append(resp, cfg.Username...), 0)
+	resp = append(append(resp, byte(len(authResponse))), authResponse...)
+	if cfg.Database != "" {
+		resp = append(append(resp, cfg.Database...), 0)
+	}
+	resp = append(append(resp, plugin...), 0)
+	seq++
+	if err := writeMySQLPacket(rw, seq, resp); err != nil {
+		return err
+	}
+
+	for authenticated := false; !authenticated; {
+		if seq, pkt, err = readMySQLPacket(r); err != nil {
+			return err
+		}
+		if len(pkt) == 0 {
+			return errors.New("mysql: empty packet from server")
+		}
+		switch pkt[0] {
+		case 0x00:
+			authenticated = true
+		case 0xff:
+			return mysqlError(pkt)
+		case 0xfe: // auth switch
+			name, data, _ := bytes.Cut(pkt[1:], []byte{0})
+			plugin, scramble = string(name), bytes.TrimSuffix(data, []byte{0})
+			if authResponse, err = mysqlAuthResponse(plugin, cfg.Password, scramble); err != nil {
+				return err
+			}
+			seq++
+			err = writeMySQLPacket(rw, seq, authResponse)
+		case 0x01: // more data from caching_sha2_password
+			switch {
+			case len(pkt) == 2 && pkt[1] == 3:
+				// Fast auth succeeded; the OK packet follows
+			case len(pkt) == 2 && pkt[1] == 4:
+				// Full auth: without TLS the password goes encrypted with the server's key
+				seq++
+				err = writeMySQLPacket(rw, seq, []byte{0x02})
+			default:
+				var encrypted []byte
+				if encrypted, err = mysqlEncryptPassword(pkt[1:], cfg.Password, scramble); err == nil {
+					seq++
+					err = writeMySQLPacket(rw, seq, encrypted)
+				}
+			}
+		default:
+			return fmt.Errorf("mysql: unexpected packet 0x%02x during authentication", pkt[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeMySQLPacket(rw, 0, []byte{mysqlComPing}); err != nil {
+		return err
+	}
+	if _, pkt, err = readMySQLPacket(r); err != nil {
+		return err
+	}
+	if len(pkt) > 0 && pkt[0] == 0xff {
+		return mysqlError(pkt)
+	}
+	if len(pkt) == 0 || pkt[0] != 0x00 {
+		return errors.New("mysql: unexpected reply to ping")
+	}
+	writeMySQLPacket(rw, 0, []byte{mysqlComQuit})
+	return nil
+}
+
+func readMySQLPacket(r *bufio.Reader) (seq byte, pkt []byte, err error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("mysql: %w", err)
+	}
+	size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if size > maxProtocolMessage {
+		return 0, nil, errors.New("mysql: packet from server too large")
+	}
+	pkt = make([]byte, size)
+	if _, err := io.ReadFull(r, pkt); err != nil {
+		return 0, nil, fmt.Errorf("mysql: %w", err)
+	}
+	return header[3], pkt, nil
+}
+
+func writeMySQLPacket(w io.Writer, seq byte, payload []byte) error {
+	n := len(payload)
+	_, err := w.Write(append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...))
+	return err
+}
+
+// parseMySQLHandshake reads the auth plugin, scramble and capabilities from a protocol
+// version 10 handshake
+func parseMySQLHandshake(pkt []byte) (plugin string, scramble []byte, caps uint32, err error) {
+	malformed := errors.New("mysql: malformed handshake from server")
+	if len(pkt) == 0 || pkt[0] != 10 {
+		return "", nil, 0, errors.New("mysql: unsupported protocol version")
+	}
+	end := bytes.IndexByte(pkt[1:], 0)
+	if end < 0 {
+		return "", nil, 0, malformed
+	}
+	pos := 1 + end + 1 + 4 // server version, connection id
+	if len(pkt) < pos+8+1+2 {
+		return "", nil, 0, malformed
+	}
+	scramble = append(scramble, pkt[pos:pos+8]...)
+	pos += 9
+	caps = uint32(binary.LittleEndian.Uint16(pkt[pos:]))
+	pos += 2
+	if len(pkt) < pos+1+2+2+1+10 {
+		return "", scramble, caps, nil
+	}
+	pos += 3 // character set, status
+	caps |= uint32(binary.LittleEndian.Uint16(pkt[pos:])) << 16
+	pos += 2
+	authLen := int(pkt[pos])
+	pos += 1 + 10
+	if caps&mysqlClientSecureConnection != 0 {
+		n := min(max(13, authLen-8), len(pkt)-pos)
+		scramble = append(scramble, bytes.TrimSuffix(pkt[pos:pos+n], []byte{0})...)
+		pos += n
+	}
+	if caps&mysqlClientPluginAuth != 0 && pos < len(pkt) {
+		name, _, _ := bytes.Cut(pkt[pos:], []byte{0})
+		plugin = string(name)
+	}
+	return plugin, scramble, caps, nil
+}
+
+// mysqlAuthResponse scrambles the password for the auth plugin
+func mysqlAuthResponse(plugin, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	switch plugin {
+	case "mysql_native_password":
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		h1 := sha1.Sum([]byte(password))
+		h2 := sha1.Sum(h1[:])
+		h3 := sha1.Sum(append(append([]byte{}, scramble...), h2[:]...))
+		for i := range h1 {
+			h1[i] ^= h3[i]
+		}
+		return h1[:], nil
+	case "caching_sha2_password":
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		h1 := sha256.Sum256([]byte(password))
+		h2 := sha256.Sum256(h1[:])
+		h3 := sha256.Sum256(append(h2[:], scramble...))
+		for i := range h1 {
+			h1[i] ^= h3[i]
+		}
+		return h1[:], nil
+	}
+	return nil, fmt.Errorf("mysql: unsupported auth plugin %s", plugin)
+}
+
+// mysqlEncryptPassword encrypts the password, XORed with the scramble, with the server's
+// RSA public key for caching_sha2_password full authentication
+func mysqlEncryptPassword(keyPEM []byte, password string, scramble []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("mysql: malformed public key from server")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: %w", err)
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok || len(scramble) == 0 {
+		return nil, errors.New("mysql: unsupported public key from server")
+	}
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, plain, nil)
+}
+
+// mysqlError formats an ERR packet as its message, code and SQLSTATE
+func mysqlError(pkt []byte) error {
+	if len(pkt) < 3 {
+		return errors.New("mysql: error from server")
+	}
+	code := binary.LittleEndian.Uint16(pkt[1:])
+	msg := pkt[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		return fmt.Errorf("mysql: %s (error %d, SQLSTATE %s)", msg[6:], code, msg[1:6])
+	}
+	return fmt.Errorf("mysql: %s (error %d)", msg, code)
+}
+
+// Redis
+
+// redisHandshake authenticates when a password is set, selects the database and expects
+// PONG in reply to PING
+func redisHandshake(rw io.ReadWriter, cfg *ConnectionMonitorConfig) error {
+	r := bufio.NewReader(rw)
+
+	if cfg.Password != "" {
+		args := []string{"AUTH", cfg.Password}
+		if cfg.Username != "" {
+			args = []string{"AUTH", cfg.Username, cfg.Password}
+		}
+		if _, err := redisCommand(rw, r, args...); err != nil {
+			return err
+		}
+	}
+	if cfg.Database != "" && cfg.Database != "0" {
+		if _, err := redisCommand(rw, r, "SELECT", cfg.Database); err != nil {
+			return err
+		}
+	}
+	reply, err := redisCommand(rw, r, "PING")
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("redis: unexpected reply to PING: %q", reply)
+	}
+	redisCommand(rw, r, "QUIT")
+	return nil
+}
+
+// redisCommand sends a command and reads a simple string or bulk string reply
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (string, error) {
+	var cmd bytes.Buffer
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := w.Write(cmd.Bytes()); err != nil {
+		return "", err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 || n > maxProtocolMessage {
+			return "", fmt.Errorf("redis: unexpected reply %q", line)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", fmt.Errorf("redis: %w", err)
+		}
+		return string(buf[:n]), nil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %q", line)
+}
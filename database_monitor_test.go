@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// protocolStub accepts connections and runs handle on each, recording what the
+// handler reports as received
+type protocolStub struct {
+	addr string
+
+	mu   sync.Mutex
+	seen []string
+}
+
+func newProtocolStub(t *testing.T, handle func(s *protocolStub, conn net.Conn)) *protocolStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &protocolStub{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				handle(s, conn)
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *protocolStub) record(format string, args ...interface{}) {
+	s.mu.Lock()
+	s.seen = append(s.seen, fmt.Sprintf(format, args...))
+	s.mu.Unlock()
+}
+
+// received returns what was recorded, waiting briefly for the handler to finish
+// reading the client's goodbye
+func (s *protocolStub) received(want int) []string {
+	for deadline := time.Now().Add(time.Second); ; {
+		s.mu.Lock()
+		seen := append([]string(nil), s.seen...)
+		s.mu.Unlock()
+		if len(seen) >= want || time.Now().After(deadline) {
+			return seen
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func runConnectionCheck(monitorType, addr string, cfg *ConnectionMonitorConfig) (string, string) {
+	return checkConnection(&Monitor{Type: monitorType, URL: addr, Connection: cfg}, 3*time.Second)
+}
+
+// Postgres
+
+// postgresStub serves one user with the given authentication method: md5 or scram
+func postgresStub(t *testing.T, method, user, password string) *protocolStub {
+	return newProtocolStub(t, func(s *protocolStub, conn net.Conn) {
+		r := bufio.NewReader(conn)
+		var length uint32
+		if binary.Read(r, binary.BigEndian, &length) != nil || length < 8 {
+			return
+		}
+		startup := make([]byte, length-4)
+		if _, err := io.ReadFull(r, startup); err != nil {
+			return
+		}
+		params := splitCStrings(startup[4:])
+		values := map[string]string{}
+		for i := 0; i+1 < len(params); i += 2 {
+			values[params[i]] = params[i+1]
+		}
+		s.record("startup protocol=%d user=%s database=%s application_name=%s",
+			binary.BigEndian.Uint32(startup), values["user"], values["database"], values["application_name"])
+
+		send := func(kind byte, body []byte) { writePostgresMessage(conn, kind, body) }
+		auth := func(code uint32, data []byte) { send('R', append(binary.BigEndian.AppendUint32(nil, code), data...)) }
+		fail := func() {
+			send('E', []byte("SERROR\x00C28P01\x00Mpassword authentication failed for user \""+values["user"]+"\"\x00\x00"))
+		}
+		readPassword := func() []byte {
+			kind, body, err := readPostgresMessage(r)
+			if err != nil || kind != 'p' {
+				return nil
+			}
+			return body
+		}
+
+		switch method {
+		case "md5":
+			salt := []byte{1, 2, 3, 4}
+			auth(5, salt)
+			inner := md5.Sum([]byte(password + user))
+			outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+			got := string(bytes.TrimSuffix(readPassword(), []byte{0}))
+			s.record("md5 response valid=%t", got == "md5"+hex.EncodeToString(outer[:]))
+			if values["user"] != user || got != "md5"+hex.EncodeToString(outer[:]) {
+				fail()
+				return
+			}
+		case "scram":
+			auth(10, []byte("SCRAM-SHA-256\x00\x00"))
+			body := readPassword()
+			mechanism, rest, _ := bytes.Cut(body, []byte{0})
+			if len(rest) < 4 {
+				return
+			}
+			clientFirst := string(rest[4:])
+			clientFirstBare := strings.TrimPrefix(clientFirst, "n,,")
+			s.record("sasl mechanism=%s gs2=%t", mechanism, strings.HasPrefix(clientFirst, "n,,"))
+
+			salt := []byte("pulse-test-salt")
+			nonce := scramAttributes(clientFirstBare)["r"] + "server-nonce"
+			serverFirst := fmt.Sprintf("r=%s,s=%s,i=4096", nonce, base64.StdEncoding.EncodeToString(salt))
+			auth(11, []byte(serverFirst))
+
+			clientFinal := string(readPassword())
+			withoutProof, proofB64, _ := strings.Cut(clientFinal, ",p=")
+			proof, _ := base64.StdEncoding.DecodeString(proofB64)
+			salted, _ := pbkdf2.Key(sha256.New, password, salt, 4096, sha256.Size)
+			clientKey := hmacSHA256(salted, "Client Key")
+			storedKey := sha256.Sum256(clientKey)
+			authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+			signature := hmacSHA256(storedKey[:], authMessage)
+			valid := len(proof) == len(signature) && withoutProof == "c=biws,r="+nonce
+			if valid {
+				for i := range proof {
+					proof[i] ^= signature[i]
+				}
+				recovered := sha256.Sum256(proof)
+				valid = hmac.Equal(recovered[:], storedKey[:])
+			}
+			s.record("scram proof valid=%t", valid)
+			if !valid || values["user"] != user {
+				fail()
+				return
+			}
+			serverSignature := hmacSHA256(hmacSHA256(salted, "Server Key"), authMessage)
+			auth(12, []byte("v="+base64.StdEncoding.EncodeToString(serverSignature)))
+		}
+		auth(0, nil)
+		send('S', []byte("server_version\x0016.2\x00"))
+		send('Z', []byte("I"))
+
+		kind, body, err := readPostgresMessage(r)
+		if err != nil || kind != 'Q' {
+			return
+		}
+		s.record("query %s", bytes.TrimSuffix(body, []byte{0}))
+		send('T', []byte("\x00\x01?column?\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x17\x00\x04\xff\xff\xff\xff\x00\x00"))
+		send('D', []byte("\x00\x01\x00\x00\x00\x011"))
+		send('C', []byte("SELECT 1\x00"))
+		send('Z', []byte("I"))
+		if kind, _, err := readPostgresMessage(r); err == nil {
+			s.record("terminate %c", kind)
+		}
+	})
+}
+
+func TestPostgresMonitorAgainstStub(t *testing.T) {
+	// startup, authentication steps, query and terminate
+	for method, lines := range map[string]int{"md5": 4, "scram": 5} {
+		t.Run(method, func(t *testing.T) {
+			stub := postgresStub(t, method, "pulse", "s3cret")
+			status, errMsg := runConnectionCheck("postgres", stub.addr,
+				&ConnectionMonitorConfig{Username: "pulse", Password: "s3cret", Database: "app"})
+			if status != "up" {
+				t.Fatalf("check = %s %q", status, errMsg)
+			}
+			seen := stub.received(lines)
+			if len(seen) != lines {
+				t.Fatalf("stub received %q", seen)
+			}
+			if seen[0] != "startup protocol=196608 user=pulse database=app application_name=pulse" {
+				t.Errorf("startup = %q", seen[0])
+			}
+			if !strings.HasSuffix(seen[len(seen)-3], "valid=true") {
+				t.Errorf("authentication = %q", seen[1:len(seen)-2])
+			}
+			if seen[len(seen)-2] != "query SELECT 1" || seen[len(seen)-1] != "terminate X" {
+				t.Errorf("after login = %q", seen[len(seen)-2:])
+			}
+
+			status, errMsg = runConnectionCheck("postgres", stub.addr,
+				&ConnectionMonitorConfig{Username: "pulse", Password: "wrong"})
+			if want := `postgres: password authentication failed for user "pulse" (SQLSTATE 28P01)`; status != "down" || errMsg != want {
+				t.Errorf("wrong password: %s %q, want %q", status, errMsg, want)
+			}
+		})
+	}
+}
+
+// MySQL
+
+// mysqlStub serves one user. method is native, switch (caching_sha2_password offered,
+// switched to mysql_native_password), sha2-fast or sha2-full (RSA-encrypted password).
+func mysqlStub(t *testing.T, method, user, password string) *protocolStub {
+	var key *rsa.PrivateKey
+	if method == "sha2-full" {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newProtocolStub(t, func(s *protocolStub, conn net.Conn) {
+		r := bufio.NewReader(conn)
+		scramble := []byte("abcdefghijklmnopqrst")
+		plugin := "mysql_native_password"
+		if method != "native" {
+			plugin = "caching_sha2_password"
+		}
+
+		caps := uint32(mysqlClientLongPassword | mysqlClientConnectWithDB | mysqlClientProtocol41 |
+			mysqlClientTransactions | mysqlClientSecureConnection | mysqlClientPluginAuth)
+		hello := append([]byte{10}, "8.0.36-stub\x00"...)
+		hello = binary.LittleEndian.AppendUint32(hello, 7)
+		hello = append(append(hello, scramble[:8]...), 0)
+		hello = binary.LittleEndian.AppendUint16(hello, uint16(caps))
+		hello = append(hello, mysqlCharsetUTF8MB4, 2, 0)
+		hello = binary.LittleEndian.AppendUint16(hello, uint16(caps>>16))
+		hello = append(hello, byte(len(scramble)+1))
+		hello = append(hello, make([]byte, 10)...)
+		hello = append(append(hello, scramble[8:]...), 0)
+		hello = append(append(hello, plugin...), 0)
+		writeMySQLPacket(conn, 0, hello)
+
+		_, resp, err := readMySQLPacket(r)
+		if err != nil || len(resp) < 32 {
+			return
+		}
+		clientCaps := binary.LittleEndian.Uint32(resp)
+		rest := resp[32:]
+		name, rest, _ := bytes.Cut(rest, []byte{0})
+		authResp := rest[1 : 1+int(rest[0])]
+		rest = rest[1+int(rest[0]):]
+		var database []byte
+		if clientCaps&mysqlClientConnectWithDB != 0 {
+			database, rest, _ = bytes.Cut(rest, []byte{0})
+		}
+		clientPlugin, _, _ := bytes.Cut(rest, []byte{0})
+		s.record("login user=%s database=%s plugin=%s protocol41=%t", name, database, clientPlugin,
+			clientCaps&mysqlClientProtocol41 != 0)
+
+		seq := byte(2)
+		deny := func() {
+			pkt := append([]byte{0xff}, binary.LittleEndian.AppendUint16(nil, 1045)...)
+			writeMySQLPacket(conn, seq, append(pkt, "#28000Access denied for user '"+string(name)+"'"...))
+		}
+		nativeValid := func(resp, scramble []byte) bool {
+			stored := sha1.Sum(func() []byte { h := sha1.Sum([]byte(password)); return h[:] }())
+			h3 := sha1.Sum(append(append([]byte{}, scramble...), stored[:]...))
+			if len(resp) != len(h3) {
+				return false
+			}
+			candidate := make([]byte, len(resp))
+			for i := range resp {
+				candidate[i] = resp[i] ^ h3[i]
+			}
+			got := sha1.Sum(candidate)
+			return got == stored
+		}
+
+		var valid bool
+		switch method {
+		case "native":
+			valid = nativeValid(authResp, scramble)
+		case "switch":
+			newScramble := []byte("ABCDEFGHIJKLMNOPQRST")
+			writeMySQLPacket(conn, seq, append(append([]byte{0xfe}, "mysql_native_password\x00"...), append(newScramble, 0)...))
+			var switched []byte
+			if seq, switched, err = readMySQLPacket(r); err != nil {
+				return
+			}
+			seq++
+			valid = nativeValid(switched, newScramble)
+		case "sha2-fast":
+			h1 := sha256.Sum256([]byte(password))
+			h2 := sha256.Sum256(h1[:])
+			h3 := sha256.Sum256(append(h2[:], scramble...))
+			valid = len(authResp) == 32
+			for i := 0; valid && i < 32; i++ {
+				valid = authResp[i]^h3[i] == h1[i]
+			}
+			if valid {
+				writeMySQLPacket(conn, seq, []byte{0x01, 0x03})
+				seq++
+			}
+		case "sha2-full":
+			writeMySQLPacket(conn, seq, []byte{0x01, 0x04})
+			var req []byte
+			if seq, req, err = readMySQLPacket(r); err != nil || !bytes.Equal(req, []byte{0x02}) {
+				return
+			}
+			der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			writeMySQLPacket(conn, seq+1, append([]byte{0x01}, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...))
+			var encrypted []byte
+			if seq, encrypted, err = readMySQLPacket(r); err != nil {
+				return
+			}
+			seq++
+			plain, err := rsa.DecryptOAEP(sha1.New(), nil, key, encrypted, nil)
+			if err == nil {
+				for i := range plain {
+					plain[i] ^= scramble[i%len(scramble)]
+				}
+				valid = string(plain) == password+"\x00"
+			}
+		}
+		s.record("auth valid=%t", valid)
+		if !valid || string(name) != user {
+			deny()
+			return
+		}
+		writeMySQLPacket(conn, seq, []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+
+		for {
+			seq, cmd, err := readMySQLPacket(r)
+			if err != nil || len(cmd) == 0 {
+				return
+			}
+			s.record("command 0x%02x seq=%d", cmd[0], seq)
+			if cmd[0] == mysqlComQuit {
+				return
+			}
+			writeMySQLPacket(conn, seq+1, []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+		}
+	})
+}
+
+func TestMySQLMonitorAgainstStub(t *testing.T) {
+	for _, method := range []string{"native", "switch", "sha2-fast", "sha2-full"} {
+		t.Run(method, func(t *testing.T) {
+			stub := mysqlStub(t, method, "pulse", "s3cret")
+			status, errMsg := runConnectionCheck("mysql", stub.addr,
+				&ConnectionMonitorConfig{Username: "pulse", Password: "s3cret", Database: "shop"})
+			if status != "up" {
+				t.Fatalf("check = %s %q", status, errMsg)
+			}
+			seen := stub.received(4)
+			plugin := "caching_sha2_password"
+			if method == "native" {
+				plugin = "mysql_native_password"
+			}
+			want := []string{
+				"login user=pulse database=shop plugin=" + plugin + " protocol41=true",
+				"auth valid=true",
+				fmt.Sprintf("command 0x%02x seq=0", mysqlComPing),
+				fmt.Sprintf("command 0x%02x seq=0", mysqlComQuit),
+			}
+			if strings.Join(seen, "\n") != strings.Join(want, "\n") {
+				t.Errorf("stub received:\n%s\nwant:\n%s", strings.Join(seen, "\n"), strings.Join(want, "\n"))
+			}
+
+			status, errMsg = runConnectionCheck("mysql", stub.addr,
+				&ConnectionMonitorConfig{Username: "pulse", Password: "wrong"})
+			if want := "mysql: Access denied for user 'pulse' (error 1045, SQLSTATE 28000)"; status != "down" || errMsg != want {
+				t.Errorf("wrong password: %s %q, want %q", status, errMsg, want)
+			}
+		})
+	}
+}
+
+// Redis
+
+// redisStub requires AUTH with password (and user, when set) before other commands
+func redisStub(t *testing.T, user, password string) *protocolStub {
+	return newProtocolStub(t, func(s *protocolStub, conn net.Conn) {
+		r := bufio.NewReader(conn)
+		authed := password == ""
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || !strings.HasPrefix(line, "*") {
+				return
+			}
+			var n int
+			fmt.Sscanf(line, "*%d", &n)
+			args := make([]string, n)
+			for i := range args {
+				var size int
+				header, _ := r.ReadString('\n')
+				fmt.Sscanf(header, "$%d", &size)
+				buf := make([]byte, size+2)
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return
+				}
+				args[i] = string(buf[:size])
+			}
+			s.record("%s", strings.Join(args, " "))
+
+			switch strings.ToUpper(args[0]) {
+			case "AUTH":
+				gotUser := "default"
+				if len(args) == 3 {
+					gotUser = args[1]
+				}
+				if args[len(args)-1] == password && (user == "" || gotUser == user) {
+					authed = true
+					io.WriteString(conn, "+OK\r\n")
+				} else {
+					io.WriteString(conn, "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+				}
+			case "QUIT":
+				io.WriteString(conn, "+OK\r\n")
+				return
+			default:
+				if !authed {
+					io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+				} else if strings.ToUpper(args[0]) == "PING" {
+					io.WriteString(conn, "+PONG\r\n")
+				} else {
+					io.WriteString(conn, "+OK\r\n")
+				}
+			}
+		}
+	})
+}
+
+func TestRedisMonitorAgainstStub(t *testing.T) {
+	tests := []struct {
+		name       string
+		stubUser   string
+		cfg        ConnectionMonitorConfig
+		wantStatus string
+		wantError  string
+		wantSeen   []string
+	}{
+		{"password and database", "", ConnectionMonitorConfig{Password: "s3cret", Database: "2"},
+			"up", "", []string{"AUTH s3cret", "SELECT 2", "PING", "QUIT"}},
+		{"ACL user", "monitor", ConnectionMonitorConfig{Username: "monitor", Password: "s3cret"},
+			"up", "", []string{"AUTH monitor s3cret", "PING", "QUIT"}},
+		{"wrong password", "", ConnectionMonitorConfig{Password: "wrong"},
+			"down", "redis: WRONGPASS invalid username-password pair or user is disabled.", []string{"AUTH wrong"}},
+		{"missing password", "", ConnectionMonitorConfig{},
+			"down", "redis: NOAUTH Authentication required.", []string{"PING"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := redisStub(t, tt.stubUser, "s3cret")
+			cfg := tt.cfg
+			status, errMsg := runConnectionCheck("redis", stub.addr, &cfg)
+			if status != tt.wantStatus || errMsg != tt.wantError {
+				t.Fatalf("check = %s %q, want %s %q", status, errMsg, tt.wantStatus, tt.wantError)
+			}
+			if seen := stub.received(len(tt.wantSeen)); strings.Join(seen, "|") != strings.Join(tt.wantSeen, "|") {
+				t.Errorf("stub received %q, want %q", seen, tt.wantSeen)
+			}
+		})
+	}
+}
+
+func TestConnectionMonitorUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	status, errMsg := runConnectionCheck("postgres", addr, &ConnectionMonitorConfig{Username: "pulse"})
+	if status != "down" || !strings.Contains(errMsg, "refused") {
+		t.Errorf("check = %s %q", status, errMsg)
+	}
+}
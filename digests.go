@@ -0,0 +1,581 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationDigest summarises everything buffered for one channel over a period
+type NotificationDigest struct {
+	Project         *Project               `json:"project"`
+	Frequency       string                 `json:"frequency"`
+	PeriodStart     time.Time              `json:"period_start"`
+	PeriodEnd       time.Time              `json:"period_end"`
+	NewIssues       []DigestIssue          `json:"new_issues"`
+	Regressions     []DigestIssue          `json:"regressions"`
+	TopIssues       []DigestIssue          `json:"top_issues"`
+	UptimeIncidents []DigestUptimeIncident `json:"uptime_incidents"`
+	Link            string                 `json:"link"`
+}
+
+// DigestIssue is one issue line in a digest
+type DigestIssue struct {
+	Fingerprint string `json:"fingerprint"`
+	EventID     string `json:"event_id"`
+	Message     string `json:"message"`
+	Level       string `json:"level"`
+	Count       int    `json:"count"`
+	Link        string `json:"link"`
+}
+
+// DigestUptimeIncident is a monitor that failed during the digest period
+type DigestUptimeIncident struct {
+	MonitorID    string    `json:"monitor_id"`
+	MonitorName  string    `json:"monitor_name"`
+	FirstFailure time.Time `json:"first_failure"`
+	FailedChecks int       `json:"failed_checks"`
+	Resolved     bool      `json:"resolved"`
+}
+
+// Digest item kinds. Monitor items only make sure the digest is sent; the outage
+// itself is listed from monitor_checks.
+const (
+	digestItemIssue   = "issue"
+	digestItemMonitor = "monitor"
+)
+
+type digestItem struct {
+	ID            string
+	Kind          string
+	ChannelKey    string
+	Action        AlertAction
+	Fingerprint   string
+	EventID       string
+	Message       string
+	Level         string
+	IsNew         bool
+	IsRegression  bool
+	Attempts      int
+	NextAttemptAt *time.Time
+	CreatedAt     time.Time
+}
+
+// A digest that fails to send is retried with backoff until it has failed
+// digestMaxAttempts times or its oldest item is digestMaxAge old, then dropped
+const (
+	digestMaxAttempts = 6
+	digestBaseBackoff = time.Minute
+	digestMaxAge      = 24 * time.Hour
+)
+
+func isDigestFrequency(frequency string) bool {
+	return frequency == "hourly" || frequency == "daily"
+}
+
+// digestPeriodStart returns the start of the digest period containing t
+func digestPeriodStart(frequency string, t time.Time) time.Time {
+	t = t.UTC()
+	if frequency == "daily" {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// bufferDigestItems stores the alert once per channel until the next digest
+func bufferDigestItems(db *sql.DB, actions []AlertAction, n *AlertNotification) error {
+	isNew := containsString(n.Triggers, "new_issue")
+	if !isNew {
+		isNew, _ = AlertCondition{Type: "new_issue"}.matches(db, n.Event)
+	}
+	isRegression := containsString(n.Triggers, "regression")
+	if !isRegression {
+		isRegression, _ = AlertCondition{Type: "regression"}.matches(db, n.Event)
+	}
+
+	return insertDigestItems(db, n.Project.ID, actions, digestItem{
+		Kind:         digestItemIssue,
+		Fingerprint:  n.Event.Fingerprint,
+		EventID:      n.Event.ID,
+		Message:      n.Event.Message,
+		Level:        n.Event.Level,
+		IsNew:        isNew,
+		IsRegression: isRegression,
+	})
+}
+
+// bufferMonitorDigestItems stores a monitor going down or recovering once per channel,
+// so the project's digest goes out even when no error events were buffered
+func bufferMonitorDigestItems(db *sql.DB, actions []AlertAction, a *MonitorAlert) error {
+	level := "error"
+	if a.Kind == "recovered" {
+		level = "info"
+	}
+	return insertDigestItems(db, a.Project.ID, actions, digestItem{
+		Kind:        digestItemMonitor,
+		Fingerprint: "monitor:" + a.Monitor.ID,
+		Message:     fmt.Sprintf("Monitor '%s' %s", a.Monitor.Name, a.Kind),
+		Level:       level,
+	})
+}
+
+func insertDigestItems(db *sql.DB, projectID string, actions []AlertAction, item digestItem) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, action := range actions {
+		actionJSON, _ := json.Marshal(action)
+		_, err := tx.Exec(`
+			INSERT INTO notification_digest_items (id, project_id, kind, channel_key, action, fingerprint, event_id, message, level, is_new, is_regression, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.New().String(), projectID, item.Kind, action.Type+"|"+action.Target, string(actionJSON),
+			item.Fingerprint, item.EventID, item.Message, item.Level, item.IsNew, item.IsRegression, time.Now(),
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// StartDigestWorker sends hourly and daily digests once their period has ended.
+// Pending items live in the database, so a restart only delays a digest.
+func StartDigestWorker(db *sql.DB) {
+	log.Println("Starting notification digest worker...")
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	flushDueDigests(db, time.Now())
+	for now := range ticker.C {
+		flushDueDigests(db, now)
+	}
+}
+
+func flushDueDigests(db *sql.DB, now time.Time) {
+	rows, err := db.Query("SELECT DISTINCT project_id FROM notification_digest_items")
+	if err != nil {
+		log.Printf("[Digest] Failed to list pending digests: %v", err)
+		return
+	}
+	var projectIDs []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			projectIDs = append(projectIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, projectID := range projectIDs {
+		project, err := GetProject(db, projectID)
+		if err == sql.ErrNoRows {
+			// Items of a project deleted before foreign keys applied to every connection
+			db.Exec("DELETE FROM notification_digest_items WHERE project_id = ?", projectID)
+			continue
+		} else if err != nil {
+			continue
+		}
+		settings, err := GetProjectSettings(db, projectID)
+		if err != nil {
+			continue
+		}
+
+		// Anything still pending after switching back to immediate goes out now
+		cutoff := now
+		if isDigestFrequency(settings.NotificationFrequency) {
+			cutoff = digestPeriodStart(settings.NotificationFrequency, now)
+		}
+
+		items, err := getDigestItems(db, projectID, cutoff)
+		if err != nil {
+			log.Printf("[Digest] Failed to load digest items for %s: %v", projectID, err)
+			continue
+		}
+
+		byChannel := make(map[string][]digestItem)
+		var channels []string
+		for _, item := range items {
+			if _, ok := byChannel[item.ChannelKey]; !ok {
+				channels = append(channels, item.ChannelKey)
+			}
+			byChannel[item.ChannelKey] = append(byChannel[item.ChannelKey], item)
+		}
+
+		for _, key := range channels {
+			if digestRetryPending(byChannel[key], now) {
+				continue
+			}
+			sendChannelDigest(db, project, settings.NotificationFrequency, byChannel[key], cutoff, now)
+		}
+	}
+}
+
+// digestRetryPending reports whether a failed digest of these items waits for its next
+// attempt. Items buffered since join the retry.
+func digestRetryPending(items []digestItem, now time.Time) bool {
+	for _, item := range items {
+		if item.NextAttemptAt != nil && item.NextAttemptAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func getDigestItems(db *sql.DB, projectID string, before time.Time) ([]digestItem, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(kind, 'issue'), channel_key, action, fingerprint, event_id, message, level, is_new, is_regression,
+		COALESCE(attempts, 0), next_attempt_at, created_at
+		FROM notification_digest_items WHERE project_id = ? AND created_at < ? ORDER BY created_at ASC`, projectID, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []digestItem
+	for rows.Next() {
+		var item digestItem
+		var action string
+		if err := rows.Scan(&item.ID, &item.Kind, &item.ChannelKey, &action, &item.Fingerprint, &item.EventID,
+			&item.Message, &item.Level, &item.IsNew, &item.IsRegression, &item.Attempts, &item.NextAttemptAt, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(action), &item.Action)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// sendChannelDigest sends the items buffered for one channel. Items are kept for a
+// retry when the send fails, and cleared once it succeeds or retries run out.
+func sendChannelDigest(db *sql.DB, project *Project, frequency string, items []digestItem, periodEnd, now time.Time) {
+	digest := buildDigest(db, project, frequency, items, periodEnd)
+	action := items[0].Action
+
+	ids := make([]interface{}, len(items))
+	attempts := 0
+	for i, item := range items {
+		ids[i] = item.ID
+		if item.Attempts > attempts {
+			attempts = item.Attempts
+		}
+	}
+	attempts++
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	status := "sent"
+	errMsg := ""
+	if err := sendDigestAction(db, action, digest); err != nil {
+		// Items are oldest first
+		if attempts < digestMaxAttempts && now.Sub(items[0].CreatedAt) < digestMaxAge {
+			next := now.Add(digestBackoff(attempts))
+			log.Printf("[Digest] %s digest failed for project %s (attempt %d/%d): %v; retrying at %s",
+				action.Type, project.ID, attempts, digestMaxAttempts, err, next.Format(time.RFC3339))
+			args := append([]interface{}{attempts, next}, ids...)
+			if _, err := db.Exec("UPDATE notification_digest_items SET attempts = ?, next_attempt_at = ? WHERE id IN ("+placeholders+")", args...); err != nil {
+				log.Printf("[Digest] Failed to schedule digest retry for project %s: %v", project.ID, err)
+			}
+			return
+		}
+		log.Printf("[Digest] %s digest failed for project %s, giving up after %d attempts: %v", action.Type, project.ID, attempts, err)
+		status = "failed"
+		errMsg = fmt.Sprintf("%s: %v", action.Type, err)
+	} else {
+		log.Printf("[Digest] Sent %s digest for project '%s' via %s (%d items)", frequency, project.Name, action.Type, len(items))
+	}
+
+	if _, err := db.Exec("DELETE FROM notification_digest_items WHERE id IN ("+placeholders+")", ids...); err != nil {
+		log.Printf("[Digest] Failed to clear digest items for project %s: %v", project.ID, err)
+	}
+
+	entry := &AlertHistoryEntry{
+		ID:        uuid.New().String(),
+		RuleID:    "digest:" + frequency,
+		RuleName:  digestLabel(frequency) + " digest",
+		ProjectID: project.ID,
+		Triggers:  []string{"digest"},
+		Actions:   []AlertAction{action},
+		Status:    status,
+		Error:     errMsg,
+		CreatedAt: time.Now(),
+	}
+	if err := InsertAlertHistory(db, entry); err != nil {
+		log.Printf("[Digest] Failed to record alert history: %v", err)
+	}
+}
+
+// digestBackoff returns the delay before the next attempt after `attempts` failures
+func digestBackoff(attempts int) time.Duration {
+	return digestBaseBackoff << (attempts - 1)
+}
+
+func buildDigest(db *sql.DB, project *Project, frequency string, items []digestItem, periodEnd time.Time) *NotificationDigest {
+	publicURL := getPublicURL(db)
+	periodStart := items[0].CreatedAt
+	if isDigestFrequency(frequency) {
+		periodStart = digestPeriodStart(frequency, periodStart)
+	}
+
+	d := &NotificationDigest{
+		Project:     project,
+		Frequency:   frequency,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Link:        fmt.Sprintf("%s/projects/%s", publicURL, project.ID),
+	}
+
+	seen := make(map[string]*DigestIssue)
+	var issues []*DigestIssue
+	for _, item := range items {
+		if item.Kind != digestItemIssue {
+			continue
+		}
+		issue, ok := seen[item.Fingerprint]
+		if !ok {
+			issue = &DigestIssue{
+				Fingerprint: item.Fingerprint,
+				EventID:     item.EventID,
+				Message:     item.Message,
+				Level:       item.Level,
+				Link:        fmt.Sprintf("%s/errors/%s", publicURL, item.EventID),
+			}
+			db.QueryRow("SELECT COUNT(*) FROM errors WHERE project_id = ? AND fingerprint = ? AND created_at >= ? AND created_at < ?",
+				project.ID, item.Fingerprint, periodStart, periodEnd).Scan(&issue.Count)
+			seen[item.Fingerprint] = issue
+			issues = append(issues, issue)
+
+			if item.IsNew {
+				d.NewIssues = append(d.NewIssues, *issue)
+			}
+		}
+		if item.IsRegression && !containsIssue(d.Regressions, item.Fingerprint) {
+			d.Regressions = append(d.Regressions, *issue)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Count > issues[j].Count })
+	for i := 0; i < len(issues) && i < 5; i++ {
+		d.TopIssues = append(d.TopIssues, *issues[i])
+	}
+
+	d.UptimeIncidents = getDigestUptimeIncidents(db, project.ID, periodStart, periodEnd)
+	return d
+}
+
+func containsIssue(issues []DigestIssue, fingerprint string) bool {
+	for _, issue := range issues {
+		if issue.Fingerprint == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+func getDigestUptimeIncidents(db *sql.DB, projectID string, from, to time.Time) []DigestUptimeIncident {
+	rows, err := db.Query(`
+		SELECT m.id, m.name, m.status, MIN(c.created_at), COUNT(*)
+		FROM monitor_checks c JOIN monitors m ON m.id = c.monitor_id
+		WHERE m.project_id = ? AND c.status = 'down' AND c.created_at >= ? AND c.created_at < ?
+		GROUP BY m.id ORDER BY MIN(c.created_at) ASC`, projectID, from, to)
+	if err != nil {
+		log.Printf("[Digest] Failed to load uptime incidents for %s: %v", projectID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	var incidents []DigestUptimeIncident
+	for rows.Next() {
+		var inc DigestUptimeIncident
+		var status, firstFailure string
+		if err := rows.Scan(&inc.MonitorID, &inc.MonitorName, &status, &firstFailure, &inc.FailedChecks); err != nil {
+			continue
+		}
+		inc.FirstFailure = parseSQLiteTime(firstFailure)
+		inc.Resolved = status != "down"
+		incidents = append(incidents, inc)
+	}
+	return incidents
+}
+
+// parseSQLiteTime parses timestamps returned by aggregate functions, which the
+// driver hands back as text rather than time.Time
+func parseSQLiteTime(s string) time.Time {
+	for _, layout := range []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05",
+		time.RFC3339Nano,
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func digestLabel(frequency string) string {
+	switch frequency {
+	case "hourly":
+		return "Hourly"
+	case "daily":
+		return "Daily"
+	}
+	return "Notification"
+}
+
+func (d *NotificationDigest) title() string {
+	return fmt.Sprintf("%s digest for %s", digestLabel(d.Frequency), d.Project.Name)
+}
+
+func (d *NotificationDigest) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s – %s (UTC)\n", d.title(),
+		d.PeriodStart.UTC().Format("2006-01-02 15:04"), d.PeriodEnd.UTC().Format("2006-01-02 15:04"))
+
+	writeIssues := func(heading string, issues []DigestIssue) {
+		if len(issues) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s (%d)\n", heading, len(issues))
+		for _, issue := range issues {
+			fmt.Fprintf(&b, "  • [%s] %s (%d events) %s\n", issue.Level, issue.Message, issue.Count, issue.Link)
+		}
+	}
+	writeIssues("New issues", d.NewIssues)
+	writeIssues("Regressions", d.Regressions)
+	writeIssues("Top issues", d.TopIssues)
+
+	if len(d.UptimeIncidents) > 0 {
+		fmt.Fprintf(&b, "\nUptime incidents (%d)\n", len(d.UptimeIncidents))
+		for _, inc := range d.UptimeIncidents {
+			state := "ongoing"
+			if inc.Resolved {
+				state = "resolved"
+			}
+			fmt.Fprintf(&b, "  • %s: down since %s, %d failed checks (%s)\n",
+				inc.MonitorName, inc.FirstFailure.UTC().Format("15:04"), inc.FailedChecks, state)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nOpen project: %s\n", d.Link)
+	return b.String()
+}
+
+func (d *NotificationDigest) html() string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;color:#0f172a;background:#f8fafc;padding:24px">`)
+	b.WriteString(`<div style="max-width:640px;margin:0 auto;background:#ffffff;border:1px solid #e2e8f0;border-radius:8px;padding:24px">`)
+	fmt.Fprintf(&b, `<h2 style="margin:0 0 4px;font-size:18px">%s</h2>`, html.EscapeString(d.title()))
+	fmt.Fprintf(&b, `<p style="margin:0 0 16px;font-size:12px;color:#64748b">%s &ndash; %s UTC</p>`,
+		d.PeriodStart.UTC().Format("2006-01-02 15:04"), d.PeriodEnd.UTC().Format("2006-01-02 15:04"))
+
+	writeIssues := func(heading string, issues []DigestIssue) {
+		if len(issues) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, `<h3 style="font-size:14px;margin:16px 0 8px">%s (%d)</h3><ul style="padding-left:18px;font-size:14px">`, heading, len(issues))
+		for _, issue := range issues {
+			fmt.Fprintf(&b, `<li><a href="%s">%s</a> <span style="color:#64748b">%s &middot; %d events</span></li>`,
+				html.EscapeString(issue.Link), html.EscapeString(issue.Message), html.EscapeString(issue.Level), issue.Count)
+		}
+		b.WriteString(`</ul>`)
+	}
+	writeIssues("New issues", d.NewIssues)
+	writeIssues("Regressions", d.Regressions)
+	writeIssues("Top issues", d.TopIssues)
+
+	if len(d.UptimeIncidents) > 0 {
+		fmt.Fprintf(&b, `<h3 style="font-size:14px;margin:16px 0 8px">Uptime incidents (%d)</h3><ul style="padding-left:18px;font-size:14px">`, len(d.UptimeIncidents))
+		for _, inc := range d.UptimeIncidents {
+			state := "ongoing"
+			if inc.Resolved {
+				state = "resolved"
+			}
+			fmt.Fprintf(&b, `<li>%s <span style="color:#64748b">down since %s UTC &middot; %d failed checks &middot; %s</span></li>`,
+				html.EscapeString(inc.MonitorName), inc.FirstFailure.UTC().Format("15:04"), inc.FailedChecks, state)
+		}
+		b.WriteString(`</ul>`)
+	}
+
+	fmt.Fprintf(&b, `<a href="%s" style="display:inline-block;margin-top:16px;background:#6366f1;color:#ffffff;text-decoration:none;padding:8px 16px;border-radius:6px;font-size:14px">Open project</a>`,
+		html.EscapeString(d.Link))
+	b.WriteString(`</div></body></html>`)
+	return b.String()
+}
+
+// sendDigestAction delivers a digest through a single channel
+func sendDigestAction(db *sql.DB, action AlertAction, d *NotificationDigest) error {
+	switch action.Type {
+	case "slack":
+		target := action.Target
+		if target == "" {
+			target, _ = GetSetting(db, "slack_webhook")
+		}
+		if target == "" {
+			return errors.New("no Slack webhook configured")
+		}
+		_, err := enqueueWebhook(db, d.Project.ID, target, "digest", map[string]interface{}{"text": "*Pulse:* " + d.text()})
+		return err
+	case "webhook":
+		target := action.Target
+		if target == "" {
+			if settings, err := GetProjectSettings(db, d.Project.ID); err == nil {
+				target = settings.NotificationWebhookURL
+			}
+		}
+		if target == "" {
+			return errors.New("no webhook URL configured")
+		}
+		_, err := enqueueWebhook(db, d.Project.ID, target, "digest", map[string]interface{}{
+			"type":      "digest",
+			"digest":    d,
+			"timestamp": time.Now(),
+		})
+		return err
+	case "email":
+		target := action.Target
+		if target == "" {
+			if settings, err := GetProjectSettings(db, d.Project.ID); err == nil {
+				target = settings.NotificationEmail
+			}
+		}
+		to := splitEmailList(target)
+		if len(to) == 0 {
+			return errors.New("no notification email configured")
+		}
+		return sendEmailMessage(db, &EmailMessage{
+			To:      to,
+			Subject: "[Pulse] " + d.title(),
+			Text:    d.text(),
+			HTML:    d.html(),
+		})
+	case "integration":
+		integ, err := GetProjectIntegration(db, d.Project.ID, action.Target)
+		if err != nil {
+			return fmt.Errorf("integration %s not found", action.Target)
+		}
+		if !integ.Enabled {
+			return nil
+		}
+		return sendIntegrationDigest(db, integ, d)
+	}
+	return fmt.Errorf("unknown action type %q", action.Type)
+}
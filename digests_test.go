@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestRetriedAfterFailedSend(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+
+	n := &AlertNotification{
+		Project:  project,
+		Event:    &ErrorEvent{ID: "evt-1", ProjectID: project.ID, Fingerprint: "fp-1", Message: "Timeout talking to payments", Level: "error"},
+		Triggers: []string{"new_issue"},
+	}
+	if err := bufferDigestItems(db, []AlertAction{{Type: "email", Target: "ops@example.com"}}, n); err != nil {
+		t.Fatalf("bufferDigestItems: %v", err)
+	}
+	pending := func() (count, attempts int) {
+		db.QueryRow("SELECT COUNT(*), COALESCE(MAX(attempts), 0) FROM notification_digest_items").Scan(&count, &attempts)
+		return
+	}
+
+	// SMTP isn't configured yet, so the send fails and the items wait for a retry
+	now := time.Now().Add(time.Second)
+	flushDueDigests(db, now)
+	if count, attempts := pending(); count != 1 || attempts != 1 {
+		t.Fatalf("after failed send: %d items, %d attempts", count, attempts)
+	}
+	flushDueDigests(db, now.Add(30*time.Second))
+	if _, attempts := pending(); attempts != 1 {
+		t.Fatalf("retried before the backoff: %d attempts", attempts)
+	}
+
+	stub := newSMTPStub(t)
+	configureSMTPStub(t, db, stub)
+	flushDueDigests(db, now.Add(2*time.Minute))
+	msg := stub.wait(t)
+	if !strings.Contains(msg.Data, "Timeout talking to payments") {
+		t.Errorf("digest is missing the issue:\n%s", msg.Data)
+	}
+	if count, _ := pending(); count != 0 {
+		t.Errorf("%d items left after a successful send", count)
+	}
+}
+
+func TestDigestDroppedAfterMaxAttempts(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+
+	n := &AlertNotification{
+		Project: project,
+		Event:   &ErrorEvent{ID: "evt-1", ProjectID: project.ID, Fingerprint: "fp-1", Message: "boom", Level: "error"},
+	}
+	if err := bufferDigestItems(db, []AlertAction{{Type: "email", Target: "ops@example.com"}}, n); err != nil {
+		t.Fatalf("bufferDigestItems: %v", err)
+	}
+
+	now := time.Now().Add(time.Second)
+	for i := 0; i < digestMaxAttempts; i++ {
+		flushDueDigests(db, now)
+		now = now.Add(time.Hour)
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM notification_digest_items").Scan(&count)
+	if count != 0 {
+		t.Errorf("%d items left after %d failed attempts", count, digestMaxAttempts)
+	}
+	var status string
+	db.QueryRow("SELECT status FROM alert_history WHERE rule_id = 'digest:immediate'").Scan(&status)
+	if status != "failed" {
+		t.Errorf("history status = %q", status)
+	}
+}
+
+func TestDigestSentForOutageOnlyPeriod(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	stub := newWebhookStub(t)
+	if err := UpdateProjectSettings(db, &ProjectSettings{
+		ProjectID:              project.ID,
+		NotificationEnabled:    true,
+		NotificationLevels:     "error,fatal",
+		NotificationFrequency:  "hourly",
+		NotificationWebhookURL: stub.URL + "/digest",
+		NotificationRateLimit:  60,
+	}); err != nil {
+		t.Fatalf("UpdateProjectSettings: %v", err)
+	}
+
+	monitor := &Monitor{ID: "mon-1", ProjectID: project.ID, Name: "Checkout API", Type: "http", URL: "https://example.com",
+		Interval: 60, Timeout: 10, Status: "up", CreatedAt: time.Now()}
+	if err := CreateMonitor(db, monitor); err != nil {
+		t.Fatalf("CreateMonitor: %v", err)
+	}
+	down := &MonitorCheck{ID: "chk-1", MonitorID: monitor.ID, Status: "down", ErrorMessage: "connection refused", CreatedAt: time.Now()}
+	up := &MonitorCheck{ID: "chk-2", MonitorID: monitor.ID, Status: "up", CreatedAt: time.Now()}
+	for _, check := range []*MonitorCheck{down, up} {
+		if err := InsertMonitorCheck(db, check); err != nil {
+			t.Fatalf("InsertMonitorCheck: %v", err)
+		}
+	}
+	notifyMonitorAlert(db, &MonitorAlert{Kind: "down", Monitor: monitor, Check: down, DownSince: down.CreatedAt, Failures: 1})
+	notifyMonitorAlert(db, &MonitorAlert{Kind: "recovered", Monitor: monitor, Check: up, DownSince: down.CreatedAt})
+
+	// Nothing goes out immediately for a digest project
+	deliverQueuedWebhooks(t, db)
+	if got := stub.received(); len(got) != 0 {
+		t.Fatalf("sent %d immediate alerts", len(got))
+	}
+
+	flushDueDigests(db, time.Now().Add(time.Hour))
+	deliverQueuedWebhooks(t, db)
+	got := stub.received()
+	if len(got) != 1 {
+		t.Fatalf("stub received %d digests, want 1", len(got))
+	}
+	var body struct {
+		Digest NotificationDigest `json:"digest"`
+	}
+	if err := json.Unmarshal(got[0].Body, &body); err != nil {
+		t.Fatalf("digest payload: %v", err)
+	}
+	d := body.Digest
+	if len(d.TopIssues) != 0 || len(d.NewIssues) != 0 {
+		t.Errorf("monitor items were listed as issues: %+v", d.TopIssues)
+	}
+	if len(d.UptimeIncidents) != 1 || d.UptimeIncidents[0].MonitorName != "Checkout API" ||
+		d.UptimeIncidents[0].FailedChecks != 1 || !d.UptimeIncidents[0].Resolved {
+		t.Errorf("uptime incidents = %+v", d.UptimeIncidents)
+	}
+
+	var pending int
+	db.QueryRow("SELECT COUNT(*) FROM notification_digest_items").Scan(&pending)
+	if pending != 0 {
+		t.Errorf("%d items left after the digest was sent", pending)
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNSMonitorConfig selects the record a DNS monitor queries and what it must contain.
+// Without a config, DNS monitors only check that the host resolves via the system resolver.
+type DNSMonitorConfig struct {
+	RecordType string `json:"record_type"`
+	// Resolver is host[:port]; empty uses the first nameserver in /etc/resolv.conf
+	Resolver string   `json:"resolver,omitempty"`
+	Expected []string `json:"expected,omitempty"`
+	// Match is exact (the records are exactly Expected), contains (every expected value is
+	// returned) or regex (every record matches one of the Expected patterns)
+	Match string `json:"match,omitempty"`
+}
+
+// DNSResult records what a DNS check received
+type DNSResult struct {
+	Resolver       string   `json:"resolver"`
+	RecordType     string   `json:"record_type"`
+	Rcode          string   `json:"rcode"`
+	Records        []string `json:"records"`
+	ResolutionTime float64  `json:"resolution_ms"`
+}
+
+var dnsRecordTypes = map[string]uint16{
+	"A": 1, "NS": 2, "CNAME": 5, "MX": 15, "TXT": 16, "AAAA": 28, "SRV": 33, "CAA": 257,
+}
+
+var dnsRcodes = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED"}
+
+// validate normalises the config and rejects unknown record types, matchers and patterns
+func (c *DNSMonitorConfig) validate() error {
+	c.RecordType = strings.ToUpper(strings.TrimSpace(c.RecordType))
+	if c.RecordType == "" {
+		c.RecordType = "A"
+	}
+	if _, ok := dnsRecordTypes[c.RecordType]; !ok {
+		return fmt.Errorf("record_type must be one of A, AAAA, CNAME, MX, TXT, NS, SRV, CAA")
+	}
+	c.Match = strings.ToLower(strings.TrimSpace(c.Match))
+	switch c.Match {
+	case "":
+		c.Match = "exact"
+	case "exact", "contains":
+	case "regex":
+		for _, pattern := range c.Expected {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid regex %q: %v", pattern, err)
+			}
+		}
+	default:
+		return errors.New("match must be exact, contains or regex")
+	}
+	if c.Resolver != "" {
+		addr := dnsResolverAddr(c.Resolver)
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || host == "" || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+			return fmt.Errorf("invalid resolver %q", c.Resolver)
+		}
+		c.Resolver = addr
+	}
+	return nil
+}
+
+// checkDNS queries the monitor's record and compares the answer with the expected values
+func checkDNS(m *Monitor, timeout time.Duration) (status string, errMsg string, result *DNSResult) {
+	host := strings.TrimSuffix(pingHost(m.URL), ".")
+	if m.DNS == nil {
+		return checkSystemDNS(host, timeout)
+	}
+	cfg := m.DNS
+
+	resolver := cfg.Resolver
+	if resolver == "" {
+		resolver = systemNameserver()
+	}
+	result = &DNSResult{Resolver: resolver, RecordType: cfg.RecordType, Records: []string{}}
+
+	start := time.Now()
+	rcode, records, err := queryDNS(resolver, host, cfg.RecordType, timeout)
+	result.ResolutionTime = durationMillis(time.Since(start))
+	if err != nil {
+		return "down", err.Error(), result
+	}
+	result.Rcode = rcode
+	result.Records = records
+	if rcode != "NOERROR" {
+		return "down", fmt.Sprintf("%s lookup of %s returned %s", cfg.RecordType, host, rcode), result
+	}
+	if len(records) == 0 {
+		return "down", fmt.Sprintf("no %s records for %s", cfg.RecordType, host), result
+	}
+	if msg := matchDNSRecords(cfg, records); msg != "" {
+		return "down", msg, result
+	}
+	return "up", "", result
+}
+
+// checkSystemDNS is the check of DNS monitors without a config: the host must resolve
+func checkSystemDNS(host string, timeout time.Duration) (status string, errMsg string, result *DNSResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	result = &DNSResult{Resolver: "system", RecordType: "A/AAAA", Records: addrs, ResolutionTime: durationMillis(time.Since(start))}
+	if err != nil {
+		return "down", err.Error(), result
+	}
+	result.Rcode = "NOERROR"
+	return "up", "", result
+}
+
+// matchDNSRecords returns why the records don't match the expectation, or "" if they do
+func matchDNSRecords(cfg *DNSMonitorConfig, records []string) string {
+	if len(cfg.Expected) == 0 {
+		return ""
+	}
+	normalize := func(v string) string {
+		if cfg.RecordType == "TXT" {
+			return v
+		}
+		return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(v), "."))
+	}
+	got := map[string]bool{}
+	for _, r := range records {
+		got[normalize(r)] = true
+	}
+
+	switch cfg.Match {
+	case "contains":
+		var missing []string
+		for _, e := range cfg.Expected {
+			if !got[normalize(e)] {
+				missing = append(missing, e)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Sprintf("%s records %s missing %s", cfg.RecordType, formatRecords(records), formatRecords(missing))
+		}
+	case "regex":
+		var patterns []*regexp.Regexp
+		for _, e := range cfg.Expected {
+			if re, err := regexp.Compile(e); err == nil {
+				patterns = append(patterns, re)
+			}
+		}
+		for _, r := range records {
+			matched := false
+			for _, re := range patterns {
+				if re.MatchString(r) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Sprintf("%s record %q matches none of %s", cfg.RecordType, r, formatRecords(cfg.Expected))
+			}
+		}
+	default:
+		want := map[string]bool{}
+		for _, e := range cfg.Expected {
+			want[normalize(e)] = true
+		}
+		equal := len(want) == len(got)
+		for v := range want {
+			equal = equal && got[v]
+		}
+		if !equal {
+			return fmt.Sprintf("%s records are %s, expected %s", cfg.RecordType, formatRecords(records), formatRecords(cfg.Expected))
+		}
+	}
+	return ""
+}
+
+func formatRecords(records []string) string {
+	sorted := append([]string{}, records...)
+	sort.Strings(sorted)
+	return "[" + strings.Join(sorted, ", ") + "]"
+}
+
+// dnsResolverAddr adds the default port to a resolver address
+func dnsResolverAddr(resolver string) string {
+	resolver = strings.TrimSpace(resolver)
+	if _, _, err := net.SplitHostPort(resolver); err == nil {
+		return resolver
+	}
+	return net.JoinHostPort(strings.Trim(resolver, "[]"), "53")
+}
+
+// systemNameserver returns the first nameserver in /etc/resolv.conf
+func systemNameserver() string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return dnsResolverAddr(fields[1])
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// queryDNS sends a recursive query over UDP, retrying over TCP when the answer is truncated
+func queryDNS(resolver, name, recordType string, timeout time.Duration) (rcode string, records []string, err error) {
+	qtype := dnsRecordTypes[recordType]
+	query, id, err := buildDNSQuery(name, qtype)
+	if err != nil {
+		return "", nil, err
+	}
+	deadline := time.Now().Add(timeout)
+
+	resp, err := exchangeDNS("udp", resolver, query, id, deadline)
+	if err != nil {
+		return "", nil, err
+	}
+	if resp[2]&0x02 != 0 {
+		if resp, err = exchangeDNS("tcp", resolver, query, id, deadline); err != nil {
+			return "", nil, err
+		}
+	}
+	return parseDNSResponse(resp, qtype)
+}
+
+func buildDNSQuery(name string, qtype uint16) ([]byte, uint16, error) {
+	var idBytes [2]byte
+	rand.Read(idBytes[:])
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	msg[2] = 0x01 // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid domain name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1)
+	return msg, id, nil
+}
+
+func exchangeDNS(network, resolver string, query []byte, id uint16, deadline time.Time) ([]byte, error) {
+	conn, err := net.DialTimeout(network, resolver, time.Until(deadline))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	if network == "tcp" {
+		framed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		copy(framed[2:], query)
+		if _, err := conn.Write(framed); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		if len(resp) < 12 || binary.BigEndian.Uint16(resp) != id {
+			return nil, errors.New("malformed DNS response")
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray datagrams that don't answer this query
+		if n >= 12 && binary.BigEndian.Uint16(buf) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+// parseDNSResponse returns the rcode and the answers of type qtype, formatted as text
+func parseDNSResponse(msg []byte, qtype uint16) (string, []string, error) {
+	rcode := int(msg[3] & 0x0f)
+	rcodeName := "RCODE" + strconv.Itoa(rcode)
+	if rcode < len(dnsRcodes) {
+		rcodeName = dnsRcodes[rcode]
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		_, next, err := readDNSName(msg, off)
+		if err != nil {
+			return "", nil, err
+		}
+		off = next + 4
+	}
+
+	records := []string{}
+	for i := 0; i < ancount; i++ {
+		_, next, err := readDNSName(msg, off)
+		if err != nil {
+			return "", nil, err
+		}
+		off = next
+		if off+10 > len(msg) {
+			return "", nil, errors.New("truncated DNS answer")
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		rdata := off + 10
+		off = rdata + rdlen
+		if off > len(msg) {
+			return "", nil, errors.New("truncated DNS answer")
+		}
+		// Answers for other types, e.g. the CNAME chain of an A query, are skipped
+		if rtype != qtype {
+			continue
+		}
+		record, err := formatDNSRecord(msg, rtype, rdata, rdlen)
+		if err != nil {
+			return "", nil, err
+		}
+		records = append(records, record)
+	}
+	return rcodeName, records, nil
+}
+
+func formatDNSRecord(msg []byte, rtype uint16, off, length int) (string, error) {
+	rdata := msg[off : off+length]
+	switch rtype {
+	case 1, 28: // A, AAAA
+		if (rtype == 1 && length != 4) || (rtype == 28 && length != 16) {
+			return "", errors.New("malformed address record")
+		}
+		return net.IP(rdata).String(), nil
+	case 2, 5: // NS, CNAME
+		name, _, err := readDNSName(msg, off)
+		return name, err
+	case 15: // MX
+		if length < 3 {
+			return "", errors.New("malformed MX record")
+		}
+		name, _, err := readDNSName(msg, off+2)
+		return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(rdata), name), err
+	case 16: // TXT
+		var b strings.Builder
+		for i := 0; i < len(rdata); {
+			n := int(rdata[i])
+			if i+1+n > len(rdata) {
+				return "", errors.New("malformed TXT record")
+			}
+			b.Write(rdata[i+1 : i+1+n])
+			i += 1 + n
+		}
+		return b.String(), nil
+	case 33: // SRV
+		if length < 7 {
+			return "", errors.New("malformed SRV record")
+		}
+		name, _, err := readDNSName(msg, off+6)
+		return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(rdata), binary.BigEndian.Uint16(rdata[2:]),
+			binary.BigEndian.Uint16(rdata[4:]), name), err
+	case 257: // CAA
+		if length < 2 || 2+int(rdata[1]) > length {
+			return "", errors.New("malformed CAA record")
+		}
+		tagEnd := 2 + int(rdata[1])
+		return fmt.Sprintf("%d %s %q", rdata[0], rdata[2:tagEnd], rdata[tagEnd:]), nil
+	}
+	return "", fmt.Errorf("unsupported record type %d", rtype)
+}
+
+// readDNSName decodes a possibly compressed name at off and returns the offset after it
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("malformed DNS name")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 10 {
+				return "", 0, errors.New("malformed DNS name")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errors.New("malformed DNS name")
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
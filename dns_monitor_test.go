@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dnsRR is one answer served by dnsStub; rdata is already wire-encoded
+type dnsRR struct {
+	rtype uint16
+	rdata []byte
+}
+
+// dnsQuestion is what dnsStub received
+type dnsQuestion struct {
+	Network          string
+	Name             string
+	Type             uint16
+	RecursionDesired bool
+}
+
+// dnsStub is an authoritative server for a fixed zone on UDP and TCP. Names in
+// truncate get a truncated UDP answer so the client has to retry over TCP.
+type dnsStub struct {
+	addr     string
+	zone     map[string][]dnsRR // by lower-case name
+	truncate map[string]bool
+
+	mu        sync.Mutex
+	questions []dnsQuestion
+}
+
+func newDNSStub(t *testing.T, zone map[string][]dnsRR) *dnsStub {
+	t.Helper()
+	s := &dnsStub{zone: zone, truncate: map[string]bool{}}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	s.addr = udp.LocalAddr().String()
+	tcp, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		udp.Close()
+		t.Fatalf("listen tcp: %v", err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.answer("udp", buf[:n]); resp != nil {
+				udp.WriteTo(resp, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := s.answer("tcp", query)
+				framed := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+				conn.Write(append(framed, resp...))
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *dnsStub) received() []dnsQuestion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]dnsQuestion(nil), s.questions...)
+}
+
+// answer builds the response to query, with answers pointing at the question name
+func (s *dnsStub) answer(network string, query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	name, off, err := readDNSName(query, 12)
+	if err != nil || off+4 > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[off:])
+	s.mu.Lock()
+	s.questions = append(s.questions, dnsQuestion{Network: network, Name: name, Type: qtype, RecursionDesired: query[2]&0x01 != 0})
+	s.mu.Unlock()
+
+	resp := append([]byte{}, query[:off+4]...)
+	resp[2] = 0x84 | query[2]&0x01 // response, authoritative, copy RD
+	resp[3] = 0
+	binary.BigEndian.PutUint16(resp[6:], 0)
+	binary.BigEndian.PutUint16(resp[8:], 0)
+	binary.BigEndian.PutUint16(resp[10:], 0)
+
+	records, ok := s.zone[strings.ToLower(name)]
+	if !ok {
+		resp[3] = 3 // NXDOMAIN
+		return resp
+	}
+	if network == "udp" && s.truncate[strings.ToLower(name)] {
+		resp[2] |= 0x02
+		return resp
+	}
+	var count uint16
+	for _, rr := range records {
+		// A CNAME answers any type, as in a real chain
+		if rr.rtype != qtype && rr.rtype != 5 {
+			continue
+		}
+		resp = append(resp, 0xc0, 12) // owner: the question name
+		resp = binary.BigEndian.AppendUint16(resp, rr.rtype)
+		resp = append(resp, 0, 1, 0, 0, 0x0e, 0x10) // IN, TTL 3600
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(rr.rdata)))
+		resp = append(resp, rr.rdata...)
+		count++
+	}
+	binary.BigEndian.PutUint16(resp[6:], count)
+	return resp
+}
+
+func dnsWireName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(append(b, byte(len(label))), label...)
+	}
+	return append(b, 0)
+}
+
+func dnsA(ip string) dnsRR    { return dnsRR{1, net.ParseIP(ip).To4()} }
+func dnsAAAA(ip string) dnsRR { return dnsRR{28, net.ParseIP(ip).To16()} }
+func dnsCNAME(target string) dnsRR {
+	return dnsRR{5, dnsWireName(target)}
+}
+func dnsMX(pref uint16, host string) dnsRR {
+	return dnsRR{15, append(binary.BigEndian.AppendUint16(nil, pref), dnsWireName(host)...)}
+}
+func dnsTXT(text string) dnsRR {
+	return dnsRR{16, append([]byte{byte(len(text))}, text...)}
+}
+
+func TestDNSMonitorAgainstStub(t *testing.T) {
+	stub := newDNSStub(t, map[string][]dnsRR{
+		"example.test":     {dnsA("192.0.2.10"), dnsA("192.0.2.11"), dnsAAAA("2001:db8::1"), dnsMX(10, "mx1.example.test"), dnsTXT("v=spf1 -all")},
+		"www.example.test": {dnsCNAME("example.test"), dnsA("192.0.2.10")},
+		"big.example.test": {dnsA("192.0.2.99")},
+	})
+	stub.truncate["big.example.test"] = true
+
+	tests := []struct {
+		name       string
+		host       string
+		cfg        DNSMonitorConfig
+		wantStatus string
+		wantError  string
+		wantRecord []string
+	}{
+		{"exact A", "example.test", DNSMonitorConfig{RecordType: "A", Expected: []string{"192.0.2.11", "192.0.2.10"}},
+			"up", "", []string{"192.0.2.10", "192.0.2.11"}},
+		{"exact A mismatch", "example.test", DNSMonitorConfig{RecordType: "A", Expected: []string{"192.0.2.10"}},
+			"down", "A records are [192.0.2.10, 192.0.2.11], expected [192.0.2.10]", nil},
+		{"contains AAAA", "example.test", DNSMonitorConfig{RecordType: "aaaa", Match: "contains", Expected: []string{"2001:DB8::1"}},
+			"up", "", []string{"2001:db8::1"}},
+		{"MX with trailing dot", "example.test", DNSMonitorConfig{RecordType: "MX", Expected: []string{"10 mx1.example.test."}},
+			"up", "", []string{"10 mx1.example.test"}},
+		{"TXT regex", "example.test", DNSMonitorConfig{RecordType: "TXT", Match: "regex", Expected: []string{`^v=spf1 `}},
+			"up", "", []string{"v=spf1 -all"}},
+		{"CNAME chain skipped for A", "www.example.test", DNSMonitorConfig{RecordType: "A"},
+			"up", "", []string{"192.0.2.10"}},
+		{"missing MX", "www.example.test", DNSMonitorConfig{RecordType: "MX"},
+			"down", "no MX records for www.example.test", nil},
+		{"NXDOMAIN", "nope.example.test", DNSMonitorConfig{RecordType: "A"},
+			"down", "A lookup of nope.example.test returned NXDOMAIN", nil},
+		{"truncated retried over TCP", "big.example.test", DNSMonitorConfig{RecordType: "A", Expected: []string{"192.0.2.99"}},
+			"up", "", []string{"192.0.2.99"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Resolver = stub.addr
+			if err := cfg.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			before := len(stub.received())
+			status, errMsg, result := checkDNS(&Monitor{URL: tt.host, DNS: &cfg}, 2*time.Second)
+			if status != tt.wantStatus || errMsg != tt.wantError {
+				t.Fatalf("checkDNS = %s %q, want %s %q", status, errMsg, tt.wantStatus, tt.wantError)
+			}
+			if tt.wantRecord != nil && formatRecords(result.Records) != formatRecords(tt.wantRecord) {
+				t.Errorf("records = %v, want %v", result.Records, tt.wantRecord)
+			}
+			if result.Resolver != stub.addr {
+				t.Errorf("resolver = %q", result.Resolver)
+			}
+
+			questions := stub.received()[before:]
+			if len(questions) == 0 {
+				t.Fatal("stub received no query")
+			}
+			q := questions[0]
+			if q.Network != "udp" || q.Name != tt.host || q.Type != dnsRecordTypes[cfg.RecordType] || !q.RecursionDesired {
+				t.Errorf("stub received %+v", q)
+			}
+			if tt.name == "truncated retried over TCP" && (len(questions) != 2 || questions[1].Network != "tcp") {
+				t.Errorf("no TCP retry after truncation: %+v", questions)
+			}
+		})
+	}
+}
+
+func TestDNSMonitorResolverDown(t *testing.T) {
+	// A closed UDP port: the query times out or is refused, never "up"
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	cfg := DNSMonitorConfig{RecordType: "A", Resolver: addr}
+	cfg.validate()
+	status, errMsg, _ := checkDNS(&Monitor{URL: "example.test", DNS: &cfg}, 300*time.Millisecond)
+	if status != "down" || errMsg == "" {
+		t.Errorf("checkDNS = %s %q", status, errMsg)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds outbound mail settings read from the global settings table
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Security string // starttls, tls, none
+	Username string
+	Password string
+	From     string
+}
+
+// EmailMessage is a single outbound email; HTML is optional
+type EmailMessage struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// getSMTPConfig loads the smtp_* keys from settings
+func getSMTPConfig(db *sql.DB) (*SMTPConfig, error) {
+	settings, err := GetAllSettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &SMTPConfig{
+		Host:     settings["smtp_host"],
+		Port:     587,
+		Security: strings.ToLower(settings["smtp_security"]),
+		Username: settings["smtp_user"],
+		Password: settings["smtp_password"],
+		From:     settings["smtp_from"],
+	}
+	if cfg.Host == "" {
+		return nil, errors.New("SMTP is not configured")
+	}
+	if p, err := strconv.Atoi(settings["smtp_port"]); err == nil && p > 0 {
+		cfg.Port = p
+	}
+	if cfg.Password == "" {
+		// Older versions of the settings page stored the password under smtp_pass
+		cfg.Password = settings["smtp_pass"]
+	}
+	if cfg.Security == "" {
+		cfg.Security = "starttls"
+		if cfg.Port == 465 {
+			cfg.Security = "tls"
+		}
+	}
+	if cfg.Security != "starttls" && cfg.Security != "tls" && cfg.Security != "none" {
+		return nil, fmt.Errorf("unsupported smtp_security %q (expected starttls, tls or none)", cfg.Security)
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.Username
+	}
+	if cfg.From == "" {
+		return nil, errors.New("SMTP from address is not configured")
+	}
+	return cfg, nil
+}
+
+// sendEmail delivers a plain-text message using the configured SMTP server
+func sendEmail(db *sql.DB, to []string, subject, body string) error {
+	return sendEmailMessage(db, &EmailMessage{To: to, Subject: subject, Text: body})
+}
+
+// sendEmailMessage delivers msg using the configured SMTP server
+func sendEmailMessage(db *sql.DB, msg *EmailMessage) error {
+	cfg, err := getSMTPConfig(db)
+	if err != nil {
+		return err
+	}
+	return cfg.Send(msg)
+}
+
+// Send connects to the server and delivers msg, upgrading to TLS as configured
+func (cfg *SMTPConfig) Send(msg *EmailMessage) error {
+	if len(msg.To) == 0 {
+		return errors.New("no recipients")
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if cfg.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(60 * time.Second))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if cfg.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := client.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, rcpt := range msg.To {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.build(cfg.From)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// build renders msg as an RFC 5322 message, multipart/alternative when HTML is set
+func (msg *EmailMessage) build(from string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	text := strings.ReplaceAll(msg.Text, "\n", "\r\n")
+	if msg.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		b.WriteString(text)
+		return []byte(b.String())
+	}
+
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	boundary := "pulse-" + hex.EncodeToString(buf)
+
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", boundary, text)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", boundary, strings.ReplaceAll(msg.HTML, "\n", "\r\n"))
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return []byte(b.String())
+}
+
+// getPublicURL returns the externally reachable base URL used in links sent to users
+func getPublicURL(db *sql.DB) string {
+	if value, _ := GetSetting(db, "public_url"); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	if value := os.Getenv("PUBLIC_URL"); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	return "http://localhost:" + getEnvOrDefault("PORT", "8080")
+}
+
+// splitEmailList parses a comma or semicolon separated list of addresses
+func splitEmailList(list string) []string {
+	var out []string
+	for _, addr := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ';' }) {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// topFrames returns up to n "function (file:line)" descriptions, innermost first
+func topFrames(stacktraceJSON string, n int) []string {
+	var stacktrace struct {
+		Frames []struct {
+			Filename string  `json:"filename"`
+			AbsPath  string  `json:"abs_path"`
+			Function string  `json:"function"`
+			Module   string  `json:"module"`
+			Lineno   float64 `json:"lineno"`
+		} `json:"frames"`
+	}
+	json.Unmarshal([]byte(stacktraceJSON), &stacktrace)
+
+	var frames []string
+	for i := len(stacktrace.Frames) - 1; i >= 0 && len(frames) < n; i-- {
+		f := stacktrace.Frames[i]
+		file := f.Filename
+		if file == "" {
+			file = f.AbsPath
+		}
+		if file == "" {
+			file = f.Module
+		}
+		function := f.Function
+		if function == "" {
+			function = "<anonymous>"
+		}
+		if f.Lineno > 0 {
+			frames = append(frames, fmt.Sprintf("%s (%s:%d)", function, file, int(f.Lineno)))
+		} else {
+			frames = append(frames, fmt.Sprintf("%s (%s)", function, file))
+		}
+	}
+	return frames
+}
+
+// buildAlertEmail renders the text and HTML bodies for an alert notification
+func buildAlertEmail(db *sql.DB, n *AlertNotification, to []string) *EmailMessage {
+	e := n.Event
+	link := fmt.Sprintf("%s/errors/%s", getPublicURL(db), e.ID)
+	environment := valueOrDash(e.Environment)
+	release := valueOrDash(e.Release)
+	frames := topFrames(e.Stacktrace, 5)
+
+	var body strings.Builder
+	body.WriteString(`<!DOCTYPE html><html><body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;color:#0f172a;background:#f8fafc;padding:24px">`)
+	body.WriteString(`<div style="max-width:640px;margin:0 auto;background:#ffffff;border:1px solid #e2e8f0;border-radius:8px;padding:24px">`)
+	fmt.Fprintf(&body, `<p style="margin:0 0 4px;font-size:12px;color:#64748b;text-transform:uppercase">%s &middot; %s</p>`,
+		html.EscapeString(n.Project.Name), html.EscapeString(e.Level))
+	fmt.Fprintf(&body, `<h2 style="margin:0 0 16px;font-size:18px">%s</h2>`, html.EscapeString(e.Message))
+	body.WriteString(`<table style="border-collapse:collapse;font-size:14px;margin-bottom:16px">`)
+	for _, row := range [][2]string{
+		{"Level", e.Level},
+		{"Environment", environment},
+		{"Release", release},
+		{"Events", strconv.Itoa(n.EventCount)},
+	} {
+		fmt.Fprintf(&body, `<tr><td style="padding:2px 16px 2px 0;color:#64748b">%s</td><td>%s</td></tr>`,
+			row[0], html.EscapeString(row[1]))
+	}
+	body.WriteString(`</table>`)
+	if len(frames) > 0 {
+		body.WriteString(`<pre style="background:#0f172a;color:#e2e8f0;padding:12px;border-radius:6px;font-size:12px;overflow-x:auto">`)
+		for _, f := range frames {
+			fmt.Fprintf(&body, "at %s\n", html.EscapeString(f))
+		}
+		body.WriteString(`</pre>`)
+	}
+	fmt.Fprintf(&body, `<a href="%s" style="display:inline-block;background:#6366f1;color:#ffffff;text-decoration:none;padding:8px 16px;border-radius:6px;font-size:14px">View issue</a>`,
+		html.EscapeString(link))
+	body.WriteString(`</div></body></html>`)
+
+	msg := &EmailMessage{
+		To:      to,
+		Subject: truncateSubject(renderNotification(db, "email_subject", n), 200),
+		Text:    renderNotification(db, "email_text", n),
+		HTML:    body.String(),
+	}
+	// The HTML layout isn't templated, so a custom text template is sent on its own
+	if _, err := GetNotificationTemplate(db, n.Project.ID, "email_text"); err == nil {
+		msg.HTML = ""
+	}
+	return msg
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func truncateSubject(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+// sendTestEmail sends a test message to the given address, or the caller's own
+func sendTestEmail(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req struct {
+		To string `json:"to"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	to := strings.TrimSpace(req.To)
+	if to == "" {
+		if claims, err := claimsFromRequest(r); err == nil {
+			to = claims.Email
+		}
+	}
+	if to == "" {
+		http.Error(w, "Recipient address is required", http.StatusBadRequest)
+		return
+	}
+
+	msg := &EmailMessage{
+		To:      []string{to},
+		Subject: "[Pulse] Test email",
+		Text:    "This is a test email from Pulse. Your SMTP settings are working.\n\n" + getPublicURL(db) + "\n",
+		HTML: `<!DOCTYPE html><html><body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif">` +
+			`<p>This is a test email from <strong>Pulse</strong>. Your SMTP settings are working.</p>` +
+			`<p><a href="` + html.EscapeString(getPublicURL(db)) + `">Open Pulse</a></p></body></html>`,
+	}
+
+	if err := sendEmailMessage(db, msg); err != nil {
+		log.Printf("Failed to send test email to %s: %v", to, err)
+		http.Error(w, "Failed to send test email: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "sent", "to": to})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpMessage is one message received by smtpStub
+type smtpMessage struct {
+	Auth string // decoded AUTH PLAIN credentials
+	From string
+	To   []string
+	Data string
+}
+
+// smtpStub is an in-process SMTP server that accepts every message
+type smtpStub struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+	received chan struct{}
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpStub{ln: ln, received: make(chan struct{}, 16)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var msg smtpMessage
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-stub")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN "):
+			creds, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			msg.Auth = strings.ReplaceAll(string(creds), "\x00", " ")
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.From = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.To = append(msg.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			s.received <- struct{}{}
+			msg = smtpMessage{Auth: msg.Auth}
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// wait returns the next message received, failing the test after a timeout
+func (s *smtpStub) wait(t *testing.T) smtpMessage {
+	t.Helper()
+	select {
+	case <-s.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages[len(s.messages)-1]
+}
+
+func configureSMTPStub(t *testing.T, db *sql.DB, s *smtpStub) {
+	mustSetting(t, db, "smtp_host", "127.0.0.1")
+	mustSetting(t, db, "smtp_port", strconv.Itoa(s.port()))
+	mustSetting(t, db, "smtp_security", "none")
+	mustSetting(t, db, "smtp_user", "pulse")
+	mustSetting(t, db, "smtp_password", "hunter2")
+	mustSetting(t, db, "smtp_from", "alerts@pulse.test")
+	mustSetting(t, db, "public_url", "https://pulse.test")
+}
+
+func TestSendTestEmail(t *testing.T) {
+	db := newTestDB(t)
+	stub := newSMTPStub(t)
+	configureSMTPStub(t, db, stub)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/settings/test-email", strings.NewReader(`{"to":"ops@example.com"}`))
+	rec := httptest.NewRecorder()
+	sendTestEmail(rec, req, db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	msg := stub.wait(t)
+	if msg.Auth != " pulse hunter2" {
+		t.Errorf("auth = %q", msg.Auth)
+	}
+	if msg.From != "alerts@pulse.test" || len(msg.To) != 1 || msg.To[0] != "ops@example.com" {
+		t.Errorf("envelope = %s -> %v", msg.From, msg.To)
+	}
+	for _, want := range []string{
+		"Subject: [Pulse] Test email",
+		"Content-Type: multipart/alternative",
+		"Your SMTP settings are working.",
+		`<a href="https://pulse.test">`,
+	} {
+		if !strings.Contains(msg.Data, want) {
+			t.Errorf("message is missing %q:\n%s", want, msg.Data)
+		}
+	}
+}
+
+func TestEmailAlert(t *testing.T) {
+	db := newTestDB(t)
+	stub := newSMTPStub(t)
+	configureSMTPStub(t, db, stub)
+	project := newTestProject(t, db)
+
+	n := &AlertNotification{
+		Project: project,
+		Event: &ErrorEvent{
+			ID:          "evt-1",
+			ProjectID:   project.ID,
+			Message:     "TypeError: cart is undefined",
+			Level:       "error",
+			Environment: "production",
+			Release:     "checkout@1.4.2",
+			Stacktrace:  `{"frames":[{"function":"main","filename":"app.js","lineno":3},{"function":"addToCart","filename":"cart.js","lineno":42}]}`,
+			Timestamp:   time.Now(),
+		},
+		Rule:       &AlertRule{Name: "New issues"},
+		Triggers:   []string{"new_issue"},
+		EventCount: 7,
+	}
+	if err := sendAlertAction(db, AlertAction{Type: "email", Target: "dev@example.com; lead@example.com"}, n); err != nil {
+		t.Fatalf("sendAlertAction: %v", err)
+	}
+
+	msg := stub.wait(t)
+	if len(msg.To) != 2 || msg.To[0] != "dev@example.com" || msg.To[1] != "lead@example.com" {
+		t.Errorf("recipients = %v", msg.To)
+	}
+	for _, want := range []string{
+		"Subject: [Pulse] [checkout] ERROR: TypeError: cart is undefined",
+		"Environment: production",
+		"Release:     checkout@1.4.2",
+		"Events:      7",
+		"at addToCart (cart.js:42)",
+		"View issue: https://pulse.test/errors/evt-1",
+		"text/html",
+	} {
+		if !strings.Contains(msg.Data, want) {
+			t.Errorf("message is missing %q:\n%s", want, msg.Data)
+		}
+	}
+}
@@ -172,6 +172,20 @@ export function getMonitorStatusColor(status) {
         border: 'border-red-500/20',
         icon: '✕'
       };
+    case 'degraded':
+      return {
+        text: 'text-orange-400',
+        bg: 'bg-orange-500/10',
+        border: 'border-orange-500/20',
+        icon: '!'
+      };
+    case 'maintenance':
+      return {
+        text: 'text-blue-400',
+        bg: 'bg-blue-500/10',
+        border: 'border-blue-500/20',
+        icon: '⚙'
+      };
     case 'paused':
       return {
         text: 'text-yellow-400',
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gRPC monitors call the standard health service, grpc.health.v1.Health/Check, over
+// HTTP/2: with TLS when the config asks for it and in cleartext (h2c) otherwise. The
+// request and response are single-field protobuf messages, so they're encoded by hand.
+
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// Serving statuses of grpc.health.v1.HealthCheckResponse
+var grpcServingStatuses = []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}
+
+const grpcServing = 1
+
+// gRPC status codes, indexed by value
+var grpcStatusCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION", "ABORTED",
+	"OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+var grpcMetadataKey = regexp.MustCompile(`^[0-9a-z_.-]+$`)
+
+// GRPCMonitorConfig holds the options of a gRPC health monitor. The zero value asks a
+// cleartext server about its overall health.
+type GRPCMonitorConfig struct {
+	// Service is the service name to check; empty checks the server as a whole
+	Service       string `json:"service,omitempty"`
+	TLS           bool   `json:"tls,omitempty"`
+	SkipTLSVerify bool   `json:"skip_tls_verify,omitempty"`
+	// Metadata is sent with the call, e.g. an authorization token
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// openErr is set when stored metadata can't be decrypted
+	openErr error
+}
+
+// validate normalises the config and rejects metadata gRPC reserves
+func (c *GRPCMonitorConfig) validate() error {
+	c.Service = strings.TrimSpace(c.Service)
+	if c.SkipTLSVerify && !c.TLS {
+		c.SkipTLSVerify = false
+	}
+	if len(c.Metadata) > 0 {
+		metadata := make(map[string]string, len(c.Metadata))
+		for k, v := range c.Metadata {
+			key := strings.ToLower(strings.TrimSpace(k))
+			if !grpcMetadataKey.MatchString(key) {
+				return fmt.Errorf("metadata key %q is invalid", k)
+			}
+			if strings.HasPrefix(key, "grpc-") || key == "content-type" || key == "te" {
+				return fmt.Errorf("metadata key %q is reserved", k)
+			}
+			metadata[key] = v
+		}
+		c.Metadata = metadata
+	}
+	return nil
+}
+
+// masked returns a copy safe to send to clients, hiding credentials in metadata
+func (c *GRPCMonitorConfig) masked() *GRPCMonitorConfig {
+	if c == nil {
+		return nil
+	}
+	out := *c
+	out.Metadata = maskedHeaders(c.Metadata)
+	return &out
+}
+
+// sealed returns a copy for storage with sensitive metadata values encrypted
+func (c *GRPCMonitorConfig) sealed() (*GRPCMonitorConfig, error) {
+	if c == nil {
+		return nil, nil
+	}
+	out := *c
+	metadata, err := sealedHeaders(c.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	out.Metadata = metadata
+	return &out, nil
+}
+
+// open decrypts the stored metadata in place
+func (c *GRPCMonitorConfig) open() {
+	if c != nil {
+		c.openErr = openHeaders(c.Metadata)
+	}
+}
+
+// keepMaskedSecrets restores metadata that a client echoed back masked
+func (c *GRPCMonitorConfig) keepMaskedSecrets(existing *GRPCMonitorConfig) {
+	if existing != nil {
+		keepMaskedHeaders(c.Metadata, existing.Metadata)
+	}
+}
+
+// checkGRPC asks the monitor's server whether the configured service is serving
+func checkGRPC(m *Monitor, timeout time.Duration) (status string, statusCode int, errMsg string, timings *HTTPTimings) {
+	cfg := m.GRPC
+	if cfg == nil {
+		cfg = &GRPCMonitorConfig{}
+	}
+	if cfg.openErr != nil {
+		return "down", 0, cfg.openErr.Error(), nil
+	}
+	scheme, defaultPort := "http", "80"
+	if cfg.TLS {
+		scheme, defaultPort = "https", "443"
+	}
+	target := scheme + "://" + connectionAddr(m.URL, defaultPort) + grpcHealthCheckPath
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	body := grpcFrame(grpcHealthRequest(cfg.Service))
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return "down", 0, err.Error(), nil
+	}
+	for k, v := range cfg.Metadata {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("Grpc-Timeout", strconv.FormatInt(timeout.Milliseconds(), 10)+"m")
+
+	req, snapshot := traceHTTPTimings(req)
+
+	var protocols http.Protocols
+	if cfg.TLS {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify},
+		Protocols:         &protocols,
+		DisableKeepAlives: true, // measure a fresh connection every check
+	}
+	defer transport.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return "down", 0, err.Error(), snapshot()
+	}
+	defer resp.Body.Close()
+	// Trailers arrive once the body is read to the end
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxMonitorBody))
+	timings = snapshot()
+	if err != nil {
+		return "down", resp.StatusCode, "reading response: " + err.Error(), timings
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "down", resp.StatusCode, "unexpected HTTP status " + resp.Status, timings
+	}
+	if err := grpcStatusError(resp); err != nil {
+		return "down", resp.StatusCode, err.Error(), timings
+	}
+
+	serving, err := grpcHealthStatus(respBody)
+	if err != nil {
+		return "down", resp.StatusCode, "invalid health check response: " + err.Error(), timings
+	}
+	if serving != grpcServing {
+		name := fmt.Sprintf("status %d", serving)
+		if serving < uint64(len(grpcServingStatuses)) {
+			name = grpcServingStatuses[serving]
+		}
+		if cfg.Service == "" {
+			return "down", resp.StatusCode, "server is " + name, timings
+		}
+		return "down", resp.StatusCode, fmt.Sprintf("service %q is %s", cfg.Service, name), timings
+	}
+	return "up", resp.StatusCode, "", timings
+}
+
+// grpcStatusError reports a failed call. Servers answering with an error alone may put
+// the status in the headers instead of the trailers.
+func grpcStatusError(resp *http.Response) error {
+	code, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if code == "" {
+		return errors.New("response has no grpc-status; is this a gRPC server?")
+	}
+	if code == "0" {
+		return nil
+	}
+	name := "status " + code
+	if n, err := strconv.Atoi(code); err == nil && n >= 0 && n < len(grpcStatusCodes) {
+		name = grpcStatusCodes[n]
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	if code == "12" && message == "" {
+		message = "server doesn't implement grpc.health.v1.Health"
+	}
+	if message == "" {
+		return errors.New(name)
+	}
+	return fmt.Errorf("%s: %s", name, message)
+}
+
+// grpcHealthRequest encodes a HealthCheckRequest, whose only field is service = 1
+func grpcHealthRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	msg := []byte{1<<3 | 2} // field 1, length-delimited
+	msg = binary.AppendUvarint(msg, uint64(len(service)))
+	return append(msg, service...)
+}
+
+// grpcFrame prefixes an uncompressed message with its gRPC length header
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// grpcHealthStatus decodes the status field of a framed HealthCheckResponse. Unknown
+// fields are skipped and a missing status is UNKNOWN, as protobuf has it.
+func grpcHealthStatus(frame []byte) (uint64, error) {
+	if len(frame) < 5 {
+		return 0, errors.New("empty response")
+	}
+	if frame[0] != 0 {
+		return 0, errors.New("compressed messages aren't supported")
+	}
+	n := binary.BigEndian.Uint32(frame[1:5])
+	if uint64(len(frame)-5) < uint64(n) {
+		return 0, errors.New("truncated message")
+	}
+	msg := frame[5 : 5+n]
+
+	var status uint64
+	for len(msg) > 0 {
+		tag, size := binary.Uvarint(msg)
+		if size <= 0 {
+			return 0, errors.New("malformed field tag")
+		}
+		msg = msg[size:]
+		field, wireType := tag>>3, tag&7
+		switch wireType {
+		case 0: // varint
+			v, size := binary.Uvarint(msg)
+			if size <= 0 {
+				return 0, errors.New("malformed varint")
+			}
+			msg = msg[size:]
+			if field == 1 {
+				status = v
+			}
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return 0, errors.New("truncated field")
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			l, size := binary.Uvarint(msg)
+			if size <= 0 || uint64(len(msg)-size) < l {
+				return 0, errors.New("truncated field")
+			}
+			msg = msg[size+int(l):]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return 0, errors.New("truncated field")
+			}
+			msg = msg[4:]
+		default:
+			return 0, fmt.Errorf("unsupported wire type %d", wireType)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// grpcHealthStub answers grpc.health.v1.Health/Check over h2c with the status set for
+// the requested service; services missing from statuses get UNIMPLEMENTED.
+type grpcHealthStub struct {
+	*httptest.Server
+	statuses map[string]uint64
+
+	mu       sync.Mutex
+	requests []*http.Request
+	services []string
+}
+
+func newGRPCHealthStub(t *testing.T, statuses map[string]uint64) *grpcHealthStub {
+	t.Helper()
+	s := &grpcHealthStub{statuses: statuses}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	s.Config.Protocols = new(http.Protocols)
+	s.Config.Protocols.SetUnencryptedHTTP2(true)
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *grpcHealthStub) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	service := ""
+	// A framed HealthCheckRequest: the service, when set, is field 1
+	if len(body) > 7 && body[5] == 1<<3|2 {
+		service = string(body[7 : 7+body[6]])
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	s.services = append(s.services, service)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/grpc")
+	status, ok := s.statuses[service]
+	if !ok {
+		// Trailers-only response, as servers without the health service send
+		w.Header().Set("Grpc-Status", "12")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Trailer", "Grpc-Status")
+	w.WriteHeader(http.StatusOK)
+	w.Write(grpcFrame(binary.AppendUvarint([]byte{1 << 3}, status)))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func TestGRPCMonitorAgainstStub(t *testing.T) {
+	stub := newGRPCHealthStub(t, map[string]uint64{"": 1, "orders.v1.Orders": 2})
+	addr := strings.TrimPrefix(stub.URL, "http://")
+
+	tests := []struct {
+		name       string
+		cfg        GRPCMonitorConfig
+		wantStatus string
+		wantError  string
+	}{
+		{"server serving", GRPCMonitorConfig{Metadata: map[string]string{"authorization": "Bearer t0ken"}}, "up", ""},
+		{"service not serving", GRPCMonitorConfig{Service: "orders.v1.Orders"}, "down", `service "orders.v1.Orders" is NOT_SERVING`},
+		{"health service unimplemented", GRPCMonitorConfig{Service: "billing.v1.Billing"}, "down",
+			"UNIMPLEMENTED: server doesn't implement grpc.health.v1.Health"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if err := cfg.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			status, code, errMsg, timings := checkGRPC(&Monitor{URL: addr, GRPC: &cfg}, 2*time.Second)
+			if status != tt.wantStatus || errMsg != tt.wantError {
+				t.Fatalf("checkGRPC = %s %q, want %s %q", status, errMsg, tt.wantStatus, tt.wantError)
+			}
+			if code != http.StatusOK || timings == nil {
+				t.Errorf("status code %d, timings %v", code, timings)
+			}
+
+			stub.mu.Lock()
+			defer stub.mu.Unlock()
+			if len(stub.requests) != i+1 {
+				t.Fatalf("stub received %d requests", len(stub.requests))
+			}
+			req := stub.requests[i]
+			if req.ProtoMajor != 2 || req.URL.Path != grpcHealthCheckPath || req.Header.Get("Te") != "trailers" {
+				t.Errorf("request = HTTP/%d %s, TE %q", req.ProtoMajor, req.URL.Path, req.Header.Get("Te"))
+			}
+			if stub.services[i] != cfg.Service {
+				t.Errorf("service = %q, want %q", stub.services[i], cfg.Service)
+			}
+			for k, v := range cfg.Metadata {
+				if req.Header.Get(k) != v {
+					t.Errorf("metadata %s = %q", k, req.Header.Get(k))
+				}
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -90,7 +91,7 @@ type EnvelopeHeader struct {
 
 type ItemHeader struct {
 	Type        string `json:"type"`
-	Length      int    `json:"length"`
+	Length      *int   `json:"length"` // nil when the item ends at the next newline
 	ContentType string `json:"content_type"`
 }
 
@@ -284,7 +285,7 @@ func storeError(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 			http.Error(w, "Failed to store error", http.StatusInternalServerError)
 			return
 		}
-		triggerNotificationsThrottled(db, project, event)
+		go evaluateAlertRules(db, project, event)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -322,6 +323,8 @@ func createProject(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	recordAudit(db, r, "project.create", "project", project.ID, nil, project)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(project)
@@ -920,7 +923,7 @@ func storeErrorSentry(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 			http.Error(w, "Failed to store error", http.StatusInternalServerError)
 			return
 		}
-		triggerNotificationsThrottled(db, project, event)
+		go evaluateAlertRules(db, project, event)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1074,19 +1077,30 @@ func handleEnvelopeSentry(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 			continue
 		}
 
-		// Read payload based on length
-		payload := make([]byte, itemHeader.Length)
-		n, err := reader.Read(payload)
-		if err != nil || n < itemHeader.Length {
-			log.Printf("[DSN Debug] Failed to read payload of length %d. Read %d bytes. Error: %v", itemHeader.Length, n, err)
-			break
-		}
+		// Read payload based on length; items without one end at the next newline.
+		// An explicit length of 0 is an empty payload, not a missing length.
+		var payload []byte
+		if itemHeader.Length == nil {
+			payload, _ = readEnvelopeLine(reader)
+		} else {
+			length := *itemHeader.Length
+			if length < 0 {
+				log.Printf("[DSN Debug] Invalid item length %d", length)
+				break
+			}
+			payload = make([]byte, length)
+			n, err := reader.Read(payload)
+			if length > 0 && (err != nil || n < length) {
+				log.Printf("[DSN Debug] Failed to read payload of length %d. Read %d bytes. Error: %v", length, n, err)
+				break
+			}
 
-		// Skip possible trailing \n after payload
-		if reader.Len() > 0 {
-			b, _ := reader.ReadByte()
-			if b != '\n' {
-				reader.UnreadByte()
+			// Skip possible trailing \n after payload
+			if reader.Len() > 0 {
+				b, _ := reader.ReadByte()
+				if b != '\n' {
+					reader.UnreadByte()
+				}
 			}
 		}
 
@@ -1192,11 +1206,17 @@ func handleEnvelopeSentry(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 						log.Printf("[DSN Debug] Failed to insert error from transaction: %v", err)
 					} else {
 						log.Printf("[DSN Debug] Successfully stored error from transaction %s", tx.EventID)
-						triggerNotificationsThrottled(db, project, errorEvent)
+						go evaluateAlertRules(db, project, errorEvent)
 					}
 				}
 			}
 
+		} else if itemHeader.Type == "check_in" {
+			processSentryCheckIn(db, projectID, payload)
+		} else if itemHeader.Type == "session" {
+			processSentrySession(db, projectID, payload)
+		} else if itemHeader.Type == "sessions" {
+			processSentrySessions(db, projectID, payload)
 		} else if itemHeader.Type == "event" {
 			var evt SentryEvent
 			if err := json.Unmarshal(payload, &evt); err != nil {
@@ -1258,7 +1278,7 @@ func handleEnvelopeSentry(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 					log.Printf("[DSN Debug] Failed to insert error event: %v", err)
 				} else {
 					log.Printf("[DSN Debug] Successfully stored error event %s", evt.EventID)
-					triggerNotificationsThrottled(db, project, errorEvent)
+					go evaluateAlertRules(db, project, errorEvent)
 				}
 			}
 		}
@@ -1368,6 +1388,8 @@ func deleteProject(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	before, _ := GetProject(db, id)
+
 	err := DeleteProject(db, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1378,6 +1400,8 @@ func deleteProject(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	recordAudit(db, r, "project.delete", "project", id, before, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1388,6 +1412,8 @@ func updateErrorStatus(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 
 	var req struct {
 		Status string `json:"status"`
+		// Release the issue is resolved in; defaults to the project's latest
+		Release string `json:"release"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -1399,7 +1425,7 @@ func updateErrorStatus(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	err := UpdateErrorStatus(db, id, req.Status)
+	event, err := GetError(db, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Error not found", http.StatusNotFound)
@@ -1408,6 +1434,31 @@ func updateErrorStatus(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		}
 		return
 	}
+	if req.Release != "" {
+		if req.Status != "resolved" {
+			http.Error(w, "A release can only be given when resolving", http.StatusBadRequest)
+			return
+		}
+		if _, err := GetRelease(db, event.ProjectID, req.Release); err != nil {
+			http.Error(w, "Release not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = UpdateErrorStatus(db, event.ID, req.Status)
+	if err != nil {
+		http.Error(w, "Failed to update error status", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordIssueResolution(db, event, req.Status, req.Release); err != nil {
+		log.Printf("Failed to attribute issue %s to a release: %v", event.Fingerprint, err)
+	}
+
+	// Close any PagerDuty incidents or Opsgenie alerts opened for this issue
+	if req.Status == "resolved" && event.Fingerprint != "" {
+		go resolveIntegrationAlerts(db, event.ProjectID, event.Fingerprint)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1438,6 +1489,8 @@ func updateProjectQuota(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	before, _ := GetProject(db, id)
+
 	res, err := db.Exec("UPDATE projects SET max_events_per_month = ? WHERE id = ?", quota, id)
 	if err != nil {
 		http.Error(w, "Failed to update project quota", http.StatusInternalServerError)
@@ -1457,6 +1510,8 @@ func updateProjectQuota(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	recordAudit(db, r, "project.update_quota", "project", id, before, project)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(project)
 }
@@ -1486,6 +1541,12 @@ func updateSettings(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	current, _ := GetAllSettings(db)
+	before := make(map[string]string, len(req))
+	for k := range req {
+		before[k] = current[k]
+	}
+
 	for k, v := range req {
 		if err := UpdateSetting(db, k, v); err != nil {
 			http.Error(w, "Failed to update setting: "+k, http.StatusInternalServerError)
@@ -1493,6 +1554,8 @@ func updateSettings(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		}
 	}
 
+	recordAudit(db, r, "settings.update", "settings", "global", before, req)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1515,6 +1578,12 @@ func runCleanup(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	rowsAffected, _ := result.RowsAffected()
 	log.Printf("System cleanup: Deleted %d old errors (older than %d days)", rowsAffected, retentionDays)
 
+	recordAudit(db, r, "system.cleanup", "system", "errors", nil, map[string]interface{}{
+		"deleted":        rowsAffected,
+		"retention_days": retentionDays,
+		"cutoff":         cutoff,
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"deleted": rowsAffected,
@@ -1674,164 +1743,14 @@ func getCoverageBadge(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 </svg>`, color, coverageText, coverageText)
 }
 
-// triggerNotificationsThrottled checks if notification should be sent based on rate limiting
-func triggerNotificationsThrottled(db *sql.DB, project *Project, event *ErrorEvent) {
-	// Get project-specific notification settings
-	projectSettings, err := GetProjectSettings(db, project.ID)
-	if err != nil {
-		log.Printf("Failed to get project settings for notifications: %v", err)
-		// Continue with default settings
-		projectSettings = &ProjectSettings{
-			NotificationEnabled:   true,
-			NotificationLevels:    "error,fatal",
-			NotificationRateLimit: 60, // Default 60 minutes
-		}
-	}
-
-	// Check if notifications are enabled for this project
-	if !projectSettings.NotificationEnabled {
-		return
-	}
-
-	// Check if the error level should trigger notifications
-	if projectSettings.NotificationLevels != "" {
-		levels := strings.Split(projectSettings.NotificationLevels, ",")
-		shouldNotify := false
-		for _, level := range levels {
-			if strings.TrimSpace(level) == event.Level {
-				shouldNotify = true
-				break
-			}
-		}
-		if !shouldNotify {
-			log.Printf("[Notification] Skipping notification for level %s (not in configured levels: %s)", event.Level, projectSettings.NotificationLevels)
-			return
-		}
-	}
-
-	// Check rate limiting using project settings
-	cacheKey := fmt.Sprintf("%s:%s", project.ID, event.Message)
-	now := time.Now()
-
-	notificationCache.mu.Lock()
-	lastNotification, exists := notificationCache.lastNotifications[cacheKey]
-	rateLimit := time.Duration(projectSettings.NotificationRateLimit) * time.Minute
-
-	if exists && now.Sub(lastNotification) < rateLimit {
-		notificationCache.mu.Unlock()
-		log.Printf("[Notification] Suppressed duplicate notification for error '%s' in project '%s' (last sent %v ago, rate limit: %v)",
-			event.Message, project.Name, now.Sub(lastNotification).Round(time.Minute), rateLimit)
-		return
-	}
-
-	// Update cache with current time
-	notificationCache.lastNotifications[cacheKey] = now
-	notificationCache.mu.Unlock()
-
-	// Clean up old cache entries periodically (every 100 notifications)
-	if len(notificationCache.lastNotifications)%100 == 0 {
-		go cleanNotificationCache(rateLimit * 2)
-	}
-
-	// Get event count for this error
-	var eventCount int
-	db.QueryRow("SELECT COUNT(*) FROM errors WHERE message = ? AND project_id = ?", event.Message, project.ID).Scan(&eventCount)
-
-	log.Printf("[Notification] Sending notification for error '%s' in project '%s' (occurrence #%d)",
-		event.Message, project.Name, eventCount)
-
-	// Trigger actual notifications
-	triggerNotifications(db, project, event, eventCount, projectSettings)
-}
-
-// cleanNotificationCache removes old entries from the notification cache
-func cleanNotificationCache(olderThan time.Duration) {
-	notificationCache.mu.Lock()
-	defer notificationCache.mu.Unlock()
-
-	now := time.Now()
-	for key, lastTime := range notificationCache.lastNotifications {
-		if now.Sub(lastTime) > olderThan {
-			delete(notificationCache.lastNotifications, key)
-		}
-	}
-	log.Printf("[Notification] Cleaned notification cache, current size: %d", len(notificationCache.lastNotifications))
-}
-
-func triggerNotifications(db *sql.DB, project *Project, event *ErrorEvent, eventCount int, projectSettings *ProjectSettings) {
-	settings, err := GetAllSettings(db)
-	if err != nil {
-		return
-	}
-
-	// Build notification message with context
-	occurrenceText := ""
-	if eventCount > 1 {
-		occurrenceText = fmt.Sprintf(" (occurred %d times)", eventCount)
-	}
-
-	// Slack Notification
-	if webhook, ok := settings["slack_webhook"]; ok && webhook != "" {
-		go func() {
-			payload := map[string]interface{}{
-				"text": fmt.Sprintf("*Pulse Alert:* New %s error in project *%s*%s\n> %s",
-					event.Level, project.Name, occurrenceText, event.Message),
-			}
-			body, _ := json.Marshal(payload)
-			resp, err := http.Post(webhook, "application/json", bytes.NewBuffer(body))
-			if err != nil {
-				log.Printf("Failed to send Slack notification: %v", err)
-			} else {
-				resp.Body.Close()
-			}
-		}()
-	}
-
-	// Project-specific webhook
-	if projectSettings.NotificationWebhookURL != "" {
-		go func() {
-			payload := map[string]interface{}{
-				"event":       event,
-				"project":     project,
-				"event_count": eventCount,
-				"timestamp":   time.Now(),
-			}
-			body, _ := json.Marshal(payload)
-			resp, err := http.Post(projectSettings.NotificationWebhookURL, "application/json", bytes.NewBuffer(body))
-			if err != nil {
-				log.Printf("Failed to send project webhook notification: %v", err)
-			} else {
-				resp.Body.Close()
-			}
-		}()
-	}
-
-	// Generic Webhook
-	if webhook, ok := settings["generic_webhook"]; ok && webhook != "" {
-		go func() {
-			payload := map[string]interface{}{
-				"event":       event,
-				"project":     project,
-				"event_count": eventCount,
-				"timestamp":   time.Now(),
-			}
-			body, _ := json.Marshal(payload)
-			resp, err := http.Post(webhook, "application/json", bytes.NewBuffer(body))
-			if err != nil {
-				log.Printf("Failed to send generic webhook: %v", err)
-			} else {
-				resp.Body.Close()
-			}
-		}()
-	}
-}
-
 // Security Vault Handlers
 
 func rotateProjectAPIKey(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	vars := mux.Vars(r)
 	projectID := vars["id"]
 
+	before, _ := GetProject(db, projectID)
+
 	newKey, err := RotateAPIKey(db, projectID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1842,6 +1761,12 @@ func rotateProjectAPIKey(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	var beforeKey map[string]string
+	if before != nil {
+		beforeKey = map[string]string{"api_key": before.APIKey}
+	}
+	recordAudit(db, r, "project.rotate_key", "project", projectID, beforeKey, map[string]string{"api_key": newKey})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"api_key": newKey})
 }
@@ -1885,11 +1810,15 @@ func updateSecurityPolicies(w http.ResponseWriter, r *http.Request, db *sql.DB)
 	}
 	policy.ProjectID = projectID
 
+	before, _ := GetSecurityPolicy(db, projectID)
+
 	if err := UpdateSecurityPolicy(db, &policy); err != nil {
 		http.Error(w, "Failed to update security policies", http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(db, r, "security_policy.update", "project", projectID, before, &policy)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1952,11 +1881,17 @@ func enableMFA(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	recordAudit(db, r, "user.mfa_enable", "user", claims.UserID,
+		map[string]bool{"mfa_enabled": false}, map[string]bool{"mfa_enabled": true})
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // Uptime Monitoring Handlers
 
+var validMonitorTypes = map[string]bool{"http": true, "https": true, "tcp": true, "icmp": true, "dns": true, "ssl": true, "heartbeat": true,
+	"postgres": true, "mysql": true, "redis": true, "grpc": true, "websocket": true, "multistep": true}
+
 func getProjectMonitors(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	vars := mux.Vars(r)
 	projectID := vars["id"]
@@ -1972,6 +1907,9 @@ func getProjectMonitors(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	if monitors == nil {
 		monitors = []Monitor{}
 	}
+	for i := range monitors {
+		monitors[i] = monitors[i].masked()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(monitors)
@@ -1987,27 +1925,57 @@ func createMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		URL      string `json:"url"`
 		Interval int    `json:"interval"`
 		Timeout  int    `json:"timeout"`
+
+		FailureThreshold int `json:"failure_threshold"`
+		RealertMinutes   int `json:"realert_minutes"`
+
+		Retries              int `json:"retries"`
+		RetryInterval        int `json:"retry_interval"`
+		DegradedResponseTime int `json:"degraded_response_time"`
+
+		PingCount           int     `json:"ping_count"`
+		PacketLossThreshold float64 `json:"packet_loss_threshold"`
+
+		HTTP *HTTPMonitorConfig `json:"http"`
+
+		SSLAlertDays []int `json:"ssl_alert_days"`
+
+		DNS *DNSMonitorConfig `json:"dns"`
+
+		Heartbeat *HeartbeatConfig `json:"heartbeat"`
+
+		Connection *ConnectionMonitorConfig `json:"connection"`
+
+		GRPC *GRPCMonitorConfig `json:"grpc"`
+
+		WebSocket *WebSocketMonitorConfig `json:"websocket"`
+
+		MultiStep *MultiStepMonitorConfig `json:"multistep"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Name == "" || req.URL == "" {
-		http.Error(w, "Name and URL/target are required", http.StatusBadRequest)
-		return
-	}
 	if req.Type == "" {
 		req.Type = "http"
 	}
+	// Heartbeats are pushed to, so they have no target
+	isHeartbeat := strings.ToLower(req.Type) == "heartbeat"
+	if req.Name == "" || (req.URL == "" && !isHeartbeat) {
+		http.Error(w, "Name and URL/target are required", http.StatusBadRequest)
+		return
+	}
 	// Validate monitor type
-	validTypes := map[string]bool{"http": true, "https": true, "tcp": true, "icmp": true, "dns": true}
-	if !validTypes[strings.ToLower(req.Type)] {
-		http.Error(w, "Invalid monitor type. Supported: http, https, tcp, icmp, dns", http.StatusBadRequest)
+	if !validMonitorTypes[strings.ToLower(req.Type)] {
+		http.Error(w, "Invalid monitor type. Supported: http, https, tcp, icmp, dns, ssl, heartbeat, postgres, mysql, redis, grpc, websocket, multistep", http.StatusBadRequest)
 		return
 	}
-	if req.Interval < 60 {
-		req.Interval = 60 // Minimum 1 minute
+	if req.Interval <= 0 {
+		req.Interval = 60 // Default 1 minute
+	}
+	if req.Interval < minMonitorInterval {
+		req.Interval = minMonitorInterval
 	}
 	if req.Timeout < 5 {
 		req.Timeout = 30 // Default timeout 30 seconds
@@ -2015,6 +1983,123 @@ func createMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	if req.Timeout > 300 {
 		req.Timeout = 300 // Maximum timeout 5 minutes
 	}
+	if req.FailureThreshold <= 0 {
+		req.FailureThreshold = 2 // Don't page on a single blip
+		if isHeartbeat {
+			req.FailureThreshold = 1 // A missed run isn't a blip
+		}
+	}
+	if req.FailureThreshold > 20 {
+		req.FailureThreshold = 20
+	}
+	if req.RealertMinutes < 0 {
+		req.RealertMinutes = 0
+	}
+	if req.Retries < 0 {
+		req.Retries = 0
+	}
+	if req.Retries > maxRetries {
+		req.Retries = maxRetries
+	}
+	if req.RetryInterval <= 0 {
+		req.RetryInterval = defaultRetryInterval
+	}
+	if req.RetryInterval > maxRetryInterval {
+		req.RetryInterval = maxRetryInterval
+	}
+	if req.DegradedResponseTime < 0 {
+		req.DegradedResponseTime = 0
+	}
+	if req.PingCount <= 0 {
+		req.PingCount = defaultPingCount
+	}
+	if req.PingCount > maxPingCount {
+		req.PingCount = maxPingCount
+	}
+	if req.PacketLossThreshold <= 0 || req.PacketLossThreshold > 100 {
+		req.PacketLossThreshold = 100 // Down only when every probe is lost
+	}
+	if req.HTTP != nil {
+		if err := req.HTTP.validate(); err != nil {
+			http.Error(w, "Invalid http options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	sslAlertDays, err := normalizeSSLAlertDays(req.SSLAlertDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DNS != nil {
+		if err := req.DNS.validate(); err != nil {
+			http.Error(w, "Invalid dns options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if isConnectionMonitor(strings.ToLower(req.Type)) {
+		if req.Connection == nil {
+			req.Connection = &ConnectionMonitorConfig{}
+		}
+		if err := req.Connection.validate(strings.ToLower(req.Type)); err != nil {
+			http.Error(w, "Invalid connection options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.Connection = nil
+	}
+	if strings.ToLower(req.Type) == "grpc" && req.GRPC != nil {
+		if err := req.GRPC.validate(); err != nil {
+			http.Error(w, "Invalid grpc options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.GRPC = nil
+	}
+	if strings.ToLower(req.Type) == "websocket" {
+		if _, err := websocketHTTPURL(req.URL); err != nil {
+			http.Error(w, "Invalid WebSocket URL: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.WebSocket != nil {
+			if err := req.WebSocket.validate(); err != nil {
+				http.Error(w, "Invalid websocket options: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	} else {
+		req.WebSocket = nil
+	}
+	if strings.ToLower(req.Type) == "multistep" {
+		if req.MultiStep == nil {
+			http.Error(w, "Multi-step monitors need steps", http.StatusBadRequest)
+			return
+		}
+		if err := req.MultiStep.validate(); err != nil {
+			http.Error(w, "Invalid multistep options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.MultiStep = nil
+	}
+	heartbeatToken := ""
+	if isHeartbeat {
+		if req.Heartbeat == nil {
+			req.Heartbeat = &HeartbeatConfig{}
+		}
+		if err := req.Heartbeat.validate(); err != nil {
+			http.Error(w, "Invalid heartbeat options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Heartbeat.Slug != "" {
+			if _, err := getMonitorByHeartbeatSlug(db, projectID, req.Heartbeat.Slug); err == nil {
+				http.Error(w, "A heartbeat monitor with this slug already exists", http.StatusConflict)
+				return
+			}
+		}
+		heartbeatToken = generateHeartbeatToken()
+	} else {
+		req.Heartbeat = nil
+	}
 
 	monitor := &Monitor{
 		ID:        uuid.New().String(),
@@ -2026,6 +2111,25 @@ func createMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		Timeout:   req.Timeout,
 		Status:    "up", // Default status, will be updated by check
 		CreatedAt: time.Now(),
+
+		FailureThreshold: req.FailureThreshold,
+		RealertMinutes:   req.RealertMinutes,
+
+		Retries:              req.Retries,
+		RetryInterval:        req.RetryInterval,
+		DegradedResponseTime: req.DegradedResponseTime,
+
+		PingCount:           req.PingCount,
+		PacketLossThreshold: req.PacketLossThreshold,
+		HTTP:                req.HTTP,
+		SSLAlertDays:        sslAlertDays,
+		DNS:                 req.DNS,
+		Heartbeat:           req.Heartbeat,
+		HeartbeatToken:      heartbeatToken,
+		Connection:          req.Connection,
+		GRPC:                req.GRPC,
+		WebSocket:           req.WebSocket,
+		MultiStep:           req.MultiStep,
 	}
 
 	if err := CreateMonitor(db, monitor); err != nil {
@@ -2033,9 +2137,10 @@ func createMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "Failed to create monitor", http.StatusInternalServerError)
 		return
 	}
+	scheduleMonitor(monitor)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(monitor)
+	json.NewEncoder(w).Encode(monitor.masked())
 }
 
 func updateMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
@@ -2049,53 +2154,300 @@ func updateMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		Interval int    `json:"interval"`
 		Timeout  int    `json:"timeout"`
 		Status   string `json:"status"`
+
+		FailureThreshold *int `json:"failure_threshold"`
+		RealertMinutes   *int `json:"realert_minutes"`
+
+		Retries              *int `json:"retries"`
+		RetryInterval        *int `json:"retry_interval"`
+		DegradedResponseTime *int `json:"degraded_response_time"`
+
+		PingCount           *int     `json:"ping_count"`
+		PacketLossThreshold *float64 `json:"packet_loss_threshold"`
+
+		// HTTP replaces the request options and assertions; null clears them
+		HTTP json.RawMessage `json:"http"`
+
+		SSLAlertDays []int `json:"ssl_alert_days"`
+
+		// DNS replaces the record type, resolver and expected values; null clears them
+		DNS json.RawMessage `json:"dns"`
+
+		// Heartbeat replaces the schedule of heartbeat monitors
+		Heartbeat *HeartbeatConfig `json:"heartbeat"`
+
+		// Connection replaces the credentials of postgres, mysql and redis monitors
+		Connection *ConnectionMonitorConfig `json:"connection"`
+
+		// GRPC replaces the service and transport of gRPC monitors; null clears them
+		GRPC json.RawMessage `json:"grpc"`
+
+		// WebSocket replaces the headers, message and assertions; null clears them
+		WebSocket json.RawMessage `json:"websocket"`
+
+		// MultiStep replaces the steps and secrets of multi-step monitors
+		MultiStep *MultiStepMonitorConfig `json:"multistep"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Build update query dynamically based on provided fields
+	existing, err := GetMonitor(db, monitorID)
+	if err == sql.ErrNoRows || err == nil && existing.ProjectID != vars["id"] {
+		http.Error(w, "Monitor not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching monitor: %v", err)
+		http.Error(w, "Failed to update monitor", http.StatusInternalServerError)
+		return
+	}
+
+	// The request is merged into a copy of the monitor, which is validated as a whole
+	// before the changed columns are written
+	m := *existing
 	updates := []string{}
 	args := []interface{}{}
 
 	if req.Name != "" {
+		m.Name = req.Name
 		updates = append(updates, "name = ?")
-		args = append(args, req.Name)
+		args = append(args, m.Name)
 	}
 	if req.Type != "" {
-		validTypes := map[string]bool{"http": true, "https": true, "tcp": true, "icmp": true, "dns": true}
-		if !validTypes[strings.ToLower(req.Type)] {
-			http.Error(w, "Invalid monitor type. Supported: http, https, tcp, icmp, dns", http.StatusBadRequest)
+		m.Type = strings.ToLower(req.Type)
+		if !validMonitorTypes[m.Type] {
+			http.Error(w, "Invalid monitor type. Supported: http, https, tcp, icmp, dns, ssl, heartbeat, postgres, mysql, redis, grpc, websocket, multistep", http.StatusBadRequest)
 			return
 		}
 		updates = append(updates, "type = ?")
-		args = append(args, strings.ToLower(req.Type))
+		args = append(args, m.Type)
 	}
 	if req.URL != "" {
+		m.URL = req.URL
 		updates = append(updates, "url = ?")
-		args = append(args, req.URL)
+		args = append(args, m.URL)
 	}
 	if req.Interval > 0 {
-		if req.Interval < 60 {
-			req.Interval = 60
-		}
+		m.Interval = max(req.Interval, minMonitorInterval)
 		updates = append(updates, "interval = ?")
-		args = append(args, req.Interval)
+		args = append(args, m.Interval)
 	}
 	if req.Timeout > 0 {
-		if req.Timeout < 5 {
-			req.Timeout = 30
+		m.Timeout = req.Timeout
+		if m.Timeout < 5 {
+			m.Timeout = 30
 		}
-		if req.Timeout > 300 {
-			req.Timeout = 300
+		if m.Timeout > 300 {
+			m.Timeout = 300
 		}
 		updates = append(updates, "timeout = ?")
-		args = append(args, req.Timeout)
+		args = append(args, m.Timeout)
 	}
 	if req.Status != "" {
+		m.Status = req.Status
 		updates = append(updates, "status = ?")
-		args = append(args, req.Status)
+		args = append(args, m.Status)
+		if m.Status != "paused" {
+			// Resumed heartbeats expect runs from now rather than counting the pause as missed
+			m.NextCheckInAt = nil
+			updates = append(updates, "next_checkin_at = NULL")
+		}
+	}
+	if req.FailureThreshold != nil {
+		if *req.FailureThreshold < 1 || *req.FailureThreshold > 20 {
+			http.Error(w, "failure_threshold must be between 1 and 20", http.StatusBadRequest)
+			return
+		}
+		m.FailureThreshold = *req.FailureThreshold
+		updates = append(updates, "failure_threshold = ?")
+		args = append(args, m.FailureThreshold)
+	}
+	if req.RealertMinutes != nil {
+		if *req.RealertMinutes < 0 {
+			http.Error(w, "realert_minutes must be non-negative", http.StatusBadRequest)
+			return
+		}
+		m.RealertMinutes = *req.RealertMinutes
+		updates = append(updates, "realert_minutes = ?")
+		args = append(args, m.RealertMinutes)
+	}
+	if req.Retries != nil {
+		if *req.Retries < 0 || *req.Retries > maxRetries {
+			http.Error(w, fmt.Sprintf("retries must be between 0 and %d", maxRetries), http.StatusBadRequest)
+			return
+		}
+		m.Retries = *req.Retries
+		updates = append(updates, "retries = ?")
+		args = append(args, m.Retries)
+	}
+	if req.RetryInterval != nil {
+		if *req.RetryInterval < 1 || *req.RetryInterval > maxRetryInterval {
+			http.Error(w, fmt.Sprintf("retry_interval must be between 1 and %d seconds", maxRetryInterval), http.StatusBadRequest)
+			return
+		}
+		m.RetryInterval = *req.RetryInterval
+		updates = append(updates, "retry_interval = ?")
+		args = append(args, m.RetryInterval)
+	}
+	if req.DegradedResponseTime != nil {
+		if *req.DegradedResponseTime < 0 {
+			http.Error(w, "degraded_response_time must be non-negative", http.StatusBadRequest)
+			return
+		}
+		m.DegradedResponseTime = *req.DegradedResponseTime
+		updates = append(updates, "degraded_response_time = ?")
+		args = append(args, m.DegradedResponseTime)
+	}
+	if req.PingCount != nil {
+		if *req.PingCount < 1 || *req.PingCount > maxPingCount {
+			http.Error(w, fmt.Sprintf("ping_count must be between 1 and %d", maxPingCount), http.StatusBadRequest)
+			return
+		}
+		m.PingCount = *req.PingCount
+		updates = append(updates, "ping_count = ?")
+		args = append(args, m.PingCount)
+	}
+	if req.PacketLossThreshold != nil {
+		if *req.PacketLossThreshold <= 0 || *req.PacketLossThreshold > 100 {
+			http.Error(w, "packet_loss_threshold must be greater than 0 and at most 100", http.StatusBadRequest)
+			return
+		}
+		m.PacketLossThreshold = *req.PacketLossThreshold
+		updates = append(updates, "packet_loss_threshold = ?")
+		args = append(args, m.PacketLossThreshold)
+	}
+	if req.SSLAlertDays != nil {
+		days, err := normalizeSSLAlertDays(req.SSLAlertDays)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.SSLAlertDays = days
+		updates = append(updates, "ssl_alert_days = ?")
+		args = append(args, formatSSLAlertDays(days))
+	}
+
+	// Options replace the monitor's, keeping the secrets that come back masked
+	if len(req.HTTP) > 0 {
+		m.HTTP = nil
+		if err := json.Unmarshal(req.HTTP, &m.HTTP); err != nil {
+			http.Error(w, "Invalid http options", http.StatusBadRequest)
+			return
+		}
+		if m.HTTP != nil {
+			m.HTTP.keepMaskedSecrets(existing.HTTP)
+		}
+	}
+	if len(req.DNS) > 0 {
+		m.DNS = nil
+		if err := json.Unmarshal(req.DNS, &m.DNS); err != nil {
+			http.Error(w, "Invalid dns options", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Connection != nil {
+		req.Connection.keepMaskedSecrets(existing.Connection)
+		m.Connection = req.Connection
+	}
+	if len(req.GRPC) > 0 {
+		m.GRPC = nil
+		if err := json.Unmarshal(req.GRPC, &m.GRPC); err != nil {
+			http.Error(w, "Invalid grpc options", http.StatusBadRequest)
+			return
+		}
+		if m.GRPC != nil {
+			m.GRPC.keepMaskedSecrets(existing.GRPC)
+		}
+	}
+	if len(req.WebSocket) > 0 {
+		m.WebSocket = nil
+		if err := json.Unmarshal(req.WebSocket, &m.WebSocket); err != nil {
+			http.Error(w, "Invalid websocket options", http.StatusBadRequest)
+			return
+		}
+		if m.WebSocket != nil {
+			m.WebSocket.keepMaskedSecrets(existing.WebSocket)
+		}
+	}
+	if req.MultiStep != nil {
+		req.MultiStep.keepMaskedSecrets(existing.MultiStep)
+		m.MultiStep = req.MultiStep
+	}
+	if req.Heartbeat != nil {
+		m.Heartbeat = req.Heartbeat
+	}
+
+	if status, message := validateMergedMonitor(db, &m); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	if len(req.HTTP) > 0 {
+		sealed, err := m.HTTP.sealed()
+		if err != nil {
+			log.Printf("Error sealing monitor credentials: %v", err)
+			http.Error(w, "Failed to update monitor", http.StatusInternalServerError)
+			return
+		}
+		updates = append(updates, "http_config = ?")
+		args = append(args, encodeJSONColumn(sealed))
+	}
+	if len(req.DNS) > 0 {
+		updates = append(updates, "dns_config = ?")
+		args = append(args, encodeJSONColumn(m.DNS))
+	}
+	if req.Connection != nil {
+		connection, err := m.Connection.sealed()
+		if err != nil {
+			log.Printf("Error sealing monitor credentials: %v", err)
+			http.Error(w, "Failed to update monitor", http.StatusInternalServerError)
+			return
+		}
+		updates = append(updates, "connection_config = ?")
+		args = append(args, encodeJSONColumn(connection))
+	}
+	if len(req.GRPC) > 0 {
+		sealed, err := m.GRPC.sealed()
+		if err != nil {
+			log.Printf("Error sealing monitor credentials: %v", err)
+			http.Error(w, "Failed to update monitor", http.StatusInternalServerError)
+			return
+		}
+		updates = append(updates, "grpc_config = ?")
+		args = append(args, encodeJSONColumn(sealed))
+	}
+	if len(req.WebSocket) > 0 {
+		sealed, err := m.WebSocket.sealed()
+		if err != nil {
+			log.Printf("Error sealing monitor credentials: %v", err)
+			http.Error(w, "Failed to update monitor", http.StatusInternalServerError)
+			return
+		}
+		updates = append(updates, "websocket_config = ?")
+		args = append(args, encodeJSONColumn(sealed))
+	}
+	if req.MultiStep != nil {
+		multiStep, err := m.MultiStep.sealed()
+		if err != nil {
+			log.Printf("Error sealing monitor secrets: %v", err)
+			http.Error(w, "Failed to update monitor", http.StatusInternalServerError)
+			return
+		}
+		updates = append(updates, "multistep_config = ?")
+		args = append(args, encodeJSONColumn(multiStep))
+	}
+	if req.Heartbeat != nil {
+		m.NextCheckInAt = nil
+		updates = append(updates, "heartbeat_config = ?", "heartbeat_slug = ?", "next_checkin_at = NULL")
+		args = append(args, encodeJSONColumn(m.Heartbeat), m.Heartbeat.Slug)
+		if m.HeartbeatToken == "" {
+			// Monitors switched to heartbeat get their ping URL now
+			m.HeartbeatToken = generateHeartbeatToken()
+			updates = append(updates, "heartbeat_token = ?")
+			args = append(args, m.HeartbeatToken)
+		}
 	}
 
 	if len(updates) == 0 {
@@ -2105,35 +2457,75 @@ func updateMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 
 	args = append(args, monitorID)
 	query := "UPDATE monitors SET " + strings.Join(updates, ", ") + " WHERE id = ?"
-	_, err := db.Exec(query, args...)
-	if err != nil {
+	if _, err := db.Exec(query, args...); err != nil {
 		log.Printf("Error updating monitor: %v", err)
 		http.Error(w, "Failed to update monitor", http.StatusInternalServerError)
 		return
 	}
+	scheduleMonitor(&m)
 
-	// Fetch updated monitor
-	var m Monitor
-	var lastChecked sql.NullTime
-	var timeout sql.NullInt64
-	err = db.QueryRow("SELECT id, project_id, name, type, url, interval, timeout, status, last_checked_at, created_at FROM monitors WHERE id = ?", monitorID).
-		Scan(&m.ID, &m.ProjectID, &m.Name, &m.Type, &m.URL, &m.Interval, &timeout, &m.Status, &lastChecked, &m.CreatedAt)
-	if err != nil {
-		log.Printf("Error fetching updated monitor: %v", err)
-		http.Error(w, "Failed to fetch updated monitor", http.StatusInternalServerError)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.masked())
+}
+
+// validateMergedMonitor checks a monitor with an update merged in, as createMonitor
+// checks a new one. It returns the status and message to reject it with, or 0.
+func validateMergedMonitor(db *sql.DB, m *Monitor) (status int, message string) {
+	if m.HTTP != nil {
+		if err := m.HTTP.validate(); err != nil {
+			return http.StatusBadRequest, "Invalid http options: " + err.Error()
+		}
 	}
-	if lastChecked.Valid {
-		m.LastCheckedAt = &lastChecked.Time
+	if m.DNS != nil {
+		if err := m.DNS.validate(); err != nil {
+			return http.StatusBadRequest, "Invalid dns options: " + err.Error()
+		}
 	}
-	if timeout.Valid {
-		m.Timeout = int(timeout.Int64)
-	} else {
-		m.Timeout = 30
+	if isConnectionMonitor(m.Type) {
+		if m.Connection == nil {
+			m.Connection = &ConnectionMonitorConfig{}
+		}
+		if err := m.Connection.validate(m.Type); err != nil {
+			return http.StatusBadRequest, "Invalid connection options: " + err.Error()
+		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(m)
+	if m.GRPC != nil {
+		if err := m.GRPC.validate(); err != nil {
+			return http.StatusBadRequest, "Invalid grpc options: " + err.Error()
+		}
+	}
+	if m.Type == "websocket" {
+		if _, err := websocketHTTPURL(m.URL); err != nil {
+			return http.StatusBadRequest, "Invalid WebSocket URL: " + err.Error()
+		}
+	}
+	if m.WebSocket != nil {
+		if err := m.WebSocket.validate(); err != nil {
+			return http.StatusBadRequest, "Invalid websocket options: " + err.Error()
+		}
+	}
+	if m.Type == "multistep" && m.MultiStep == nil {
+		return http.StatusBadRequest, "Multi-step monitors need steps"
+	}
+	if m.MultiStep != nil {
+		if err := m.MultiStep.validate(); err != nil {
+			return http.StatusBadRequest, "Invalid multistep options: " + err.Error()
+		}
+	}
+	if m.Type == "heartbeat" && m.Heartbeat == nil {
+		return http.StatusBadRequest, "Heartbeat monitors need heartbeat options"
+	}
+	if m.Heartbeat != nil {
+		if err := m.Heartbeat.validate(); err != nil {
+			return http.StatusBadRequest, "Invalid heartbeat options: " + err.Error()
+		}
+		if m.Heartbeat.Slug != "" {
+			if other, err := getMonitorByHeartbeatSlug(db, m.ProjectID, m.Heartbeat.Slug); err == nil && other.ID != m.ID {
+				return http.StatusConflict, "A heartbeat monitor with this slug already exists"
+			}
+		}
+	}
+	return 0, ""
 }
 
 func deleteMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
@@ -2146,13 +2538,32 @@ func deleteMonitor(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "Failed to delete monitor", http.StatusInternalServerError)
 		return
 	}
+	unscheduleMonitor(monitorID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func getStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	vars := mux.Vars(r)
-	projectID := vars["projectId"]
+	// Status pages are found by slug. With the project_status_pages setting on, projects
+	// without one still get a page of all their monitors at their project id.
+	if page, err := GetStatusPageBySlug(db, mux.Vars(r)["page"]); err == nil {
+		servePublicStatusPage(w, db, page)
+		return
+	}
+	if enabled, _ := GetSetting(db, "project_status_pages"); enabled != "true" {
+		http.Error(w, "Status page not found", http.StatusNotFound)
+		return
+	}
+	projectID := mux.Vars(r)["page"]
+	project, err := GetProject(db, projectID)
+	if err != nil {
+		http.Error(w, "Status page not found", http.StatusNotFound)
+		return
+	}
+	if pages, _ := GetStatusPages(db, projectID); len(pages) > 0 {
+		http.Error(w, "Status page not found", http.StatusNotFound)
+		return
+	}
 
 	monitors, err := GetProjectMonitors(db, projectID)
 	if err != nil {
@@ -2160,74 +2571,72 @@ func getStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	// Calculate uptime for each monitor
-	type StatusPageMonitor struct {
-		Monitor
-		Uptime24h    float64        `json:"uptime_24h"`
-		Uptime7d     float64        `json:"uptime_7d"`
-		Uptime30d    float64        `json:"uptime_30d"`
-		RecentChecks []MonitorCheck `json:"recent_checks"`
-	}
-
-	statusMonitors := make([]StatusPageMonitor, 0, len(monitors))
-	for _, m := range monitors {
-		checks, _ := GetMonitorChecks(db, m.ID, 1000)
-
-		now := time.Now()
-		dayAgo := now.Add(-24 * time.Hour)
-		weekAgo := now.Add(-7 * 24 * time.Hour)
-		monthAgo := now.Add(-30 * 24 * time.Hour)
-
-		var up24h, total24h, up7d, total7d, up30d, total30d int
+	now := time.Now()
 
-		for _, check := range checks {
-			if check.CreatedAt.After(monthAgo) {
-				total30d++
-				if check.Status == "up" {
-					up30d++
-				}
-				if check.CreatedAt.After(weekAgo) {
-					total7d++
-					if check.Status == "up" {
-						up7d++
-					}
-					if check.CreatedAt.After(dayAgo) {
-						total24h++
-						if check.Status == "up" {
-							up24h++
-						}
-					}
-				}
-			}
-		}
+	// The page is down while any monitor is, degraded while any is slow, and under
+	// maintenance while any is in a window and the rest are up
+	pageStatus := "operational"
 
-		var uptime24h, uptime7d, uptime30d float64
-		if total24h > 0 {
-			uptime24h = float64(up24h) / float64(total24h) * 100
-		}
-		if total7d > 0 {
-			uptime7d = float64(up7d) / float64(total7d) * 100
-		}
-		if total30d > 0 {
-			uptime30d = float64(up30d) / float64(total30d) * 100
-		}
+	// Only the fields of publicMonitor and publicCheck are shown, as on slug pages:
+	// targets, request options and error messages stay private
+	statusMonitors := make([]publicMonitor, 0, len(monitors))
+	for _, m := range monitors {
+		pageStatus = worseStatus(pageStatus, m.Status)
 
-		recentChecks := checks
-		if len(checks) > 50 {
-			recentChecks = checks[:50]
+		pm := publicMonitor{
+			ID:           m.ID,
+			Name:         m.Name,
+			Status:       m.Status,
+			uptimeStats:  monitorUptimeStats(db, &m, now),
+			History:      dailyUptimeHistory(db, m.ID, uptimeHistoryDays, now),
+			RecentChecks: []publicCheck{},
 		}
-
-		statusMonitors = append(statusMonitors, StatusPageMonitor{
-			Monitor:      m,
-			Uptime24h:    uptime24h,
-			Uptime7d:     uptime7d,
-			Uptime30d:    uptime30d,
-			RecentChecks: recentChecks,
+		checks, _ := GetMonitorChecks(db, m.ID, 50)
+		for _, check := range checks {
+			pm.RecentChecks = append(pm.RecentChecks, publicCheck{
+				Status:       check.Status,
+				ResponseTime: check.ResponseTime,
+				CreatedAt:    check.CreatedAt,
+			})
+		}
+		statusMonitors = append(statusMonitors, pm)
+	}
+
+	type publicMonitorIncident struct {
+		ID              string     `json:"id"`
+		MonitorID       string     `json:"monitor_id"`
+		MonitorName     string     `json:"monitor_name,omitempty"`
+		Status          string     `json:"status"`
+		StartedAt       time.Time  `json:"started_at"`
+		ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+		DurationSeconds int64      `json:"duration_seconds"`
+	}
+	incidents, _, _ := GetIncidents(db, projectID, "", "", 10, 0)
+	publicIncidents := make([]publicMonitorIncident, 0, len(incidents))
+	for _, incident := range incidents {
+		publicIncidents = append(publicIncidents, publicMonitorIncident{
+			ID:              incident.ID,
+			MonitorID:       incident.MonitorID,
+			MonitorName:     incident.MonitorName,
+			Status:          incident.Status,
+			StartedAt:       incident.StartedAt,
+			ResolvedAt:      incident.ResolvedAt,
+			DurationSeconds: incident.DurationSeconds,
 		})
 	}
 
-	// Get project name
-	project, _ := GetProject(db, projectID)
+	// Maintenance in progress or starting soon
+	maintenance := []MaintenanceWindow{}
+	windows, _ := GetMaintenanceWindows(db, projectID)
+	for _, window := range windows {
+		window.describe(now)
+		if window.Occurrence != nil && window.Occurrence.StartsAt.Before(now.Add(upcomingMaintenanceHorizon)) {
+			maintenance = append(maintenance, window)
+		}
+	}
+	sort.Slice(maintenance, func(i, j int) bool {
+		return maintenance[i].Occurrence.StartsAt.Before(maintenance[j].Occurrence.StartsAt)
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -2235,7 +2644,10 @@ func getStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 			"id":   projectID,
 			"name": project.Name,
 		},
-		"monitors": statusMonitors,
+		"status":      pageStatus,
+		"monitors":    statusMonitors,
+		"incidents":   publicIncidents,
+		"maintenance": maintenance,
 	})
 }
 
@@ -2295,132 +2707,29 @@ func getInsights(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		monitors, _ := GetProjectMonitors(db, projectID)
 		uptimeStats["total_monitors"] = len(monitors)
 
-		var totalUptime24h, totalUptime7d, totalUptime30d float64
-		var activeMonitors int
-
+		var uptime rollupUptimeAverage
 		for _, m := range monitors {
-			checks, _ := GetMonitorChecks(db, m.ID, 100)
-			if len(checks) == 0 {
-				continue
-			}
-			activeMonitors++
-
-			now := time.Now()
-			dayAgo := now.Add(-24 * time.Hour)
-			weekAgo := now.Add(-7 * 24 * time.Hour)
-			monthAgo := now.Add(-30 * 24 * time.Hour)
-
-			var up24h, total24h, up7d, total7d, up30d, total30d int
-			for _, check := range checks {
-				if check.CreatedAt.After(monthAgo) {
-					total30d++
-					if check.Status == "up" {
-						up30d++
-					}
-					if check.CreatedAt.After(weekAgo) {
-						total7d++
-						if check.Status == "up" {
-							up7d++
-						}
-						if check.CreatedAt.After(dayAgo) {
-							total24h++
-							if check.Status == "up" {
-								up24h++
-							}
-						}
-					}
-				}
-			}
-
-			if total24h > 0 {
-				totalUptime24h += float64(up24h) / float64(total24h) * 100
-			}
-			if total7d > 0 {
-				totalUptime7d += float64(up7d) / float64(total7d) * 100
-			}
-			if total30d > 0 {
-				totalUptime30d += float64(up30d) / float64(total30d) * 100
-			}
-		}
-
-		if activeMonitors > 0 {
-			uptimeStats["avg_uptime_24h"] = totalUptime24h / float64(activeMonitors)
-			uptimeStats["avg_uptime_7d"] = totalUptime7d / float64(activeMonitors)
-			uptimeStats["avg_uptime_30d"] = totalUptime30d / float64(activeMonitors)
-		} else {
-			uptimeStats["avg_uptime_24h"] = 0
-			uptimeStats["avg_uptime_7d"] = 0
-			uptimeStats["avg_uptime_30d"] = 0
+			uptime.add(db, m.ID)
 		}
+		uptime.write(uptimeStats)
 
 		uptimeStats["monitors"] = monitors
 	} else {
 		// All projects
 		projects, _ := GetAllProjects(db)
 		var totalMonitors int
-		var totalUptime24h, totalUptime7d, totalUptime30d float64
-		var activeMonitors int
+		var uptime rollupUptimeAverage
 
 		for _, p := range projects {
 			monitors, _ := GetProjectMonitors(db, p.ID)
 			totalMonitors += len(monitors)
-
 			for _, m := range monitors {
-				checks, _ := GetMonitorChecks(db, m.ID, 100)
-				if len(checks) == 0 {
-					continue
-				}
-				activeMonitors++
-
-				now := time.Now()
-				dayAgo := now.Add(-24 * time.Hour)
-				weekAgo := now.Add(-7 * 24 * time.Hour)
-				monthAgo := now.Add(-30 * 24 * time.Hour)
-
-				var up24h, total24h, up7d, total7d, up30d, total30d int
-				for _, check := range checks {
-					if check.CreatedAt.After(monthAgo) {
-						total30d++
-						if check.Status == "up" {
-							up30d++
-						}
-						if check.CreatedAt.After(weekAgo) {
-							total7d++
-							if check.Status == "up" {
-								up7d++
-							}
-							if check.CreatedAt.After(dayAgo) {
-								total24h++
-								if check.Status == "up" {
-									up24h++
-								}
-							}
-						}
-					}
-				}
-
-				if total24h > 0 {
-					totalUptime24h += float64(up24h) / float64(total24h) * 100
-				}
-				if total7d > 0 {
-					totalUptime7d += float64(up7d) / float64(total7d) * 100
-				}
-				if total30d > 0 {
-					totalUptime30d += float64(up30d) / float64(total30d) * 100
-				}
+				uptime.add(db, m.ID)
 			}
 		}
 
 		uptimeStats["total_monitors"] = totalMonitors
-		if activeMonitors > 0 {
-			uptimeStats["avg_uptime_24h"] = totalUptime24h / float64(activeMonitors)
-			uptimeStats["avg_uptime_7d"] = totalUptime7d / float64(activeMonitors)
-			uptimeStats["avg_uptime_30d"] = totalUptime30d / float64(activeMonitors)
-		} else {
-			uptimeStats["avg_uptime_24h"] = 0
-			uptimeStats["avg_uptime_7d"] = 0
-			uptimeStats["avg_uptime_30d"] = 0
-		}
+		uptime.write(uptimeStats)
 	}
 	insights["uptime"] = uptimeStats
 
@@ -2538,6 +2847,7 @@ func updateProjectSettings(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "Failed to fetch project settings", http.StatusInternalServerError)
 		return
 	}
+	before := *settings
 
 	// Update settings fields if provided
 	if req.NotificationEnabled != nil {
@@ -2547,6 +2857,10 @@ func updateProjectSettings(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		settings.NotificationLevels = req.NotificationLevels
 	}
 	if req.NotificationFrequency != "" {
+		if req.NotificationFrequency != "immediate" && !isDigestFrequency(req.NotificationFrequency) {
+			http.Error(w, "notification_frequency must be immediate, hourly or daily", http.StatusBadRequest)
+			return
+		}
 		settings.NotificationFrequency = req.NotificationFrequency
 	}
 	if req.NotificationEmail != "" || req.NotificationEmail == "" {
@@ -2567,6 +2881,8 @@ func updateProjectSettings(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	recordAudit(db, r, "project_settings.update", "project", projectID, &before, settings)
+
 	// Return updated project and settings
 	project, err := GetProject(db, projectID)
 	if err != nil {
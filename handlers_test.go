@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestEnvelopeExplicitZeroLength(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+
+	tests := []struct {
+		name     string
+		envelope string
+	}{
+		// The newline after a payload with a length is optional, so the next header
+		// may follow the item header directly
+		{"without newline", `{"type":"attachment","length":0}` + "\n" +
+			`{"type":"event"}` + "\n" + `{"event_id":"0f3b6a2c9d1e4f5a8b7c6d5e4f3a2b1c","message":"after an empty item"}` + "\n"},
+		{"with newline", `{"type":"attachment","length":0}` + "\n\n" +
+			`{"type":"event"}` + "\n" + `{"event_id":"1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d","message":"after an empty item"}` + "\n"},
+		{"length before event", `{"type":"event","length":80}` + "\n" +
+			`{"event_id":"2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e","message":"before an empty item"}` + "\n" +
+			`{"type":"attachment","length":0}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"dsn":"https://key@pulse.test/1"}` + "\n" + tt.envelope
+			req := httptest.NewRequest(http.MethodPost, "/api/"+project.ID+"/envelope/", strings.NewReader(body))
+			req.Header.Set("X-Sentry-Auth", "Sentry sentry_key="+project.APIKey+", sentry_version=7")
+			rec := httptest.NewRecorder()
+			handleEnvelopeSentry(rec, mux.SetURLVars(req, map[string]string{"projectId": project.ID}), db)
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+
+			// Events are queued for the batch inserter
+			select {
+			case batch := <-errorBatchChan:
+				if !strings.Contains(tt.envelope, `"message":"`+batch.Event.Message+`"`) || !strings.Contains(tt.envelope, batch.Event.ID) {
+					t.Errorf("queued event = %+v", batch.Event)
+				}
+			default:
+				t.Error("the event next to the empty item was dropped")
+			}
+		})
+	}
+}
+
+func TestUpdateMonitorValidatesMergedMonitor(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	m := newTestMonitor(t, db, project.ID, "API", "api.example.test:443")
+
+	update := func(projectID, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/api/projects/"+projectID+"/monitors/"+m.ID, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		updateMonitor(rec, mux.SetURLVars(req, map[string]string{"id": projectID, "monitorId": m.ID}), db)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		name, body string
+		want       int
+	}{
+		// The stored URL isn't a WebSocket one
+		{"type against stored url", `{"type":"websocket"}`, http.StatusBadRequest},
+		{"type with url", `{"type":"websocket","url":"wss://api.example.test/socket"}`, http.StatusOK},
+		{"url against stored type", `{"url":"api.example.test:443"}`, http.StatusBadRequest},
+		{"multistep without steps", `{"type":"multistep"}`, http.StatusBadRequest},
+		{"heartbeat without options", `{"type":"heartbeat"}`, http.StatusBadRequest},
+		{"connection options", `{"type":"postgres","connection":{"password":"hunter2"}}`, http.StatusBadRequest},
+		{"stored connection options", `{"type":"postgres"}`, http.StatusBadRequest},
+	} {
+		if rec := update(project.ID, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	stored, err := GetMonitor(db, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Type != "websocket" || stored.URL != "wss://api.example.test/socket" || stored.Name != "API" {
+		t.Errorf("stored monitor = %s %s %s", stored.Type, stored.URL, stored.Name)
+	}
+
+	other, err := CreateProject(db, "billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := update(other.ID, `{"name":"Billing API"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("update through another project: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,637 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // schedules may name any timezone; slim images ship without zoneinfo
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Heartbeat monitors are pushed to rather than polled: cron jobs and workers check in
+// through their ping URL or Sentry check-ins, and runs that are missed, fail or overrun
+// their max runtime are recorded as down checks.
+
+const (
+	defaultHeartbeatGraceMinutes      = 1
+	defaultHeartbeatMaxRuntimeMinutes = 30
+	maxCheckInMessageLength           = 1000
+)
+
+// HeartbeatConfig is when a heartbeat monitor expects its job to run
+type HeartbeatConfig struct {
+	// Slug identifies the monitor in Sentry check-ins (monitor_slug)
+	Slug string `json:"slug,omitempty"`
+	// Schedule is a cron expression evaluated in Timezone; IntervalMinutes is used without one
+	Schedule        string `json:"schedule,omitempty"`
+	IntervalMinutes int    `json:"interval_minutes,omitempty"`
+	Timezone        string `json:"timezone,omitempty"`
+	// GraceMinutes is how late a run may check in, MaxRuntimeMinutes how long it may stay in progress
+	GraceMinutes      int `json:"grace_minutes"`
+	MaxRuntimeMinutes int `json:"max_runtime_minutes"`
+}
+
+// MonitorCheckIn is one run reported to a heartbeat monitor, or one it missed
+type MonitorCheckIn struct {
+	ID          string     `json:"id"`
+	MonitorID   string     `json:"monitor_id"`
+	Status      string     `json:"status"` // in_progress, ok, error, missed, timeout
+	Source      string     `json:"source"` // ping, sentry, schedule
+	CheckInID   string     `json:"check_in_id,omitempty"`
+	Environment string     `json:"environment,omitempty"`
+	Message     string     `json:"message,omitempty"`
+	DurationMs  int64      `json:"duration_ms"`
+	ExpectedAt  *time.Time `json:"expected_at,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+var heartbeatSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// validate normalises the config and applies defaults
+func (c *HeartbeatConfig) validate() error {
+	c.Slug = strings.ToLower(strings.TrimSpace(c.Slug))
+	if c.Slug != "" && !heartbeatSlugPattern.MatchString(c.Slug) {
+		return errors.New("slug may only contain lowercase letters, digits, - and _, up to 64 characters")
+	}
+	c.Schedule = strings.TrimSpace(c.Schedule)
+	switch {
+	case c.Schedule != "" && c.IntervalMinutes != 0:
+		return errors.New("set either schedule or interval_minutes, not both")
+	case c.Schedule != "":
+		sched, err := parseCron(c.Schedule)
+		if err != nil {
+			return err
+		}
+		if sched.next(time.Now()).IsZero() {
+			return fmt.Errorf("schedule %q never runs", c.Schedule)
+		}
+	case c.IntervalMinutes < 0 || c.IntervalMinutes > 366*24*60:
+		return errors.New("interval_minutes must be between 1 and 527040")
+	case c.IntervalMinutes == 0:
+		return errors.New("heartbeat monitors need a schedule or interval_minutes")
+	}
+	if c.Timezone == "" {
+		c.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", c.Timezone)
+	}
+	if c.GraceMinutes < 0 || c.GraceMinutes > 24*60 {
+		return errors.New("grace_minutes must be between 1 and 1440")
+	}
+	if c.GraceMinutes == 0 {
+		c.GraceMinutes = defaultHeartbeatGraceMinutes
+	}
+	if c.MaxRuntimeMinutes < 0 || c.MaxRuntimeMinutes > 24*60 {
+		return errors.New("max_runtime_minutes must be between 1 and 1440")
+	}
+	if c.MaxRuntimeMinutes == 0 {
+		c.MaxRuntimeMinutes = defaultHeartbeatMaxRuntimeMinutes
+	}
+	return nil
+}
+
+// nextRun returns the first scheduled run after t
+func (c *HeartbeatConfig) nextRun(t time.Time) time.Time {
+	if c.Schedule == "" {
+		return t.Add(time.Duration(c.IntervalMinutes) * time.Minute)
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	sched, err := parseCron(c.Schedule)
+	if err != nil {
+		return time.Time{}
+	}
+	return sched.next(t.In(loc))
+}
+
+func generateHeartbeatToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// recordCheckIn applies a start (in_progress), ok or error signal to a heartbeat monitor.
+// ok and error finish the run started with the same Sentry check-in ID, or the latest
+// run still in progress; without one they're recorded as a run of their own.
+func recordCheckIn(db *sql.DB, m *Monitor, in *MonitorCheckIn, duration *time.Duration) (*MonitorCheckIn, error) {
+	// Check-in and schedule times are kept in UTC so they compare correctly in SQL
+	now := time.Now().UTC()
+	in.MonitorID = m.ID
+	if len(in.Message) > maxCheckInMessageLength {
+		in.Message = in.Message[:maxCheckInMessageLength]
+	}
+
+	if in.Status == "in_progress" {
+		in.ID = uuid.New().String()
+		in.StartedAt = &now
+		in.CreatedAt = now
+		if err := insertCheckIn(db, in); err != nil {
+			return nil, err
+		}
+		advanceHeartbeat(db, m, now)
+		return in, nil
+	}
+
+	open, err := findOpenCheckIn(db, m.ID, in.Source, in.CheckInID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if open != nil && open.Status != "in_progress" {
+		// Retried signal for a run that already finished
+		return open, nil
+	}
+
+	in.FinishedAt = &now
+	if duration != nil {
+		in.DurationMs = duration.Milliseconds()
+	}
+	started := now
+	if open != nil {
+		started = *open.StartedAt
+		if duration == nil {
+			in.DurationMs = now.Sub(started).Milliseconds()
+		}
+		res, err := db.Exec(`UPDATE monitor_checkins SET status = ?, message = ?, duration_ms = ?, finished_at = ?,
+			environment = COALESCE(NULLIF(?, ''), environment) WHERE id = ? AND status = 'in_progress'`,
+			in.Status, in.Message, in.DurationMs, now, in.Environment, open.ID)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// The worker timed the run out in the meantime
+			return getCheckIn(db, open.ID)
+		}
+		in.ID, in.StartedAt, in.CreatedAt = open.ID, open.StartedAt, open.CreatedAt
+		if in.Environment == "" {
+			in.Environment = open.Environment
+		}
+	} else {
+		in.ID = uuid.New().String()
+		in.CreatedAt = now
+		if in.DurationMs > 0 {
+			s := now.Add(-time.Duration(in.DurationMs) * time.Millisecond)
+			in.StartedAt = &s
+			started = s
+		}
+		if err := insertCheckIn(db, in); err != nil {
+			return nil, err
+		}
+	}
+	advanceHeartbeat(db, m, started)
+
+	status, errMsg := "up", ""
+	if in.Status == "error" {
+		status, errMsg = "down", "Job reported an error"
+		if in.Message != "" {
+			errMsg += ": " + in.Message
+		}
+	}
+	recordHeartbeatCheck(db, m, status, errMsg, in.DurationMs)
+	return in, nil
+}
+
+// advanceHeartbeat expects the next run after the one that started at t
+func advanceHeartbeat(db *sql.DB, m *Monitor, t time.Time) {
+	if m.Heartbeat == nil {
+		return
+	}
+	if next := m.Heartbeat.nextRun(t); !next.IsZero() {
+		db.Exec("UPDATE monitors SET next_checkin_at = ? WHERE id = ?", next.UTC(), m.ID)
+	}
+}
+
+// recordHeartbeatCheck turns a run's outcome into a monitor check, which drives alerts and incidents
+func recordHeartbeatCheck(db *sql.DB, m *Monitor, status, errMsg string, durationMs int64) {
+	var current string
+	db.QueryRow("SELECT status FROM monitors WHERE id = ?", m.ID).Scan(&current)
+	if current == "paused" {
+		return
+	}
+	window := activeMaintenance(db, m, time.Now())
+	if window != nil {
+		status = "maintenance"
+	}
+
+	check := &MonitorCheck{
+		ID:           uuid.New().String(),
+		MonitorID:    m.ID,
+		Status:       status,
+		ResponseTime: int(durationMs),
+		ErrorMessage: errMsg,
+		CreatedAt:    time.Now(),
+	}
+	if err := InsertMonitorCheck(db, check); err != nil {
+		log.Printf("Failed to insert check for monitor %s: %v", m.ID, err)
+		return
+	}
+	if window == nil {
+		evaluateMonitorAlert(db, m, check)
+	}
+}
+
+// processHeartbeat times out overrunning runs and records missed ones. It runs on every
+// worker tick instead of a pull check.
+func processHeartbeat(db *sql.DB, m Monitor) {
+	cfg := m.Heartbeat
+	if cfg == nil {
+		return
+	}
+	now := time.Now().UTC()
+
+	maxRuntime := time.Duration(cfg.MaxRuntimeMinutes) * time.Minute
+	rows, err := db.Query("SELECT id, started_at FROM monitor_checkins WHERE monitor_id = ? AND status = 'in_progress' AND started_at < ?",
+		m.ID, now.Add(-maxRuntime))
+	if err != nil {
+		log.Printf("Failed to load running check-ins for monitor %s: %v", m.ID, err)
+		return
+	}
+	type run struct {
+		id      string
+		started time.Time
+	}
+	var overdue []run
+	for rows.Next() {
+		var r run
+		if rows.Scan(&r.id, &r.started) == nil {
+			overdue = append(overdue, r)
+		}
+	}
+	rows.Close()
+	for _, r := range overdue {
+		durationMs := now.Sub(r.started).Milliseconds()
+		msg := fmt.Sprintf("Run started at %s exceeded the max runtime of %d minutes", r.started.UTC().Format("2006-01-02 15:04 UTC"), cfg.MaxRuntimeMinutes)
+		res, err := db.Exec("UPDATE monitor_checkins SET status = 'timeout', message = ?, duration_ms = ?, finished_at = ? WHERE id = ? AND status = 'in_progress'",
+			msg, durationMs, now, r.id)
+		if err != nil {
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			recordHeartbeatCheck(db, &m, "down", msg, durationMs)
+		}
+	}
+
+	if m.NextCheckInAt == nil {
+		// New, resumed or rescheduled: start expecting runs from now
+		if next := cfg.nextRun(now); !next.IsZero() {
+			db.Exec("UPDATE monitors SET next_checkin_at = ? WHERE id = ? AND next_checkin_at IS NULL", next.UTC(), m.ID)
+		}
+		return
+	}
+
+	expected := m.NextCheckInAt.UTC()
+	if !now.After(expected.Add(time.Duration(cfg.GraceMinutes) * time.Minute)) {
+		return
+	}
+	next := cfg.nextRun(now)
+	if next.IsZero() {
+		return
+	}
+	// Claim the missed run; a check-in that arrived meanwhile moves next_checkin_at ahead
+	res, err := db.Exec("UPDATE monitors SET next_checkin_at = ? WHERE id = ? AND next_checkin_at < ?",
+		next.UTC(), m.ID, now.Add(-time.Duration(cfg.GraceMinutes)*time.Minute))
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Missed check-in expected at %s", expected.UTC().Format("2006-01-02 15:04 UTC"))
+	missed := &MonitorCheckIn{
+		ID:         uuid.New().String(),
+		MonitorID:  m.ID,
+		Status:     "missed",
+		Source:     "schedule",
+		Message:    msg,
+		ExpectedAt: &expected,
+		CreatedAt:  now,
+	}
+	if err := insertCheckIn(db, missed); err != nil {
+		log.Printf("Failed to record missed check-in for monitor %s: %v", m.ID, err)
+	}
+	recordHeartbeatCheck(db, &m, "down", msg, 0)
+}
+
+const checkInColumns = `id, monitor_id, status, source, check_in_id, environment, message, duration_ms,
+	expected_at, started_at, finished_at, created_at`
+
+func scanCheckIn(row interface{ Scan(...interface{}) error }) (*MonitorCheckIn, error) {
+	var c MonitorCheckIn
+	var expectedAt, startedAt, finishedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.MonitorID, &c.Status, &c.Source, &c.CheckInID, &c.Environment, &c.Message, &c.DurationMs,
+		&expectedAt, &startedAt, &finishedAt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expectedAt.Valid {
+		c.ExpectedAt = &expectedAt.Time
+	}
+	if startedAt.Valid {
+		c.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		c.FinishedAt = &finishedAt.Time
+	}
+	if c.Status == "in_progress" && c.StartedAt != nil {
+		// Running jobs report how long they've taken so far
+		c.DurationMs = time.Since(*c.StartedAt).Milliseconds()
+	}
+	return &c, nil
+}
+
+func insertCheckIn(db *sql.DB, c *MonitorCheckIn) error {
+	_, err := db.Exec(`INSERT INTO monitor_checkins (id, monitor_id, status, source, check_in_id, environment, message, duration_ms,
+		expected_at, started_at, finished_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.MonitorID, c.Status, c.Source, c.CheckInID, c.Environment, c.Message, c.DurationMs,
+		c.ExpectedAt, c.StartedAt, c.FinishedAt, c.CreatedAt)
+	return err
+}
+
+func getCheckIn(db *sql.DB, id string) (*MonitorCheckIn, error) {
+	return scanCheckIn(db.QueryRow("SELECT "+checkInColumns+" FROM monitor_checkins WHERE id = ?", id))
+}
+
+// findOpenCheckIn returns the run a finishing signal belongs to: the one with the Sentry
+// check-in ID, or the latest run from the same source still in progress
+func findOpenCheckIn(db *sql.DB, monitorID, source, checkInID string) (*MonitorCheckIn, error) {
+	if checkInID != "" {
+		return scanCheckIn(db.QueryRow("SELECT "+checkInColumns+" FROM monitor_checkins WHERE monitor_id = ? AND check_in_id = ? ORDER BY created_at DESC LIMIT 1",
+			monitorID, checkInID))
+	}
+	return scanCheckIn(db.QueryRow("SELECT "+checkInColumns+` FROM monitor_checkins
+		WHERE monitor_id = ? AND source = ? AND status = 'in_progress' ORDER BY created_at DESC LIMIT 1`, monitorID, source))
+}
+
+// GetMonitorCheckIns lists a monitor's check-ins, newest first
+func GetMonitorCheckIns(db *sql.DB, monitorID, status string, limit, offset int) ([]MonitorCheckIn, int, error) {
+	where := " WHERE monitor_id = ?"
+	args := []interface{}{monitorID}
+	if status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM monitor_checkins"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query("SELECT "+checkInColumns+" FROM monitor_checkins"+where+" ORDER BY created_at DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	checkIns := []MonitorCheckIn{}
+	for rows.Next() {
+		c, err := scanCheckIn(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		checkIns = append(checkIns, *c)
+	}
+	return checkIns, total, nil
+}
+
+func getMonitorByHeartbeatToken(db *sql.DB, token string) (*Monitor, error) {
+	return scanMonitor(db.QueryRow("SELECT "+monitorColumns+" FROM monitors WHERE type = 'heartbeat' AND heartbeat_token = ?", token))
+}
+
+func getMonitorByHeartbeatSlug(db *sql.DB, projectID, slug string) (*Monitor, error) {
+	return scanMonitor(db.QueryRow("SELECT "+monitorColumns+" FROM monitors WHERE project_id = ? AND type = 'heartbeat' AND heartbeat_slug = ?",
+		projectID, slug))
+}
+
+// handleHeartbeatPing receives a job's signal on its ping URL: /api/heartbeat/<token> or
+// /api/heartbeat/<token>/ok for success, /start when a run begins and /error (or /fail)
+// when it fails. An error's request body is kept as its message.
+func handleHeartbeatPing(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	status := ""
+	switch vars["signal"] {
+	case "", "ok":
+		status = "ok"
+	case "start":
+		status = "in_progress"
+	case "error", "fail":
+		status = "error"
+	default:
+		http.Error(w, "Unknown signal. Use start, ok or error", http.StatusNotFound)
+		return
+	}
+
+	m, err := getMonitorByHeartbeatToken(db, vars["token"])
+	if err != nil {
+		http.Error(w, "Heartbeat not found", http.StatusNotFound)
+		return
+	}
+
+	in := &MonitorCheckIn{Status: status, Source: "ping", Environment: r.URL.Query().Get("env")}
+	if status == "error" && r.Body != nil {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxCheckInMessageLength))
+		in.Message = strings.TrimSpace(string(body))
+	}
+	var duration *time.Duration
+	if v := r.URL.Query().Get("duration"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil || seconds < 0 {
+			http.Error(w, "duration must be a number of seconds", http.StatusBadRequest)
+			return
+		}
+		d := time.Duration(seconds * float64(time.Second))
+		duration = &d
+	}
+
+	checkIn, err := recordCheckIn(db, m, in, duration)
+	if err != nil {
+		log.Printf("Failed to record check-in for monitor %s: %v", m.ID, err)
+		http.Error(w, "Failed to record check-in", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkIn)
+}
+
+// SentryCheckIn is the payload of a check_in envelope item
+type SentryCheckIn struct {
+	CheckInID     string               `json:"check_in_id"`
+	MonitorSlug   string               `json:"monitor_slug"`
+	Status        string               `json:"status"`   // in_progress, ok, error
+	Duration      *float64             `json:"duration"` // seconds
+	Environment   string               `json:"environment"`
+	MonitorConfig *SentryMonitorConfig `json:"monitor_config"`
+}
+
+// SentryMonitorConfig is the schedule SDKs send to create or update a monitor
+type SentryMonitorConfig struct {
+	Schedule struct {
+		Type  string          `json:"type"` // crontab, interval
+		Value json.RawMessage `json:"value"`
+		Unit  string          `json:"unit"`
+	} `json:"schedule"`
+	CheckinMargin *int   `json:"checkin_margin"` // minutes
+	MaxRuntime    *int   `json:"max_runtime"`    // minutes
+	Timezone      string `json:"timezone"`
+}
+
+// heartbeatConfig converts a Sentry monitor config
+func (c *SentryMonitorConfig) heartbeatConfig(slug string) (*HeartbeatConfig, error) {
+	cfg := &HeartbeatConfig{Slug: slug, Timezone: c.Timezone}
+	switch c.Schedule.Type {
+	case "crontab":
+		if err := json.Unmarshal(c.Schedule.Value, &cfg.Schedule); err != nil {
+			return nil, errors.New("crontab schedule value must be a string")
+		}
+	case "interval":
+		var n int
+		if err := json.Unmarshal(c.Schedule.Value, &n); err != nil || n <= 0 {
+			return nil, errors.New("interval schedule value must be a positive number")
+		}
+		units := map[string]int{"minute": 1, "hour": 60, "day": 24 * 60, "week": 7 * 24 * 60, "month": 30 * 24 * 60, "year": 365 * 24 * 60}
+		minutes, ok := units[c.Schedule.Unit]
+		if !ok {
+			return nil, fmt.Errorf("unknown interval unit %q", c.Schedule.Unit)
+		}
+		cfg.IntervalMinutes = n * minutes
+	default:
+		return nil, fmt.Errorf("unknown schedule type %q", c.Schedule.Type)
+	}
+	if c.CheckinMargin != nil {
+		cfg.GraceMinutes = *c.CheckinMargin
+	}
+	if c.MaxRuntime != nil {
+		cfg.MaxRuntimeMinutes = *c.MaxRuntime
+	}
+	return cfg, cfg.validate()
+}
+
+// processSentryCheckIn records a check_in envelope item. Like Sentry, an unknown slug that
+// comes with a monitor config creates the monitor, and a changed config updates it.
+func processSentryCheckIn(db *sql.DB, projectID string, payload []byte) {
+	var ci SentryCheckIn
+	if err := json.Unmarshal(payload, &ci); err != nil {
+		log.Printf("[DSN Debug] Failed to unmarshal check-in: %v", err)
+		return
+	}
+	slug := strings.ToLower(strings.TrimSpace(ci.MonitorSlug))
+	if ci.Status != "in_progress" && ci.Status != "ok" && ci.Status != "error" {
+		log.Printf("[DSN Debug] Ignoring check-in for %s with status %q", slug, ci.Status)
+		return
+	}
+
+	var cfg *HeartbeatConfig
+	if ci.MonitorConfig != nil {
+		var err error
+		if cfg, err = ci.MonitorConfig.heartbeatConfig(slug); err != nil {
+			log.Printf("[DSN Debug] Invalid monitor config for %s: %v", slug, err)
+			return
+		}
+	}
+
+	m, err := getMonitorByHeartbeatSlug(db, projectID, slug)
+	if err == sql.ErrNoRows && cfg != nil {
+		m = &Monitor{
+			ID:               uuid.New().String(),
+			ProjectID:        projectID,
+			Name:             slug,
+			Type:             "heartbeat",
+			Interval:         60,
+			Timeout:          30,
+			Status:           "up",
+			CreatedAt:        time.Now(),
+			FailureThreshold: 1,
+			PingCount:        defaultPingCount,
+			SSLAlertDays:     defaultSSLAlertDays,
+			Heartbeat:        cfg,
+			HeartbeatToken:   generateHeartbeatToken(),
+		}
+		if err = CreateMonitor(db, m); err != nil {
+			log.Printf("[DSN Debug] Failed to create monitor %s: %v", slug, err)
+			return
+		}
+		scheduleMonitor(m)
+		log.Printf("[DSN Debug] Created heartbeat monitor %s from check-in", slug)
+	} else if err != nil {
+		log.Printf("[DSN Debug] No heartbeat monitor %s for check-in", slug)
+		return
+	} else if cfg != nil && encodeJSONColumn(cfg) != encodeJSONColumn(m.Heartbeat) {
+		// Expect runs on the new schedule from now
+		db.Exec("UPDATE monitors SET heartbeat_config = ?, next_checkin_at = NULL WHERE id = ?", encodeJSONColumn(cfg), m.ID)
+		m.Heartbeat = cfg
+	}
+
+	in := &MonitorCheckIn{Status: ci.Status, Source: "sentry", CheckInID: ci.CheckInID, Environment: ci.Environment}
+	var duration *time.Duration
+	if ci.Duration != nil && *ci.Duration >= 0 {
+		d := time.Duration(*ci.Duration * float64(time.Second))
+		duration = &d
+	}
+	if _, err := recordCheckIn(db, m, in, duration); err != nil {
+		log.Printf("[DSN Debug] Failed to record check-in for %s: %v", slug, err)
+	}
+}
+
+// getMonitorCheckIns returns a heartbeat monitor's check-in history
+func getMonitorCheckIns(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	m, err := GetMonitor(db, vars["monitorId"])
+	if err != nil || m.ProjectID != vars["id"] {
+		http.Error(w, "Monitor not found", http.StatusNotFound)
+		return
+	}
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	checkIns, total, err := GetMonitorCheckIns(db, m.ID, query.Get("status"), limit, offset)
+	if err != nil {
+		log.Printf("Error fetching check-ins: %v", err)
+		http.Error(w, "Failed to fetch check-ins", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"checkins": checkIns,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+func heartbeatSlug(c *HeartbeatConfig) string {
+	if c == nil {
+		return ""
+	}
+	return c.Slug
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a fresh database with the full schema in a temporary directory
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "pulse.db"))
+	t.Setenv("JWT_SECRET", "test-secret")
+	db, err := InitDB()
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestProject creates a project in db
+func newTestProject(t *testing.T, db *sql.DB) *Project {
+	t.Helper()
+	project, err := CreateProject(db, "checkout")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	return project
+}
+
+func mustSetting(t *testing.T, db *sql.DB, key, value string) {
+	t.Helper()
+	if err := UpdateSetting(db, key, value); err != nil {
+		t.Fatalf("UpdateSetting %s: %v", key, err)
+	}
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRedirects = 10
+	maxMonitorRedirects = 20
+	// maxMonitorBody caps how much of the response body assertions can see
+	maxMonitorBody = 1 << 20
+)
+
+// HTTPMonitorConfig holds the request options and assertions of an HTTP monitor.
+// The zero value makes a plain GET that expects a 2xx response.
+type HTTPMonitorConfig struct {
+	Method          string            `json:"method,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body,omitempty"`
+	Auth            *HTTPMonitorAuth  `json:"auth,omitempty"`
+	FollowRedirects *bool             `json:"follow_redirects,omitempty"`
+	MaxRedirects    int               `json:"max_redirects,omitempty"`
+	SkipTLSVerify   bool              `json:"skip_tls_verify,omitempty"`
+	// ExpectedStatus lists codes ("200"), ranges ("200-299") or classes ("3xx")
+	ExpectedStatus []string        `json:"expected_status,omitempty"`
+	Assertions     []HTTPAssertion `json:"assertions,omitempty"`
+
+	// openErr is set when a stored credential can't be decrypted
+	openErr error
+}
+
+// HTTPMonitorAuth is basic (username/password) or bearer (token) authentication
+type HTTPMonitorAuth struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// HTTPAssertion checks one property of the response. Source is body, json, header or
+// response_time; Property is the JSON path or header name.
+type HTTPAssertion struct {
+	Source   string `json:"source"`
+	Property string `json:"property,omitempty"`
+	Operator string `json:"operator"`
+	Value    string `json:"value,omitempty"`
+}
+
+// HTTPTimings splits an HTTP check into phases, in milliseconds. With redirects, DNS,
+// connect and TLS add up over all hops and TTFB is the wait for the final response.
+type HTTPTimings struct {
+	DNS     float64 `json:"dns_ms"`
+	Connect float64 `json:"connect_ms"`
+	TLS     float64 `json:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms"`
+}
+
+var monitorMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// Operators allowed per assertion source
+var assertionOperators = map[string]map[string]bool{
+	"body": {"contains": true, "not_contains": true, "matches": true, "not_matches": true},
+	"json": {
+		"equals": true, "not_equals": true, "contains": true, "not_contains": true, "matches": true,
+		"not_matches": true, "exists": true, "not_exists": true, "less_than": true, "greater_than": true,
+	},
+	"header": {
+		"equals": true, "not_equals": true, "contains": true, "not_contains": true, "matches": true,
+		"not_matches": true, "exists": true, "not_exists": true,
+	},
+	"response_time": {"less_than": true},
+}
+
+// validate normalises the config and rejects options and assertions that can't be evaluated
+func (c *HTTPMonitorConfig) validate() error {
+	c.Method = strings.ToUpper(strings.TrimSpace(c.Method))
+	if c.Method == "" {
+		c.Method = "GET"
+	}
+	if !monitorMethods[c.Method] {
+		return fmt.Errorf("unsupported method %q", c.Method)
+	}
+	for name := range c.Headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	if c.Auth != nil {
+		switch c.Auth.Type {
+		case "basic":
+			if c.Auth.Username == "" {
+				return errors.New("auth.username is required for basic auth")
+			}
+		case "bearer":
+			if c.Auth.Token == "" {
+				return errors.New("auth.token is required for bearer auth")
+			}
+		case "":
+			c.Auth = nil
+		default:
+			return errors.New("auth.type must be 'basic' or 'bearer'")
+		}
+	}
+	if c.MaxRedirects < 0 || c.MaxRedirects > maxMonitorRedirects {
+		return fmt.Errorf("max_redirects must be between 0 and %d", maxMonitorRedirects)
+	}
+	if _, err := parseStatusRanges(c.ExpectedStatus); err != nil {
+		return err
+	}
+	return validateAssertions(c.Assertions, assertionOperators)
+}
+
+// validateAssertions normalises assertions and rejects those the sources and operators
+// allowed can't evaluate
+func validateAssertions(assertions []HTTPAssertion, sources map[string]map[string]bool) error {
+	for i := range assertions {
+		a := &assertions[i]
+		a.Source = strings.ToLower(strings.TrimSpace(a.Source))
+		a.Operator = strings.ToLower(strings.TrimSpace(a.Operator))
+		if a.Source == "response_time" && a.Operator == "" {
+			a.Operator = "less_than"
+		}
+		operators, ok := sources[a.Source]
+		if !ok {
+			names := make([]string, 0, len(sources))
+			for name := range sources {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("assertions[%d]: source must be one of %s", i, strings.Join(names, ", "))
+		}
+		if !operators[a.Operator] {
+			return fmt.Errorf("assertions[%d]: operator %q is not supported for %s", i, a.Operator, a.Source)
+		}
+		if (a.Source == "json" || a.Source == "header") && a.Property == "" {
+			return fmt.Errorf("assertions[%d]: property is required for %s assertions", i, a.Source)
+		}
+		switch a.Operator {
+		case "exists", "not_exists":
+		case "matches", "not_matches":
+			if _, err := regexp.Compile(a.Value); err != nil {
+				return fmt.Errorf("assertions[%d]: invalid regex: %v", i, err)
+			}
+		case "less_than", "greater_than":
+			if _, err := strconv.ParseFloat(a.Value, 64); err != nil {
+				return fmt.Errorf("assertions[%d]: value must be a number", i)
+			}
+		default:
+			if a.Value == "" && a.Operator != "equals" && a.Operator != "not_equals" {
+				return fmt.Errorf("assertions[%d]: value is required", i)
+			}
+		}
+	}
+	return nil
+}
+
+// masked returns a copy safe to send to clients, hiding credentials
+func (c *HTTPMonitorConfig) masked() *HTTPMonitorConfig {
+	if c == nil {
+		return nil
+	}
+	out := *c
+	if c.Auth != nil {
+		auth := *c.Auth
+		auth.Password = maskSecret(auth.Password)
+		auth.Token = maskSecret(auth.Token)
+		out.Auth = &auth
+	}
+	out.Headers = maskedHeaders(c.Headers)
+	return &out
+}
+
+// keepMaskedSecrets restores credentials that a client echoed back masked
+func (c *HTTPMonitorConfig) keepMaskedSecrets(existing *HTTPMonitorConfig) {
+	if existing == nil {
+		return
+	}
+	if c.Auth != nil && existing.Auth != nil {
+		if strings.HasPrefix(c.Auth.Password, maskedSecretPrefix) {
+			c.Auth.Password = existing.Auth.Password
+		}
+		if strings.HasPrefix(c.Auth.Token, maskedSecretPrefix) {
+			c.Auth.Token = existing.Auth.Token
+		}
+	}
+	keepMaskedHeaders(c.Headers, existing.Headers)
+}
+
+// sealed returns a copy for storage with the auth password, token and sensitive header
+// values encrypted
+func (c *HTTPMonitorConfig) sealed() (*HTTPMonitorConfig, error) {
+	if c == nil {
+		return nil, nil
+	}
+	out := *c
+	if c.Auth != nil {
+		auth := *c.Auth
+		var err error
+		if auth.Password, err = sealSecret(auth.Password); err != nil {
+			return nil, err
+		}
+		if auth.Token, err = sealSecret(auth.Token); err != nil {
+			return nil, err
+		}
+		out.Auth = &auth
+	}
+	headers, err := sealedHeaders(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+	out.Headers = headers
+	return &out, nil
+}
+
+// open decrypts the stored credentials in place
+func (c *HTTPMonitorConfig) open() {
+	if c == nil {
+		return
+	}
+	if c.Auth != nil {
+		var err error
+		if c.Auth.Password, err = openSecret(c.Auth.Password); err != nil {
+			c.openErr = err
+		}
+		if c.Auth.Token, err = openSecret(c.Auth.Token); err != nil {
+			c.openErr = err
+		}
+	}
+	if err := openHeaders(c.Headers); err != nil {
+		c.openErr = err
+	}
+}
+
+// sealedHeaders copies headers, encrypting the values of sensitive ones
+func sealedHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return headers, nil
+	}
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if sensitiveHeader(k) {
+			sealed, err := sealSecret(v)
+			if err != nil {
+				return nil, err
+			}
+			v = sealed
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// openHeaders decrypts sealed header values in place
+func openHeaders(headers map[string]string) error {
+	var openErr error
+	for k, v := range headers {
+		plain, err := openSecret(v)
+		if err != nil {
+			openErr = err
+			continue
+		}
+		headers[k] = plain
+	}
+	return openErr
+}
+
+// maskedHeaders copies headers, hiding the values of sensitive ones
+func maskedHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if sensitiveHeader(k) {
+			v = maskSecret(v)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// keepMaskedHeaders restores header values that a client echoed back masked
+func keepMaskedHeaders(headers, existing map[string]string) {
+	for k, v := range headers {
+		if strings.HasPrefix(v, maskedSecretPrefix) {
+			headers[k] = existing[k]
+		}
+	}
+}
+
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	if name == "authorization" || name == "cookie" || name == "proxy-authorization" {
+		return true
+	}
+	for _, s := range []string{"token", "secret", "key", "password"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusRanges turns "200", "200-299" and "2xx" into inclusive ranges
+func parseStatusRanges(specs []string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, spec := range specs {
+		spec = strings.ToLower(strings.TrimSpace(spec))
+		var lo, hi int
+		var err error
+		switch {
+		case len(spec) == 3 && strings.HasSuffix(spec, "xx"):
+			lo, err = strconv.Atoi(spec[:1])
+			lo, hi = lo*100, lo*100+99
+		case strings.Contains(spec, "-"):
+			parts := strings.SplitN(spec, "-", 2)
+			lo, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+			if err == nil {
+				hi, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			}
+		default:
+			lo, err = strconv.Atoi(spec)
+			hi = lo
+		}
+		if err != nil || lo < 100 || hi > 599 || lo > hi {
+			return nil, fmt.Errorf("invalid expected status %q", spec)
+		}
+		ranges = append(ranges, [2]int{lo, hi})
+	}
+	return ranges, nil
+}
+
+func statusExpected(code int, ranges [][2]int) bool {
+	if len(ranges) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, r := range ranges {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHTTP requests the monitor's URL and evaluates the expected status and assertions.
+// Every failure is listed in errMsg.
+func checkHTTP(m *Monitor, timeout time.Duration) (status string, statusCode int, errMsg string, timings *HTTPTimings) {
+	cfg := m.HTTP
+	if cfg == nil {
+		cfg = &HTTPMonitorConfig{}
+	}
+	if cfg.openErr != nil {
+		return "down", 0, cfg.openErr.Error(), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ex, err := doMonitorRequest(ctx, m.URL, cfg, nil)
+	if err != nil {
+		return "down", ex.statusCode(), err.Error(), ex.timings
+	}
+	if failures := cfg.failures(ex); len(failures) > 0 {
+		return "down", ex.statusCode(), strings.Join(failures, "; "), ex.timings
+	}
+	return "up", ex.statusCode(), "", ex.timings
+}
+
+// httpExchange is a request a check made and what came back. resp is nil when the
+// request failed.
+type httpExchange struct {
+	resp    *http.Response
+	body    []byte
+	elapsed time.Duration
+	timings *HTTPTimings
+}
+
+func (e *httpExchange) statusCode() int {
+	if e.resp == nil {
+		return 0
+	}
+	return e.resp.StatusCode
+}
+
+// doMonitorRequest makes the request cfg describes to target, reading up to
+// maxMonitorBody of the response. jar, when set, carries cookies between requests.
+// The exchange is returned with an error too, for the timings and status it got to.
+func doMonitorRequest(ctx context.Context, target string, cfg *HTTPMonitorConfig, jar http.CookieJar) (*httpExchange, error) {
+	method := cfg.Method
+	if method == "" {
+		method = "GET"
+	}
+	var body io.Reader
+	if cfg.Body != "" {
+		body = strings.NewReader(cfg.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return &httpExchange{}, err
+	}
+	for k, v := range cfg.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	if cfg.Auth != nil {
+		switch cfg.Auth.Type {
+		case "basic":
+			req.SetBasicAuth(cfg.Auth.Username, cfg.Auth.Password)
+		case "bearer":
+			req.Header.Set("Authorization", "Bearer "+cfg.Auth.Token)
+		}
+	}
+
+	req, snapshot := traceHTTPTimings(req)
+
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify},
+		DisableKeepAlives: true, // measure a fresh connection every check
+	}
+	defer transport.CloseIdleConnections()
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	client := http.Client{
+		Transport: transport,
+		Jar:       jar,
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if cfg.FollowRedirects != nil && !*cfg.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return &httpExchange{timings: snapshot()}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxMonitorBody))
+	ex := &httpExchange{resp: resp, body: respBody, elapsed: time.Since(start), timings: snapshot()}
+	if err != nil {
+		return ex, errors.New("reading body: " + err.Error())
+	}
+	return ex, nil
+}
+
+// failures lists the expected status and assertions the exchange doesn't meet
+func (c *HTTPMonitorConfig) failures(ex *httpExchange) []string {
+	var failures []string
+	ranges, _ := parseStatusRanges(c.ExpectedStatus)
+	if !statusExpected(ex.resp.StatusCode, ranges) {
+		if len(ranges) == 0 {
+			failures = append(failures, ex.resp.Status)
+		} else {
+			failures = append(failures, fmt.Sprintf("status %s, expected %s", ex.resp.Status, strings.Join(c.ExpectedStatus, ", ")))
+		}
+	}
+	for _, a := range c.Assertions {
+		if msg := a.evaluate(ex.resp, ex.body, ex.elapsed); msg != "" {
+			failures = append(failures, msg)
+		}
+	}
+	return failures
+}
+
+// traceHTTPTimings times the phases of req. snapshot copies the timings once the
+// response is in; a losing dual-stack dial may still report late.
+func traceHTTPTimings(req *http.Request) (traced *http.Request, snapshot func() *HTTPTimings) {
+	// Dual-stack dials can report connects concurrently
+	var mu sync.Mutex
+	phase := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	timings := &HTTPTimings{}
+	var dnsStart, connectStart, tlsStart, wroteRequest time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { phase(func() { dnsStart = time.Now() }) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			phase(func() { timings.DNS += durationMillis(time.Since(dnsStart)) })
+		},
+		ConnectStart: func(string, string) { phase(func() { connectStart = time.Now() }) },
+		ConnectDone: func(string, string, error) {
+			phase(func() { timings.Connect += durationMillis(time.Since(connectStart)) })
+		},
+		TLSHandshakeStart: func() { phase(func() { tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			phase(func() { timings.TLS += durationMillis(time.Since(tlsStart)) })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { phase(func() { wroteRequest = time.Now() }) },
+		GotFirstResponseByte: func() {
+			phase(func() { timings.TTFB = durationMillis(time.Since(wroteRequest)) })
+		},
+	}
+	snapshot = func() *HTTPTimings {
+		mu.Lock()
+		defer mu.Unlock()
+		c := *timings
+		return &c
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), snapshot
+}
+
+// evaluate returns why the assertion failed, or "" if it passed
+func (a HTTPAssertion) evaluate(resp *http.Response, body []byte, elapsed time.Duration) string {
+	switch a.Source {
+	case "body":
+		return a.compare("body", string(body), true)
+	case "header":
+		values := resp.Header.Values(a.Property)
+		return a.compare("header "+a.Property, strings.Join(values, ", "), len(values) > 0)
+	case "json":
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "body is not valid JSON"
+		}
+		value, found := lookupJSONPath(doc, a.Property)
+		return a.compare("json "+a.Property, jsonValueString(value), found)
+	case "response_time":
+		limit, _ := strconv.ParseFloat(a.Value, 64)
+		if ms := durationMillis(elapsed); ms >= limit {
+			return fmt.Sprintf("response time %.0fms exceeds %sms", ms, a.Value)
+		}
+	}
+	return ""
+}
+
+// compare applies the operator to actual; found is false when the header or JSON path is missing
+func (a HTTPAssertion) compare(subject, actual string, found bool) string {
+	switch a.Operator {
+	case "exists":
+		if !found {
+			return subject + " is missing"
+		}
+		return ""
+	case "not_exists":
+		if found {
+			return subject + " is present"
+		}
+		return ""
+	}
+	if !found {
+		if a.Operator == "not_equals" || a.Operator == "not_contains" || a.Operator == "not_matches" {
+			return ""
+		}
+		return subject + " is missing"
+	}
+
+	quoted := truncateRunes(actual, 100)
+	switch a.Operator {
+	case "equals":
+		if actual != a.Value {
+			return fmt.Sprintf("%s is %q, expected %q", subject, quoted, a.Value)
+		}
+	case "not_equals":
+		if actual == a.Value {
+			return fmt.Sprintf("%s is %q", subject, a.Value)
+		}
+	case "contains":
+		if !strings.Contains(actual, a.Value) {
+			return fmt.Sprintf("%s does not contain %q", subject, a.Value)
+		}
+	case "not_contains":
+		if strings.Contains(actual, a.Value) {
+			return fmt.Sprintf("%s contains %q", subject, a.Value)
+		}
+	case "matches", "not_matches":
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			return fmt.Sprintf("invalid regex %q", a.Value)
+		}
+		if matched := re.MatchString(actual); matched != (a.Operator == "matches") {
+			if matched {
+				return fmt.Sprintf("%s matches /%s/", subject, a.Value)
+			}
+			return fmt.Sprintf("%s does not match /%s/", subject, a.Value)
+		}
+	case "less_than", "greater_than":
+		n, err := strconv.ParseFloat(actual, 64)
+		if err != nil {
+			return fmt.Sprintf("%s is %q, not a number", subject, quoted)
+		}
+		limit, _ := strconv.ParseFloat(a.Value, 64)
+		if a.Operator == "less_than" && !(n < limit) {
+			return fmt.Sprintf("%s is %s, expected less than %s", subject, actual, a.Value)
+		}
+		if a.Operator == "greater_than" && !(n > limit) {
+			return fmt.Sprintf("%s is %s, expected greater than %s", subject, actual, a.Value)
+		}
+	}
+	return ""
+}
+
+// lookupJSONPath resolves dotted paths with array indexes, e.g. "data.items[0].status".
+// A leading "$." is optional.
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, true
+	}
+	current := doc
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		var indexes []int
+		if i := strings.Index(part, "["); i >= 0 {
+			name = part[:i]
+			for _, idx := range strings.Split(strings.TrimSuffix(part[i+1:], "]"), "][") {
+				n, err := strconv.Atoi(idx)
+				if err != nil {
+					return nil, false
+				}
+				indexes = append(indexes, n)
+			}
+		}
+		if name != "" {
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if current, ok = obj[name]; !ok {
+				return nil, false
+			}
+		}
+		for _, n := range indexes {
+			arr, ok := current.([]interface{})
+			if !ok || n < 0 || n >= len(arr) {
+				return nil, false
+			}
+			current = arr[n]
+		}
+	}
+	return current, true
+}
+
+// jsonValueString renders strings bare and everything else as JSON
+func jsonValueString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
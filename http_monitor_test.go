@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestHTTPMonitorCredentialsSealed(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+
+	var mu sync.Mutex
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = r.Header.Clone()
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	m := newTestMonitor(t, db, project.ID, "API", server.URL)
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"http": {
+		"auth": {"type": "bearer", "token": "bearer-token-1234"},
+		"headers": {"X-Api-Key": "header-key-5678", "Accept": "application/json"}}}`))
+	rec := httptest.NewRecorder()
+	updateMonitor(rec, mux.SetURLVars(req, map[string]string{"id": m.ProjectID, "monitorId": m.ID}), db)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var stored string
+	db.QueryRow("SELECT http_config FROM monitors WHERE id = ?", m.ID).Scan(&stored)
+	if strings.Contains(stored, "bearer-token") || strings.Contains(stored, "header-key") || !strings.Contains(stored, "application/json") {
+		t.Errorf("stored http_config = %s", stored)
+	}
+
+	loaded, err := GetMonitor(db, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _, errMsg, _ := checkHTTP(loaded, 2*time.Second); status != "up" {
+		t.Fatalf("checkHTTP = %s %q", status, errMsg)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got.Get("Authorization") != "Bearer bearer-token-1234" || got.Get("X-Api-Key") != "header-key-5678" {
+		t.Errorf("server received %v", got)
+	}
+
+	// Created monitors are sealed the same way
+	created := &Monitor{ID: uuid.New().String(), ProjectID: project.ID, Name: "Admin", Type: "http", URL: server.URL,
+		Status: "up", CreatedAt: time.Now(), HTTP: &HTTPMonitorConfig{Auth: &HTTPMonitorAuth{Type: "basic", Username: "admin", Password: "basic-pass-9012"}}}
+	if err := CreateMonitor(db, created); err != nil {
+		t.Fatal(err)
+	}
+	db.QueryRow("SELECT http_config FROM monitors WHERE id = ?", created.ID).Scan(&stored)
+	if strings.Contains(stored, "basic-pass") {
+		t.Errorf("created http_config = %s", stored)
+	}
+	if again, _ := GetMonitor(db, created.ID); again.HTTP.Auth.Password != "basic-pass-9012" {
+		t.Errorf("password after load = %q", again.HTTP.Auth.Password)
+	}
+}
+
+func TestGRPCAndWebSocketCredentialsSealed(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+
+	m := &Monitor{ID: uuid.New().String(), ProjectID: project.ID, Name: "Orders", Type: "grpc", URL: "orders.example.test:443",
+		Status: "up", CreatedAt: time.Now(), GRPC: &GRPCMonitorConfig{Metadata: map[string]string{"authorization": "Bearer grpc-token-1234", "x-tenant": "acme"}}}
+	ws := &Monitor{ID: uuid.New().String(), ProjectID: project.ID, Name: "Feed", Type: "websocket", URL: "wss://feed.example.test",
+		Status: "up", CreatedAt: time.Now(), WebSocket: &WebSocketMonitorConfig{Headers: map[string]string{"Cookie": "session=ws-cookie-5678"}}}
+	for _, created := range []*Monitor{m, ws} {
+		if err := CreateMonitor(db, created); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var grpcConfig, websocketConfig string
+	db.QueryRow("SELECT grpc_config FROM monitors WHERE id = ?", m.ID).Scan(&grpcConfig)
+	db.QueryRow("SELECT websocket_config FROM monitors WHERE id = ?", ws.ID).Scan(&websocketConfig)
+	if strings.Contains(grpcConfig, "grpc-token") || !strings.Contains(grpcConfig, "acme") {
+		t.Errorf("stored grpc_config = %s", grpcConfig)
+	}
+	if strings.Contains(websocketConfig, "ws-cookie") {
+		t.Errorf("stored websocket_config = %s", websocketConfig)
+	}
+
+	if loaded, _ := GetMonitor(db, m.ID); loaded.GRPC.Metadata["authorization"] != "Bearer grpc-token-1234" {
+		t.Errorf("metadata after load = %v", loaded.GRPC.Metadata)
+	}
+	if loaded, _ := GetMonitor(db, ws.ID); loaded.WebSocket.Headers["Cookie"] != "session=ws-cookie-5678" {
+		t.Errorf("headers after load = %v", loaded.WebSocket.Headers)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Incident is a confirmed monitor outage, from its first failed check to recovery
+type Incident struct {
+	ID              string     `json:"id"`
+	MonitorID       string     `json:"monitor_id"`
+	MonitorName     string     `json:"monitor_name,omitempty"`
+	ProjectID       string     `json:"project_id"`
+	Status          string     `json:"status"` // open, resolved
+	RootError       string     `json:"root_error"`
+	RootStatusCode  int        `json:"root_status_code"`
+	StartedAt       time.Time  `json:"started_at"`
+	ConfirmedAt     time.Time  `json:"confirmed_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	DurationSeconds int64      `json:"duration_seconds"`
+	FailedChecks    int        `json:"failed_checks"`
+	AcknowledgedAt  *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy  string     `json:"acknowledged_by,omitempty"`
+}
+
+// IncidentTimelineEntry is one step of an incident's history
+type IncidentTimelineEntry struct {
+	Type   string    `json:"type"` // started, confirmed, acknowledged, resolved
+	At     time.Time `json:"at"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// IncidentStats summarises reliability over a period
+type IncidentStats struct {
+	MonitorID            string  `json:"monitor_id,omitempty"`
+	MonitorName          string  `json:"monitor_name,omitempty"`
+	Incidents            int     `json:"incidents"`
+	Open                 int     `json:"open"`
+	TotalDowntimeSeconds int64   `json:"total_downtime_seconds"`
+	UptimePercent        float64 `json:"uptime_percent"`
+	MTTRSeconds          int64   `json:"mttr_seconds"` // mean time to recovery of resolved incidents
+	MTBFSeconds          int64   `json:"mtbf_seconds"` // mean time between failures; 0 without incidents
+}
+
+// openMonitorIncident records a confirmed outage starting at downSince
+func openMonitorIncident(db *sql.DB, m *Monitor, check *MonitorCheck, downSince time.Time) {
+	if downSince.IsZero() {
+		downSince = check.CreatedAt
+	}
+
+	// The first failed check of the outage carries the root error
+	rootError, rootStatus := check.ErrorMessage, check.StatusCode
+	db.QueryRow(`SELECT error_message, status_code FROM monitor_checks
+		WHERE monitor_id = ? AND status = 'down' AND created_at >= ? ORDER BY created_at ASC LIMIT 1`,
+		m.ID, downSince).Scan(&rootError, &rootStatus)
+
+	_, err := db.Exec(`INSERT INTO incidents (id, monitor_id, project_id, status, root_error, root_status_code, started_at, confirmed_at)
+		VALUES (?, ?, ?, 'open', ?, ?, ?, ?)`,
+		uuid.New().String(), m.ID, m.ProjectID, rootError, rootStatus, downSince, check.CreatedAt)
+	if err != nil {
+		log.Printf("[Uptime] Failed to open incident for monitor %s: %v", m.ID, err)
+	}
+}
+
+// resolveMonitorIncident closes the monitor's open incident at resolvedAt
+func resolveMonitorIncident(db *sql.DB, monitorID string, resolvedAt time.Time) {
+	var id string
+	var startedAt time.Time
+	err := db.QueryRow("SELECT id, started_at FROM incidents WHERE monitor_id = ? AND status = 'open' ORDER BY started_at DESC LIMIT 1",
+		monitorID).Scan(&id, &startedAt)
+	if err != nil {
+		return
+	}
+
+	var failedChecks int
+	db.QueryRow("SELECT COUNT(*) FROM monitor_checks WHERE monitor_id = ? AND status = 'down' AND created_at >= ? AND created_at <= ?",
+		monitorID, startedAt, resolvedAt).Scan(&failedChecks)
+
+	_, err = db.Exec(`UPDATE incidents SET status = 'resolved', resolved_at = ?, duration_seconds = ?, failed_checks = ? WHERE id = ?`,
+		resolvedAt, int64(resolvedAt.Sub(startedAt).Seconds()), failedChecks, id)
+	if err != nil {
+		log.Printf("[Uptime] Failed to resolve incident %s: %v", id, err)
+	}
+}
+
+const incidentColumns = `i.id, i.monitor_id, COALESCE(m.name, ''), i.project_id, i.status, i.root_error, i.root_status_code,
+	i.started_at, i.confirmed_at, i.resolved_at, i.duration_seconds, i.failed_checks, i.acknowledged_at, i.acknowledged_by`
+
+func scanIncident(row interface{ Scan(...interface{}) error }) (*Incident, error) {
+	var inc Incident
+	var resolvedAt, acknowledgedAt sql.NullTime
+	err := row.Scan(&inc.ID, &inc.MonitorID, &inc.MonitorName, &inc.ProjectID, &inc.Status, &inc.RootError, &inc.RootStatusCode,
+		&inc.StartedAt, &inc.ConfirmedAt, &resolvedAt, &inc.DurationSeconds, &inc.FailedChecks, &acknowledgedAt, &inc.AcknowledgedBy)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		inc.ResolvedAt = &resolvedAt.Time
+	}
+	if acknowledgedAt.Valid {
+		inc.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if inc.Status == "open" {
+		// Ongoing incidents report their duration so far
+		inc.DurationSeconds = int64(time.Since(inc.StartedAt).Seconds())
+	}
+	return &inc, nil
+}
+
+// GetIncidents lists a project's incidents, newest first, optionally for one monitor
+func GetIncidents(db *sql.DB, projectID, monitorID, status string, limit, offset int) ([]Incident, int, error) {
+	where := " WHERE i.project_id = ?"
+	args := []interface{}{projectID}
+	if monitorID != "" {
+		where += " AND i.monitor_id = ?"
+		args = append(args, monitorID)
+	}
+	if status != "" {
+		where += " AND i.status = ?"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM incidents i"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query("SELECT "+incidentColumns+" FROM incidents i LEFT JOIN monitors m ON m.id = i.monitor_id"+where+
+		" ORDER BY i.started_at DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	incidents := []Incident{}
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		incidents = append(incidents, *inc)
+	}
+	return incidents, total, rows.Err()
+}
+
+func GetIncident(db *sql.DB, projectID, id string) (*Incident, error) {
+	return scanIncident(db.QueryRow("SELECT "+incidentColumns+" FROM incidents i LEFT JOIN monitors m ON m.id = i.monitor_id WHERE i.project_id = ? AND i.id = ?",
+		projectID, id))
+}
+
+// GetIncidentStats computes incident count, downtime, MTTR and MTBF for each monitor of
+// the project since the given time, plus a project-wide total
+func GetIncidentStats(db *sql.DB, projectID, monitorID string, since time.Time) (*IncidentStats, []IncidentStats, error) {
+	monitors, err := GetProjectMonitors(db, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	total := &IncidentStats{}
+	var totalObserved, totalUptime time.Duration
+	var resolvedCount int
+	var resolvedDuration time.Duration
+	perMonitor := []IncidentStats{}
+
+	for _, m := range monitors {
+		if monitorID != "" && m.ID != monitorID {
+			continue
+		}
+		windowStart := since
+		if m.CreatedAt.After(windowStart) {
+			windowStart = m.CreatedAt
+		}
+		// Planned maintenance is left out of the observed time
+		maintenance := monitorMaintenance(db, &m, windowStart, now)
+		observed := now.Sub(windowStart) - overlapDuration(windowStart, now, maintenance)
+		if observed <= 0 {
+			continue
+		}
+
+		stats, downtime, resolved, resolvedTime := monitorIncidentStats(db, m.ID, windowStart, now, maintenance)
+		stats.MonitorID = m.ID
+		stats.MonitorName = m.Name
+		stats.UptimePercent = uptimePercent(observed, downtime)
+		if stats.Incidents > 0 {
+			stats.MTBFSeconds = int64((observed - downtime).Seconds()) / int64(stats.Incidents)
+		}
+		if resolved > 0 {
+			stats.MTTRSeconds = int64(resolvedTime.Seconds()) / int64(resolved)
+		}
+		perMonitor = append(perMonitor, stats)
+
+		total.Incidents += stats.Incidents
+		total.Open += stats.Open
+		total.TotalDowntimeSeconds += stats.TotalDowntimeSeconds
+		totalObserved += observed
+		totalUptime += observed - downtime
+		resolvedCount += resolved
+		resolvedDuration += resolvedTime
+	}
+
+	total.UptimePercent = uptimePercent(totalObserved, totalObserved-totalUptime)
+	if total.Incidents > 0 {
+		total.MTBFSeconds = int64(totalUptime.Seconds()) / int64(total.Incidents)
+	}
+	if resolvedCount > 0 {
+		total.MTTRSeconds = int64(resolvedDuration.Seconds()) / int64(resolvedCount)
+	}
+	return total, perMonitor, nil
+}
+
+// monitorIncidentStats sums incidents overlapping [from, to], clipping their downtime to the
+// window. Downtime during maintenance doesn't count.
+func monitorIncidentStats(db *sql.DB, monitorID string, from, to time.Time, maintenance []timeRange) (stats IncidentStats, downtime time.Duration, resolved int, resolvedTime time.Duration) {
+	rows, err := db.Query(`SELECT started_at, resolved_at, status FROM incidents
+		WHERE monitor_id = ? AND (resolved_at IS NULL OR resolved_at >= ?) AND started_at <= ?`, monitorID, from, to)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var startedAt time.Time
+		var resolvedAt sql.NullTime
+		var status string
+		if rows.Scan(&startedAt, &resolvedAt, &status) != nil {
+			continue
+		}
+		end := to
+		if resolvedAt.Valid {
+			end = resolvedAt.Time
+			resolved++
+			resolvedTime += resolvedAt.Time.Sub(startedAt)
+		}
+		if status == "open" {
+			stats.Open++
+		}
+		stats.Incidents++
+
+		start := startedAt
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(start) {
+			downtime += end.Sub(start) - overlapDuration(start, end, maintenance)
+		}
+	}
+	stats.TotalDowntimeSeconds = int64(downtime.Seconds())
+	return
+}
+
+func uptimePercent(observed, downtime time.Duration) float64 {
+	if observed <= 0 {
+		return 100
+	}
+	if downtime > observed {
+		downtime = observed
+	}
+	return float64(observed-downtime) / float64(observed) * 100
+}
+
+// Incident handlers
+
+func getIncidents(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	monitorID := vars["monitorId"]
+	if monitorID == "" {
+		monitorID = query.Get("monitor_id")
+	}
+
+	incidents, total, err := GetIncidents(db, vars["id"], monitorID, query.Get("status"), limit, offset)
+	if err != nil {
+		log.Printf("Error fetching incidents: %v", err)
+		http.Error(w, "Failed to fetch incidents", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"incidents": incidents,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// getIncident returns an incident with its timeline and the checks made during it
+func getIncident(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	inc, err := GetIncident(db, vars["id"], vars["incidentId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Incident not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch incident", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	timeline := []IncidentTimelineEntry{
+		{Type: "started", At: inc.StartedAt, Detail: inc.RootError},
+		{Type: "confirmed", At: inc.ConfirmedAt},
+	}
+	if inc.AcknowledgedAt != nil {
+		timeline = append(timeline, IncidentTimelineEntry{Type: "acknowledged", At: *inc.AcknowledgedAt, Detail: inc.AcknowledgedBy})
+	}
+	end := time.Now()
+	if inc.ResolvedAt != nil {
+		timeline = append(timeline, IncidentTimelineEntry{Type: "resolved", At: *inc.ResolvedAt})
+		end = *inc.ResolvedAt
+	}
+
+	checks := []MonitorCheck{}
+	rows, err := db.Query(`SELECT `+monitorCheckColumns+` FROM monitor_checks
+		WHERE monitor_id = ? AND created_at >= ? AND created_at <= ? ORDER BY created_at ASC LIMIT 500`,
+		inc.MonitorID, inc.StartedAt, end)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			if c, err := scanMonitorCheck(rows); err == nil {
+				checks = append(checks, *c)
+			}
+		}
+	}
+	if inc.Status == "open" {
+		for _, c := range checks {
+			if c.Status == "down" {
+				inc.FailedChecks++
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"incident": inc,
+		"timeline": timeline,
+		"checks":   checks,
+	})
+}
+
+func acknowledgeIncident(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	id := vars["incidentId"]
+
+	acknowledgedBy := ""
+	if claims, err := claimsFromRequest(r); err == nil {
+		acknowledgedBy = claims.Email
+	}
+
+	res, err := db.Exec("UPDATE incidents SET acknowledged_at = ?, acknowledged_by = ? WHERE project_id = ? AND id = ? AND acknowledged_at IS NULL",
+		time.Now(), acknowledgedBy, projectID, id)
+	if err != nil {
+		http.Error(w, "Failed to acknowledge incident", http.StatusInternalServerError)
+		return
+	}
+
+	inc, err := GetIncident(db, projectID, id)
+	if err != nil {
+		http.Error(w, "Incident not found", http.StatusNotFound)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Incident already acknowledged", http.StatusConflict)
+		return
+	}
+
+	recordAudit(db, r, "incident.acknowledge", "incident", id, nil, inc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inc)
+}
+
+func getIncidentStats(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	days, _ := strconv.Atoi(query.Get("days"))
+	if days <= 0 {
+		days = 30
+	}
+	if days > 365 {
+		days = 365
+	}
+
+	monitorID := vars["monitorId"]
+	if monitorID == "" {
+		monitorID = query.Get("monitor_id")
+	}
+
+	total, perMonitor, err := GetIncidentStats(db, vars["id"], monitorID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("Error computing incident stats: %v", err)
+		http.Error(w, "Failed to compute incident stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":     days,
+		"total":    total,
+		"monitors": perMonitor,
+	})
+}
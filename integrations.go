@@ -0,0 +1,876 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ProjectIntegration is a natively formatted notification channel configured per project
+type ProjectIntegration struct {
+	ID        string            `json:"id"`
+	ProjectID string            `json:"project_id"`
+	Type      string            `json:"type"` // slack, discord, teams, pagerduty, opsgenie
+	Name      string            `json:"name"`
+	Enabled   bool              `json:"enabled"`
+	Config    map[string]string `json:"config"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+
+	// openErr is set when a stored secret can't be decrypted
+	openErr error
+}
+
+// Required config keys per integration type. api_url may be set on pagerduty and
+// opsgenie to point at a proxy or a local stub.
+var integrationRequiredConfig = map[string][]string{
+	"slack":     {"webhook_url"},
+	"discord":   {"webhook_url"},
+	"teams":     {"webhook_url"},
+	"pagerduty": {"routing_key"},
+	"opsgenie":  {"api_key"},
+}
+
+var integrationSecretKeys = map[string]bool{
+	"webhook_url": true,
+	"routing_key": true,
+	"api_key":     true,
+}
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	opsgenieAPIURL     = "https://api.opsgenie.com"
+	opsgenieEUAPIURL   = "https://api.eu.opsgenie.com"
+	maskedSecretPrefix = "••••"
+)
+
+// isIncidentIntegration reports whether the integration pages people and tracks
+// incident state, as opposed to posting into a chat channel
+func isIncidentIntegration(integrationType string) bool {
+	return integrationType == "pagerduty" || integrationType == "opsgenie"
+}
+
+// integrationDedupKey identifies an issue in external incident tools so repeated
+// alerts update one incident and resolving the issue closes it
+func integrationDedupKey(projectID, fingerprint string) string {
+	return "pulse:" + projectID + ":" + fingerprint
+}
+
+// sendIntegrationAlert formats n for the integration and queues the delivery. Incident
+// tools get an open alert recorded so resolving the issue closes it.
+func sendIntegrationAlert(db *sql.DB, integ *ProjectIntegration, n *AlertNotification) error {
+	dedupKey := integrationDedupKey(n.Project.ID, n.Event.Fingerprint)
+	if err := queueIntegrationAlert(db, integ, n, dedupKey); err != nil {
+		return err
+	}
+
+	if !isIncidentIntegration(integ.Type) {
+		return nil
+	}
+	_, err := db.Exec(`
+		INSERT INTO integration_alerts (integration_id, fingerprint, dedup_key, status, updated_at) VALUES (?, ?, ?, 'open', ?)
+		ON CONFLICT(integration_id, fingerprint) DO UPDATE SET status = 'open', updated_at = excluded.updated_at`,
+		integ.ID, n.Event.Fingerprint, dedupKey, time.Now())
+	return err
+}
+
+func queueIntegrationAlert(db *sql.DB, integ *ProjectIntegration, n *AlertNotification, dedupKey string) error {
+	if integ.openErr != nil {
+		return integ.openErr
+	}
+	link := fmt.Sprintf("%s/errors/%s", getPublicURL(db), n.Event.ID)
+
+	if _, ok := integrationRequiredConfig[integ.Type]; !ok {
+		return fmt.Errorf("unknown integration type %q", integ.Type)
+	}
+	text := renderNotification(db, integ.Type, n)
+
+	var err error
+	switch integ.Type {
+	case "slack":
+		_, err = enqueueWebhook(db, n.Project.ID, integ.Config["webhook_url"], "alert", slackAlertPayload(n, link, text))
+	case "discord":
+		_, err = enqueueWebhook(db, n.Project.ID, integ.Config["webhook_url"], "alert", discordAlertPayload(n, link, text))
+	case "teams":
+		_, err = enqueueWebhook(db, n.Project.ID, integ.Config["webhook_url"], "alert", teamsAlertPayload(n, link, text))
+	case "pagerduty":
+		_, err = enqueueWebhook(db, n.Project.ID, pagerDutyURL(integ), "alert", pagerDutyTriggerPayload(integ, n, link, dedupKey, text))
+	case "opsgenie":
+		_, err = enqueueWebhookWithHeaders(db, n.Project.ID, opsgenieBaseURL(integ)+"/v2/alerts", "alert",
+			opsgenieHeaders(integ), opsgenieAlertPayload(n, link, dedupKey, text))
+	}
+	return err
+}
+
+// queueIntegrationResolve queues the PagerDuty resolve or Opsgenie close for dedupKey
+func queueIntegrationResolve(db *sql.DB, projectID string, integ *ProjectIntegration, dedupKey string) (*WebhookDelivery, error) {
+	if integ.openErr != nil {
+		return nil, integ.openErr
+	}
+	switch integ.Type {
+	case "pagerduty":
+		return enqueueWebhook(db, projectID, pagerDutyURL(integ), "resolve", map[string]interface{}{
+			"routing_key":  integ.Config["routing_key"],
+			"event_action": "resolve",
+			"dedup_key":    dedupKey,
+		})
+	case "opsgenie":
+		return enqueueWebhookWithHeaders(db, projectID,
+			opsgenieBaseURL(integ)+"/v2/alerts/"+url.PathEscape(dedupKey)+"/close?identifierType=alias", "resolve",
+			opsgenieHeaders(integ), map[string]interface{}{
+				"source": "Pulse",
+				"note":   "Issue resolved in Pulse",
+			})
+	}
+	return nil, fmt.Errorf("%s alerts can't be resolved", integ.Type)
+}
+
+// resolveIntegrationAlerts closes open PagerDuty incidents and Opsgenie alerts for an issue
+func resolveIntegrationAlerts(db *sql.DB, projectID, fingerprint string) {
+	rows, err := db.Query(`SELECT a.integration_id, a.dedup_key FROM integration_alerts a
+		JOIN project_integrations i ON i.id = a.integration_id
+		WHERE i.project_id = ? AND a.fingerprint = ? AND a.status = 'open'`, projectID, fingerprint)
+	if err != nil {
+		log.Printf("[Integrations] Failed to load open alerts for %s: %v", fingerprint, err)
+		return
+	}
+	type openAlert struct{ integrationID, dedupKey string }
+	var open []openAlert
+	for rows.Next() {
+		var a openAlert
+		if rows.Scan(&a.integrationID, &a.dedupKey) == nil {
+			open = append(open, a)
+		}
+	}
+	rows.Close()
+
+	for _, a := range open {
+		integ, err := GetProjectIntegration(db, projectID, a.integrationID)
+		if err != nil || !integ.Enabled {
+			continue
+		}
+		if _, err := queueIntegrationResolve(db, projectID, integ, a.dedupKey); err != nil {
+			log.Printf("[Integrations] Failed to queue resolve for %s via %s: %v", fingerprint, integ.Type, err)
+			continue
+		}
+
+		db.Exec("UPDATE integration_alerts SET status = 'resolved', updated_at = ? WHERE integration_id = ? AND fingerprint = ?",
+			time.Now(), a.integrationID, fingerprint)
+		log.Printf("[Integrations] Resolved %s alert for issue %s", integ.Type, fingerprint)
+	}
+}
+
+// sendIntegrationDigest posts a digest to chat integrations. Incident tools don't
+// take digests; their alerts are always sent immediately.
+func sendIntegrationDigest(db *sql.DB, integ *ProjectIntegration, d *NotificationDigest) error {
+	if integ.openErr != nil {
+		return integ.openErr
+	}
+	text := d.text()
+	var payload interface{}
+	switch integ.Type {
+	case "slack":
+		payload = map[string]interface{}{
+			"text": d.title(),
+			"blocks": []interface{}{
+				map[string]interface{}{"type": "header", "text": slackText("plain_text", d.title())},
+				map[string]interface{}{"type": "section", "text": slackText("mrkdwn", truncateRunes(text, 2900))},
+			},
+		}
+	case "discord":
+		payload = map[string]interface{}{
+			"username": "Pulse",
+			"embeds": []interface{}{map[string]interface{}{
+				"title":       d.title(),
+				"url":         d.Link,
+				"description": truncateRunes(text, 4000),
+				"color":       0x6366f1,
+			}},
+		}
+	case "teams":
+		payload = teamsCard([]interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": d.title(), "weight": "Bolder", "size": "Medium", "wrap": true},
+			map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true},
+		}, "Open project", d.Link)
+	default:
+		return nil
+	}
+	_, err := enqueueWebhook(db, d.Project.ID, integ.Config["webhook_url"], "digest", payload)
+	return err
+}
+
+// Native payload builders
+
+func levelColor(level string) int {
+	switch level {
+	case "fatal":
+		return 0x7f1d1d
+	case "error":
+		return 0xef4444
+	case "warning":
+		return 0xf59e0b
+	case "info":
+		return 0x3b82f6
+	}
+	return 0x64748b
+}
+
+func truncateRunes(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+func alertTitle(n *AlertNotification) string {
+	return truncateRunes(fmt.Sprintf("[%s] %s", strings.ToUpper(n.Event.Level), n.Event.Message), 150)
+}
+
+func alertFacts(n *AlertNotification) [][2]string {
+	return [][2]string{
+		{"Project", n.Project.Name},
+		{"Level", n.Event.Level},
+		{"Environment", valueOrDash(n.Event.Environment)},
+		{"Release", valueOrDash(n.Event.Release)},
+		{"Events", fmt.Sprintf("%d", n.EventCount)},
+		{"Users", fmt.Sprintf("%d", n.UserCount)},
+	}
+}
+
+func slackText(kind, text string) map[string]interface{} {
+	return map[string]interface{}{"type": kind, "text": text}
+}
+
+// slackAlertPayload renders an alert as Slack Block Kit with link buttons; text is
+// the rendered slack template
+func slackAlertPayload(n *AlertNotification, link, text string) map[string]interface{} {
+	var fields []interface{}
+	for _, f := range alertFacts(n) {
+		fields = append(fields, slackText("mrkdwn", fmt.Sprintf("*%s*\n%s", f[0], f[1])))
+	}
+
+	blocks := []interface{}{
+		map[string]interface{}{"type": "section", "text": slackText("mrkdwn", truncateRunes(text, 3000))},
+		map[string]interface{}{"type": "section", "fields": fields},
+	}
+	if frames := topFrames(n.Event.Stacktrace, 3); len(frames) > 0 {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": slackText("mrkdwn", "```"+strings.Join(frames, "\n")+"```"),
+		})
+	}
+	if len(n.Triggers) > 0 {
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "context",
+			"elements": []interface{}{slackText("mrkdwn", "Triggered by: "+strings.Join(n.Triggers, ", "))},
+		})
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type": "actions",
+		"elements": []interface{}{
+			map[string]interface{}{
+				"type":      "button",
+				"text":      slackText("plain_text", "View issue"),
+				"url":       link,
+				"style":     "primary",
+				"action_id": "pulse_view_issue",
+			},
+			map[string]interface{}{
+				"type":      "button",
+				"text":      slackText("plain_text", "Open project"),
+				"url":       strings.TrimSuffix(link, "/errors/"+n.Event.ID) + "/projects/" + n.Project.ID,
+				"action_id": "pulse_open_project",
+			},
+		},
+	})
+
+	return map[string]interface{}{
+		"text":   text, // fallback for notifications and clients that don't render blocks
+		"blocks": blocks,
+	}
+}
+
+// discordAlertPayload renders an alert as a Discord embed
+func discordAlertPayload(n *AlertNotification, link, text string) map[string]interface{} {
+	var fields []interface{}
+	for _, f := range alertFacts(n) {
+		fields = append(fields, map[string]interface{}{"name": f[0], "value": f[1], "inline": true})
+	}
+	if frames := topFrames(n.Event.Stacktrace, 3); len(frames) > 0 {
+		fields = append(fields, map[string]interface{}{
+			"name":  "Top frames",
+			"value": truncateRunes("```"+strings.Join(frames, "\n")+"```", 1024),
+		})
+	}
+
+	embed := map[string]interface{}{
+		"title":       alertTitle(n),
+		"url":         link,
+		"description": truncateRunes(text, 4000),
+		"color":       levelColor(n.Event.Level),
+		"fields":      fields,
+		"timestamp":   n.Event.Timestamp.UTC().Format(time.RFC3339),
+	}
+	if len(n.Triggers) > 0 {
+		embed["footer"] = map[string]interface{}{"text": "Triggered by: " + strings.Join(n.Triggers, ", ")}
+	}
+	return map[string]interface{}{
+		"username": "Pulse",
+		"embeds":   []interface{}{embed},
+	}
+}
+
+func teamsCard(body []interface{}, actionTitle, actionURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+				"actions": []interface{}{map[string]interface{}{
+					"type":  "Action.OpenUrl",
+					"title": actionTitle,
+					"url":   actionURL,
+				}},
+			},
+		}},
+	}
+}
+
+// teamsAlertPayload renders an alert as a Microsoft Teams Adaptive Card
+func teamsAlertPayload(n *AlertNotification, link, text string) map[string]interface{} {
+	var facts []interface{}
+	for _, f := range alertFacts(n) {
+		facts = append(facts, map[string]interface{}{"title": f[0], "value": f[1]})
+	}
+
+	color := "Attention"
+	if n.Event.Level == "warning" {
+		color = "Warning"
+	} else if n.Event.Level == "info" || n.Event.Level == "debug" {
+		color = "Accent"
+	}
+
+	body := []interface{}{
+		map[string]interface{}{"type": "TextBlock", "text": alertTitle(n), "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+		map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true},
+		map[string]interface{}{"type": "FactSet", "facts": facts},
+	}
+	if frames := topFrames(n.Event.Stacktrace, 3); len(frames) > 0 {
+		body = append(body, map[string]interface{}{"type": "TextBlock", "text": strings.Join(frames, "\n\n"), "fontType": "Monospace", "wrap": true, "size": "Small"})
+	}
+	return teamsCard(body, "View issue", link)
+}
+
+func pagerDutyURL(integ *ProjectIntegration) string {
+	if u := integ.Config["api_url"]; u != "" {
+		return u
+	}
+	return pagerDutyEventsURL
+}
+
+func pagerDutySeverity(level string) string {
+	switch level {
+	case "fatal":
+		return "critical"
+	case "error":
+		return "error"
+	case "warning":
+		return "warning"
+	}
+	return "info"
+}
+
+// pagerDutyTriggerPayload builds a PagerDuty Events API v2 trigger
+func pagerDutyTriggerPayload(integ *ProjectIntegration, n *AlertNotification, link, dedupKey, summary string) map[string]interface{} {
+	details := map[string]interface{}{
+		"environment": n.Event.Environment,
+		"release":     n.Event.Release,
+		"event_count": n.EventCount,
+		"user_count":  n.UserCount,
+		"triggers":    n.Triggers,
+	}
+	if frames := topFrames(n.Event.Stacktrace, 5); len(frames) > 0 {
+		details["top_frames"] = frames
+	}
+
+	return map[string]interface{}{
+		"routing_key":  integ.Config["routing_key"],
+		"event_action": "trigger",
+		"dedup_key":    dedupKey,
+		"payload": map[string]interface{}{
+			"summary":        truncateRunes(summary, 1024),
+			"source":         "pulse/" + n.Project.Name,
+			"severity":       pagerDutySeverity(n.Event.Level),
+			"timestamp":      n.Event.Timestamp.UTC().Format(time.RFC3339),
+			"component":      n.Project.Name,
+			"class":          n.Event.Level,
+			"custom_details": details,
+		},
+		"links":  []interface{}{map[string]string{"href": link, "text": "View issue in Pulse"}},
+		"client": "Pulse",
+	}
+}
+
+func opsgenieBaseURL(integ *ProjectIntegration) string {
+	if u := integ.Config["api_url"]; u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	if strings.EqualFold(integ.Config["region"], "eu") {
+		return opsgenieEUAPIURL
+	}
+	return opsgenieAPIURL
+}
+
+func opsgenieHeaders(integ *ProjectIntegration) map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + integ.Config["api_key"]}
+}
+
+func opsgeniePriority(level string) string {
+	switch level {
+	case "fatal":
+		return "P1"
+	case "error":
+		return "P2"
+	case "warning":
+		return "P3"
+	case "info":
+		return "P4"
+	}
+	return "P5"
+}
+
+// opsgenieAlertPayload builds an Opsgenie Alert API create request
+func opsgenieAlertPayload(n *AlertNotification, link, alias, message string) map[string]interface{} {
+	var description strings.Builder
+	fmt.Fprintf(&description, "%s\n\n", n.Event.Message)
+	for _, f := range alertFacts(n) {
+		fmt.Fprintf(&description, "%s: %s\n", f[0], f[1])
+	}
+	if frames := topFrames(n.Event.Stacktrace, 5); len(frames) > 0 {
+		description.WriteString("\nTop frames:\n  at " + strings.Join(frames, "\n  at ") + "\n")
+	}
+	fmt.Fprintf(&description, "\n%s\n", link)
+
+	tags := []string{"pulse", n.Event.Level}
+	if n.Event.Environment != "" {
+		tags = append(tags, n.Event.Environment)
+	}
+
+	return map[string]interface{}{
+		"message":     truncateRunes(message, 130),
+		"alias":       alias,
+		"description": truncateRunes(description.String(), 15000),
+		"priority":    opsgeniePriority(n.Event.Level),
+		"source":      "Pulse",
+		"entity":      n.Project.Name,
+		"tags":        tags,
+		"details": map[string]string{
+			"project":     n.Project.Name,
+			"environment": n.Event.Environment,
+			"release":     n.Event.Release,
+			"event_count": fmt.Sprintf("%d", n.EventCount),
+			"link":        link,
+		},
+	}
+}
+
+// validate normalises the integration and rejects incomplete configs
+func (integ *ProjectIntegration) validate() error {
+	required, ok := integrationRequiredConfig[integ.Type]
+	if !ok {
+		return fmt.Errorf("unsupported integration type %q", integ.Type)
+	}
+	if strings.TrimSpace(integ.Name) == "" {
+		integ.Name = integ.Type
+	}
+	if integ.Config == nil {
+		integ.Config = map[string]string{}
+	}
+	for _, key := range required {
+		if strings.TrimSpace(integ.Config[key]) == "" {
+			return fmt.Errorf("config.%s is required for %s", key, integ.Type)
+		}
+	}
+	for _, key := range []string{"webhook_url", "api_url"} {
+		if v := integ.Config[key]; v != "" {
+			if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("config.%s must be an http(s) URL", key)
+			}
+		}
+	}
+	if region := integ.Config["region"]; region != "" && !strings.EqualFold(region, "us") && !strings.EqualFold(region, "eu") {
+		return errors.New("config.region must be 'us' or 'eu'")
+	}
+	return nil
+}
+
+// masked returns a copy safe to send to clients, hiding secrets except the last 4 characters
+func (integ ProjectIntegration) masked() ProjectIntegration {
+	config := make(map[string]string, len(integ.Config))
+	for k, v := range integ.Config {
+		if integrationSecretKeys[k] {
+			v = maskSecret(v)
+		}
+		config[k] = v
+	}
+	integ.Config = config
+	return integ
+}
+
+// maskSecret hides all but the last 4 characters of a secret, and short secrets entirely
+func maskSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	tail := ""
+	if r := []rune(v); len(r) > 8 {
+		tail = string(r[len(r)-4:])
+	}
+	return maskedSecretPrefix + tail
+}
+
+// Integration database functions
+
+func GetProjectIntegrations(db *sql.DB, projectID string) ([]ProjectIntegration, error) {
+	rows, err := db.Query(`SELECT id, project_id, type, name, enabled, config, created_at, updated_at
+		FROM project_integrations WHERE project_id = ? ORDER BY created_at ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var integrations []ProjectIntegration
+	for rows.Next() {
+		integ, err := scanProjectIntegration(rows)
+		if err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, *integ)
+	}
+	return integrations, rows.Err()
+}
+
+func GetProjectIntegration(db *sql.DB, projectID, id string) (*ProjectIntegration, error) {
+	rows, err := db.Query(`SELECT id, project_id, type, name, enabled, config, created_at, updated_at
+		FROM project_integrations WHERE project_id = ? AND id = ?`, projectID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	return scanProjectIntegration(rows)
+}
+
+func scanProjectIntegration(rows *sql.Rows) (*ProjectIntegration, error) {
+	var integ ProjectIntegration
+	var config string
+	err := rows.Scan(&integ.ID, &integ.ProjectID, &integ.Type, &integ.Name, &integ.Enabled, &config, &integ.CreatedAt, &integ.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(config), &integ.Config)
+	integ.open()
+	return &integ, nil
+}
+
+// sealedConfig returns the config with webhook URLs and keys encrypted for storage
+func (integ *ProjectIntegration) sealedConfig() (map[string]string, error) {
+	config := make(map[string]string, len(integ.Config))
+	for k, v := range integ.Config {
+		if integrationSecretKeys[k] {
+			sealed, err := sealSecret(v)
+			if err != nil {
+				return nil, err
+			}
+			v = sealed
+		}
+		config[k] = v
+	}
+	return config, nil
+}
+
+// open decrypts the stored secrets in place
+func (integ *ProjectIntegration) open() {
+	for k, v := range integ.Config {
+		if !integrationSecretKeys[k] {
+			continue
+		}
+		plain, err := openSecret(v)
+		if err != nil {
+			integ.openErr = err
+			continue
+		}
+		integ.Config[k] = plain
+	}
+}
+
+func SaveProjectIntegration(db *sql.DB, integ *ProjectIntegration) error {
+	sealed, err := integ.sealedConfig()
+	if err != nil {
+		return err
+	}
+	config, _ := json.Marshal(sealed)
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO project_integrations (id, project_id, type, name, enabled, config, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		integ.ID, integ.ProjectID, integ.Type, integ.Name, integ.Enabled, string(config), integ.CreatedAt, integ.UpdatedAt,
+	)
+	return err
+}
+
+func DeleteProjectIntegration(db *sql.DB, projectID, id string) error {
+	res, err := db.Exec("DELETE FROM project_integrations WHERE project_id = ? AND id = ?", projectID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Integration handlers
+
+func getProjectIntegrations(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	integrations, err := GetProjectIntegrations(db, vars["id"])
+	if err != nil {
+		log.Printf("Error fetching integrations: %v", err)
+		http.Error(w, "Failed to fetch integrations", http.StatusInternalServerError)
+		return
+	}
+
+	masked := make([]ProjectIntegration, 0, len(integrations))
+	for _, integ := range integrations {
+		masked = append(masked, integ.masked())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(masked)
+}
+
+func createProjectIntegration(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	if _, err := GetProject(db, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	integ := ProjectIntegration{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&integ); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := integ.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	integ.ID = uuid.New().String()
+	integ.ProjectID = projectID
+	integ.CreatedAt = time.Now()
+	integ.UpdatedAt = integ.CreatedAt
+
+	if err := SaveProjectIntegration(db, &integ); err != nil {
+		log.Printf("Error creating integration: %v", err)
+		http.Error(w, "Failed to create integration", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "integration.create", "integration", integ.ID, nil, integ.masked())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(integ.masked())
+}
+
+func updateProjectIntegration(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	existing, err := GetProjectIntegration(db, projectID, vars["integrationId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Integration not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch integration", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var req struct {
+		Name    *string           `json:"name"`
+		Enabled *bool             `json:"enabled"`
+		Config  map[string]string `json:"config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	integ := *existing
+	integ.Config = make(map[string]string, len(existing.Config))
+	for k, v := range existing.Config {
+		integ.Config[k] = v
+	}
+	if req.Name != nil {
+		integ.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		integ.Enabled = *req.Enabled
+	}
+	for k, v := range req.Config {
+		// Masked values echoed back from a GET leave the stored secret untouched
+		if strings.HasPrefix(v, maskedSecretPrefix) {
+			continue
+		}
+		if v == "" {
+			delete(integ.Config, k)
+		} else {
+			integ.Config[k] = v
+		}
+	}
+	if err := integ.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	integ.UpdatedAt = time.Now()
+
+	if err := SaveProjectIntegration(db, &integ); err != nil {
+		log.Printf("Error updating integration: %v", err)
+		http.Error(w, "Failed to update integration", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "integration.update", "integration", integ.ID, existing.masked(), integ.masked())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(integ.masked())
+}
+
+func deleteProjectIntegration(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	id := vars["integrationId"]
+
+	existing, _ := GetProjectIntegration(db, projectID, id)
+
+	if err := DeleteProjectIntegration(db, projectID, id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Integration not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete integration", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var before interface{}
+	if existing != nil {
+		before = existing.masked()
+	}
+	recordAudit(db, r, "integration.delete", "integration", id, before, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testResolveDelay is how long after a test trigger its resolve is sent
+const testResolveDelay = 30 * time.Second
+
+// testProjectIntegration sends a sample alert built from the project's latest event
+func testProjectIntegration(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	integ, err := GetProjectIntegration(db, projectID, vars["integrationId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Integration not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch integration", http.StatusInternalServerError)
+		}
+		return
+	}
+	project, err := GetProject(db, projectID)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	n := sampleAlertNotification(db, project)
+	n.Event.Fingerprint = "test-" + uuid.New().String()[:8]
+	dedupKey := integrationDedupKey(project.ID, n.Event.Fingerprint)
+	if err := queueIntegrationAlert(db, integ, n, dedupKey); err != nil {
+		http.Error(w, "Failed to send test notification: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// A test shouldn't leave on-call with an open incident: it's resolved right after,
+	// and no integration_alerts row is kept. The resolve waits a little so a concurrent
+	// webhook worker can't deliver it before the trigger.
+	if isIncidentIntegration(integ.Type) {
+		resolve, err := queueIntegrationResolve(db, project.ID, integ, dedupKey)
+		if err != nil {
+			http.Error(w, "Failed to queue test resolve: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		db.Exec("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ?", time.Now().Add(testResolveDelay), resolve.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "queued"})
+}
+
+// sampleAlertNotification uses the project's most recent event, or a placeholder
+// when the project has none yet
+func sampleAlertNotification(db *sql.DB, project *Project) *AlertNotification {
+	n := &AlertNotification{
+		Project:  project,
+		Rule:     &AlertRule{Name: "Test notification"},
+		Triggers: []string{"test"},
+	}
+
+	var id string
+	if db.QueryRow("SELECT id FROM errors WHERE project_id = ? ORDER BY created_at DESC LIMIT 1", project.ID).Scan(&id) == nil {
+		if event, err := GetError(db, id); err == nil {
+			n.Event = event
+			n.EventCount, _ = countIssueEvents(db, event, 0)
+			n.UserCount, _ = countIssueUsers(db, event, 0)
+			return n
+		}
+	}
+
+	n.Event = &ErrorEvent{
+		ID:          uuid.New().String(),
+		ProjectID:   project.ID,
+		Message:     "This is a test notification from Pulse",
+		Level:       "error",
+		Environment: "production",
+		Timestamp:   time.Now(),
+		Stacktrace:  `{"frames":[{"filename":"main.go","function":"main","lineno":12},{"filename":"handler.go","function":"handleRequest","lineno":42}]}`,
+		Status:      "unresolved",
+		Fingerprint: "test",
+		CreatedAt:   time.Now(),
+	}
+	n.EventCount = 1
+	return n
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func newTestIntegration(t *testing.T, db *sql.DB, projectID, integrationType string, config map[string]string) *ProjectIntegration {
+	t.Helper()
+	integ := &ProjectIntegration{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Type:      integrationType,
+		Name:      integrationType,
+		Enabled:   true,
+		Config:    config,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := SaveProjectIntegration(db, integ); err != nil {
+		t.Fatalf("SaveProjectIntegration: %v", err)
+	}
+	return integ
+}
+
+func newTestNotification(project *Project) *AlertNotification {
+	return &AlertNotification{
+		Project: project,
+		Event: &ErrorEvent{
+			ID:          uuid.New().String(),
+			ProjectID:   project.ID,
+			Message:     "TypeError: cart is undefined",
+			Level:       "error",
+			Environment: "production",
+			Release:     "1.4.2",
+			Timestamp:   time.Now(),
+			Stacktrace:  `{"frames":[{"filename":"cart.js","function":"checkout","lineno":42}]}`,
+			Fingerprint: "fp-cart",
+		},
+		Rule:       &AlertRule{Name: "New issues"},
+		Triggers:   []string{"new_issue"},
+		EventCount: 3,
+		UserCount:  2,
+	}
+}
+
+// sendOne queues an alert through the integration and returns what the stub received
+func sendOne(t *testing.T, db *sql.DB, stub *webhookStub, integ *ProjectIntegration, n *AlertNotification) webhookRequest {
+	t.Helper()
+	if err := sendIntegrationAlert(db, integ, n); err != nil {
+		t.Fatalf("sendIntegrationAlert(%s): %v", integ.Type, err)
+	}
+	deliverQueuedWebhooks(t, db)
+	got := stub.received()
+	if len(got) == 0 {
+		t.Fatalf("%s: stub received nothing", integ.Type)
+	}
+	return got[len(got)-1]
+}
+
+func TestChatIntegrationPayloads(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	mustSetting(t, db, "public_url", "https://pulse.test")
+	stub := newWebhookStub(t)
+	n := newTestNotification(project)
+	link := "https://pulse.test/errors/" + n.Event.ID
+
+	t.Run("slack", func(t *testing.T) {
+		url := stub.URL + "/slack/T1/B1/token"
+		req := sendOne(t, db, stub, newTestIntegration(t, db, project.ID, "slack", map[string]string{"webhook_url": url}), n)
+		checkSignature(t, webhookSecret(t, db, url), req)
+		if req.Path != "/slack/T1/B1/token" || req.Header.Get("X-Pulse-Event") != "alert" {
+			t.Errorf("path %q event %q", req.Path, req.Header.Get("X-Pulse-Event"))
+		}
+		body := req.json(t)
+		if !strings.Contains(body["text"].(string), "cart is undefined") {
+			t.Errorf("fallback text = %v", body["text"])
+		}
+		blocks := body["blocks"].([]interface{})
+		actions := blocks[len(blocks)-1].(map[string]interface{})
+		button := actions["elements"].([]interface{})[0].(map[string]interface{})
+		if actions["type"] != "actions" || button["url"] != link {
+			t.Errorf("last block = %v", actions)
+		}
+		if !strings.Contains(string(req.Body), "cart.js") {
+			t.Errorf("top frames missing: %s", req.Body)
+		}
+	})
+
+	t.Run("discord", func(t *testing.T) {
+		url := stub.URL + "/discord/123/token"
+		req := sendOne(t, db, stub, newTestIntegration(t, db, project.ID, "discord", map[string]string{"webhook_url": url}), n)
+		checkSignature(t, webhookSecret(t, db, url), req)
+		embed := req.json(t)["embeds"].([]interface{})[0].(map[string]interface{})
+		if embed["url"] != link || embed["color"] != float64(levelColor("error")) {
+			t.Errorf("embed = %v", embed)
+		}
+		if !strings.Contains(embed["title"].(string), "cart is undefined") {
+			t.Errorf("embed title = %v", embed["title"])
+		}
+	})
+
+	t.Run("teams", func(t *testing.T) {
+		url := stub.URL + "/teams/workflow"
+		req := sendOne(t, db, stub, newTestIntegration(t, db, project.ID, "teams", map[string]string{"webhook_url": url}), n)
+		checkSignature(t, webhookSecret(t, db, url), req)
+		attachment := req.json(t)["attachments"].([]interface{})[0].(map[string]interface{})
+		card := attachment["content"].(map[string]interface{})
+		action := card["actions"].([]interface{})[0].(map[string]interface{})
+		if attachment["contentType"] != "application/vnd.microsoft.card.adaptive" || card["type"] != "AdaptiveCard" || action["url"] != link {
+			t.Errorf("card = %v", attachment)
+		}
+	})
+}
+
+func TestPagerDutyTriggerAndResolve(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	stub := newWebhookStub(t)
+	n := newTestNotification(project)
+	integ := newTestIntegration(t, db, project.ID, "pagerduty", map[string]string{
+		"routing_key": "R0UTINGKEY123456",
+		"api_url":     stub.URL + "/v2/enqueue",
+	})
+
+	trigger := sendOne(t, db, stub, integ, n).json(t)
+	dedupKey := integrationDedupKey(project.ID, "fp-cart")
+	if trigger["routing_key"] != "R0UTINGKEY123456" || trigger["event_action"] != "trigger" || trigger["dedup_key"] != dedupKey {
+		t.Errorf("trigger = %v", trigger)
+	}
+	payload := trigger["payload"].(map[string]interface{})
+	if payload["severity"] != "error" || payload["source"] != "pulse/checkout" {
+		t.Errorf("trigger payload = %v", payload)
+	}
+
+	resolveIntegrationAlerts(db, project.ID, "fp-cart")
+	deliverQueuedWebhooks(t, db)
+	got := stub.received()
+	if len(got) != 2 {
+		t.Fatalf("stub received %d requests, want trigger and resolve", len(got))
+	}
+	resolve := got[1].json(t)
+	if resolve["event_action"] != "resolve" || resolve["dedup_key"] != dedupKey || resolve["routing_key"] != "R0UTINGKEY123456" {
+		t.Errorf("resolve = %v", resolve)
+	}
+
+	// Already resolved: nothing more is sent
+	resolveIntegrationAlerts(db, project.ID, "fp-cart")
+	deliverQueuedWebhooks(t, db)
+	if len(stub.received()) != 2 {
+		t.Errorf("resolved incident was resolved again")
+	}
+}
+
+func TestOpsgenieAlertAndClose(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	stub := newWebhookStub(t)
+	n := newTestNotification(project)
+	n.Event.Level = "fatal"
+	integ := newTestIntegration(t, db, project.ID, "opsgenie", map[string]string{
+		"api_key": "og-key-0000-1111",
+		"api_url": stub.URL + "/",
+	})
+
+	create := sendOne(t, db, stub, integ, n)
+	alias := integrationDedupKey(project.ID, "fp-cart")
+	if create.Path != "/v2/alerts" || create.Header.Get("Authorization") != "GenieKey og-key-0000-1111" {
+		t.Errorf("create went to %q with Authorization %q", create.Path, create.Header.Get("Authorization"))
+	}
+	body := create.json(t)
+	if body["alias"] != alias || body["priority"] != "P1" || body["entity"] != "checkout" {
+		t.Errorf("create = %v", body)
+	}
+
+	var headers string
+	db.QueryRow("SELECT headers FROM webhook_deliveries WHERE url = ?", stub.URL+"/v2/alerts").Scan(&headers)
+	if !strings.HasPrefix(headers, sealedSecretPrefix) || strings.Contains(headers, "og-key") {
+		t.Errorf("GenieKey stored unsealed: %q", headers)
+	}
+
+	resolveIntegrationAlerts(db, project.ID, "fp-cart")
+	deliverQueuedWebhooks(t, db)
+	got := stub.received()
+	if len(got) != 2 {
+		t.Fatalf("stub received %d requests, want create and close", len(got))
+	}
+	closeReq := got[1]
+	if want := "/v2/alerts/" + alias + "/close?identifierType=alias"; closeReq.Path != want {
+		t.Errorf("close path = %q, want %q", closeReq.Path, want)
+	}
+	if closeReq.Header.Get("Authorization") != "GenieKey og-key-0000-1111" {
+		t.Errorf("close Authorization = %q", closeReq.Header.Get("Authorization"))
+	}
+}
+
+func TestIncidentIntegrationTestIsResolved(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+
+	for _, typ := range []string{"pagerduty", "opsgenie"} {
+		t.Run(typ, func(t *testing.T) {
+			stub := newWebhookStub(t)
+			integ := newTestIntegration(t, db, project.ID, typ, map[string]string{
+				"routing_key": "R0UTINGKEY123456",
+				"api_key":     "og-key-0000-1111",
+				"api_url":     stub.URL,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			rec := httptest.NewRecorder()
+			testProjectIntegration(rec, mux.SetURLVars(req, map[string]string{"id": project.ID, "integrationId": integ.ID}), db)
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+
+			// The resolve is held back so it can't overtake the trigger
+			deliverQueuedWebhooks(t, db)
+			if got := stub.received(); len(got) != 1 {
+				t.Fatalf("stub received %d requests before the resolve delay, want the trigger", len(got))
+			}
+			db.Exec("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE status = 'pending'", time.Now())
+			deliverQueuedWebhooks(t, db)
+			got := stub.received()
+			if len(got) != 2 {
+				t.Fatalf("stub received %d requests, want trigger and resolve", len(got))
+			}
+			if typ == "pagerduty" {
+				trigger, resolve := got[0].json(t), got[1].json(t)
+				if trigger["event_action"] != "trigger" || resolve["event_action"] != "resolve" || resolve["dedup_key"] != trigger["dedup_key"] {
+					t.Errorf("trigger = %v, resolve = %v", trigger, resolve)
+				}
+			} else {
+				alias, _ := got[0].json(t)["alias"].(string)
+				if got[0].Path != "/v2/alerts" || got[1].Path != "/v2/alerts/"+alias+"/close?identifierType=alias" {
+					t.Errorf("requests went to %q then %q", got[0].Path, got[1].Path)
+				}
+			}
+
+			var tracked int
+			db.QueryRow("SELECT COUNT(*) FROM integration_alerts WHERE integration_id = ?", integ.ID).Scan(&tracked)
+			if tracked != 0 {
+				t.Errorf("test send recorded %d integration alerts", tracked)
+			}
+		})
+	}
+}
+
+func TestIntegrationSecretsSealed(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	integ := newTestIntegration(t, db, project.ID, "opsgenie", map[string]string{
+		"api_key": "og-key-0000-1111",
+		"region":  "eu",
+	})
+
+	var stored string
+	db.QueryRow("SELECT config FROM project_integrations WHERE id = ?", integ.ID).Scan(&stored)
+	if strings.Contains(stored, "og-key") || !strings.Contains(stored, sealedSecretPrefix) || !strings.Contains(stored, `"region":"eu"`) {
+		t.Errorf("stored config = %s", stored)
+	}
+
+	loaded, err := GetProjectIntegration(db, project.ID, integ.ID)
+	if err != nil || loaded.Config["api_key"] != "og-key-0000-1111" || loaded.openErr != nil {
+		t.Fatalf("loaded = %+v, %v", loaded, err)
+	}
+
+	// Saving again doesn't seal twice
+	if err := SaveProjectIntegration(db, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := GetProjectIntegration(db, project.ID, integ.ID); again.Config["api_key"] != "og-key-0000-1111" {
+		t.Errorf("api_key after resave = %q", again.Config["api_key"])
+	}
+}
@@ -93,6 +93,18 @@ func main() {
 		handleMe(w, r, db)
 	}).Methods("GET", "OPTIONS")
 
+	api.HandleFunc("/auth/password/change", func(w http.ResponseWriter, r *http.Request) {
+		handleChangePassword(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/auth/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		handleForgotPassword(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/auth/password/reset", func(w http.ResponseWriter, r *http.Request) {
+		handleResetPassword(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
 	// Sentry-compatible error ingestion endpoint: /api/{project_id}/store/
 	api.HandleFunc("/{projectId}/store/", func(w http.ResponseWriter, r *http.Request) {
 		storeErrorSentry(w, r, db)
@@ -142,6 +154,88 @@ func main() {
 		updateProjectSettings(w, r, db)
 	}).Methods("PUT", "PATCH", "OPTIONS")
 
+	// Alert rules
+	api.HandleFunc("/projects/{id}/alert-rules", func(w http.ResponseWriter, r *http.Request) {
+		getAlertRules(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/alert-rules", func(w http.ResponseWriter, r *http.Request) {
+		createAlertRule(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/alert-rules/{ruleId}", func(w http.ResponseWriter, r *http.Request) {
+		getAlertRule(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/alert-rules/{ruleId}", func(w http.ResponseWriter, r *http.Request) {
+		updateAlertRule(w, r, db)
+	}).Methods("PUT", "PATCH", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/alert-rules/{ruleId}", func(w http.ResponseWriter, r *http.Request) {
+		deleteAlertRule(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	// Webhook delivery log
+	api.HandleFunc("/projects/{id}/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		getWebhookEndpoints(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/webhooks/{webhookId}/rotate-secret", func(w http.ResponseWriter, r *http.Request) {
+		rotateWebhookSecret(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/webhook-deliveries", func(w http.ResponseWriter, r *http.Request) {
+		getWebhookDeliveries(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/webhook-deliveries/{deliveryId}", func(w http.ResponseWriter, r *http.Request) {
+		getWebhookDelivery(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/webhook-deliveries/{deliveryId}/redeliver", func(w http.ResponseWriter, r *http.Request) {
+		redeliverWebhook(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/alert-history", func(w http.ResponseWriter, r *http.Request) {
+		getAlertHistory(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/integrations", func(w http.ResponseWriter, r *http.Request) {
+		getProjectIntegrations(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/integrations", func(w http.ResponseWriter, r *http.Request) {
+		createProjectIntegration(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/integrations/{integrationId}", func(w http.ResponseWriter, r *http.Request) {
+		updateProjectIntegration(w, r, db)
+	}).Methods("PUT", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/integrations/{integrationId}", func(w http.ResponseWriter, r *http.Request) {
+		deleteProjectIntegration(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/integrations/{integrationId}/test", func(w http.ResponseWriter, r *http.Request) {
+		testProjectIntegration(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/notification-templates", func(w http.ResponseWriter, r *http.Request) {
+		getNotificationTemplates(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/notification-templates/preview", func(w http.ResponseWriter, r *http.Request) {
+		previewNotificationTemplate(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/notification-templates/{channel}", func(w http.ResponseWriter, r *http.Request) {
+		updateNotificationTemplate(w, r, db)
+	}).Methods("PUT", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/notification-templates/{channel}", func(w http.ResponseWriter, r *http.Request) {
+		deleteNotificationTemplate(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
 	api.HandleFunc("/errors", func(w http.ResponseWriter, r *http.Request) {
 		getErrors(w, r, db)
 	}).Methods("GET", "OPTIONS")
@@ -208,10 +302,205 @@ func main() {
 		deleteMonitor(w, r, db)
 	}).Methods("DELETE", "OPTIONS")
 
-	// Public status page API endpoint (no auth required)
-	r.HandleFunc("/api/status/{projectId}", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/projects/{id}/monitors/{monitorId}/incidents", func(w http.ResponseWriter, r *http.Request) {
+		getIncidents(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/monitors/{monitorId}/incidents/stats", func(w http.ResponseWriter, r *http.Request) {
+		getIncidentStats(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/monitors/{monitorId}/stats", func(w http.ResponseWriter, r *http.Request) {
+		getMonitorStats(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/monitors/{monitorId}/checkins", func(w http.ResponseWriter, r *http.Request) {
+		getMonitorCheckIns(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/incidents", func(w http.ResponseWriter, r *http.Request) {
+		getIncidents(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/incidents/stats", func(w http.ResponseWriter, r *http.Request) {
+		getIncidentStats(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/incidents/{incidentId}", func(w http.ResponseWriter, r *http.Request) {
+		getIncident(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/incidents/{incidentId}/acknowledge", func(w http.ResponseWriter, r *http.Request) {
+		acknowledgeIncident(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	// Maintenance windows
+	api.HandleFunc("/projects/{id}/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		getMaintenanceWindows(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		createMaintenanceWindow(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/maintenance/{windowId}", func(w http.ResponseWriter, r *http.Request) {
+		updateMaintenanceWindow(w, r, db)
+	}).Methods("PUT", "PATCH", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/maintenance/{windowId}", func(w http.ResponseWriter, r *http.Request) {
+		deleteMaintenanceWindow(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	// Releases
+	api.HandleFunc("/projects/{id}/releases", func(w http.ResponseWriter, r *http.Request) {
+		getReleases(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases", func(w http.ResponseWriter, r *http.Request) {
+		createRelease(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases/compare", func(w http.ResponseWriter, r *http.Request) {
+		compareReleases(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases/{version}", func(w http.ResponseWriter, r *http.Request) {
+		getRelease(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases/{version}", func(w http.ResponseWriter, r *http.Request) {
+		updateRelease(w, r, db)
+	}).Methods("PUT", "PATCH", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases/{version}", func(w http.ResponseWriter, r *http.Request) {
+		deleteRelease(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases/{version}/deploys", func(w http.ResponseWriter, r *http.Request) {
+		getReleaseDeploys(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases/{version}/deploys", func(w http.ResponseWriter, r *http.Request) {
+		createReleaseDeploy(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/releases/{version}/health", func(w http.ResponseWriter, r *http.Request) {
+		getReleaseHealth(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/sessions", func(w http.ResponseWriter, r *http.Request) {
+		getProjectSessions(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	// sentry-cli release commands (project auth token, see auth_tokens.go). Older versions
+	// use the project paths, newer ones the organization paths.
+	api.HandleFunc("/0/organizations/{org}/releases/", func(w http.ResponseWriter, r *http.Request) {
+		sentryListReleases(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/0/organizations/{org}/releases/", func(w http.ResponseWriter, r *http.Request) {
+		sentryCreateRelease(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/0/organizations/{org}/releases/{version}/", func(w http.ResponseWriter, r *http.Request) {
+		sentryGetRelease(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/0/organizations/{org}/releases/{version}/", func(w http.ResponseWriter, r *http.Request) {
+		sentryUpdateRelease(w, r, db)
+	}).Methods("PUT", "OPTIONS")
+
+	api.HandleFunc("/0/organizations/{org}/releases/{version}/", func(w http.ResponseWriter, r *http.Request) {
+		sentryDeleteRelease(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	api.HandleFunc("/0/organizations/{org}/releases/{version}/deploys/", func(w http.ResponseWriter, r *http.Request) {
+		sentryListDeploys(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/0/organizations/{org}/releases/{version}/deploys/", func(w http.ResponseWriter, r *http.Request) {
+		sentryCreateDeploy(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/0/projects/{org}/{project}/releases/", func(w http.ResponseWriter, r *http.Request) {
+		sentryListReleases(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/0/projects/{org}/{project}/releases/", func(w http.ResponseWriter, r *http.Request) {
+		sentryCreateRelease(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/0/projects/{org}/{project}/releases/{version}/", func(w http.ResponseWriter, r *http.Request) {
+		sentryGetRelease(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/0/projects/{org}/{project}/releases/{version}/", func(w http.ResponseWriter, r *http.Request) {
+		sentryUpdateRelease(w, r, db)
+	}).Methods("PUT", "OPTIONS")
+
+	api.HandleFunc("/0/projects/{org}/{project}/releases/{version}/", func(w http.ResponseWriter, r *http.Request) {
+		sentryDeleteRelease(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	// Status pages
+	api.HandleFunc("/projects/{id}/status-pages", func(w http.ResponseWriter, r *http.Request) {
+		getStatusPages(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages", func(w http.ResponseWriter, r *http.Request) {
+		createStatusPage(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}", func(w http.ResponseWriter, r *http.Request) {
+		getStatusPageConfig(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}", func(w http.ResponseWriter, r *http.Request) {
+		updateStatusPage(w, r, db)
+	}).Methods("PUT", "PATCH", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}", func(w http.ResponseWriter, r *http.Request) {
+		deleteStatusPage(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}/incidents", func(w http.ResponseWriter, r *http.Request) {
+		getStatusPageIncidents(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}/incidents", func(w http.ResponseWriter, r *http.Request) {
+		createStatusPageIncident(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}/incidents/{incidentId}", func(w http.ResponseWriter, r *http.Request) {
+		updateStatusPageIncident(w, r, db)
+	}).Methods("PUT", "PATCH", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}/incidents/{incidentId}", func(w http.ResponseWriter, r *http.Request) {
+		deleteStatusPageIncident(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/status-pages/{pageId}/incidents/{incidentId}/updates", func(w http.ResponseWriter, r *http.Request) {
+		addStatusPageIncidentUpdate(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	// Heartbeat ping URLs (no auth required; the token identifies the monitor)
+	r.HandleFunc("/api/heartbeat/{token}", func(w http.ResponseWriter, r *http.Request) {
+		handleHeartbeatPing(w, r, db)
+	}).Methods("GET", "POST", "HEAD", "OPTIONS")
+	r.HandleFunc("/api/heartbeat/{token}/{signal}", func(w http.ResponseWriter, r *http.Request) {
+		handleHeartbeatPing(w, r, db)
+	}).Methods("GET", "POST", "HEAD", "OPTIONS")
+
+	// Public status page API endpoints (no auth required); pages are found by slug
+	r.HandleFunc("/api/status/{page}", func(w http.ResponseWriter, r *http.Request) {
 		getStatusPage(w, r, db)
 	}).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/status/{page}/feed.{format:rss|atom|json}", func(w http.ResponseWriter, r *http.Request) {
+		getStatusPageFeed(w, r, db)
+	}).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/status/{page}/components/{componentId}/badge.svg", func(w http.ResponseWriter, r *http.Request) {
+		getStatusPageBadge(w, r, db)
+	}).Methods("GET", "OPTIONS")
 
 	api.HandleFunc("/insights", func(w http.ResponseWriter, r *http.Request) {
 		getInsights(w, r, db)
@@ -302,6 +591,18 @@ func main() {
 		getProjectAPIKeyHistory(w, r, db)
 	}).Methods("GET", "OPTIONS")
 
+	api.HandleFunc("/projects/{id}/auth-tokens", func(w http.ResponseWriter, r *http.Request) {
+		getProjectAuthTokens(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/auth-tokens", func(w http.ResponseWriter, r *http.Request) {
+		createProjectAuthToken(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/projects/{id}/auth-tokens/{tokenId}", func(w http.ResponseWriter, r *http.Request) {
+		deleteProjectAuthToken(w, r, db)
+	}).Methods("DELETE", "OPTIONS")
+
 	api.HandleFunc("/projects/{id}/security-policies", func(w http.ResponseWriter, r *http.Request) {
 		getSecurityPolicies(w, r, db)
 	}).Methods("GET", "OPTIONS")
@@ -319,10 +620,23 @@ func main() {
 		updateSettings(w, r, db)
 	}).Methods("POST", "PATCH", "OPTIONS")
 
+	api.HandleFunc("/settings/test-email", func(w http.ResponseWriter, r *http.Request) {
+		sendTestEmail(w, r, db)
+	}).Methods("POST", "OPTIONS")
+
 	api.HandleFunc("/system/cleanup", func(w http.ResponseWriter, r *http.Request) {
 		runCleanup(w, r, db)
 	}).Methods("POST", "OPTIONS")
 
+	// Audit log
+	api.HandleFunc("/audit-log", func(w http.ResponseWriter, r *http.Request) {
+		getAuditLog(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
+	api.HandleFunc("/audit-log/export", func(w http.ResponseWriter, r *http.Request) {
+		exportAuditLog(w, r, db)
+	}).Methods("GET", "OPTIONS")
+
 	// Serve static files (SPA routing - serve index.html for all non-API routes)
 	r.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", http.FileServer(http.Dir("./frontend/dist/assets"))))
 
@@ -352,6 +666,10 @@ func main() {
 	// Start background workers
 	go StartMonitorWorker(db)
 	go StartErrorBatchInserter(db)
+	go StartDigestWorker(db)
+	go StartWebhookWorker(db)
+	go StartRollupWorker(db)
+	go StartSessionWorker(db)
 
 	log.Printf("Pulse OSS starting on port %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, r))
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Status pages list maintenance starting within this long
+const upcomingMaintenanceHorizon = 30 * 24 * time.Hour
+
+// MaintenanceWindow is planned downtime. During a window, checks of the monitors it
+// covers are recorded as maintenance, don't count against uptime and don't notify.
+type MaintenanceWindow struct {
+	ID          string `json:"id"`
+	ProjectID   string `json:"project_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// MonitorIDs limits the window to some monitors; empty covers the whole project
+	MonitorIDs []string  `json:"monitor_ids"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	// Recurrence repeats the window with the same duration: a cron expression gives its
+	// start times, or an RRULE repeats it from StartsAt. Both are read in Timezone.
+	Recurrence string    `json:"recurrence"`
+	Timezone   string    `json:"timezone"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Active reports whether the window is on now. Occurrence is the one in progress,
+	// or else the next one.
+	Active     bool                   `json:"active"`
+	Occurrence *MaintenanceOccurrence `json:"occurrence,omitempty"`
+
+	cron  *cronSchedule
+	rule  *rrule
+	loc   *time.Location
+	ready bool
+}
+
+type MaintenanceOccurrence struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// timeRange is the span [start, end)
+type timeRange struct {
+	start, end time.Time
+}
+
+// compile parses the timezone and recurrence; it reports invalid windows for validate
+func (w *MaintenanceWindow) compile() error {
+	w.ready = true
+	if w.Timezone == "" {
+		w.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", w.Timezone)
+	}
+	w.loc = loc
+	w.cron, w.rule = nil, nil
+
+	w.Recurrence = strings.TrimSpace(w.Recurrence)
+	switch {
+	case w.Recurrence == "":
+	case isRRule(w.Recurrence):
+		if w.rule, err = parseRRule(w.Recurrence, loc); err != nil {
+			return fmt.Errorf("invalid recurrence: %v", err)
+		}
+	default:
+		if w.cron, err = parseCron(w.Recurrence); err != nil {
+			return fmt.Errorf("invalid recurrence: %v", err)
+		}
+	}
+	return nil
+}
+
+func (w *MaintenanceWindow) validate() error {
+	w.Title = strings.TrimSpace(w.Title)
+	if w.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if w.StartsAt.IsZero() || w.EndsAt.IsZero() {
+		return fmt.Errorf("starts_at and ends_at are required")
+	}
+	if !w.EndsAt.After(w.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	if err := w.compile(); err != nil {
+		return err
+	}
+	if w.Recurrence != "" {
+		if w.EndsAt.Sub(w.StartsAt) > 7*24*time.Hour {
+			return fmt.Errorf("recurring windows can last at most 7 days")
+		}
+		if w.nextStart(w.StartsAt.Add(-time.Nanosecond)).IsZero() {
+			return fmt.Errorf("recurrence never occurs")
+		}
+	}
+	if w.MonitorIDs == nil {
+		w.MonitorIDs = []string{}
+	}
+	w.StartsAt, w.EndsAt = w.StartsAt.UTC(), w.EndsAt.UTC()
+	return nil
+}
+
+// nextStart returns the first start after t, or the zero time if none is left
+func (w *MaintenanceWindow) nextStart(t time.Time) time.Time {
+	if !w.ready && w.compile() != nil {
+		return time.Time{}
+	}
+	switch {
+	case w.cron != nil:
+		// Cron windows start no earlier than StartsAt
+		if t.Before(w.StartsAt) {
+			t = w.StartsAt.Add(-time.Nanosecond)
+		}
+		return w.cron.next(t.In(w.loc))
+	case w.rule != nil:
+		return w.rule.next(w.StartsAt.In(w.loc), t)
+	case w.StartsAt.After(t):
+		return w.StartsAt
+	}
+	return time.Time{}
+}
+
+// occurrenceAt returns the occurrence in progress at t, if any
+func (w *MaintenanceWindow) occurrenceAt(t time.Time) (timeRange, bool) {
+	d := w.EndsAt.Sub(w.StartsAt)
+	start := w.nextStart(t.Add(-d))
+	if start.IsZero() || start.After(t) {
+		return timeRange{}, false
+	}
+	return timeRange{start, start.Add(d)}, true
+}
+
+// occurrences lists the occurrences overlapping [from, to)
+func (w *MaintenanceWindow) occurrences(from, to time.Time) []timeRange {
+	d := w.EndsAt.Sub(w.StartsAt)
+	var out []timeRange
+	for start := w.nextStart(from.Add(-d)); !start.IsZero() && start.Before(to) && len(out) < 10000; start = w.nextStart(start) {
+		out = append(out, timeRange{start, start.Add(d)})
+	}
+	return out
+}
+
+// describe fills in Active and Occurrence as of now
+func (w *MaintenanceWindow) describe(now time.Time) {
+	w.Active, w.Occurrence = false, nil
+	if r, ok := w.occurrenceAt(now); ok {
+		w.Active = true
+		w.Occurrence = &MaintenanceOccurrence{StartsAt: r.start.UTC(), EndsAt: r.end.UTC()}
+	} else if start := w.nextStart(now); !start.IsZero() {
+		w.Occurrence = &MaintenanceOccurrence{StartsAt: start.UTC(), EndsAt: start.Add(w.EndsAt.Sub(w.StartsAt)).UTC()}
+	}
+}
+
+func (w *MaintenanceWindow) covers(monitorID string) bool {
+	if len(w.MonitorIDs) == 0 {
+		return true
+	}
+	for _, id := range w.MonitorIDs {
+		if id == monitorID {
+			return true
+		}
+	}
+	return false
+}
+
+// activeMaintenance returns a window covering the monitor at t, or nil
+func activeMaintenance(db *sql.DB, m *Monitor, t time.Time) *MaintenanceWindow {
+	windows, err := GetMaintenanceWindows(db, m.ProjectID)
+	if err != nil {
+		return nil
+	}
+	for i := range windows {
+		if w := &windows[i]; w.covers(m.ID) {
+			if _, ok := w.occurrenceAt(t); ok {
+				return w
+			}
+		}
+	}
+	return nil
+}
+
+// monitorMaintenance returns the monitor's maintenance within [from, to), clipped to it,
+// in order and merged where windows overlap
+func monitorMaintenance(db *sql.DB, m *Monitor, from, to time.Time) []timeRange {
+	windows, err := GetMaintenanceWindows(db, m.ProjectID)
+	if err != nil {
+		return nil
+	}
+	var spans []timeRange
+	for i := range windows {
+		if !windows[i].covers(m.ID) {
+			continue
+		}
+		for _, r := range windows[i].occurrences(from, to) {
+			if r.start.Before(from) {
+				r.start = from
+			}
+			if r.end.After(to) {
+				r.end = to
+			}
+			if r.end.After(r.start) {
+				spans = append(spans, r)
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+
+	var merged []timeRange
+	for _, r := range spans {
+		if n := len(merged); n > 0 && !r.start.After(merged[n-1].end) {
+			if r.end.After(merged[n-1].end) {
+				merged[n-1].end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// overlapDuration is how much of [start, end) falls within the spans
+func overlapDuration(start, end time.Time, spans []timeRange) time.Duration {
+	var d time.Duration
+	for _, r := range spans {
+		s, e := r.start, r.end
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			d += e.Sub(s)
+		}
+	}
+	return d
+}
+
+// syncHeartbeatMaintenance moves heartbeat monitors in and out of the maintenance
+// status. Other monitors get it from their checks, but heartbeats only record one
+// when a run is due.
+func syncHeartbeatMaintenance(db *sql.DB, m *Monitor, window *MaintenanceWindow) {
+	switch {
+	case window != nil && m.Status != "maintenance":
+		db.Exec("UPDATE monitors SET status = 'maintenance' WHERE id = ? AND status != 'paused'", m.ID)
+	case window == nil && m.Status == "maintenance":
+		status := "up"
+		db.QueryRow("SELECT status FROM monitor_checks WHERE monitor_id = ? AND status != 'maintenance' ORDER BY created_at DESC LIMIT 1",
+			m.ID).Scan(&status)
+		db.Exec("UPDATE monitors SET status = ? WHERE id = ? AND status = 'maintenance'", status, m.ID)
+	}
+}
+
+// Maintenance window storage
+
+const maintenanceColumns = `id, project_id, title, description, monitor_ids, starts_at, ends_at, recurrence, timezone, created_at`
+
+func scanMaintenanceWindow(row interface{ Scan(...interface{}) error }) (*MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	var monitorIDs string
+	err := row.Scan(&w.ID, &w.ProjectID, &w.Title, &w.Description, &monitorIDs, &w.StartsAt, &w.EndsAt,
+		&w.Recurrence, &w.Timezone, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(monitorIDs), &w.MonitorIDs)
+	if w.MonitorIDs == nil {
+		w.MonitorIDs = []string{}
+	}
+	if err := w.compile(); err != nil {
+		log.Printf("Maintenance window %s is invalid: %v", w.ID, err)
+	}
+	return &w, nil
+}
+
+func GetMaintenanceWindows(db *sql.DB, projectID string) ([]MaintenanceWindow, error) {
+	rows, err := db.Query("SELECT "+maintenanceColumns+" FROM maintenance_windows WHERE project_id = ? ORDER BY starts_at", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []MaintenanceWindow
+	for rows.Next() {
+		w, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, *w)
+	}
+	return windows, rows.Err()
+}
+
+func GetMaintenanceWindow(db *sql.DB, projectID, id string) (*MaintenanceWindow, error) {
+	return scanMaintenanceWindow(db.QueryRow("SELECT "+maintenanceColumns+" FROM maintenance_windows WHERE project_id = ? AND id = ?",
+		projectID, id))
+}
+
+func SaveMaintenanceWindow(db *sql.DB, w *MaintenanceWindow) error {
+	monitorIDs, _ := json.Marshal(w.MonitorIDs)
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO maintenance_windows (id, project_id, title, description, monitor_ids, starts_at, ends_at, recurrence, timezone, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.ProjectID, w.Title, w.Description, string(monitorIDs), w.StartsAt, w.EndsAt, w.Recurrence, w.Timezone, w.CreatedAt,
+	)
+	return err
+}
+
+func DeleteMaintenanceWindow(db *sql.DB, projectID, id string) error {
+	res, err := db.Exec("DELETE FROM maintenance_windows WHERE project_id = ? AND id = ?", projectID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Maintenance window handlers
+
+func getMaintenanceWindows(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+
+	windows, err := GetMaintenanceWindows(db, projectID)
+	if err != nil {
+		log.Printf("Error fetching maintenance windows: %v", err)
+		http.Error(w, "Failed to fetch maintenance windows", http.StatusInternalServerError)
+		return
+	}
+	if windows == nil {
+		windows = []MaintenanceWindow{}
+	}
+	now := time.Now()
+	for i := range windows {
+		windows[i].describe(now)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(windows)
+}
+
+// validateMaintenanceMonitors checks the window only names monitors of its project
+func validateMaintenanceMonitors(db *sql.DB, window *MaintenanceWindow) error {
+	for _, id := range window.MonitorIDs {
+		m, err := GetMonitor(db, id)
+		if err != nil || m.ProjectID != window.ProjectID {
+			return fmt.Errorf("monitor %s not found in this project", id)
+		}
+	}
+	return nil
+}
+
+func createMaintenanceWindow(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+
+	if _, err := GetProject(db, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var window MaintenanceWindow
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	window.ID = uuid.New().String()
+	window.ProjectID = projectID
+	window.CreatedAt = time.Now()
+	if err := window.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateMaintenanceMonitors(db, &window); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SaveMaintenanceWindow(db, &window); err != nil {
+		log.Printf("Error creating maintenance window: %v", err)
+		http.Error(w, "Failed to create maintenance window", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "maintenance.create", "maintenance_window", window.ID, nil, &window)
+
+	window.describe(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(window)
+}
+
+func updateMaintenanceWindow(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	existing, err := GetMaintenanceWindow(db, projectID, vars["windowId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Maintenance window not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch maintenance window", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	window := *existing
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	window.ID = existing.ID
+	window.ProjectID = existing.ProjectID
+	window.CreatedAt = existing.CreatedAt
+	if err := window.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateMaintenanceMonitors(db, &window); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SaveMaintenanceWindow(db, &window); err != nil {
+		log.Printf("Error updating maintenance window: %v", err)
+		http.Error(w, "Failed to update maintenance window", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "maintenance.update", "maintenance_window", window.ID, existing, &window)
+
+	window.describe(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(window)
+}
+
+func deleteMaintenanceWindow(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	windowID := vars["windowId"]
+
+	existing, _ := GetMaintenanceWindow(db, projectID, windowID)
+
+	if err := DeleteMaintenanceWindow(db, projectID, windowID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Maintenance window not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete maintenance window", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(db, r, "maintenance.delete", "maintenance_window", windowID, existing, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
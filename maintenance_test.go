@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMaintenanceOccurrenceAt(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	at := func(s string, loc *time.Location) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		return v
+	}
+
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		t      time.Time
+		want   time.Time // start of the occurrence in progress; zero for none
+	}{
+		{"one-off inside", MaintenanceWindow{StartsAt: at("2026-10-20 10:00", time.UTC), EndsAt: at("2026-10-20 11:00", time.UTC)},
+			at("2026-10-20 10:59", time.UTC), at("2026-10-20 10:00", time.UTC)},
+		{"one-off starts inclusive", MaintenanceWindow{StartsAt: at("2026-10-20 10:00", time.UTC), EndsAt: at("2026-10-20 11:00", time.UTC)},
+			at("2026-10-20 10:00", time.UTC), at("2026-10-20 10:00", time.UTC)},
+		{"one-off ends exclusive", MaintenanceWindow{StartsAt: at("2026-10-20 10:00", time.UTC), EndsAt: at("2026-10-20 11:00", time.UTC)},
+			at("2026-10-20 11:00", time.UTC), time.Time{}},
+		{"one-off before", MaintenanceWindow{StartsAt: at("2026-10-20 10:00", time.UTC), EndsAt: at("2026-10-20 11:00", time.UTC)},
+			at("2026-10-20 09:59", time.UTC), time.Time{}},
+		{"cron in the window's zone", MaintenanceWindow{StartsAt: at("2026-10-01 02:00", ny), EndsAt: at("2026-10-01 03:00", ny),
+			Recurrence: "0 2 * * sun", Timezone: "America/New_York"},
+			at("2026-10-25 02:45", ny), at("2026-10-25 02:00", ny)},
+		{"cron on another day", MaintenanceWindow{StartsAt: at("2026-10-01 02:00", ny), EndsAt: at("2026-10-01 03:00", ny),
+			Recurrence: "0 2 * * sun", Timezone: "America/New_York"},
+			at("2026-10-24 02:45", ny), time.Time{}},
+		{"cron not before StartsAt", MaintenanceWindow{StartsAt: at("2026-10-26 02:00", ny), EndsAt: at("2026-10-26 03:00", ny),
+			Recurrence: "0 2 * * sun", Timezone: "America/New_York"},
+			at("2026-10-25 02:45", ny), time.Time{}},
+		{"rrule spanning midnight", MaintenanceWindow{StartsAt: at("2026-10-03 23:00", time.UTC), EndsAt: at("2026-10-04 01:00", time.UTC),
+			Recurrence: "FREQ=WEEKLY;BYDAY=SA"},
+			at("2026-10-18 00:30", time.UTC), at("2026-10-17 23:00", time.UTC)},
+		{"rrule after COUNT", MaintenanceWindow{StartsAt: at("2026-10-03 23:00", time.UTC), EndsAt: at("2026-10-04 01:00", time.UTC),
+			Recurrence: "FREQ=WEEKLY;BYDAY=SA;COUNT=2"},
+			at("2026-10-18 00:30", time.UTC), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.window
+			w.Title = tt.name
+			if err := w.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			r, ok := w.occurrenceAt(tt.t)
+			if ok != !tt.want.IsZero() || !r.start.Equal(tt.want) {
+				t.Fatalf("occurrenceAt(%s) = %v %v, want start %s", tt.t, r, ok, tt.want)
+			}
+			if ok && !r.end.Equal(r.start.Add(w.EndsAt.Sub(w.StartsAt))) {
+				t.Errorf("occurrence ends %s", r.end)
+			}
+		})
+	}
+}
+
+func TestMonitorMaintenanceMerged(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	m := newTestMonitor(t, db, project.ID, "API", "https://api.example.test")
+	other := newTestMonitor(t, db, project.ID, "Admin", "https://admin.example.test")
+
+	day := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	hour := func(h float64) time.Time { return day.Add(time.Duration(h * float64(time.Hour))) }
+	save := func(start, end time.Time, recurrence string, monitorIDs ...string) {
+		t.Helper()
+		w := &MaintenanceWindow{ID: uuid.New().String(), ProjectID: project.ID, Title: "Upgrade", StartsAt: start, EndsAt: end,
+			Recurrence: recurrence, MonitorIDs: monitorIDs, CreatedAt: time.Now()}
+		if err := w.validate(); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		if err := SaveMaintenanceWindow(db, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save(hour(-1), hour(1), "")              // clipped at from
+	save(hour(2), hour(3), "", m.ID)         // overlaps the next one
+	save(hour(2.5), hour(4), "")             // ...
+	save(hour(4), hour(5), "", m.ID)         // abuts it
+	save(hour(6), hour(7), "", other.ID)     // another monitor's
+	save(hour(8), hour(8.5), "0 8,20 * * *") // recurring: 08:00 and 20:00, the latter clipped at to
+
+	got := monitorMaintenance(db, m, hour(0), hour(20.25))
+	want := []timeRange{{hour(0), hour(1)}, {hour(2), hour(5)}, {hour(8), hour(8.5)}, {hour(20), hour(20.25)}}
+	if len(got) != len(want) {
+		t.Fatalf("monitorMaintenance = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].start.Equal(want[i].start) || !got[i].end.Equal(want[i].end) {
+			t.Errorf("span %d = %s-%s, want %s-%s", i, got[i].start, got[i].end, want[i].start, want[i].end)
+		}
+	}
+	if d := overlapDuration(hour(0), hour(24), got); d != 4*time.Hour+45*time.Minute {
+		t.Errorf("overlapDuration = %s", d)
+	}
+}
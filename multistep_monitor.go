@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Multi-step monitors run a flow of HTTP requests in order, such as logging in and
+// then calling an API with the token. Each step is an HTTP monitor request with its own
+// expected status and assertions, and can extract values from its response for later
+// steps to use as {{name}}. Credentials live in the config's secrets, stored encrypted
+// and referenced as {{secrets.name}}; their values are redacted from check results.
+
+const maxMonitorSteps = 10
+
+// templateRef matches {{name}} and {{secrets.name}}
+var templateRef = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)?)\s*\}\}`)
+
+var stepVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// MultiStepMonitorConfig holds the steps and secrets of a multi-step monitor
+type MultiStepMonitorConfig struct {
+	Steps []MonitorStep `json:"steps"`
+	// Secrets are referenced in steps as {{secrets.name}}; they're stored encrypted
+	Secrets map[string]string `json:"secrets,omitempty"`
+
+	// openErr is set when a stored secret can't be decrypted
+	openErr error
+}
+
+// MonitorStep is one request of a multi-step monitor. Its URL may be relative to the
+// monitor's URL. URL, header, body, auth and assertion values are interpolated.
+type MonitorStep struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+	HTTPMonitorConfig
+	Extract []StepExtraction `json:"extract,omitempty"`
+}
+
+// StepExtraction saves a value of a step's response as a variable. Source is json (a
+// JSON path), header (a header name) or regex (a pattern matched against the body,
+// whose first group is kept when it has one).
+type StepExtraction struct {
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Property string `json:"property"`
+}
+
+// StepResult is the outcome of one step of a multi-step check. Steps after a failed
+// one are skipped.
+type StepResult struct {
+	Name         string       `json:"name,omitempty"`
+	Status       string       `json:"status"`
+	StatusCode   int          `json:"status_code,omitempty"`
+	ResponseTime int64        `json:"response_time"`
+	Timings      *HTTPTimings `json:"timings,omitempty"`
+	Error        string       `json:"error,omitempty"`
+}
+
+// encodeStepResults stores step results as JSON, and none as an empty string
+func encodeStepResults(steps []StepResult) string {
+	if len(steps) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(steps)
+	return string(b)
+}
+
+// validate normalises the config and rejects steps that can't run, including
+// references to variables no earlier step extracts and to undefined secrets
+func (c *MultiStepMonitorConfig) validate() error {
+	if len(c.Steps) == 0 {
+		return errors.New("at least one step is required")
+	}
+	if len(c.Steps) > maxMonitorSteps {
+		return fmt.Errorf("at most %d steps are allowed", maxMonitorSteps)
+	}
+	for name, value := range c.Secrets {
+		if !stepVariableName.MatchString(name) {
+			return fmt.Errorf("secret name %q must be letters, digits and underscores", name)
+		}
+		if value == "" {
+			return fmt.Errorf("secret %q is empty", name)
+		}
+	}
+
+	defined := map[string]bool{}
+	for i := range c.Steps {
+		step := &c.Steps[i]
+		step.Name = strings.TrimSpace(step.Name)
+		step.URL = strings.TrimSpace(step.URL)
+		if step.URL == "" {
+			return fmt.Errorf("steps[%d]: url is required", i)
+		}
+		if err := step.HTTPMonitorConfig.validate(); err != nil {
+			return fmt.Errorf("steps[%d]: %v", i, err)
+		}
+		_, err := step.rendered(func(s string) (string, error) {
+			for _, ref := range templateRef.FindAllStringSubmatch(s, -1) {
+				if secret, ok := strings.CutPrefix(ref[1], "secrets."); ok {
+					if _, ok := c.Secrets[secret]; !ok {
+						return "", fmt.Errorf("secret %q is not defined", secret)
+					}
+				} else if !defined[ref[1]] {
+					return "", fmt.Errorf("variable %q isn't extracted by an earlier step", ref[1])
+				}
+			}
+			return s, nil
+		})
+		if err != nil {
+			return fmt.Errorf("steps[%d]: %v", i, err)
+		}
+		for j := range step.Extract {
+			e := &step.Extract[j]
+			e.Name = strings.TrimSpace(e.Name)
+			e.Source = strings.ToLower(strings.TrimSpace(e.Source))
+			if !stepVariableName.MatchString(e.Name) || e.Name == "secrets" {
+				return fmt.Errorf("steps[%d].extract[%d]: name must be letters, digits and underscores", i, j)
+			}
+			if e.Property == "" {
+				return fmt.Errorf("steps[%d].extract[%d]: property is required", i, j)
+			}
+			switch e.Source {
+			case "json", "header":
+			case "regex":
+				if _, err := regexp.Compile(e.Property); err != nil {
+					return fmt.Errorf("steps[%d].extract[%d]: invalid regex: %v", i, j, err)
+				}
+			default:
+				return fmt.Errorf("steps[%d].extract[%d]: source must be json, header or regex", i, j)
+			}
+			defined[e.Name] = true
+		}
+	}
+	return nil
+}
+
+// rendered returns a copy of the step with every interpolated value passed through render
+func (s MonitorStep) rendered(render func(string) (string, error)) (MonitorStep, error) {
+	var err error
+	apply := func(v *string) {
+		if err == nil {
+			*v, err = render(*v)
+		}
+	}
+	out := s
+	apply(&out.URL)
+	apply(&out.Body)
+	if s.Headers != nil {
+		out.Headers = make(map[string]string, len(s.Headers))
+		for k, v := range s.Headers {
+			apply(&v)
+			out.Headers[k] = v
+		}
+	}
+	if s.Auth != nil {
+		auth := *s.Auth
+		apply(&auth.Username)
+		apply(&auth.Password)
+		apply(&auth.Token)
+		out.Auth = &auth
+	}
+	out.Assertions = append([]HTTPAssertion(nil), s.Assertions...)
+	for i := range out.Assertions {
+		apply(&out.Assertions[i].Value)
+	}
+	return out, err
+}
+
+// label names a step in results, by its name or else its position
+func (s MonitorStep) label(i int) string {
+	if s.Name != "" {
+		return fmt.Sprintf("step %d (%s)", i+1, s.Name)
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// masked returns a copy safe to send to clients. Secrets are masked, and so are
+// credentials written into steps literally; values that reference variables are kept.
+func (c *MultiStepMonitorConfig) masked() *MultiStepMonitorConfig {
+	if c == nil {
+		return nil
+	}
+	out := *c
+	if len(c.Secrets) > 0 {
+		out.Secrets = make(map[string]string, len(c.Secrets))
+		for name, value := range c.Secrets {
+			out.Secrets[name] = maskSecret(value)
+		}
+	}
+	out.Steps = make([]MonitorStep, len(c.Steps))
+	for i, step := range c.Steps {
+		out.Steps[i] = step
+		out.Steps[i].HTTPMonitorConfig = *step.HTTPMonitorConfig.masked()
+		masked := &out.Steps[i].HTTPMonitorConfig
+		for k, v := range step.Headers {
+			if templateRef.MatchString(v) {
+				masked.Headers[k] = v
+			}
+		}
+		if step.Auth != nil {
+			if templateRef.MatchString(step.Auth.Password) {
+				masked.Auth.Password = step.Auth.Password
+			}
+			if templateRef.MatchString(step.Auth.Token) {
+				masked.Auth.Token = step.Auth.Token
+			}
+		}
+	}
+	return &out
+}
+
+// keepMaskedSecrets restores secrets and step credentials that a client echoed back
+// masked. Steps are matched by position.
+func (c *MultiStepMonitorConfig) keepMaskedSecrets(existing *MultiStepMonitorConfig) {
+	if existing == nil {
+		return
+	}
+	for name, value := range c.Secrets {
+		if strings.HasPrefix(value, maskedSecretPrefix) {
+			c.Secrets[name] = existing.Secrets[name]
+		}
+	}
+	for i := range c.Steps {
+		if i < len(existing.Steps) {
+			c.Steps[i].HTTPMonitorConfig.keepMaskedSecrets(&existing.Steps[i].HTTPMonitorConfig)
+		}
+	}
+}
+
+// sealed returns a copy for storage, with the secrets encrypted
+func (c *MultiStepMonitorConfig) sealed() (*MultiStepMonitorConfig, error) {
+	if c == nil {
+		return nil, nil
+	}
+	out := *c
+	if len(c.Secrets) > 0 {
+		out.Secrets = make(map[string]string, len(c.Secrets))
+		for name, value := range c.Secrets {
+			sealed, err := sealSecret(value)
+			if err != nil {
+				return nil, err
+			}
+			out.Secrets[name] = sealed
+		}
+	}
+	return &out, nil
+}
+
+// open decrypts the stored secrets in place
+func (c *MultiStepMonitorConfig) open() {
+	if c == nil {
+		return
+	}
+	for name, value := range c.Secrets {
+		plain, err := openSecret(value)
+		if err != nil {
+			c.openErr = err
+			return
+		}
+		c.Secrets[name] = plain
+	}
+}
+
+// redact hides secret values and values extracted from responses, which may be tokens,
+// in text that's stored or shown, such as error messages. Extracted values shorter than
+// minRedactedLength are left alone: they're no credentials, and replacing them would
+// mangle the message.
+func (c *MultiStepMonitorConfig) redact(s string, vars map[string]string) string {
+	for _, value := range c.Secrets {
+		if value != "" {
+			s = strings.ReplaceAll(s, value, maskedSecretPrefix)
+		}
+	}
+	for _, value := range vars {
+		if len(value) >= minRedactedLength {
+			s = strings.ReplaceAll(s, value, maskedSecretPrefix)
+		}
+	}
+	return s
+}
+
+const minRedactedLength = 4
+
+// checkMultiStep runs the monitor's steps in order and stops at the first that fails.
+// Cookies carry over between steps. errMsg names the failed step, and statusCode is the
+// last step's.
+func checkMultiStep(m *Monitor, timeout time.Duration) (status string, statusCode int, errMsg string, steps []StepResult) {
+	cfg := m.MultiStep
+	if cfg == nil || len(cfg.Steps) == 0 {
+		return "down", 0, "no steps configured", nil
+	}
+	if cfg.openErr != nil {
+		return "down", 0, cfg.openErr.Error(), nil
+	}
+	base, err := url.Parse(strings.TrimSpace(m.URL))
+	if err != nil {
+		return "down", 0, err.Error(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	jar, _ := cookiejar.New(nil)
+
+	vars := map[string]string{}
+	render := func(s string) (string, error) {
+		var missing error
+		out := templateRef.ReplaceAllStringFunc(s, func(ref string) string {
+			name := templateRef.FindStringSubmatch(ref)[1]
+			if secret, ok := strings.CutPrefix(name, "secrets."); ok {
+				if value, ok := cfg.Secrets[secret]; ok {
+					return value
+				}
+			} else if value, ok := vars[name]; ok {
+				return value
+			}
+			if missing == nil {
+				missing = fmt.Errorf("%s is not defined", ref)
+			}
+			return ref
+		})
+		return out, missing
+	}
+
+	status = "up"
+	steps = make([]StepResult, len(cfg.Steps))
+	for i, step := range cfg.Steps {
+		result := &steps[i]
+		result.Name = step.Name
+		if status == "down" {
+			result.Status = "skipped"
+			continue
+		}
+
+		start := time.Now()
+		failures, ex := runMonitorStep(ctx, base, step, render, vars, jar)
+		result.ResponseTime = time.Since(start).Milliseconds()
+		if ex != nil {
+			result.StatusCode, result.Timings = ex.statusCode(), ex.timings
+			statusCode = ex.statusCode()
+		}
+		if len(failures) == 0 {
+			result.Status = "up"
+			continue
+		}
+		if ctx.Err() != nil {
+			failures = []string{fmt.Sprintf("timed out after %s", timeout)}
+		}
+		result.Status = "down"
+		result.Error = cfg.redact(strings.Join(failures, "; "), vars)
+		status, errMsg = "down", step.label(i)+": "+result.Error
+	}
+	return status, statusCode, errMsg, steps
+}
+
+// runMonitorStep makes one step's request and saves its extractions into vars. It
+// returns the step's failures and the exchange, when the request was made.
+func runMonitorStep(ctx context.Context, base *url.URL, step MonitorStep, render func(string) (string, error),
+	vars map[string]string, jar *cookiejar.Jar) ([]string, *httpExchange) {
+	rendered, err := step.rendered(render)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	target, err := base.Parse(rendered.URL)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	ex, err := doMonitorRequest(ctx, target.String(), &rendered.HTTPMonitorConfig, jar)
+	if err != nil {
+		return []string{err.Error()}, ex
+	}
+	if failures := rendered.failures(ex); len(failures) > 0 {
+		return failures, ex
+	}
+	var failures []string
+	for _, e := range step.Extract {
+		value, err := e.value(ex)
+		if err != nil {
+			failures = append(failures, "extract "+e.Name+": "+err.Error())
+			continue
+		}
+		vars[e.Name] = value
+	}
+	return failures, ex
+}
+
+// value finds the extracted value in a step's response
+func (e StepExtraction) value(ex *httpExchange) (string, error) {
+	switch e.Source {
+	case "json":
+		var doc interface{}
+		if err := json.Unmarshal(ex.body, &doc); err != nil {
+			return "", errors.New("body is not valid JSON")
+		}
+		value, found := lookupJSONPath(doc, e.Property)
+		if !found {
+			return "", fmt.Errorf("json %s is missing", e.Property)
+		}
+		return jsonValueString(value), nil
+	case "header":
+		if values := ex.resp.Header.Values(e.Property); len(values) > 0 {
+			return values[0], nil
+		}
+		return "", fmt.Errorf("header %s is missing", e.Property)
+	case "regex":
+		re, err := regexp.Compile(e.Property)
+		if err != nil {
+			return "", err
+		}
+		match := re.FindSubmatch(ex.body)
+		if match == nil {
+			return "", fmt.Errorf("body doesn't match %s", e.Property)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	}
+	return "", fmt.Errorf("unknown source %q", e.Source)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiStepRedactsExtractedValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"tok-9f8e7d6c5b4a","id":"7"}`))
+	}))
+	defer server.Close()
+
+	// Nothing listens here, so the second request fails with its URL in the error
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + closed.Addr().String()
+	closed.Close()
+
+	cfg := &MultiStepMonitorConfig{
+		Steps: []MonitorStep{
+			{Name: "login", URL: "/login", HTTPMonitorConfig: HTTPMonitorConfig{Method: "POST", Body: `{"password":"{{secrets.password}}"}`},
+				Extract: []StepExtraction{{Name: "token", Source: "json", Property: "token"}, {Name: "id", Source: "json", Property: "id"}}},
+			{Name: "items", URL: refused + "/items/{{id}}?access_token={{token}}"},
+		},
+		Secrets: map[string]string{"password": "hunter2-hunter2"},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	status, _, errMsg, steps := checkMultiStep(&Monitor{URL: server.URL, MultiStep: cfg}, 5*time.Second)
+	if status != "down" || len(steps) != 2 || steps[0].Status != "up" || steps[1].Status != "down" {
+		t.Fatalf("checkMultiStep = %s %q %+v", status, errMsg, steps)
+	}
+	for _, text := range []string{errMsg, steps[1].Error} {
+		if strings.Contains(text, "tok-9f8e7d6c5b4a") || !strings.Contains(text, "access_token="+maskedSecretPrefix) {
+			t.Errorf("extracted token not redacted: %q", text)
+		}
+		// Short values aren't credentials and stay readable
+		if !strings.Contains(text, "/items/7?") {
+			t.Errorf("short value redacted: %q", text)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordPolicy describes the rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength        int    `json:"min_length"`
+	BreachedListPath string `json:"breached_list_path"`
+	// BreachedListRequired rejects passwords while the breached list can't be read,
+	// instead of accepting them unchecked
+	BreachedListRequired bool `json:"breached_list_required"`
+}
+
+// errBreachedListUnavailable is returned by Validate when the breached list is required
+// but can't be read
+var errBreachedListUnavailable = errors.New("password can't be checked against the breached password list, try again later")
+
+// bcrypt only hashes the first 72 bytes of a password and refuses longer ones
+const maxPasswordBytes = 72
+
+// Password reset requests allowed per window, by email address and by client IP
+const (
+	resetRequestsPerEmail = 3
+	resetRequestsPerIP    = 10
+	resetRequestWindow    = time.Hour
+)
+
+// GetPasswordPolicy reads the policy from settings, falling back to environment defaults
+func GetPasswordPolicy(db *sql.DB) PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:        8,
+		BreachedListPath: os.Getenv("PASSWORD_BREACHED_LIST"),
+	}
+	policy.BreachedListRequired, _ = strconv.ParseBool(os.Getenv("PASSWORD_BREACHED_LIST_REQUIRED"))
+
+	if value, _ := GetSetting(db, "password_min_length"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			policy.MinLength = n
+		}
+	}
+	if value, _ := GetSetting(db, "password_breached_list"); value != "" {
+		policy.BreachedListPath = value
+	}
+	if value, _ := GetSetting(db, "password_breached_list_required"); value != "" {
+		policy.BreachedListRequired, _ = strconv.ParseBool(value)
+	}
+	return policy
+}
+
+// Validate returns a user-facing error when password does not satisfy the policy
+func (p PasswordPolicy) Validate(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	if p.BreachedListPath != "" {
+		breached, err := breachedPasswords.contains(p.BreachedListPath, password)
+		if err != nil {
+			log.Printf("[Password] Failed to read breached password list %s: %v", p.BreachedListPath, err)
+			if p.BreachedListRequired {
+				return errBreachedListUnavailable
+			}
+		} else if breached {
+			return fmt.Errorf("password appears in a list of breached passwords")
+		}
+	}
+	return nil
+}
+
+// breachedPasswordList caches a local breached-password file. Lines may be plain
+// passwords or SHA-1 hashes (optionally in "HASH:count" form, as published by HIBP).
+type breachedPasswordList struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	plain   map[string]struct{}
+	sha1    map[string]struct{}
+}
+
+var breachedPasswords = &breachedPasswordList{}
+
+func (l *breachedPasswordList) contains(path, password string) (bool, error) {
+	if err := l.load(path); err != nil {
+		return false, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.plain[password]; ok {
+		return true, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	_, ok := l.sha1[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	return ok, nil
+}
+
+// load (re)reads the list when the path or file modification time changes
+func (l *breachedPasswordList) load(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == path && l.modTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	plain := make(map[string]struct{})
+	hashes := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		candidate := line
+		if idx := strings.IndexByte(candidate, ':'); idx == 40 {
+			candidate = candidate[:idx]
+		}
+		if len(candidate) == 40 {
+			if _, err := hex.DecodeString(candidate); err == nil {
+				hashes[strings.ToUpper(candidate)] = struct{}{}
+				continue
+			}
+		}
+		plain[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	l.path = path
+	l.modTime = info.ModTime()
+	l.plain = plain
+	l.sha1 = hashes
+	log.Printf("[Password] Loaded %d breached passwords from %s", len(plain)+len(hashes), path)
+	return nil
+}
+
+// policyErrorStatus is the response status for a Validate error: the password's fault,
+// or the server's when the breached list is unavailable
+func policyErrorStatus(err error) int {
+	if errors.Is(err, errBreachedListUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// passwordPolicyError wraps a Validate error so callers can tell it from a failure to
+// store the password
+type passwordPolicyError struct{ err error }
+
+func (e *passwordPolicyError) Error() string { return e.err.Error() }
+func (e *passwordPolicyError) Unwrap() error { return e.err }
+
+// setUserPassword validates password against the policy and stores its hash. Policy
+// violations are returned as a *passwordPolicyError.
+func setUserPassword(db *sql.DB, userID, password string) error {
+	if err := GetPasswordPolicy(db).Validate(password); err != nil {
+		return &passwordPolicyError{err}
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return UpdateUserPassword(db, userID, string(hashedPassword))
+}
+
+// requestLimiter allows a number of requests per key in a sliding window
+type requestLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+var (
+	resetRequestsByEmail = &requestLimiter{limit: resetRequestsPerEmail, window: resetRequestWindow}
+	resetRequestsByIP    = &requestLimiter{limit: resetRequestsPerIP, window: resetRequestWindow}
+)
+
+// allow records a request for key and reports whether it is within the limit
+func (l *requestLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.hits == nil {
+		l.hits = make(map[string][]time.Time)
+	}
+	cutoff := now.Add(-l.window)
+	// Forget idle keys now and then so the map doesn't grow without bound
+	if len(l.hits) > 10000 {
+		for k, times := range l.hits {
+			if !times[len(times)-1].After(cutoff) {
+				delete(l.hits, k)
+			}
+		}
+	}
+
+	recent := l.hits[key][:0]
+	for _, t := range l.hits[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.hits[key] = recent
+		return false
+	}
+	l.hits[key] = append(recent, now)
+	return true
+}
+
+// hashResetToken returns the value stored in the database for a reset token
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func passwordResetTTL(db *sql.DB) time.Duration {
+	if value, _ := GetSetting(db, "password_reset_ttl_minutes"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return time.Duration(n) * time.Minute
+		}
+	}
+	return time.Hour
+}
+
+// handleChangePassword lets an authenticated user replace their password
+func handleChangePassword(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	claims, err := claimsFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := GetUserByID(db, claims.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	if err := setUserPassword(db, user.ID, req.NewPassword); err != nil {
+		var policyErr *passwordPolicyError
+		if errors.As(err, &policyErr) {
+			http.Error(w, err.Error(), policyErrorStatus(err))
+			return
+		}
+		log.Printf("Failed to change password for user %s: %v", user.ID, err)
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "user.password_change", "user", user.ID, nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleForgotPassword emails a single-use reset link. It always responds with
+// 204 so callers cannot probe which addresses have accounts. Requests are limited
+// per client IP, which gets 429 past the limit, and per address, past which no
+// more emails are sent.
+func handleForgotPassword(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if !resetRequestsByIP.allow(clientIP(r), now) {
+		http.Error(w, "Too many password reset requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if !resetRequestsByEmail.allow(strings.ToLower(email), now) {
+		log.Printf("[Password] Too many reset requests for %s, not sending another email", email)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	user, err := GetUserByEmail(db, email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up user for password reset: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, "Failed to generate reset token", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(buf)
+	ttl := passwordResetTTL(db)
+
+	if err := CreatePasswordResetToken(db, user.ID, hashResetToken(token), time.Now().Add(ttl)); err != nil {
+		log.Printf("Failed to store password reset token: %v", err)
+		http.Error(w, "Failed to create reset token", http.StatusInternalServerError)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", getPublicURL(db), token)
+	body := fmt.Sprintf("A password reset was requested for your Pulse account (%s).\n\n"+
+		"Open the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\n"+
+		"If you did not request this, you can ignore this email.\n",
+		user.Email, int(ttl.Minutes()), link)
+
+	go func() {
+		if err := sendEmail(db, []string{user.Email}, "Reset your Pulse password", body); err != nil {
+			log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+		}
+	}()
+
+	recordAudit(db, r, "user.password_reset_request", "user", user.ID, nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResetPassword sets a new password using a token from handleForgotPassword
+func handleResetPassword(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	// Check the policy first so a weak password doesn't burn the token
+	if err := GetPasswordPolicy(db).Validate(req.Password); err != nil {
+		http.Error(w, err.Error(), policyErrorStatus(err))
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is only used up if the password is stored
+	userID, err := ConsumePasswordResetToken(db, hashResetToken(req.Token), string(hashedPassword))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		} else {
+			log.Printf("Failed to reset password: %v", err)
+			http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(db, r, "user.password_reset", "user", userID, nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicyMaxLength(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8}
+	for _, tt := range []struct {
+		password string
+		ok       bool
+	}{
+		{strings.Repeat("a", 72), true},
+		{strings.Repeat("a", 73), false},
+		// 24 three-byte characters are 72 bytes
+		{strings.Repeat("€", 24), true},
+		{strings.Repeat("€", 25), false},
+	} {
+		if err := policy.Validate(tt.password); (err == nil) != tt.ok {
+			t.Errorf("Validate(%d bytes) = %v, want ok %t", len(tt.password), err, tt.ok)
+		}
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	db := newTestDB(t)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	user := &User{ID: uuid.New().String(), Email: "ops@example.test"}
+	if _, err := db.Exec("INSERT INTO users (id, email, password_hash) VALUES (?, ?, ?)", user.ID, user.Email, string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	token, err := generateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := func(current, next string) int {
+		t.Helper()
+		body := `{"current_password":"` + current + `","new_password":"` + next + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/password", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handleChangePassword(rec, req, db)
+		return rec.Code
+	}
+
+	if code := change("wrong horse", "battery staple"); code != http.StatusUnauthorized {
+		t.Errorf("wrong current password: status = %d, want 401", code)
+	}
+	if code := change("correct horse", "short"); code != http.StatusBadRequest {
+		t.Errorf("short password: status = %d, want 400", code)
+	}
+	// bcrypt refuses passwords over 72 bytes, which the policy rejects first
+	if code := change("correct horse", strings.Repeat("x", 100)); code != http.StatusBadRequest {
+		t.Errorf("long password: status = %d, want 400", code)
+	}
+	if code := change("correct horse", "battery staple"); code != http.StatusNoContent {
+		t.Fatalf("valid change: status = %d, want 204", code)
+	}
+	stored, err := GetUserByID(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte("battery staple")) != nil {
+		t.Error("the new password wasn't stored")
+	}
+}
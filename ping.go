@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPingCount = 3
+	maxPingCount     = 10
+
+	// pingInterval spaces echo requests like ping(8); Linux rejects faster rates
+	// on unprivileged sockets
+	pingInterval = 500 * time.Millisecond
+	// maxProbeWait bounds how long a single lost probe can stall a check
+	maxProbeWait = 3 * time.Second
+)
+
+// ICMP message types
+const (
+	icmpv4EchoReply   = 0
+	icmpv4EchoRequest = 8
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// checkICMP pings the host and reports it down when the packet loss reaches lossThreshold percent
+func checkICMP(hostname string, count int, lossThreshold float64, timeout time.Duration) (status string, errMsg string, result *PingResult) {
+	result, err := ping(hostname, count, timeout)
+	if err != nil {
+		return "down", err.Error(), result
+	}
+	if result.PacketLoss >= lossThreshold {
+		return "down", fmt.Sprintf("%.0f%% packet loss (%d/%d received)", result.PacketLoss, result.Received, result.Sent), result
+	}
+	return "up", "", result
+}
+
+// ping sends count echo requests to host, one after another, and collects the replies.
+// It uses an unprivileged datagram ICMP socket where the OS allows one, and falls back
+// to a raw socket, which needs root or CAP_NET_RAW.
+func ping(host string, count int, timeout time.Duration) (*PingResult, error) {
+	if count <= 0 {
+		count = defaultPingCount
+	}
+	if count > maxPingCount {
+		count = maxPingCount
+	}
+
+	ip, err := resolvePingTarget(pingHost(host), timeout)
+	if err != nil {
+		return nil, err
+	}
+	ipv6 := ip.To4() == nil
+
+	conn, dgram, err := listenICMP(ipv6)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if dgram {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	// Replies are matched on the sequence number and a random token in the payload.
+	// The identifier can't be used: the kernel rewrites it on datagram sockets.
+	var token [16]byte
+	rand.Read(token[:])
+	id := int(binary.BigEndian.Uint16(token[:2]))
+
+	wait := timeout / time.Duration(count)
+	if wait > maxProbeWait {
+		wait = maxProbeWait
+	}
+
+	result := &PingResult{}
+	var rtts []time.Duration
+	var sendErr error
+	for seq := 1; seq <= count; seq++ {
+		sentAt := time.Now()
+		result.Sent++
+		if _, err := conn.WriteTo(echoRequest(ipv6, id, seq, token[:]), dst); err != nil {
+			sendErr = err
+			continue
+		}
+		if rtt, ok := awaitEchoReply(conn, ipv6, seq, token[:], sentAt, sentAt.Add(wait)); ok {
+			rtts = append(rtts, rtt)
+		}
+		if seq < count {
+			time.Sleep(time.Until(sentAt.Add(pingInterval)))
+		}
+	}
+
+	result.Received = len(rtts)
+	result.PacketLoss = float64(result.Sent-result.Received) / float64(result.Sent) * 100
+	if len(rtts) > 0 {
+		var sum time.Duration
+		fastest, slowest := rtts[0], rtts[0]
+		for _, rtt := range rtts {
+			sum += rtt
+			if rtt < fastest {
+				fastest = rtt
+			}
+			if rtt > slowest {
+				slowest = rtt
+			}
+		}
+		result.RTTMin = durationMillis(fastest)
+		result.RTTMax = durationMillis(slowest)
+		result.RTTAvg = durationMillis(sum / time.Duration(len(rtts)))
+	} else if sendErr != nil {
+		return result, sendErr
+	}
+	return result, nil
+}
+
+// pingHost accepts a bare host as well as a URL or host:port, which older ICMP monitors
+// were created with
+func pingHost(target string) string {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "://") {
+		if u, err := url.Parse(target); err == nil {
+			return u.Hostname()
+		}
+	}
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		return host
+	}
+	return strings.Trim(target, "[]")
+}
+
+// resolvePingTarget looks up the host, preferring IPv4 addresses
+func resolvePingTarget(host string, timeout time.Duration) (net.IP, error) {
+	if host == "" {
+		return nil, errors.New("no host to ping")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP, nil
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return addrs[0].IP, nil
+}
+
+// listenICMP opens an ICMP socket and reports whether it's a datagram socket
+func listenICMP(ipv6 bool) (conn net.PacketConn, dgram bool, err error) {
+	conn, err = listenUnprivilegedICMP(ipv6)
+	if err == nil {
+		return conn, true, nil
+	}
+
+	network, addr := "ip4:icmp", "0.0.0.0"
+	if ipv6 {
+		network, addr = "ip6:ipv6-icmp", "::"
+	}
+	conn, rawErr := net.ListenPacket(network, addr)
+	if rawErr != nil {
+		return nil, false, fmt.Errorf("ICMP not permitted: %v; raw socket: %v", err, rawErr)
+	}
+	return conn, false, nil
+}
+
+// echoRequest builds an ICMP echo request. The kernel fills in the ICMPv6 checksum.
+func echoRequest(ipv6 bool, id, seq int, payload []byte) []byte {
+	msg := make([]byte, 8+len(payload))
+	msg[0] = icmpv4EchoRequest
+	if ipv6 {
+		msg[0] = icmpv6EchoRequest
+	}
+	binary.BigEndian.PutUint16(msg[4:], uint16(id))
+	binary.BigEndian.PutUint16(msg[6:], uint16(seq))
+	copy(msg[8:], payload)
+	if !ipv6 {
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+	return msg
+}
+
+// awaitEchoReply reads until the reply to seq arrives or the deadline passes
+func awaitEchoReply(conn net.PacketConn, ipv6 bool, seq int, token []byte, sentAt, deadline time.Time) (time.Duration, bool) {
+	reply := byte(icmpv4EchoReply)
+	if ipv6 {
+		reply = icmpv6EchoReply
+	}
+
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(deadline)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, false
+		}
+		msg := buf[:n]
+		// Some platforms include the IPv4 header
+		if !ipv6 && len(msg) >= 20 && msg[0]>>4 == 4 {
+			msg = msg[int(msg[0]&0x0f)*4:]
+		}
+		if len(msg) < 8+len(token) || msg[0] != reply {
+			continue
+		}
+		if int(binary.BigEndian.Uint16(msg[6:])) != seq || string(msg[8:8+len(token)]) != string(token) {
+			continue
+		}
+		return time.Since(sentAt), true
+	}
+}
+
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenUnprivilegedICMP opens a datagram ICMP socket. On Linux the process's group must
+// be in net.ipv4.ping_group_range.
+func listenUnprivilegedICMP(ipv6 bool) (net.PacketConn, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	if ipv6 {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(fd)
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
@@ -0,0 +1,1066 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Releases are versions of a project's code. An event naming a release creates it, and
+// so does the API, which sentry-cli can drive (releases new/finalize/deploys). Issues
+// are attributed to the release whose event first showed them and to the latest
+// release when they're resolved.
+
+// Kinds of release_issues rows
+const (
+	releaseIssueNew      = "new"
+	releaseIssueResolved = "resolved"
+)
+
+// Comparisons list at most this many issues of each kind
+const maxComparedIssues = 100
+
+// Release is a version of a project's code with what happened since it shipped
+type Release struct {
+	ID          string    `json:"id"`
+	ProjectID   string    `json:"project_id"`
+	Version     string    `json:"version"`
+	Ref         string    `json:"ref"`
+	URL         string    `json:"url"`
+	DateCreated time.Time `json:"date_created"`
+	// DateReleased is set when the release is finalized
+	DateReleased *time.Time `json:"date_released"`
+	FirstEvent   *time.Time `json:"first_event"`
+	LastEvent    *time.Time `json:"last_event"`
+	// EventCount counts every event received, including ones retention has deleted
+	EventCount     int     `json:"event_count"`
+	NewIssues      int     `json:"new_issues"`
+	ResolvedIssues int     `json:"resolved_issues"`
+	LastDeploy     *Deploy `json:"last_deploy"`
+	// Health covers the last 24 hours of sessions, if the release had any
+	Health *ReleaseHealth `json:"health,omitempty"`
+}
+
+// Deploy records a release reaching an environment
+type Deploy struct {
+	ID           string     `json:"id"`
+	ReleaseID    string     `json:"release_id"`
+	Environment  string     `json:"environment"`
+	Name         string     `json:"name"`
+	URL          string     `json:"url"`
+	DateStarted  *time.Time `json:"date_started"`
+	DateFinished time.Time  `json:"date_finished"`
+}
+
+// ReleaseDetail is a release with its deploys and the issues attributed to it
+type ReleaseDetail struct {
+	Release
+	Deploys []Deploy       `json:"deploys"`
+	Issues  []ReleaseIssue `json:"issues"`
+}
+
+// ReleaseIssue is an issue a release introduced or resolved
+type ReleaseIssue struct {
+	Fingerprint string    `json:"fingerprint"`
+	Kind        string    `json:"kind"`
+	Message     string    `json:"message"`
+	Level       string    `json:"level"`
+	Status      string    `json:"status"`
+	ErrorID     string    `json:"error_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReleaseComparison shows how errors changed between two releases
+type ReleaseComparison struct {
+	Base       ReleaseStats `json:"base"`
+	Head       ReleaseStats `json:"head"`
+	EventDelta int          `json:"event_delta"`
+	// New issues have events in head but not in base, resolved ones the other way round
+	New             []IssueDelta `json:"new"`
+	Resolved        []IssueDelta `json:"resolved"`
+	Persisting      []IssueDelta `json:"persisting"`
+	NewCount        int          `json:"new_count"`
+	ResolvedCount   int          `json:"resolved_count"`
+	PersistingCount int          `json:"persisting_count"`
+}
+
+// ReleaseStats counts the events a release's version has in the errors table
+type ReleaseStats struct {
+	Version string `json:"version"`
+	Events  int    `json:"events"`
+	Issues  int    `json:"issues"`
+	Users   int    `json:"users"`
+}
+
+// IssueDelta is one issue's event counts in the two compared releases
+type IssueDelta struct {
+	Fingerprint string `json:"fingerprint"`
+	Message     string `json:"message"`
+	Level       string `json:"level"`
+	Status      string `json:"status"`
+	ErrorID     string `json:"error_id"`
+	BaseCount   int    `json:"base_count"`
+	HeadCount   int    `json:"head_count"`
+}
+
+// validateReleaseVersion rejects versions that can't be used in a URL, as Sentry does
+func validateReleaseVersion(version string) error {
+	switch {
+	case version == "":
+		return errors.New("version is required")
+	case len(version) > 200:
+		return errors.New("version must be at most 200 characters")
+	case version == "." || version == ".." || strings.EqualFold(version, "latest"):
+		return fmt.Errorf("version %q is reserved", version)
+	case strings.ContainsAny(version, "/\\ \t\r\n"):
+		return errors.New("version can't contain slashes or whitespace")
+	}
+	return nil
+}
+
+func (d *Deploy) validate() error {
+	d.Environment = strings.TrimSpace(d.Environment)
+	if d.Environment == "" {
+		return errors.New("environment is required")
+	}
+	if d.DateFinished.IsZero() {
+		d.DateFinished = time.Now()
+	}
+	if d.DateStarted != nil && d.DateStarted.After(d.DateFinished) {
+		return errors.New("date_started must be before date_finished")
+	}
+	return nil
+}
+
+// recordReleaseEvent attributes an event being inserted in tx to its release, creating
+// the release on its first event. An event whose fingerprint the project hasn't seen
+// before introduces a new issue in the release.
+func recordReleaseEvent(tx *sql.Tx, event *ErrorEvent) error {
+	version := strings.TrimSpace(event.Release)
+	if version == "" {
+		return nil
+	}
+	seen := event.CreatedAt.UTC()
+	_, err := tx.Exec(`
+		INSERT INTO releases (id, project_id, version, date_created, first_event, last_event, event_count)
+		VALUES (?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT(project_id, version) DO UPDATE SET
+			first_event = CASE WHEN first_event IS NULL OR excluded.first_event < first_event THEN excluded.first_event ELSE first_event END,
+			last_event = CASE WHEN last_event IS NULL OR excluded.last_event > last_event THEN excluded.last_event ELSE last_event END,
+			event_count = event_count + 1`,
+		uuid.New().String(), event.ProjectID, version, time.Now().UTC(), seen, seen,
+	)
+	if err != nil {
+		return err
+	}
+
+	var seenBefore bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM errors WHERE project_id = ? AND fingerprint = ? AND id != ?)",
+		event.ProjectID, event.Fingerprint, event.ID).Scan(&seenBefore)
+	if err != nil || seenBefore {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO release_issues (release_id, fingerprint, kind, created_at)
+		SELECT id, ?, ?, ? FROM releases WHERE project_id = ? AND version = ?`,
+		event.Fingerprint, releaseIssueNew, seen, event.ProjectID, version,
+	)
+	return err
+}
+
+// recordIssueResolution attributes a resolved issue to the given release, or to the
+// project's latest one when version is empty. Reopening an issue drops the attribution.
+func recordIssueResolution(db *sql.DB, event *ErrorEvent, status, version string) error {
+	if event.Fingerprint == "" {
+		return nil
+	}
+	_, err := db.Exec(`
+		DELETE FROM release_issues WHERE kind = ? AND fingerprint = ?
+		AND release_id IN (SELECT id FROM releases WHERE project_id = ?)`,
+		releaseIssueResolved, event.Fingerprint, event.ProjectID,
+	)
+	if err != nil || status != "resolved" {
+		return err
+	}
+
+	var rel *Release
+	if version != "" {
+		rel, err = GetRelease(db, event.ProjectID, version)
+	} else {
+		rel, err = latestRelease(db, event.ProjectID)
+	}
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT OR IGNORE INTO release_issues (release_id, fingerprint, kind, created_at) VALUES (?, ?, ?, ?)",
+		rel.ID, event.Fingerprint, releaseIssueResolved, time.Now().UTC())
+	return err
+}
+
+// Release storage
+
+const releaseColumns = `id, project_id, version, ref, url, date_created, date_released, first_event, last_event, event_count,
+	(SELECT COUNT(*) FROM release_issues WHERE release_id = releases.id AND kind = 'new'),
+	(SELECT COUNT(*) FROM release_issues WHERE release_id = releases.id AND kind = 'resolved')`
+
+func scanRelease(row interface{ Scan(...interface{}) error }) (*Release, error) {
+	var rel Release
+	var released, firstEvent, lastEvent sql.NullTime
+	err := row.Scan(&rel.ID, &rel.ProjectID, &rel.Version, &rel.Ref, &rel.URL, &rel.DateCreated, &released,
+		&firstEvent, &lastEvent, &rel.EventCount, &rel.NewIssues, &rel.ResolvedIssues)
+	if err != nil {
+		return nil, err
+	}
+	if released.Valid {
+		rel.DateReleased = &released.Time
+	}
+	if firstEvent.Valid {
+		rel.FirstEvent = &firstEvent.Time
+	}
+	if lastEvent.Valid {
+		rel.LastEvent = &lastEvent.Time
+	}
+	return &rel, nil
+}
+
+func GetReleases(db *sql.DB, projectID string) ([]Release, error) {
+	rows, err := db.Query("SELECT "+releaseColumns+" FROM releases WHERE project_id = ? ORDER BY date_created DESC", projectID)
+	if err != nil {
+		return nil, err
+	}
+	var releases []Release
+	for rows.Next() {
+		rel, err := scanRelease(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		releases = append(releases, *rel)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range releases {
+		deploys, err := GetDeploys(db, releases[i].ID, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(deploys) > 0 {
+			releases[i].LastDeploy = &deploys[0]
+		}
+	}
+	return releases, nil
+}
+
+func GetRelease(db *sql.DB, projectID, version string) (*Release, error) {
+	rel, err := scanRelease(db.QueryRow("SELECT "+releaseColumns+" FROM releases WHERE project_id = ? AND version = ?",
+		projectID, version))
+	if err != nil {
+		return nil, err
+	}
+	deploys, err := GetDeploys(db, rel.ID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(deploys) > 0 {
+		rel.LastDeploy = &deploys[0]
+	}
+	return rel, nil
+}
+
+// latestRelease is the project's most recently finalized release, or its newest one
+// when none is finalized
+func latestRelease(db *sql.DB, projectID string) (*Release, error) {
+	var version string
+	err := db.QueryRow(`SELECT version FROM releases WHERE project_id = ?
+		ORDER BY date_released IS NULL, date_released DESC, date_created DESC LIMIT 1`, projectID).Scan(&version)
+	if err != nil {
+		return nil, err
+	}
+	return GetRelease(db, projectID, version)
+}
+
+func CreateRelease(db *sql.DB, rel *Release) error {
+	_, err := db.Exec(`
+		INSERT INTO releases (id, project_id, version, ref, url, date_created, date_released)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rel.ID, rel.ProjectID, rel.Version, rel.Ref, rel.URL, rel.DateCreated, rel.DateReleased,
+	)
+	return err
+}
+
+func UpdateRelease(db *sql.DB, rel *Release) error {
+	_, err := db.Exec("UPDATE releases SET ref = ?, url = ?, date_released = ? WHERE id = ?",
+		rel.Ref, rel.URL, rel.DateReleased, rel.ID)
+	return err
+}
+
+func DeleteRelease(db *sql.DB, projectID, version string) error {
+	res, err := db.Exec("DELETE FROM releases WHERE project_id = ? AND version = ?", projectID, version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetDeploys lists a release's deploys, latest first; limit 0 returns them all
+func GetDeploys(db *sql.DB, releaseID string, limit int) ([]Deploy, error) {
+	query := "SELECT id, release_id, environment, name, url, date_started, date_finished FROM release_deploys WHERE release_id = ? ORDER BY date_finished DESC"
+	args := []interface{}{releaseID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deploys := []Deploy{}
+	for rows.Next() {
+		var d Deploy
+		var started sql.NullTime
+		if err := rows.Scan(&d.ID, &d.ReleaseID, &d.Environment, &d.Name, &d.URL, &started, &d.DateFinished); err != nil {
+			return nil, err
+		}
+		if started.Valid {
+			d.DateStarted = &started.Time
+		}
+		deploys = append(deploys, d)
+	}
+	return deploys, rows.Err()
+}
+
+func CreateDeploy(db *sql.DB, d *Deploy) error {
+	_, err := db.Exec(`
+		INSERT INTO release_deploys (id, release_id, environment, name, url, date_started, date_finished)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.ID, d.ReleaseID, d.Environment, d.Name, d.URL, d.DateStarted, d.DateFinished,
+	)
+	return err
+}
+
+// GetReleaseIssues lists the issues a release introduced or resolved, describing each by
+// its latest event
+func GetReleaseIssues(db *sql.DB, rel *Release) ([]ReleaseIssue, error) {
+	rows, err := db.Query(`
+		SELECT ri.fingerprint, ri.kind, ri.created_at,
+			COALESCE(e.message, ''), COALESCE(e.level, ''), COALESCE(NULLIF(e.status, ''), 'unresolved'), COALESCE(e.id, '')
+		FROM release_issues ri
+		LEFT JOIN errors e ON e.id = (
+			SELECT id FROM errors WHERE project_id = ? AND fingerprint = ri.fingerprint ORDER BY created_at DESC LIMIT 1
+		)
+		WHERE ri.release_id = ?
+		ORDER BY ri.kind, ri.created_at DESC`,
+		rel.ProjectID, rel.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := []ReleaseIssue{}
+	for rows.Next() {
+		var issue ReleaseIssue
+		err := rows.Scan(&issue.Fingerprint, &issue.Kind, &issue.CreatedAt,
+			&issue.Message, &issue.Level, &issue.Status, &issue.ErrorID)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, rows.Err()
+}
+
+// issueCount is how many events an issue has in a release
+type issueCount struct {
+	events  int
+	errorID string
+}
+
+// releaseIssueCounts counts a version's events by issue
+func releaseIssueCounts(db *sql.DB, projectID, version string) (map[string]issueCount, ReleaseStats, error) {
+	stats := ReleaseStats{Version: version}
+	rows, err := db.Query(`
+		SELECT fingerprint, COUNT(*), MAX(id) FROM errors
+		WHERE project_id = ? AND release = ? AND fingerprint IS NOT NULL
+		GROUP BY fingerprint`,
+		projectID, version,
+	)
+	if err != nil {
+		return nil, stats, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]issueCount)
+	for rows.Next() {
+		var fingerprint string
+		var c issueCount
+		if err := rows.Scan(&fingerprint, &c.events, &c.errorID); err != nil {
+			return nil, stats, err
+		}
+		counts[fingerprint] = c
+		stats.Events += c.events
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stats, err
+	}
+	stats.Issues = len(counts)
+
+	err = db.QueryRow(`SELECT COUNT(DISTINCT user) FROM errors WHERE project_id = ? AND release = ?
+		AND user IS NOT NULL AND user NOT IN ('', 'null', '{}')`, projectID, version).Scan(&stats.Users)
+	return counts, stats, err
+}
+
+// releaseKnown reports whether a version has a release or, from before releases were
+// tracked, events
+func releaseKnown(db *sql.DB, projectID, version string) (bool, error) {
+	var known bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM releases WHERE project_id = ? AND version = ?)
+		OR EXISTS(SELECT 1 FROM errors WHERE project_id = ? AND release = ?)`,
+		projectID, version, projectID, version).Scan(&known)
+	return known, err
+}
+
+// CompareReleases diffs the issues of two versions of a project
+func CompareReleases(db *sql.DB, projectID, base, head string) (*ReleaseComparison, error) {
+	baseCounts, baseStats, err := releaseIssueCounts(db, projectID, base)
+	if err != nil {
+		return nil, err
+	}
+	headCounts, headStats, err := releaseIssueCounts(db, projectID, head)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &ReleaseComparison{
+		Base:       baseStats,
+		Head:       headStats,
+		EventDelta: headStats.Events - baseStats.Events,
+		New:        []IssueDelta{},
+		Resolved:   []IssueDelta{},
+		Persisting: []IssueDelta{},
+	}
+	for fp, h := range headCounts {
+		issue := IssueDelta{Fingerprint: fp, ErrorID: h.errorID, HeadCount: h.events}
+		if b, ok := baseCounts[fp]; ok {
+			issue.BaseCount = b.events
+			cmp.Persisting = append(cmp.Persisting, issue)
+		} else {
+			cmp.New = append(cmp.New, issue)
+		}
+	}
+	for fp, b := range baseCounts {
+		if _, ok := headCounts[fp]; !ok {
+			cmp.Resolved = append(cmp.Resolved, IssueDelta{Fingerprint: fp, ErrorID: b.errorID, BaseCount: b.events})
+		}
+	}
+	cmp.NewCount, cmp.ResolvedCount, cmp.PersistingCount = len(cmp.New), len(cmp.Resolved), len(cmp.Persisting)
+
+	// Biggest changes first
+	for _, list := range []*[]IssueDelta{&cmp.New, &cmp.Resolved, &cmp.Persisting} {
+		issues := *list
+		sort.Slice(issues, func(i, j int) bool {
+			di, dj := issues[i].change(), issues[j].change()
+			if di != dj {
+				return di > dj
+			}
+			return issues[i].Fingerprint < issues[j].Fingerprint
+		})
+		if len(issues) > maxComparedIssues {
+			issues = issues[:maxComparedIssues]
+		}
+		for i := range issues {
+			db.QueryRow(`SELECT message, level, COALESCE(NULLIF(status, ''), 'unresolved') FROM errors WHERE project_id = ? AND fingerprint = ?
+				ORDER BY created_at DESC LIMIT 1`, projectID, issues[i].Fingerprint).
+				Scan(&issues[i].Message, &issues[i].Level, &issues[i].Status)
+		}
+		*list = issues
+	}
+	return cmp, nil
+}
+
+// change is how many events the issue gained or lost between the releases
+func (d IssueDelta) change() int {
+	if d.HeadCount < d.BaseCount {
+		return d.BaseCount - d.HeadCount
+	}
+	return d.HeadCount - d.BaseCount
+}
+
+// Release handlers
+
+// getReleaseOr404 writes the error response itself when the release can't be loaded
+func getReleaseOr404(w http.ResponseWriter, db *sql.DB, projectID, version string) *Release {
+	rel, err := GetRelease(db, projectID, version)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		log.Printf("Error fetching release: %v", err)
+		http.Error(w, "Failed to fetch release", http.StatusInternalServerError)
+		return nil
+	}
+	return rel
+}
+
+func getReleases(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+
+	releases, err := GetReleases(db, projectID)
+	if err != nil {
+		log.Printf("Error fetching releases: %v", err)
+		http.Error(w, "Failed to fetch releases", http.StatusInternalServerError)
+		return
+	}
+	if releases == nil {
+		releases = []Release{}
+	}
+	health, err := GetHealthByRelease(db, projectID, "", time.Now().Add(-24*time.Hour))
+	if err != nil {
+		log.Printf("Error fetching release health: %v", err)
+		http.Error(w, "Failed to fetch releases", http.StatusInternalServerError)
+		return
+	}
+	for i := range releases {
+		releases[i].Health = health[releases[i].Version]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(releases)
+}
+
+func createRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+
+	if _, err := GetProject(db, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var rel Release
+	if err := json.NewDecoder(r.Body).Decode(&rel); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rel.Version = strings.TrimSpace(rel.Version)
+	if err := validateReleaseVersion(rel.Version); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := GetRelease(db, projectID, rel.Version); err == nil {
+		http.Error(w, "Release already exists", http.StatusConflict)
+		return
+	}
+	rel.ID = uuid.New().String()
+	rel.ProjectID = projectID
+	rel.DateCreated = time.Now().UTC()
+
+	if err := CreateRelease(db, &rel); err != nil {
+		log.Printf("Error creating release: %v", err)
+		http.Error(w, "Failed to create release", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "release.create", "release", rel.ID, nil, &rel)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rel)
+}
+
+func getRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	rel := getReleaseOr404(w, db, vars["id"], vars["version"])
+	if rel == nil {
+		return
+	}
+
+	detail := ReleaseDetail{Release: *rel}
+	var err error
+	if detail.Deploys, err = GetDeploys(db, rel.ID, 0); err == nil {
+		detail.Issues, err = GetReleaseIssues(db, rel)
+	}
+	if err == nil {
+		detail.Health, err = GetReleaseHealth(db, rel.ProjectID, rel.Version, "", time.Now().Add(-24*time.Hour), "hour")
+	}
+	if err == nil && detail.Health.Sessions == 0 {
+		detail.Health = nil
+	}
+	if err != nil {
+		log.Printf("Error fetching release details: %v", err)
+		http.Error(w, "Failed to fetch release", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// updateRelease edits the ref and URL and finalizes the release by setting date_released
+func updateRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	existing := getReleaseOr404(w, db, vars["id"], vars["version"])
+	if existing == nil {
+		return
+	}
+
+	var req struct {
+		Ref          *string    `json:"ref"`
+		URL          *string    `json:"url"`
+		DateReleased *time.Time `json:"date_released"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rel := *existing
+	if req.Ref != nil {
+		rel.Ref = *req.Ref
+	}
+	if req.URL != nil {
+		rel.URL = *req.URL
+	}
+	if req.DateReleased != nil {
+		rel.DateReleased = req.DateReleased
+	}
+
+	if err := UpdateRelease(db, &rel); err != nil {
+		log.Printf("Error updating release: %v", err)
+		http.Error(w, "Failed to update release", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "release.update", "release", rel.ID, existing, &rel)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rel)
+}
+
+func deleteRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	existing, _ := GetRelease(db, projectID, vars["version"])
+
+	if err := DeleteRelease(db, projectID, vars["version"]); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Release not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete release", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if existing != nil {
+		recordAudit(db, r, "release.delete", "release", existing.ID, existing, nil)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getReleaseDeploys(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	rel := getReleaseOr404(w, db, vars["id"], vars["version"])
+	if rel == nil {
+		return
+	}
+
+	deploys, err := GetDeploys(db, rel.ID, 0)
+	if err != nil {
+		log.Printf("Error fetching deploys: %v", err)
+		http.Error(w, "Failed to fetch deploys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deploys)
+}
+
+func createReleaseDeploy(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	rel := getReleaseOr404(w, db, vars["id"], vars["version"])
+	if rel == nil {
+		return
+	}
+
+	var deploy Deploy
+	if err := json.NewDecoder(r.Body).Decode(&deploy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	deploy.ID = uuid.New().String()
+	deploy.ReleaseID = rel.ID
+	if err := deploy.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := CreateDeploy(db, &deploy); err != nil {
+		log.Printf("Error creating deploy: %v", err)
+		http.Error(w, "Failed to create deploy", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "release.deploy", "release", rel.ID, nil, &deploy)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(deploy)
+}
+
+// compareReleases diffs the versions named by the base and head query parameters
+func compareReleases(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+	base := strings.TrimSpace(r.URL.Query().Get("base"))
+	head := strings.TrimSpace(r.URL.Query().Get("head"))
+	if base == "" || head == "" {
+		http.Error(w, "base and head are required", http.StatusBadRequest)
+		return
+	}
+
+	for _, version := range []string{base, head} {
+		known, err := releaseKnown(db, projectID, version)
+		if err != nil {
+			log.Printf("Error fetching release: %v", err)
+			http.Error(w, "Failed to compare releases", http.StatusInternalServerError)
+			return
+		}
+		if !known {
+			http.Error(w, fmt.Sprintf("Release %s not found", version), http.StatusNotFound)
+			return
+		}
+	}
+
+	cmp, err := CompareReleases(db, projectID, base, head)
+	if err != nil {
+		log.Printf("Error comparing releases: %v", err)
+		http.Error(w, "Failed to compare releases", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cmp)
+}
+
+// sentry-cli API. sentry-cli authenticates with the project's API key as its auth
+// token; the organization and project in the URL are taken from that key instead.
+
+type sentryProject struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type sentryRelease struct {
+	Version      string          `json:"version"`
+	Ref          string          `json:"ref"`
+	URL          string          `json:"url"`
+	DateCreated  time.Time       `json:"dateCreated"`
+	DateReleased *time.Time      `json:"dateReleased"`
+	FirstEvent   *time.Time      `json:"firstEvent"`
+	LastEvent    *time.Time      `json:"lastEvent"`
+	NewGroups    int             `json:"newGroups"`
+	Projects     []sentryProject `json:"projects"`
+	LastDeploy   *sentryDeploy   `json:"lastDeploy"`
+}
+
+type sentryDeploy struct {
+	ID           string     `json:"id"`
+	Environment  string     `json:"environment"`
+	Name         string     `json:"name"`
+	URL          string     `json:"url"`
+	DateStarted  *time.Time `json:"dateStarted"`
+	DateFinished time.Time  `json:"dateFinished"`
+}
+
+func toSentryRelease(rel *Release, project *Project) sentryRelease {
+	out := sentryRelease{
+		Version:      rel.Version,
+		Ref:          rel.Ref,
+		URL:          rel.URL,
+		DateCreated:  rel.DateCreated,
+		DateReleased: rel.DateReleased,
+		FirstEvent:   rel.FirstEvent,
+		LastEvent:    rel.LastEvent,
+		NewGroups:    rel.NewIssues,
+		Projects:     []sentryProject{{Slug: project.ID, Name: project.Name}},
+	}
+	if rel.LastDeploy != nil {
+		d := toSentryDeploy(*rel.LastDeploy)
+		out.LastDeploy = &d
+	}
+	return out
+}
+
+func toSentryDeploy(d Deploy) sentryDeploy {
+	return sentryDeploy{ID: d.ID, Environment: d.Environment, Name: d.Name, URL: d.URL,
+		DateStarted: d.DateStarted, DateFinished: d.DateFinished}
+}
+
+// sentryError answers the way Sentry does, which sentry-cli prints
+func sentryError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"detail": detail})
+}
+
+func sentryJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// sentryAPIProject returns the project whose auth token authenticates r, or writes the
+// error response and returns nil. The project API key is refused: it's in the public
+// DSN, so anyone with the DSN could otherwise create or delete releases.
+func sentryAPIProject(w http.ResponseWriter, r *http.Request, db *sql.DB) *Project {
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		sentryError(w, http.StatusUnauthorized, "Authentication credentials were not provided.")
+		return nil
+	}
+	project, err := GetProjectByAuthToken(db, token)
+	if err == nil {
+		return project
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Error checking auth token: %v", err)
+		sentryError(w, http.StatusInternalServerError, "Failed to check token")
+		return nil
+	}
+	if _, err := GetProjectByAPIKey(db, token); err == nil {
+		sentryError(w, http.StatusUnauthorized, "Project API keys only authenticate event ingestion; create an auth token for the project")
+		return nil
+	}
+	sentryError(w, http.StatusUnauthorized, "Invalid token")
+	return nil
+}
+
+// sentryAPIRelease loads the release named in the URL, or writes the error response
+// and returns nil
+func sentryAPIRelease(w http.ResponseWriter, r *http.Request, db *sql.DB, project *Project) *Release {
+	rel, err := GetRelease(db, project.ID, mux.Vars(r)["version"])
+	if err == sql.ErrNoRows {
+		sentryError(w, http.StatusNotFound, "The requested resource does not exist")
+		return nil
+	} else if err != nil {
+		log.Printf("Error fetching release: %v", err)
+		sentryError(w, http.StatusInternalServerError, "Failed to fetch release")
+		return nil
+	}
+	return rel
+}
+
+type sentryReleaseRequest struct {
+	Version      string     `json:"version"`
+	Ref          *string    `json:"ref"`
+	URL          *string    `json:"url"`
+	DateReleased *time.Time `json:"dateReleased"`
+}
+
+// apply copies the fields the request sets onto rel
+func (req *sentryReleaseRequest) apply(rel *Release) {
+	if req.Ref != nil {
+		rel.Ref = *req.Ref
+	}
+	if req.URL != nil {
+		rel.URL = *req.URL
+	}
+	if req.DateReleased != nil {
+		rel.DateReleased = req.DateReleased
+	}
+}
+
+func sentryListReleases(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	project := sentryAPIProject(w, r, db)
+	if project == nil {
+		return
+	}
+
+	releases, err := GetReleases(db, project.ID)
+	if err != nil {
+		log.Printf("Error fetching releases: %v", err)
+		sentryError(w, http.StatusInternalServerError, "Failed to fetch releases")
+		return
+	}
+	out := make([]sentryRelease, len(releases))
+	for i := range releases {
+		out[i] = toSentryRelease(&releases[i], project)
+	}
+	sentryJSON(w, http.StatusOK, out)
+}
+
+// sentryCreateRelease backs `sentry-cli releases new`. Like Sentry, it answers 208 with
+// the release when it already exists, e.g. because an event created it.
+func sentryCreateRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	project := sentryAPIProject(w, r, db)
+	if project == nil {
+		return
+	}
+
+	var req sentryReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sentryError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Version = strings.TrimSpace(req.Version)
+	if err := validateReleaseVersion(req.Version); err != nil {
+		sentryError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := http.StatusCreated
+	rel, err := GetRelease(db, project.ID, req.Version)
+	switch {
+	case err == nil:
+		status = http.StatusAlreadyReported
+		req.apply(rel)
+		err = UpdateRelease(db, rel)
+	case err == sql.ErrNoRows:
+		rel = &Release{
+			ID:          uuid.New().String(),
+			ProjectID:   project.ID,
+			Version:     req.Version,
+			DateCreated: time.Now().UTC(),
+		}
+		req.apply(rel)
+		err = CreateRelease(db, rel)
+	}
+	if err != nil {
+		log.Printf("Error creating release: %v", err)
+		sentryError(w, http.StatusInternalServerError, "Failed to create release")
+		return
+	}
+
+	sentryJSON(w, status, toSentryRelease(rel, project))
+}
+
+func sentryGetRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	project := sentryAPIProject(w, r, db)
+	if project == nil {
+		return
+	}
+	if rel := sentryAPIRelease(w, r, db, project); rel != nil {
+		sentryJSON(w, http.StatusOK, toSentryRelease(rel, project))
+	}
+}
+
+// sentryUpdateRelease backs `sentry-cli releases finalize`, which sets dateReleased
+func sentryUpdateRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	project := sentryAPIProject(w, r, db)
+	if project == nil {
+		return
+	}
+	rel := sentryAPIRelease(w, r, db, project)
+	if rel == nil {
+		return
+	}
+
+	var req sentryReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sentryError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.apply(rel)
+	if err := UpdateRelease(db, rel); err != nil {
+		log.Printf("Error updating release: %v", err)
+		sentryError(w, http.StatusInternalServerError, "Failed to update release")
+		return
+	}
+
+	sentryJSON(w, http.StatusOK, toSentryRelease(rel, project))
+}
+
+func sentryDeleteRelease(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	project := sentryAPIProject(w, r, db)
+	if project == nil {
+		return
+	}
+	if err := DeleteRelease(db, project.ID, mux.Vars(r)["version"]); err != nil {
+		if err == sql.ErrNoRows {
+			sentryError(w, http.StatusNotFound, "The requested resource does not exist")
+		} else {
+			sentryError(w, http.StatusInternalServerError, "Failed to delete release")
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sentryListDeploys(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	project := sentryAPIProject(w, r, db)
+	if project == nil {
+		return
+	}
+	rel := sentryAPIRelease(w, r, db, project)
+	if rel == nil {
+		return
+	}
+
+	deploys, err := GetDeploys(db, rel.ID, 0)
+	if err != nil {
+		log.Printf("Error fetching deploys: %v", err)
+		sentryError(w, http.StatusInternalServerError, "Failed to fetch deploys")
+		return
+	}
+	out := make([]sentryDeploy, len(deploys))
+	for i, d := range deploys {
+		out[i] = toSentryDeploy(d)
+	}
+	sentryJSON(w, http.StatusOK, out)
+}
+
+// sentryCreateDeploy backs `sentry-cli releases deploys VERSION new`
+func sentryCreateDeploy(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	project := sentryAPIProject(w, r, db)
+	if project == nil {
+		return
+	}
+	rel := sentryAPIRelease(w, r, db, project)
+	if rel == nil {
+		return
+	}
+
+	var req sentryDeploy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sentryError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	deploy := Deploy{
+		ID:           uuid.New().String(),
+		ReleaseID:    rel.ID,
+		Environment:  req.Environment,
+		Name:         req.Name,
+		URL:          req.URL,
+		DateStarted:  req.DateStarted,
+		DateFinished: req.DateFinished,
+	}
+	if err := deploy.validate(); err != nil {
+		sentryError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := CreateDeploy(db, &deploy); err != nil {
+		log.Printf("Error creating deploy: %v", err)
+		sentryError(w, http.StatusInternalServerError, "Failed to create deploy")
+		return
+	}
+
+	sentryJSON(w, http.StatusCreated, toSentryDeploy(deploy))
+}
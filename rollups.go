@@ -0,0 +1,488 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Raw checks are kept this many days unless the check_retention_days setting says
+	// otherwise. Rollups keep the history.
+	defaultCheckRetentionDays = 30
+	// Completed days are rolled up from raw checks, so those are kept at least this long
+	minCheckRetentionDays = 2
+	// Hourly rollups cover uptime up to 30 days; older history is in the daily rollups
+	hourlyRollupRetention = 90 * 24 * time.Hour
+	// Status pages show a bar per day for this many days
+	uptimeHistoryDays = 90
+	rollupInterval    = time.Minute
+	pruneBatchSize    = 5000
+)
+
+// CheckRollup summarizes a monitor's checks over one hour or one UTC day. Response times
+// are of the checks that got a response, that is up and degraded ones.
+type CheckRollup struct {
+	Bucket          time.Time `json:"bucket"`
+	Checks          int       `json:"checks"`
+	Up              int       `json:"up"`
+	Down            int       `json:"down"`
+	Degraded        int       `json:"degraded"`
+	Maintenance     int       `json:"maintenance"`
+	AvgResponseTime float64   `json:"avg_response_time"`
+	P95ResponseTime int       `json:"p95_response_time"`
+}
+
+// Uptime is the share of counted checks that weren't down. Maintenance doesn't count.
+func (r *CheckRollup) Uptime() (float64, bool) {
+	counted := r.Checks - r.Maintenance
+	if counted <= 0 {
+		return 0, false
+	}
+	return float64(r.Up+r.Degraded) / float64(counted) * 100, true
+}
+
+func (r *CheckRollup) add(status string) {
+	r.Checks++
+	switch status {
+	case "up":
+		r.Up++
+	case "down":
+		r.Down++
+	case "degraded":
+		r.Degraded++
+	case "maintenance":
+		r.Maintenance++
+	}
+}
+
+func (r *CheckRollup) responded() int {
+	return r.Up + r.Degraded
+}
+
+// StartRollupWorker keeps the hourly and daily rollups current and prunes raw checks
+// past their retention
+func StartRollupWorker(db *sql.DB) {
+	log.Println("Starting uptime rollup worker...")
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for now := time.Now(); ; now = <-ticker.C {
+		rollupChecks(db, now)
+		if now.Sub(lastPrune) > time.Hour {
+			pruneChecks(db, now)
+			lastPrune = now
+		}
+	}
+}
+
+func hourBucket(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+func dayBucket(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// rollupChecks brings the rollups up to now. Hours are rolled up from the last one
+// already stored, which is redone as it may have been partial. Today is combined from
+// its hours, and days that have ended are redone once from raw checks. The first run
+// backfills from the oldest raw check.
+func rollupChecks(db *sql.DB, now time.Time) {
+	var from time.Time
+	var last string
+	if db.QueryRow("SELECT MAX(bucket) FROM monitor_check_rollups_hourly").Scan(&last) == nil && last != "" {
+		from = parseSQLiteTime(last)
+	} else if db.QueryRow("SELECT MIN(created_at) FROM monitor_checks").Scan(&last) == nil && last != "" {
+		from = parseSQLiteTime(last)
+	}
+	if from.IsZero() {
+		return
+	}
+	if oldest := now.Add(-hourlyRollupRetention); from.Before(oldest) {
+		from = oldest
+	}
+
+	end := hourBucket(now).Add(time.Hour)
+	for hour := hourBucket(from); hour.Before(end); hour = hour.Add(time.Hour) {
+		rollups, err := rollupRawChecks(db, hour, hour.Add(time.Hour))
+		if err != nil {
+			log.Printf("[Rollups] Failed to roll up checks at %s: %v", hour.Format(time.RFC3339), err)
+			return
+		}
+		for monitorID, r := range rollups {
+			if err := saveRollup(db, "monitor_check_rollups_hourly", monitorID, r, true); err != nil {
+				log.Printf("[Rollups] Failed to save hourly rollup: %v", err)
+			}
+		}
+	}
+
+	for day := dayBucket(from); !day.After(now); day = day.AddDate(0, 0, 1) {
+		if day.Before(dayBucket(now)) {
+			finishDay(db, day)
+		} else {
+			combineHours(db, day)
+		}
+	}
+}
+
+// finishDay rolls up a day that has ended from its raw checks and marks it complete.
+// Days already complete are left alone.
+func finishDay(db *sql.DB, day time.Time) {
+	var done int
+	db.QueryRow("SELECT COUNT(*) FROM monitor_check_rollups_daily WHERE bucket = ? AND complete = 1", day).Scan(&done)
+	if done > 0 {
+		return
+	}
+	rollups, err := rollupRawChecks(db, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("[Rollups] Failed to roll up checks of %s: %v", day.Format("2006-01-02"), err)
+		return
+	}
+	for monitorID, r := range rollups {
+		if err := saveRollup(db, "monitor_check_rollups_daily", monitorID, r, true); err != nil {
+			log.Printf("[Rollups] Failed to save daily rollup: %v", err)
+		}
+	}
+	// Monitors whose raw checks were already pruned keep what today's pass combined
+	db.Exec("UPDATE monitor_check_rollups_daily SET complete = 1 WHERE bucket = ?", day)
+}
+
+// combineHours rolls up the day so far from its hours. Averages are exact, but the p95
+// is the highest hourly one until the day is finished from raw checks.
+func combineHours(db *sql.DB, day time.Time) {
+	rows, err := db.Query(`SELECT monitor_id, checks, up, down, degraded, maintenance, avg_response_time, p95_response_time
+		FROM monitor_check_rollups_hourly WHERE bucket >= ? AND bucket < ?`, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("[Rollups] Failed to read hourly rollups: %v", err)
+		return
+	}
+	days := map[string]*CheckRollup{}
+	for rows.Next() {
+		var monitorID string
+		var h CheckRollup
+		if err := rows.Scan(&monitorID, &h.Checks, &h.Up, &h.Down, &h.Degraded, &h.Maintenance, &h.AvgResponseTime, &h.P95ResponseTime); err != nil {
+			continue
+		}
+		d := days[monitorID]
+		if d == nil {
+			d = &CheckRollup{Bucket: day}
+			days[monitorID] = d
+		}
+		if n := d.responded() + h.responded(); n > 0 {
+			d.AvgResponseTime = (d.AvgResponseTime*float64(d.responded()) + h.AvgResponseTime*float64(h.responded())) / float64(n)
+		}
+		d.Checks += h.Checks
+		d.Up += h.Up
+		d.Down += h.Down
+		d.Degraded += h.Degraded
+		d.Maintenance += h.Maintenance
+		d.P95ResponseTime = max(d.P95ResponseTime, h.P95ResponseTime)
+	}
+	rows.Close()
+
+	for monitorID, d := range days {
+		if err := saveRollup(db, "monitor_check_rollups_daily", monitorID, d, false); err != nil {
+			log.Printf("[Rollups] Failed to save daily rollup: %v", err)
+		}
+	}
+}
+
+// rollupRawChecks summarizes the raw checks in [from, to) by monitor
+func rollupRawChecks(db *sql.DB, from, to time.Time) (map[string]*CheckRollup, error) {
+	// Raw checks are stored in local time and compared as text
+	rows, err := db.Query("SELECT monitor_id, status, response_time FROM monitor_checks WHERE created_at >= ? AND created_at < ?",
+		from.Local(), to.Local())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := map[string]*CheckRollup{}
+	responseTimes := map[string][]int{}
+	for rows.Next() {
+		var monitorID, status string
+		var responseTime sql.NullInt64
+		if err := rows.Scan(&monitorID, &status, &responseTime); err != nil {
+			return nil, err
+		}
+		r := rollups[monitorID]
+		if r == nil {
+			r = &CheckRollup{Bucket: from}
+			rollups[monitorID] = r
+		}
+		r.add(status)
+		if status == "up" || status == "degraded" {
+			responseTimes[monitorID] = append(responseTimes[monitorID], int(responseTime.Int64))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for monitorID, times := range responseTimes {
+		r := rollups[monitorID]
+		sum := 0
+		for _, t := range times {
+			sum += t
+		}
+		r.AvgResponseTime = float64(sum) / float64(len(times))
+		r.P95ResponseTime = responseTimePercentile(times, 95)
+	}
+	return rollups, nil
+}
+
+// responseTimePercentile returns the nearest-rank percentile of values, sorting them in
+// place. Days can have thousands of checks, so this sorts rather than using percentile.
+func responseTimePercentile(values []int, p int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Ints(values)
+	rank := (p*len(values) + 99) / 100
+	return values[max(rank, 1)-1]
+}
+
+func saveRollup(db *sql.DB, table, monitorID string, r *CheckRollup, complete bool) error {
+	if table == "monitor_check_rollups_hourly" {
+		_, err := db.Exec(`INSERT OR REPLACE INTO monitor_check_rollups_hourly
+			(monitor_id, bucket, checks, up, down, degraded, maintenance, avg_response_time, p95_response_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			monitorID, r.Bucket, r.Checks, r.Up, r.Down, r.Degraded, r.Maintenance, r.AvgResponseTime, r.P95ResponseTime)
+		return err
+	}
+	_, err := db.Exec(`INSERT OR REPLACE INTO monitor_check_rollups_daily
+		(monitor_id, bucket, checks, up, down, degraded, maintenance, avg_response_time, p95_response_time, complete)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		monitorID, r.Bucket, r.Checks, r.Up, r.Down, r.Degraded, r.Maintenance, r.AvgResponseTime, r.P95ResponseTime, complete)
+	return err
+}
+
+// checkRetentionDays reads the check_retention_days setting
+func checkRetentionDays(db *sql.DB) int {
+	days := defaultCheckRetentionDays
+	if value, _ := GetSetting(db, "check_retention_days"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			days = n
+		}
+	}
+	return max(days, minCheckRetentionDays)
+}
+
+// pruneChecks deletes raw checks past their retention, and hourly rollups past theirs,
+// in batches so checks being recorded meanwhile aren't held up
+func pruneChecks(db *sql.DB, now time.Time) {
+	cutoff := now.AddDate(0, 0, -checkRetentionDays(db))
+	var total int64
+	for {
+		res, err := db.Exec("DELETE FROM monitor_checks WHERE rowid IN (SELECT rowid FROM monitor_checks WHERE created_at < ? LIMIT ?)",
+			cutoff, pruneBatchSize)
+		if err != nil {
+			log.Printf("[Rollups] Failed to prune old checks: %v", err)
+			return
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < pruneBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("[Rollups] Pruned %d checks older than %s", total, cutoff.Format("2006-01-02"))
+	}
+
+	db.Exec("DELETE FROM monitor_check_rollups_hourly WHERE bucket < ?", hourBucket(now.Add(-hourlyRollupRetention)))
+}
+
+// Rollup queries
+
+// GetCheckRollups returns a monitor's hourly or daily rollups from since on, oldest first
+func GetCheckRollups(db *sql.DB, monitorID, resolution string, since time.Time) ([]CheckRollup, error) {
+	table, bucket := "monitor_check_rollups_hourly", hourBucket(since)
+	if resolution == "day" {
+		table, bucket = "monitor_check_rollups_daily", dayBucket(since)
+	}
+	rows, err := db.Query(`SELECT bucket, checks, up, down, degraded, maintenance, avg_response_time, p95_response_time
+		FROM `+table+` WHERE monitor_id = ? AND bucket >= ? ORDER BY bucket`, monitorID, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := []CheckRollup{}
+	for rows.Next() {
+		var r CheckRollup
+		if err := rows.Scan(&r.Bucket, &r.Checks, &r.Up, &r.Down, &r.Degraded, &r.Maintenance, &r.AvgResponseTime, &r.P95ResponseTime); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// sumRollups totals rollups, averaging response times over the checks that responded
+func sumRollups(rollups []CheckRollup) CheckRollup {
+	var total CheckRollup
+	var responseSum float64
+	for _, r := range rollups {
+		total.Checks += r.Checks
+		total.Up += r.Up
+		total.Down += r.Down
+		total.Degraded += r.Degraded
+		total.Maintenance += r.Maintenance
+		responseSum += r.AvgResponseTime * float64(r.responded())
+		total.P95ResponseTime = max(total.P95ResponseTime, r.P95ResponseTime)
+	}
+	if n := total.responded(); n > 0 {
+		total.AvgResponseTime = responseSum / float64(n)
+	}
+	return total
+}
+
+// rollupUptime returns the share of a monitor's checks since the given time that weren't
+// down, from the hourly rollups. ok is false when no checks counted.
+func rollupUptime(db *sql.DB, monitorID string, since time.Time) (uptime, degraded float64, ok bool) {
+	var up, deg, counted int
+	db.QueryRow(`SELECT COALESCE(SUM(up + degraded), 0), COALESCE(SUM(degraded), 0), COALESCE(SUM(checks - maintenance), 0)
+		FROM monitor_check_rollups_hourly WHERE monitor_id = ? AND bucket >= ?`,
+		monitorID, hourBucket(since)).Scan(&up, &deg, &counted)
+	if counted == 0 {
+		return 0, 0, false
+	}
+	return float64(up) / float64(counted) * 100, float64(deg) / float64(counted) * 100, true
+}
+
+// DailyUptime is one day of a status page's uptime bars. Uptime is nil for days without
+// checks.
+type DailyUptime struct {
+	Date   string   `json:"date"`
+	Uptime *float64 `json:"uptime"`
+	Checks int      `json:"checks"`
+	Down   int      `json:"down"`
+}
+
+// dailyUptimeHistory returns a monitor's uptime for each of the last days UTC days,
+// oldest first and ending today
+func dailyUptimeHistory(db *sql.DB, monitorID string, days int, now time.Time) []DailyUptime {
+	first := dayBucket(now).AddDate(0, 0, -(days - 1))
+	rollups, _ := GetCheckRollups(db, monitorID, "day", first)
+	byDay := map[string]CheckRollup{}
+	for _, r := range rollups {
+		byDay[r.Bucket.UTC().Format("2006-01-02")] = r
+	}
+
+	history := make([]DailyUptime, 0, days)
+	for i := 0; i < days; i++ {
+		date := first.AddDate(0, 0, i).Format("2006-01-02")
+		entry := DailyUptime{Date: date}
+		if r, ok := byDay[date]; ok {
+			entry.Checks, entry.Down = r.Checks, r.Down
+			if uptime, ok := r.Uptime(); ok {
+				entry.Uptime = &uptime
+			}
+		}
+		history = append(history, entry)
+	}
+	return history
+}
+
+// Rollup handlers
+
+var statsRanges = map[string]struct {
+	span       time.Duration
+	resolution string
+}{
+	"24h": {24 * time.Hour, "hour"},
+	"7d":  {7 * 24 * time.Hour, "hour"},
+	"30d": {30 * 24 * time.Hour, "day"},
+	"90d": {90 * 24 * time.Hour, "day"},
+}
+
+// getMonitorStats serves a monitor's uptime and response times over a range, in hourly
+// buckets up to 7 days and daily ones beyond
+func getMonitorStats(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	m, err := GetMonitor(db, vars["monitorId"])
+	if err != nil || m.ProjectID != vars["id"] {
+		http.Error(w, "Monitor not found", http.StatusNotFound)
+		return
+	}
+
+	rangeName := r.URL.Query().Get("range")
+	if rangeName == "" {
+		rangeName = "24h"
+	}
+	statsRange, ok := statsRanges[rangeName]
+	if !ok {
+		http.Error(w, "range must be 24h, 7d, 30d or 90d", http.StatusBadRequest)
+		return
+	}
+
+	since := time.Now().Add(-statsRange.span)
+	if statsRange.resolution == "day" {
+		// Whole days, ending today
+		since = dayBucket(time.Now()).Add(-statsRange.span + 24*time.Hour)
+	}
+	buckets, err := GetCheckRollups(db, m.ID, statsRange.resolution, since)
+	if err != nil {
+		log.Printf("Error fetching check rollups: %v", err)
+		http.Error(w, "Failed to fetch monitor stats", http.StatusInternalServerError)
+		return
+	}
+
+	total := sumRollups(buckets)
+	var uptime *float64
+	if u, ok := total.Uptime(); ok {
+		uptime = &u
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"range":             rangeName,
+		"resolution":        statsRange.resolution,
+		"uptime":            uptime,
+		"checks":            total.Checks,
+		"down":              total.Down,
+		"degraded":          total.Degraded,
+		"avg_response_time": total.AvgResponseTime,
+		"p95_response_time": total.P95ResponseTime,
+		"buckets":           buckets,
+	})
+}
+
+// rollupUptimeAverage averages monitors' uptime over 24 hours, 7 days and 30 days from
+// their hourly rollups. Monitors without checks in a period don't count towards it.
+type rollupUptimeAverage struct {
+	sums   [3]float64
+	counts [3]int
+}
+
+var rollupUptimePeriods = [3]time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+func (a *rollupUptimeAverage) add(db *sql.DB, monitorID string) {
+	now := time.Now()
+	for i, period := range rollupUptimePeriods {
+		if uptime, _, ok := rollupUptime(db, monitorID, now.Add(-period)); ok {
+			a.sums[i] += uptime
+			a.counts[i]++
+		}
+	}
+}
+
+func (a *rollupUptimeAverage) write(stats map[string]interface{}) {
+	for i, key := range []string{"avg_uptime_24h", "avg_uptime_7d", "avg_uptime_30d"} {
+		stats[key] = 0.0
+		if a.counts[i] > 0 {
+			stats[key] = a.sums[i] / float64(a.counts[i])
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestRollupChecks rolls up checks on both sides of an hour and a UTC day boundary.
+// Checks are stored in local time, so local time is put half a day off UTC to make the
+// local-time text comparison cut the buckets in the right place.
+func TestRollupChecks(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = kolkata
+
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	m := newTestMonitor(t, db, project.ID, "API", "https://api.example.test")
+	if _, err := db.Exec("DELETE FROM monitor_checks WHERE monitor_id = ?", m.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(s string) time.Time {
+		v, _ := time.Parse("2006-01-02 15:04:05", s)
+		return v
+	}
+	insert := func(created, status string, responseTime int) {
+		t.Helper()
+		check := &MonitorCheck{ID: uuid.New().String(), MonitorID: m.ID, Status: status, ResponseTime: responseTime,
+			CreatedAt: at(created).Local()}
+		if err := InsertMonitorCheck(db, check); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert("2026-10-19 22:59:59", "up", 50)
+	insert("2026-10-19 23:10:00", "up", 100)
+	insert("2026-10-19 23:50:00", "up", 300)
+	insert("2026-10-19 23:55:00", "down", 0)
+	insert("2026-10-20 00:00:00", "up", 100)
+	insert("2026-10-20 00:40:00", "degraded", 500)
+	insert("2026-10-20 01:05:00", "up", 200)
+	insert("2026-10-20 01:20:00", "maintenance", 0)
+
+	rollupChecks(db, at("2026-10-20 01:30:00"))
+
+	hourly, err := GetCheckRollups(db, m.ID, "hour", at("2026-10-19 00:00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHourly := []CheckRollup{
+		{Bucket: at("2026-10-19 22:00:00"), Checks: 1, Up: 1, AvgResponseTime: 50, P95ResponseTime: 50},
+		{Bucket: at("2026-10-19 23:00:00"), Checks: 3, Up: 2, Down: 1, AvgResponseTime: 200, P95ResponseTime: 300},
+		{Bucket: at("2026-10-20 00:00:00"), Checks: 2, Up: 1, Degraded: 1, AvgResponseTime: 300, P95ResponseTime: 500},
+		{Bucket: at("2026-10-20 01:00:00"), Checks: 2, Up: 1, Maintenance: 1, AvgResponseTime: 200, P95ResponseTime: 200},
+	}
+	checkRollups(t, "hourly", hourly, wantHourly)
+
+	// The 19th has ended and is rolled up from raw checks; the 20th is combined from
+	// its hours so far
+	daily, err := GetCheckRollups(db, m.ID, "day", at("2026-10-19 00:00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRollups(t, "daily", daily, []CheckRollup{
+		{Bucket: at("2026-10-19 00:00:00"), Checks: 4, Up: 3, Down: 1, AvgResponseTime: 150, P95ResponseTime: 300},
+		{Bucket: at("2026-10-20 00:00:00"), Checks: 4, Up: 2, Degraded: 1, Maintenance: 1, AvgResponseTime: 800.0 / 3, P95ResponseTime: 500},
+	})
+	if got := dailyComplete(t, db, m.ID); got != "1,0" {
+		t.Errorf("daily complete = %s, want 1,0", got)
+	}
+
+	// Once the 20th has ended it's redone from raw checks and left alone after that
+	insert("2026-10-20 23:00:00", "up", 400)
+	rollupChecks(db, at("2026-10-21 00:10:00"))
+	if _, err := db.Exec("DELETE FROM monitor_checks WHERE monitor_id = ?", m.ID); err != nil {
+		t.Fatal(err)
+	}
+	finishDay(db, at("2026-10-20 00:00:00"))
+	daily, _ = GetCheckRollups(db, m.ID, "day", at("2026-10-20 00:00:00"))
+	checkRollups(t, "finished daily", daily[:1], []CheckRollup{
+		{Bucket: at("2026-10-20 00:00:00"), Checks: 5, Up: 3, Degraded: 1, Maintenance: 1, AvgResponseTime: 300, P95ResponseTime: 500},
+	})
+	if got := dailyComplete(t, db, m.ID); got != "1,1" {
+		t.Errorf("daily complete = %s, want 1,1", got)
+	}
+}
+
+func TestCombineHoursKeepsHighestP95(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	m := newTestMonitor(t, db, project.ID, "API", "https://api.example.test")
+
+	day := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	for i, h := range []CheckRollup{
+		{Checks: 10, Up: 9, Down: 1, AvgResponseTime: 100, P95ResponseTime: 180},
+		{Checks: 4, Up: 1, Degraded: 1, Maintenance: 2, AvgResponseTime: 400, P95ResponseTime: 700},
+		{Checks: 2, Down: 2},
+	} {
+		h.Bucket = day.Add(time.Duration(i) * time.Hour)
+		if err := saveRollup(db, "monitor_check_rollups_hourly", m.ID, &h, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The next day's hours don't count
+	next := CheckRollup{Bucket: day.AddDate(0, 0, 1), Checks: 1, Up: 1, AvgResponseTime: 9000, P95ResponseTime: 9000}
+	saveRollup(db, "monitor_check_rollups_hourly", m.ID, &next, true)
+
+	combineHours(db, day)
+	daily, _ := GetCheckRollups(db, m.ID, "day", day)
+	checkRollups(t, "daily", daily, []CheckRollup{
+		{Bucket: day, Checks: 16, Up: 10, Down: 3, Degraded: 1, Maintenance: 2, AvgResponseTime: 1700.0 / 11, P95ResponseTime: 700},
+	})
+}
+
+func TestPruneChecks(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	m := newTestMonitor(t, db, project.ID, "API", "https://api.example.test")
+	mustSetting(t, db, "check_retention_days", "1") // raised to minCheckRetentionDays
+
+	now := time.Now()
+	for _, age := range []time.Duration{47 * time.Hour, 49 * time.Hour, 72 * time.Hour} {
+		check := &MonitorCheck{ID: uuid.New().String(), MonitorID: m.ID, Status: "up", CreatedAt: now.Add(-age)}
+		if err := InsertMonitorCheck(db, check); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, age := range []time.Duration{hourlyRollupRetention - time.Hour, hourlyRollupRetention + 2*time.Hour} {
+		r := CheckRollup{Bucket: hourBucket(now.Add(-age)), Checks: 1, Up: 1}
+		if err := saveRollup(db, "monitor_check_rollups_hourly", m.ID, &r, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneChecks(db, now)
+
+	var checks, hours int
+	db.QueryRow("SELECT COUNT(*) FROM monitor_checks WHERE monitor_id = ?", m.ID).Scan(&checks)
+	db.QueryRow("SELECT COUNT(*) FROM monitor_check_rollups_hourly WHERE monitor_id = ?", m.ID).Scan(&hours)
+	// newTestMonitor's recent check and the 47 hour old one are kept
+	if checks != 2 {
+		t.Errorf("%d checks left, want 2", checks)
+	}
+	if hours != 1 {
+		t.Errorf("%d hourly rollups left, want 1", hours)
+	}
+}
+
+func checkRollups(t *testing.T, name string, got, want []CheckRollup) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s rollups = %+v, want %+v", name, got, want)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		avgOK := math.Abs(g.AvgResponseTime-w.AvgResponseTime) < 0.001
+		g.AvgResponseTime, w.AvgResponseTime = 0, 0
+		if !g.Bucket.Equal(w.Bucket) || !avgOK {
+			t.Errorf("%s rollup %d = %+v, want %+v", name, i, got[i], want[i])
+			continue
+		}
+		g.Bucket, w.Bucket = time.Time{}, time.Time{}
+		if g != w {
+			t.Errorf("%s rollup %d = %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func dailyComplete(t *testing.T, db *sql.DB, monitorID string) string {
+	t.Helper()
+	var complete string
+	if err := db.QueryRow("SELECT GROUP_CONCAT(complete) FROM (SELECT complete FROM monitor_check_rollups_daily WHERE monitor_id = ? ORDER BY bucket)",
+		monitorID).Scan(&complete); err != nil {
+		t.Fatal(err)
+	}
+	return complete
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rrule is the subset of an RFC 5545 recurrence rule that maintenance windows support:
+// FREQ=HOURLY, DAILY, WEEKLY or MONTHLY with INTERVAL, BYDAY, COUNT and UNTIL. The rule
+// repeats the start it is anchored at, keeping its wall clock time in the start's location.
+type rrule struct {
+	freq     string
+	interval int
+	byDay    uint8 // bitset of time.Weekday; 0 matches every day
+	count    int
+	until    time.Time
+}
+
+var rruleDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// isRRule tells RRULE recurrences apart from cron expressions
+func isRRule(s string) bool {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "RRULE:") || strings.HasPrefix(s, "FREQ=")
+}
+
+// parseRRule parses a rule such as FREQ=WEEKLY;BYDAY=SA,SU. UNTIL without a trailing Z
+// is read in loc.
+func parseRRule(s string, loc *time.Location) (*rrule, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToUpper(s), "RRULE:") {
+		s = s[len("RRULE:"):]
+	}
+	r := &rrule{interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		value = strings.ToUpper(strings.TrimSpace(value))
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "FREQ":
+			switch value {
+			case "HOURLY", "DAILY", "WEEKLY", "MONTHLY":
+				r.freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q: use HOURLY, DAILY, WEEKLY or MONTHLY", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.interval = n
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				day, ok := rruleDays[d]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %q", d)
+				}
+				r.byDay |= 1 << uint(day)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.count = n
+		case "UNTIL":
+			t, err := parseRRuleTime(value, loc)
+			if err != nil {
+				return nil, err
+			}
+			r.until = t
+		case "WKST":
+			// Weeks start on Monday
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+	if r.freq == "" {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if r.byDay != 0 && r.freq == "MONTHLY" {
+		return nil, fmt.Errorf("BYDAY is not supported with FREQ=MONTHLY")
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return nil, fmt.Errorf("COUNT and UNTIL can't both be set")
+	}
+	return r, nil
+}
+
+func parseRRuleTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"20060102T150405", "20060102"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", s)
+}
+
+// next returns the first occurrence after t of the rule anchored at start, or the zero
+// time if there is none
+func (r *rrule) next(start, t time.Time) time.Time {
+	limit := t.AddDate(5, 0, 0)
+	n := 0
+	period := 0
+	if r.count == 0 && t.After(start) {
+		// Nothing before t can matter without a COUNT, so skip ahead
+		period = max(r.periodsBetween(start, t)-1, 0)
+	}
+
+	for ; ; period++ {
+		base := r.periodStart(start, period)
+		if base.After(limit) {
+			return time.Time{}
+		}
+		if r.freq == "MONTHLY" && base.Day() != start.Day() {
+			// Months without the start's day are skipped, as in RFC 5545
+			continue
+		}
+		for _, c := range r.candidates(base) {
+			if c.Before(start) {
+				continue
+			}
+			if !r.until.IsZero() && c.After(r.until) {
+				return time.Time{}
+			}
+			n++
+			if r.count > 0 && n > r.count {
+				return time.Time{}
+			}
+			if c.After(t) {
+				return c
+			}
+		}
+	}
+}
+
+func (r *rrule) periodStart(start time.Time, period int) time.Time {
+	step := period * r.interval
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	switch r.freq {
+	case "HOURLY":
+		return start.Add(time.Duration(step) * time.Hour)
+	case "DAILY":
+		return time.Date(y, m, d+step, hh, mm, ss, start.Nanosecond(), start.Location())
+	case "WEEKLY":
+		return time.Date(y, m, d+7*step, hh, mm, ss, start.Nanosecond(), start.Location())
+	default:
+		return time.Date(y, m+time.Month(step), d, hh, mm, ss, start.Nanosecond(), start.Location())
+	}
+}
+
+// periodsBetween estimates how many whole periods separate start and t, erring low
+func (r *rrule) periodsBetween(start, t time.Time) int {
+	var unit time.Duration
+	switch r.freq {
+	case "HOURLY":
+		unit = time.Hour
+	case "DAILY":
+		unit = 24 * time.Hour
+	case "WEEKLY":
+		unit = 7 * 24 * time.Hour
+	default:
+		months := (t.Year()-start.Year())*12 + int(t.Month()-start.Month())
+		return months / r.interval
+	}
+	// Days can be an hour short across daylight saving changes
+	return int(t.Sub(start)/(unit+time.Hour)) / r.interval
+}
+
+// candidates lists the occurrences within one period, in order
+func (r *rrule) candidates(base time.Time) []time.Time {
+	if r.byDay == 0 {
+		return []time.Time{base}
+	}
+	if r.freq != "WEEKLY" {
+		if r.byDay&(1<<uint(base.Weekday())) == 0 {
+			return nil
+		}
+		return []time.Time{base}
+	}
+
+	y, m, d := base.Date()
+	hh, mm, ss := base.Clock()
+	monday := d - (int(base.Weekday())+6)%7
+	var out []time.Time
+	for i := 0; i < 7; i++ {
+		day := time.Date(y, m, monday+i, hh, mm, ss, base.Nanosecond(), base.Location())
+		if r.byDay&(1<<uint(day.Weekday())) != 0 {
+			out = append(out, day)
+		}
+	}
+	return out
+}
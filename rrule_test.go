@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	for _, s := range []string{"FREQ=DAILY", "RRULE:FREQ=WEEKLY;BYDAY=SA,SU;WKST=MO", "freq=monthly;interval=3;count=4",
+		"FREQ=HOURLY;UNTIL=20261231T235959Z", "FREQ=DAILY;UNTIL=20261231"} {
+		if _, err := parseRRule(s, time.UTC); err != nil {
+			t.Errorf("parseRRule(%q): %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "INTERVAL=2", "FREQ=YEARLY", "FREQ=DAILY;INTERVAL=0", "FREQ=DAILY;COUNT=0",
+		"FREQ=WEEKLY;BYDAY=XX", "FREQ=MONTHLY;BYDAY=MO", "FREQ=DAILY;COUNT=2;UNTIL=20261231", "FREQ=DAILY;UNTIL=soon",
+		"FREQ=DAILY;BYMONTH=1", "FREQ"} {
+		if _, err := parseRRule(s, time.UTC); err == nil {
+			t.Errorf("parseRRule(%q) accepted", s)
+		}
+	}
+}
+
+func TestRRuleNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	at := func(s string, loc *time.Location) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		return v
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []time.Time // every occurrence from start on, ending with the zero time when the rule ends
+	}{
+		{"daily COUNT", "FREQ=DAILY;COUNT=3", at("2026-01-05 09:00", time.UTC),
+			[]time.Time{at("2026-01-05 09:00", time.UTC), at("2026-01-06 09:00", time.UTC), at("2026-01-07 09:00", time.UTC), {}}},
+		{"daily UNTIL is inclusive", "FREQ=DAILY;UNTIL=20260107T090000Z", at("2026-01-05 09:00", time.UTC),
+			[]time.Time{at("2026-01-05 09:00", time.UTC), at("2026-01-06 09:00", time.UTC), at("2026-01-07 09:00", time.UTC), {}}},
+		{"UNTIL date in the window's zone", "FREQ=DAILY;UNTIL=20260106", at("2026-01-05 00:00", ny),
+			[]time.Time{at("2026-01-05 00:00", ny), at("2026-01-06 00:00", ny), {}}},
+		{"monthly skips months without the day", "FREQ=MONTHLY", at("2026-01-31 22:00", time.UTC),
+			[]time.Time{at("2026-01-31 22:00", time.UTC), at("2026-03-31 22:00", time.UTC), at("2026-05-31 22:00", time.UTC),
+				at("2026-07-31 22:00", time.UTC), at("2026-08-31 22:00", time.UTC), at("2026-10-31 22:00", time.UTC)}},
+		{"skipped months don't count", "FREQ=MONTHLY;COUNT=3", at("2026-01-31 22:00", time.UTC),
+			[]time.Time{at("2026-01-31 22:00", time.UTC), at("2026-03-31 22:00", time.UTC), at("2026-05-31 22:00", time.UTC), {}}},
+		{"every other weekend", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SA,SU", at("2026-01-03 22:00", time.UTC),
+			[]time.Time{at("2026-01-03 22:00", time.UTC), at("2026-01-04 22:00", time.UTC), at("2026-01-17 22:00", time.UTC),
+				at("2026-01-18 22:00", time.UTC)}},
+		{"daily BYDAY", "FREQ=DAILY;BYDAY=MO,FR", at("2026-01-05 06:00", time.UTC),
+			[]time.Time{at("2026-01-05 06:00", time.UTC), at("2026-01-09 06:00", time.UTC), at("2026-01-12 06:00", time.UTC)}},
+		{"wall clock kept across daylight saving", "FREQ=DAILY", at("2026-03-07 04:00", ny),
+			[]time.Time{at("2026-03-07 04:00", ny), at("2026-03-08 04:00", ny), at("2026-03-09 04:00", ny)}},
+		{"hourly steps real hours", "FREQ=HOURLY;INTERVAL=2", at("2026-11-01 00:00", ny),
+			[]time.Time{at("2026-11-01 00:00", ny), at("2026-11-01 00:00", ny).Add(2 * time.Hour), at("2026-11-01 00:00", ny).Add(4 * time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseRRule(tt.rule, tt.start.Location())
+			if err != nil {
+				t.Fatalf("parseRRule: %v", err)
+			}
+			after := tt.start.Add(-time.Nanosecond)
+			for i, want := range tt.want {
+				got := r.next(tt.start, after)
+				if !got.Equal(want) {
+					t.Fatalf("occurrence %d after %s = %s, want %s", i+1, after, got, want)
+				}
+				after = got
+			}
+		})
+	}
+}
+
+// Without COUNT, next skips ahead to near t instead of walking every period from the
+// start. A COUNT too large to end the rule turns that off, so both must agree.
+func TestRRuleSkipAhead(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	start := time.Date(2020, 1, 31, 2, 30, 0, 0, ny)
+	for _, rule := range []string{"FREQ=HOURLY;INTERVAL=5", "FREQ=DAILY", "FREQ=DAILY;INTERVAL=3", "FREQ=WEEKLY;BYDAY=MO,SU",
+		"FREQ=WEEKLY;INTERVAL=3;BYDAY=FR", "FREQ=MONTHLY", "FREQ=MONTHLY;INTERVAL=7"} {
+		r, err := parseRRule(rule, ny)
+		if err != nil {
+			t.Fatalf("parseRRule(%q): %v", rule, err)
+		}
+		walked := *r
+		walked.count = 1 << 30
+
+		for _, after := range []time.Time{
+			time.Date(2026, 3, 8, 1, 0, 0, 0, ny),
+			time.Date(2026, 10, 19, 12, 0, 0, 0, ny),
+			time.Date(2026, 11, 1, 1, 30, 0, 0, ny),
+			time.Date(2027, 2, 28, 23, 59, 0, 0, time.UTC),
+		} {
+			got, want := r.next(start, after), walked.next(start, after)
+			if !got.Equal(want) || !got.After(after) {
+				t.Errorf("%s after %s = %s, walking every period gives %s", rule, after, got, want)
+			}
+			// next resumes one period before the estimate; that period may only pass t
+			// when it's a month without the start's day, which has no occurrence
+			p := max(r.periodsBetween(start, after)-1, 0)
+			if base := r.periodStart(start, p); base.After(after) && base.Day() == start.Day() {
+				t.Errorf("%s: periodsBetween(%s) skips past t to %s", rule, after, base)
+			}
+		}
+	}
+}
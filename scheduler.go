@@ -0,0 +1,288 @@
+package main
+
+import (
+	"container/heap"
+	"database/sql"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// minMonitorInterval is the shortest check interval, in seconds
+	minMonitorInterval = 10
+	// Heartbeats are pushed to, so the scheduler only looks for missed runs this often
+	heartbeatEvaluationInterval = 30 * time.Second
+	// Checks due at startup are spread over this long instead of all firing at once
+	startupSpread         = 30 * time.Second
+	defaultMonitorWorkers = 20
+	// defaultRetryInterval spaces retries of a failed check, in seconds
+	defaultRetryInterval = 10
+	maxRetries           = 10
+	maxRetryInterval     = 300
+	// maxLoadRetryDelay caps the wait between attempts to load monitors at startup
+	maxLoadRetryDelay = time.Minute
+)
+
+// monitorScheduler runs each active monitor when it is due. Monitors wait in a queue
+// ordered by their next run; a fixed pool of workers runs the checks, and a monitor is
+// out of the queue while its check runs so it can never overlap with itself. The API
+// keeps the queue current through scheduleMonitor and unscheduleMonitor.
+type monitorScheduler struct {
+	mu      sync.Mutex
+	queue   scheduleQueue
+	entries map[string]*scheduleEntry
+	wake    chan struct{}
+}
+
+type scheduleEntry struct {
+	monitorID string
+	interval  time.Duration
+	next      time.Time
+	running   bool
+	removed   bool
+	attempt   int // failed attempts of the current check
+	retry     time.Duration
+	index     int // position in the queue
+}
+
+var scheduler = &monitorScheduler{
+	entries: map[string]*scheduleEntry{},
+	wake:    make(chan struct{}, 1),
+}
+
+func StartMonitorWorker(db *sql.DB) {
+	workers := defaultMonitorWorkers
+	if n, err := strconv.Atoi(getEnvOrDefault("MONITOR_WORKERS", "")); err == nil && n > 0 {
+		workers = n
+	}
+	log.Printf("Starting uptime monitor scheduler with %d workers...", workers)
+
+	go scheduler.loadActiveMonitors(db)
+	scheduler.run(db, workers)
+}
+
+// loadActiveMonitors queues the active monitors at startup, spreading checks that are
+// due over startupSpread. Loading is retried with backoff until it succeeds, so a
+// database that isn't ready yet doesn't leave monitors unchecked until a restart.
+func (s *monitorScheduler) loadActiveMonitors(db *sql.DB) {
+	var monitors []Monitor
+	for delay := time.Second; ; delay = min(delay*2, maxLoadRetryDelay) {
+		var err error
+		if monitors, err = GetAllActiveMonitors(db); err == nil {
+			break
+		}
+		log.Printf("Error fetching monitors, retrying in %s: %v", delay, err)
+		time.Sleep(delay)
+	}
+
+	now := time.Now()
+	for i := range monitors {
+		m := &monitors[i]
+		interval := scheduleInterval(m)
+		next := now.Add(randomDuration(min(interval, startupSpread)))
+		if m.LastCheckedAt != nil && m.LastCheckedAt.Add(interval).After(next) {
+			next = m.LastCheckedAt.Add(interval)
+		}
+		s.add(m.ID, interval, next)
+	}
+}
+
+// scheduleMonitor queues a created or updated monitor, or drops it once paused. New
+// monitors get their first check straight away.
+func scheduleMonitor(m *Monitor) {
+	if m.Status == "paused" {
+		scheduler.remove(m.ID)
+		return
+	}
+	scheduler.add(m.ID, scheduleInterval(m), time.Now())
+}
+
+// unscheduleMonitor stops checking a deleted monitor
+func unscheduleMonitor(monitorID string) {
+	scheduler.remove(monitorID)
+}
+
+func scheduleInterval(m *Monitor) time.Duration {
+	if m.Type == "heartbeat" {
+		return heartbeatEvaluationInterval
+	}
+	seconds := m.Interval
+	if seconds < minMonitorInterval {
+		seconds = minMonitorInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// add queues a monitor to first run at first. A monitor already queued keeps its place
+// unless a shorter interval brings its next run forward.
+func (s *monitorScheduler) add(monitorID string, interval time.Duration, first time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[monitorID]; ok {
+		e.interval = interval
+		e.removed = false
+		if next := time.Now().Add(interval); !e.running && next.Before(e.next) {
+			e.next = next
+			heap.Fix(&s.queue, e.index)
+		}
+	} else {
+		e = &scheduleEntry{monitorID: monitorID, interval: interval, next: first}
+		s.entries[monitorID] = e
+		heap.Push(&s.queue, e)
+	}
+	s.notify()
+}
+
+func (s *monitorScheduler) remove(monitorID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[monitorID]
+	if !ok {
+		return
+	}
+	if e.running {
+		// Stays registered until the check finishes, so re-adding it meanwhile can't
+		// start a second check alongside
+		e.removed = true
+		return
+	}
+	delete(s.entries, monitorID)
+	heap.Remove(&s.queue, e.index)
+	s.notify()
+}
+
+func (s *monitorScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run hands due monitors to the workers, sleeping until the next one is due or the
+// queue changes. Handing off blocks while every worker is busy, so late checks queue
+// up in order rather than piling up goroutines.
+func (s *monitorScheduler) run(db *sql.DB, workers int) {
+	jobs := make(chan *scheduleEntry)
+	for i := 0; i < workers; i++ {
+		go s.work(db, jobs)
+	}
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		var due *scheduleEntry
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			if d := time.Until(s.queue[0].next); d > 0 {
+				wait = d
+			} else {
+				due = heap.Pop(&s.queue).(*scheduleEntry)
+				due.running = true
+			}
+		}
+		s.mu.Unlock()
+
+		if due != nil {
+			jobs <- due
+			continue
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *monitorScheduler) work(db *sql.DB, jobs <-chan *scheduleEntry) {
+	for e := range jobs {
+		started := time.Now()
+		retry := s.check(db, e)
+		s.finish(e, started, retry)
+	}
+}
+
+// check runs one monitor, reading it fresh so edits since it was queued apply
+func (s *monitorScheduler) check(db *sql.DB, e *scheduleEntry) (retry bool) {
+	m, err := GetMonitor(db, e.monitorID)
+	if err == sql.ErrNoRows || (err == nil && m.Status == "paused") {
+		// Deleted along with its project, or paused by another route
+		s.mu.Lock()
+		e.removed = true
+		s.mu.Unlock()
+		return false
+	}
+	if err != nil {
+		log.Printf("Error fetching monitor %s: %v", e.monitorID, err)
+		return false
+	}
+
+	s.mu.Lock()
+	e.interval = scheduleInterval(m)
+	e.retry = time.Duration(m.RetryInterval) * time.Second
+	s.mu.Unlock()
+	return processMonitor(db, *m, e.attempt+1)
+}
+
+// finish requeues a monitor one interval after its check started, plus jitter so monitors
+// sharing an interval drift apart. A check that overran its interval runs again straight
+// away. Failed attempts being retried come back after the retry interval instead.
+func (s *monitorScheduler) finish(e *scheduleEntry, started time.Time, retry bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.running = false
+	if e.removed {
+		delete(s.entries, e.monitorID)
+		return
+	}
+	if retry {
+		e.attempt++
+		e.next = time.Now().Add(e.retry)
+	} else {
+		e.attempt = 0
+		e.next = started.Add(e.interval + randomDuration(min(e.interval/10, 5*time.Second)))
+	}
+	heap.Push(&s.queue, e)
+	s.notify()
+}
+
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// scheduleQueue is a min-heap of entries by next run
+type scheduleQueue []*scheduleEntry
+
+func (q scheduleQueue) Len() int           { return len(q) }
+func (q scheduleQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x any) {
+	e := x.(*scheduleEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *scheduleQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	e.index = -1
+	return e
+}
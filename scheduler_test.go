@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerRetriesStartupLoad(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	m := newTestMonitor(t, db, project.ID, "API", "https://api.example.test")
+
+	// The first load fails as if the database weren't ready
+	if _, err := db.Exec("ALTER TABLE monitors RENAME TO monitors_unavailable"); err != nil {
+		t.Fatal(err)
+	}
+	s := &monitorScheduler{entries: map[string]*scheduleEntry{}, wake: make(chan struct{}, 1)}
+	go s.loadActiveMonitors(db)
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := db.Exec("ALTER TABLE monitors_unavailable RENAME TO monitors"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		_, queued := s.entries[m.ID]
+		s.mu.Unlock()
+		if queued {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("monitor not queued after the database became available")
+}
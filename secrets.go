@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Stored credentials, such as database monitor passwords, are sealed with AES-256-GCM
+// under a key derived from SECRET_KEY, or JWT_SECRET when that isn't set. Changing the
+// secret makes them unreadable, and they have to be entered again.
+const sealedSecretPrefix = "enc:v1:"
+
+func secretsKey() []byte {
+	secret := os.Getenv("SECRET_KEY")
+	if secret == "" {
+		secret = string(getJWTSecret())
+	}
+	key := sha256.Sum256([]byte("pulse stored credentials\x00" + secret))
+	return key[:]
+}
+
+func secretsAEAD() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secretsKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret encrypts a credential for storage. Empty values stay empty.
+func sealSecret(plain string) (string, error) {
+	if plain == "" || strings.HasPrefix(plain, sealedSecretPrefix) {
+		return plain, nil
+	}
+	aead, err := secretsAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret decrypts a credential sealed with sealSecret
+func openSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, sealedSecretPrefix) {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, sealedSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	aead, err := secretsAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("sealed secret is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("stored credentials can't be decrypted; was SECRET_KEY changed?")
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Release health comes from the sessions SDKs send in envelopes: a `session` item is
+// one update of one session, a `sessions` item aggregates many, as server SDKs do.
+// Sessions are counted per release, environment and hour, and users per release,
+// environment and hour with whether any of their sessions crashed.
+
+const (
+	// Session states outlive their last update by this long, so late updates aren't
+	// counted as new sessions
+	endedSessionRetention = 24 * time.Hour
+	openSessionRetention  = 7 * 24 * time.Hour
+	// Session counts cover the longest stats range
+	sessionCountRetention = 90 * 24 * time.Hour
+	sessionPruneInterval  = time.Hour
+)
+
+// Hourly and daily buckets as SQLite formats the stored times
+var sessionBucketFormats = map[string]string{
+	"hour": "%Y-%m-%d %H:00:00",
+	"day":  "%Y-%m-%d 00:00:00",
+}
+
+// SentrySession is a `session` envelope item, one update of a session
+type SentrySession struct {
+	SID       string             `json:"sid"`
+	DID       string             `json:"did"`
+	Init      bool               `json:"init"`
+	Started   time.Time          `json:"started"`
+	Timestamp time.Time          `json:"timestamp"`
+	Status    string             `json:"status"` // ok, exited, crashed, abnormal
+	Errors    int                `json:"errors"`
+	Attrs     SentrySessionAttrs `json:"attrs"`
+}
+
+// SentrySessionAggregates is a `sessions` envelope item. Each aggregate counts the
+// sessions started in one period by how they ended.
+type SentrySessionAggregates struct {
+	Aggregates []SentrySessionAggregate `json:"aggregates"`
+	Attrs      SentrySessionAttrs       `json:"attrs"`
+}
+
+type SentrySessionAggregate struct {
+	Started  time.Time `json:"started"`
+	DID      string    `json:"did"`
+	Exited   int       `json:"exited"`
+	Errored  int       `json:"errored"`
+	Abnormal int       `json:"abnormal"`
+	Crashed  int       `json:"crashed"`
+}
+
+type SentrySessionAttrs struct {
+	Release     string `json:"release"`
+	Environment string `json:"environment"`
+}
+
+// ReleaseHealth summarizes a release's sessions over a range. Rates are percentages
+// and null without sessions; adoption is the release's share of the project's sessions.
+type ReleaseHealth struct {
+	Version           string         `json:"version"`
+	Sessions          int            `json:"sessions"`
+	ErroredSessions   int            `json:"errored_sessions"`
+	CrashedSessions   int            `json:"crashed_sessions"`
+	AbnormalSessions  int            `json:"abnormal_sessions"`
+	Users             int            `json:"users"`
+	CrashedUsers      int            `json:"crashed_users"`
+	CrashFreeSessions *float64       `json:"crash_free_sessions"`
+	CrashFreeUsers    *float64       `json:"crash_free_users"`
+	Adoption          *float64       `json:"adoption"`
+	Series            []HealthBucket `json:"series,omitempty"`
+}
+
+// HealthBucket is a release's health over one hour or UTC day
+type HealthBucket struct {
+	Bucket            time.Time `json:"bucket"`
+	Sessions          int       `json:"sessions"`
+	CrashedSessions   int       `json:"crashed_sessions"`
+	Users             int       `json:"users"`
+	CrashedUsers      int       `json:"crashed_users"`
+	CrashFreeSessions *float64  `json:"crash_free_sessions"`
+	CrashFreeUsers    *float64  `json:"crash_free_users"`
+	Adoption          *float64  `json:"adoption"`
+}
+
+// sessionCounts are added to an hour's counts. Errored includes crashed and abnormal
+// sessions, as they ended in an error too.
+type sessionCounts struct {
+	sessions, errored, crashed, abnormal int
+}
+
+func (a SentrySessionAttrs) normalized() (release, environment string, err error) {
+	release = strings.TrimSpace(a.Release)
+	if release == "" {
+		return "", "", errors.New("session has no release")
+	}
+	if len(release) > 200 {
+		return "", "", errors.New("session release is too long")
+	}
+	return release, strings.TrimSpace(a.Environment), nil
+}
+
+// sessionEnded reports whether a session status is final
+func sessionEnded(status string) bool {
+	return status == "exited" || status == "crashed" || status == "abnormal"
+}
+
+func processSentrySession(db *sql.DB, projectID string, payload []byte) {
+	var s SentrySession
+	if err := json.Unmarshal(payload, &s); err != nil {
+		log.Printf("[DSN Debug] Failed to unmarshal session: %v", err)
+		return
+	}
+	if err := recordSession(db, projectID, &s); err != nil {
+		log.Printf("[DSN Debug] Dropping session %s: %v", s.SID, err)
+	}
+}
+
+func processSentrySessions(db *sql.DB, projectID string, payload []byte) {
+	var agg SentrySessionAggregates
+	if err := json.Unmarshal(payload, &agg); err != nil {
+		log.Printf("[DSN Debug] Failed to unmarshal session aggregates: %v", err)
+		return
+	}
+	if err := recordSessionAggregates(db, projectID, &agg); err != nil {
+		log.Printf("[DSN Debug] Dropping session aggregates: %v", err)
+	}
+}
+
+// recordSession applies one session update. The session's state is kept so that each
+// session, error and crash is counted once however many updates report it; updates
+// after the session ended are ignored.
+func recordSession(db *sql.DB, projectID string, s *SentrySession) error {
+	release, environment, err := s.Attrs.normalized()
+	if err != nil {
+		return err
+	}
+	if s.SID == "" {
+		return errors.New("session has no sid")
+	}
+	started := s.Started
+	if started.IsZero() {
+		started = s.Timestamp
+	}
+	if started.IsZero() {
+		started = time.Now()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var st struct {
+		release, environment, user, status string
+		bucket                             time.Time
+		errored                            bool
+	}
+	var counts sessionCounts
+	err = tx.QueryRow("SELECT release, environment, bucket, user, status, errored FROM session_states WHERE project_id = ? AND sid = ?",
+		projectID, s.SID).Scan(&st.release, &st.environment, &st.bucket, &st.user, &st.status, &st.errored)
+	switch {
+	case err == sql.ErrNoRows:
+		// An update whose start we missed still counts the session
+		st.release, st.environment, st.bucket, st.status = release, environment, hourBucket(started), "ok"
+		counts.sessions = 1
+		if err := ensureRelease(tx, projectID, release); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case sessionEnded(st.status):
+		return nil
+	}
+	if st.user == "" {
+		st.user = s.DID
+	}
+
+	if (s.Errors > 0 || sessionEnded(s.Status) && s.Status != "exited") && !st.errored {
+		counts.errored = 1
+		st.errored = true
+	}
+	switch s.Status {
+	case "crashed":
+		counts.crashed = 1
+	case "abnormal":
+		counts.abnormal = 1
+	}
+	if s.Status != "" {
+		st.status = s.Status
+	}
+
+	if err := counts.save(tx, projectID, st.release, st.environment, st.bucket); err != nil {
+		return err
+	}
+	if st.user != "" && (counts.sessions > 0 || counts.crashed > 0) {
+		if err := saveSessionUser(tx, projectID, st.release, st.environment, st.bucket, st.user, counts.crashed > 0); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO session_states (project_id, sid, release, environment, bucket, user, status, errored, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		projectID, s.SID, st.release, st.environment, st.bucket, st.user, st.status, st.errored, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recordSessionAggregates adds pre-aggregated sessions; each aggregate counts sessions
+// by how they ended
+func recordSessionAggregates(db *sql.DB, projectID string, agg *SentrySessionAggregates) error {
+	release, environment, err := agg.Attrs.normalized()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ensureRelease(tx, projectID, release); err != nil {
+		return err
+	}
+	for _, a := range agg.Aggregates {
+		if a.Exited < 0 || a.Errored < 0 || a.Abnormal < 0 || a.Crashed < 0 {
+			continue
+		}
+		counts := sessionCounts{
+			sessions: a.Exited + a.Errored + a.Abnormal + a.Crashed,
+			errored:  a.Errored + a.Abnormal + a.Crashed,
+			crashed:  a.Crashed,
+			abnormal: a.Abnormal,
+		}
+		if counts.sessions == 0 {
+			continue
+		}
+		started := a.Started
+		if started.IsZero() {
+			started = time.Now()
+		}
+		bucket := hourBucket(started)
+		if err := counts.save(tx, projectID, release, environment, bucket); err != nil {
+			return err
+		}
+		if a.DID != "" {
+			if err := saveSessionUser(tx, projectID, release, environment, bucket, a.DID, a.Crashed > 0); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// ensureRelease creates a release that sessions name before any event does
+func ensureRelease(tx *sql.Tx, projectID, version string) error {
+	_, err := tx.Exec("INSERT OR IGNORE INTO releases (id, project_id, version, date_created) VALUES (?, ?, ?, ?)",
+		uuid.New().String(), projectID, version, time.Now().UTC())
+	return err
+}
+
+func (c sessionCounts) save(tx *sql.Tx, projectID, release, environment string, bucket time.Time) error {
+	if c == (sessionCounts{}) {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO release_sessions (project_id, release, environment, bucket, sessions, errored, crashed, abnormal)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(project_id, release, environment, bucket) DO UPDATE SET
+			sessions = sessions + excluded.sessions,
+			errored = errored + excluded.errored,
+			crashed = crashed + excluded.crashed,
+			abnormal = abnormal + excluded.abnormal`,
+		projectID, release, environment, bucket, c.sessions, c.errored, c.crashed, c.abnormal,
+	)
+	return err
+}
+
+func saveSessionUser(tx *sql.Tx, projectID, release, environment string, bucket time.Time, user string, crashed bool) error {
+	_, err := tx.Exec(`
+		INSERT INTO release_session_users (project_id, release, environment, bucket, user, crashed)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(project_id, release, environment, bucket, user) DO UPDATE SET
+			crashed = crashed OR excluded.crashed`,
+		projectID, release, environment, bucket, user, crashed,
+	)
+	return err
+}
+
+// StartSessionWorker prunes session states and counts past their retention
+func StartSessionWorker(db *sql.DB) {
+	log.Println("Starting session prune worker...")
+	ticker := time.NewTicker(sessionPruneInterval)
+	defer ticker.Stop()
+
+	for now := time.Now(); ; now = <-ticker.C {
+		pruneSessions(db, now)
+	}
+}
+
+func pruneSessions(db *sql.DB, now time.Time) {
+	_, err := db.Exec("DELETE FROM session_states WHERE (status IN ('exited', 'crashed', 'abnormal') AND updated_at < ?) OR updated_at < ?",
+		now.Add(-endedSessionRetention).UTC(), now.Add(-openSessionRetention).UTC())
+	if err != nil {
+		log.Printf("[Sessions] Failed to prune session states: %v", err)
+	}
+
+	cutoff := hourBucket(now.Add(-sessionCountRetention))
+	if _, err := db.Exec("DELETE FROM release_sessions WHERE bucket < ?", cutoff); err != nil {
+		log.Printf("[Sessions] Failed to prune session counts: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM release_session_users WHERE bucket < ?", cutoff); err != nil {
+		log.Printf("[Sessions] Failed to prune session users: %v", err)
+	}
+}
+
+// Health queries
+
+// percentOf is part's share of total, or nil without a total
+func percentOf(part, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	p := float64(part) / float64(total) * 100
+	return &p
+}
+
+func (h *ReleaseHealth) computeRates(projectSessions int) {
+	h.CrashFreeSessions = percentOf(h.Sessions-h.CrashedSessions, h.Sessions)
+	h.CrashFreeUsers = percentOf(h.Users-h.CrashedUsers, h.Users)
+	h.Adoption = percentOf(h.Sessions, projectSessions)
+}
+
+// sessionFilter is the WHERE clause shared by health queries
+func sessionFilter(projectID, environment string, since time.Time) (string, []interface{}) {
+	where := " WHERE project_id = ? AND bucket >= ?"
+	args := []interface{}{projectID, hourBucket(since)}
+	if environment != "" {
+		where += " AND environment = ?"
+		args = append(args, environment)
+	}
+	return where, args
+}
+
+// GetHealthByRelease summarizes the sessions of each release of a project since a time,
+// in one environment or, when it's empty, all of them
+func GetHealthByRelease(db *sql.DB, projectID, environment string, since time.Time) (map[string]*ReleaseHealth, error) {
+	where, args := sessionFilter(projectID, environment, since)
+	rows, err := db.Query(`SELECT release, SUM(sessions), SUM(errored), SUM(crashed), SUM(abnormal)
+		FROM release_sessions`+where+` GROUP BY release`, args...)
+	if err != nil {
+		return nil, err
+	}
+	health := make(map[string]*ReleaseHealth)
+	projectSessions := 0
+	for rows.Next() {
+		h := &ReleaseHealth{}
+		if err := rows.Scan(&h.Version, &h.Sessions, &h.ErroredSessions, &h.CrashedSessions, &h.AbnormalSessions); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		health[h.Version] = h
+		projectSessions += h.Sessions
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT release, COUNT(DISTINCT user), COUNT(DISTINCT CASE WHEN crashed THEN user END)
+		FROM release_session_users`+where+` GROUP BY release`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version string
+		var users, crashed int
+		if err := rows.Scan(&version, &users, &crashed); err != nil {
+			return nil, err
+		}
+		if h := health[version]; h != nil {
+			h.Users, h.CrashedUsers = users, crashed
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, h := range health {
+		h.computeRates(projectSessions)
+	}
+	return health, nil
+}
+
+// GetReleaseHealth summarizes a release's sessions since a time, with a series in
+// hourly or daily buckets
+func GetReleaseHealth(db *sql.DB, projectID, version, environment string, since time.Time, resolution string) (*ReleaseHealth, error) {
+	all, err := GetHealthByRelease(db, projectID, environment, since)
+	if err != nil {
+		return nil, err
+	}
+	health := all[version]
+	if health == nil {
+		health = &ReleaseHealth{Version: version}
+	}
+
+	format := sessionBucketFormats[resolution]
+	where, args := sessionFilter(projectID, environment, since)
+	buckets := make(map[string]*HealthBucket)
+	projectSessions := make(map[string]int)
+	bucketAt := func(key string) *HealthBucket {
+		b := buckets[key]
+		if b == nil {
+			t, _ := time.Parse("2006-01-02 15:04:05", key)
+			b = &HealthBucket{Bucket: t}
+			buckets[key] = b
+		}
+		return b
+	}
+
+	rows, err := db.Query(`SELECT strftime(?, bucket), SUM(sessions),
+		SUM(CASE WHEN release = ? THEN sessions ELSE 0 END), SUM(CASE WHEN release = ? THEN crashed ELSE 0 END)
+		FROM release_sessions`+where+` GROUP BY 1`, append([]interface{}{format, version, version}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		var total, sessions, crashed int
+		if err := rows.Scan(&key, &total, &sessions, &crashed); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		projectSessions[key] = total
+		if sessions > 0 {
+			b := bucketAt(key)
+			b.Sessions, b.CrashedSessions = sessions, crashed
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT strftime(?, bucket), COUNT(DISTINCT user), COUNT(DISTINCT CASE WHEN crashed THEN user END)
+		FROM release_session_users`+where+` AND release = ? GROUP BY 1`, append(append([]interface{}{format}, args...), version)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var users, crashed int
+		if err := rows.Scan(&key, &users, &crashed); err != nil {
+			return nil, err
+		}
+		b := bucketAt(key)
+		b.Users, b.CrashedUsers = users, crashed
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	health.Series = make([]HealthBucket, 0, len(buckets))
+	for key, b := range buckets {
+		b.CrashFreeSessions = percentOf(b.Sessions-b.CrashedSessions, b.Sessions)
+		b.CrashFreeUsers = percentOf(b.Users-b.CrashedUsers, b.Users)
+		b.Adoption = percentOf(b.Sessions, projectSessions[key])
+		health.Series = append(health.Series, *b)
+	}
+	sort.Slice(health.Series, func(i, j int) bool { return health.Series[i].Bucket.Before(health.Series[j].Bucket) })
+	return health, nil
+}
+
+// Health handlers
+
+// healthRange reads the range query parameter as the monitor stats do
+func healthRange(r *http.Request) (since time.Time, resolution string, ok bool) {
+	rangeName := r.URL.Query().Get("range")
+	if rangeName == "" {
+		rangeName = "24h"
+	}
+	statsRange, ok := statsRanges[rangeName]
+	if !ok {
+		return time.Time{}, "", false
+	}
+	since = time.Now().Add(-statsRange.span)
+	if statsRange.resolution == "day" {
+		since = dayBucket(time.Now()).Add(-statsRange.span + 24*time.Hour)
+	}
+	return since, statsRange.resolution, true
+}
+
+// getProjectSessions serves the health of each release with sessions in the range,
+// most used first
+func getProjectSessions(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+	since, _, ok := healthRange(r)
+	if !ok {
+		http.Error(w, "range must be 24h, 7d, 30d or 90d", http.StatusBadRequest)
+		return
+	}
+
+	byRelease, err := GetHealthByRelease(db, projectID, r.URL.Query().Get("environment"), since)
+	if err != nil {
+		log.Printf("Error fetching release health: %v", err)
+		http.Error(w, "Failed to fetch release health", http.StatusInternalServerError)
+		return
+	}
+	health := make([]*ReleaseHealth, 0, len(byRelease))
+	for _, h := range byRelease {
+		health = append(health, h)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		if health[i].Sessions != health[j].Sessions {
+			return health[i].Sessions > health[j].Sessions
+		}
+		return health[i].Version < health[j].Version
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// getReleaseHealth serves a release's health over the range, in hourly buckets up to
+// 7 days and daily ones beyond
+func getReleaseHealth(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	rel := getReleaseOr404(w, db, vars["id"], vars["version"])
+	if rel == nil {
+		return
+	}
+	since, resolution, ok := healthRange(r)
+	if !ok {
+		http.Error(w, "range must be 24h, 7d, 30d or 90d", http.StatusBadRequest)
+		return
+	}
+
+	health, err := GetReleaseHealth(db, rel.ProjectID, rel.Version, r.URL.Query().Get("environment"), since, resolution)
+	if err != nil {
+		log.Printf("Error fetching release health: %v", err)
+		http.Error(w, "Failed to fetch release health", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestReleaseHealthFromSessions(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	started := time.Now().Add(-30 * time.Minute).UTC().Format(time.RFC3339)
+
+	session := func(sid, did, release, status string, init bool, errors int) {
+		t.Helper()
+		payload := fmt.Sprintf(`{"sid":%q,"did":%q,"init":%t,"started":%q,"status":%q,"errors":%d,"attrs":{"release":%q,"environment":"production"}}`,
+			sid, did, init, started, status, errors, release)
+		processSentrySession(db, project.ID, []byte(payload))
+	}
+	// Exits after an error
+	session("s1", "user-a", "checkout@1.2.0", "ok", true, 0)
+	session("s1", "user-a", "checkout@1.2.0", "ok", false, 1)
+	session("s1", "user-a", "checkout@1.2.0", "exited", false, 1)
+	// Crashes, then a late duplicate of the crash and of an earlier update arrive
+	session("s2", "user-b", "checkout@1.2.0", "ok", true, 0)
+	session("s2", "user-b", "checkout@1.2.0", "crashed", false, 1)
+	session("s2", "user-b", "checkout@1.2.0", "crashed", false, 1)
+	session("s2", "user-b", "checkout@1.2.0", "ok", false, 0)
+	// Still open, by the same user as s1
+	session("s3", "user-a", "checkout@1.2.0", "ok", true, 0)
+	session("s3", "user-a", "checkout@1.2.0", "ok", false, 0)
+	// Its start was missed
+	session("s4", "user-c", "checkout@1.2.0", "abnormal", false, 0)
+	// Another release
+	session("s5", "user-a", "checkout@1.1.0", "exited", true, 0)
+
+	processSentrySessions(db, project.ID, []byte(fmt.Sprintf(`{"aggregates":[
+		{"started":%q,"did":"user-d","exited":3,"errored":1,"crashed":1},
+		{"started":%q,"exited":2}
+	],"attrs":{"release":"checkout@1.2.0","environment":"production"}}`, started, started)))
+
+	health, err := GetHealthByRelease(db, project.ID, "", time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := health["checkout@1.2.0"]
+	if h == nil {
+		t.Fatalf("no health for checkout@1.2.0: %v", health)
+	}
+	got := [6]int{h.Sessions, h.ErroredSessions, h.CrashedSessions, h.AbnormalSessions, h.Users, h.CrashedUsers}
+	if want := [6]int{11, 5, 2, 1, 4, 2}; got != want {
+		t.Errorf("sessions, errored, crashed, abnormal, users, crashed users = %v, want %v", got, want)
+	}
+	for name, rate := range map[string]struct {
+		got  *float64
+		want float64
+	}{
+		"crash free sessions": {h.CrashFreeSessions, 900.0 / 11},
+		"crash free users":    {h.CrashFreeUsers, 50},
+		"adoption":            {h.Adoption, 1100.0 / 12},
+	} {
+		if rate.got == nil || math.Abs(*rate.got-rate.want) > 0.001 {
+			t.Errorf("%s = %v, want %.3f", name, rate.got, rate.want)
+		}
+	}
+
+	if h := health["checkout@1.1.0"]; h == nil || h.Sessions != 1 || h.Users != 1 || *h.CrashFreeSessions != 100 {
+		t.Errorf("checkout@1.1.0 health = %+v", h)
+	}
+	staging, err := GetHealthByRelease(db, project.ID, "staging", time.Now().Add(-24*time.Hour))
+	if err != nil || len(staging) != 0 {
+		t.Errorf("staging health = %v, %v, want none", staging, err)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Days before expiry at which SSL monitors alert; the largest also starts the degraded state
+var defaultSSLAlertDays = []int{30, 14, 7, 1}
+
+// CertificateInfo describes the certificate an SSL monitor was served
+type CertificateInfo struct {
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	SANs          []string  `json:"sans"`
+	NotBefore     time.Time `json:"not_before"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	ChainValid    bool      `json:"chain_valid"`
+	ChainError    string    `json:"chain_error,omitempty"`
+	HostnameValid bool      `json:"hostname_valid"`
+	TLSVersion    string    `json:"tls_version"`
+}
+
+// checkSSL connects with TLS and inspects the served certificate. Expired, not yet valid
+// and hostname-mismatched certificates are down; certificates within the first alert
+// threshold of expiry, or with an untrusted chain, are degraded.
+func checkSSL(target string, alertDays []int, timeout time.Duration) (status string, errMsg string, cert *CertificateInfo) {
+	host, addr := sslTarget(target)
+	if host == "" {
+		return "down", "no host to check", nil
+	}
+
+	config := &tls.Config{
+		// Verification happens below so the certificate is recorded even when it fails
+		InsecureSkipVerify: true,
+	}
+	if net.ParseIP(host) == nil {
+		config.ServerName = host
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, config)
+	if err != nil {
+		return "down", err.Error(), nil
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return "down", "server sent no certificate", nil
+	}
+	leaf := state.PeerCertificates[0]
+	now := time.Now()
+
+	cert = &CertificateInfo{
+		Subject:       leaf.Subject.String(),
+		Issuer:        leaf.Issuer.String(),
+		SANs:          certificateNames(leaf),
+		NotBefore:     leaf.NotBefore,
+		NotAfter:      leaf.NotAfter,
+		DaysRemaining: int(math.Floor(leaf.NotAfter.Sub(now).Hours() / 24)),
+		TLSVersion:    tls.VersionName(state.Version),
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range state.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates, CurrentTime: now}); err != nil {
+		cert.ChainError = err.Error()
+	} else {
+		cert.ChainValid = true
+	}
+	cert.HostnameValid = leaf.VerifyHostname(host) == nil
+
+	switch {
+	case now.After(leaf.NotAfter):
+		return "down", fmt.Sprintf("certificate expired on %s", leaf.NotAfter.UTC().Format("2006-01-02")), cert
+	case now.Before(leaf.NotBefore):
+		return "down", fmt.Sprintf("certificate is not valid before %s", leaf.NotBefore.UTC().Format("2006-01-02")), cert
+	case !cert.HostnameValid:
+		return "down", fmt.Sprintf("certificate is not valid for %s (valid for %s)", host, strings.Join(cert.SANs, ", ")), cert
+	}
+
+	var warnings []string
+	if len(alertDays) == 0 {
+		alertDays = defaultSSLAlertDays
+	}
+	degradedDays := 0
+	for _, d := range alertDays {
+		if d > degradedDays {
+			degradedDays = d
+		}
+	}
+	if cert.DaysRemaining <= degradedDays {
+		warnings = append(warnings, fmt.Sprintf("certificate expires in %s", pluralDays(cert.DaysRemaining)))
+	}
+	if !cert.ChainValid {
+		warnings = append(warnings, "untrusted chain: "+cert.ChainError)
+	}
+	if len(warnings) > 0 {
+		return "degraded", strings.Join(warnings, "; "), cert
+	}
+	return "up", "", cert
+}
+
+// sslTarget accepts a host, host:port or URL and defaults to port 443
+func sslTarget(target string) (host, addr string) {
+	target = strings.TrimSpace(target)
+	port := "443"
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return "", ""
+		}
+		host = u.Hostname()
+		if p := u.Port(); p != "" {
+			port = p
+		}
+	} else if h, p, err := net.SplitHostPort(target); err == nil {
+		host, port = h, p
+	} else {
+		host = strings.Trim(target, "[]")
+	}
+	return host, net.JoinHostPort(host, port)
+}
+
+func certificateNames(c *x509.Certificate) []string {
+	names := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 && c.Subject.CommonName != "" {
+		names = append(names, c.Subject.CommonName)
+	}
+	return names
+}
+
+func pluralDays(n int) string {
+	if n == 1 {
+		return "1 day"
+	}
+	if n <= 0 {
+		return "less than a day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
+
+// normalizeSSLAlertDays sorts the thresholds from the earliest warning down and drops duplicates
+func normalizeSSLAlertDays(days []int) ([]int, error) {
+	if len(days) == 0 {
+		return append([]int{}, defaultSSLAlertDays...), nil
+	}
+	if len(days) > 10 {
+		return nil, fmt.Errorf("at most 10 ssl_alert_days are allowed")
+	}
+	seen := map[int]bool{}
+	var out []int
+	for _, d := range days {
+		if d < 1 || d > 365 {
+			return nil, fmt.Errorf("ssl_alert_days must be between 1 and 365")
+		}
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out, nil
+}
+
+func formatSSLAlertDays(days []int) string {
+	parts := make([]string, len(days))
+	for i, d := range days {
+		parts[i] = strconv.Itoa(d)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseSSLAlertDays(s string) []int {
+	var days []int
+	for _, part := range strings.Split(s, ",") {
+		if d, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && d > 0 {
+			days = append(days, d)
+		}
+	}
+	if len(days) == 0 {
+		return append([]int{}, defaultSSLAlertDays...)
+	}
+	return days
+}
+
+// sslAlertLevel returns the smallest threshold the certificate is within, or 0 if none
+func sslAlertLevel(daysRemaining int, alertDays []int) int {
+	level := 0
+	for _, d := range alertDays {
+		if daysRemaining <= d && (level == 0 || d < level) {
+			level = d
+		}
+	}
+	return level
+}
+
+// evaluateCertificateAlert notifies once per threshold as a certificate approaches expiry,
+// and once more when it has been renewed. Expired certificates are down and alert
+// through the outage path instead.
+func evaluateCertificateAlert(db *sql.DB, m *Monitor, check *MonitorCheck) {
+	cert := check.Certificate
+	if cert == nil {
+		return
+	}
+
+	level := sslAlertLevel(cert.DaysRemaining, m.SSLAlertDays)
+	if level == 0 {
+		res, err := db.Exec("UPDATE monitors SET cert_alert_days = 0 WHERE id = ? AND cert_alert_days > 0", m.ID)
+		if err != nil {
+			return
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			notifyMonitorAlert(db, &MonitorAlert{Kind: "cert_renewed", Monitor: m, Check: check})
+		}
+		return
+	}
+	if cert.DaysRemaining < 0 {
+		return
+	}
+
+	// Claim the threshold so an overlapping check can't alert twice
+	res, err := db.Exec(`UPDATE monitors SET cert_alert_days = ?
+		WHERE id = ? AND (COALESCE(cert_alert_days, 0) = 0 OR cert_alert_days > ?)`, level, m.ID, level)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		notifyMonitorAlert(db, &MonitorAlert{Kind: "cert_expiring", Monitor: m, Check: check})
+	}
+}
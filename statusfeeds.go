@@ -0,0 +1,343 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Status page feeds list the page's incidents, newest first, each with its timeline
+const statusFeedSize = 50
+
+var incidentStatusLabels = map[string]string{
+	"investigating": "Investigating",
+	"identified":    "Identified",
+	"monitoring":    "Monitoring",
+	"resolved":      "Resolved",
+}
+
+// statusFeed is what the RSS, Atom and JSON feeds are written from
+type statusFeed struct {
+	title       string
+	description string
+	pageURL     string
+	feedURL     string
+	iconURL     string
+	updated     time.Time
+	items       []statusFeedItem
+}
+
+type statusFeedItem struct {
+	id        string
+	title     string
+	url       string
+	html      string
+	published time.Time
+	updated   time.Time
+}
+
+func loadStatusFeed(db *sql.DB, page *StatusPage, format string) (*statusFeed, error) {
+	incidents, err := GetStatusPageIncidents(db, page.ID, statusFeedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	pageURL := getPublicURL(db) + "/status/" + page.Slug
+	feed := &statusFeed{
+		title:       page.Title,
+		description: page.Description,
+		pageURL:     pageURL,
+		feedURL:     getPublicURL(db) + "/api/status/" + page.Slug + "/feed." + format,
+		iconURL:     page.LogoURL,
+		updated:     page.UpdatedAt,
+	}
+	if feed.description == "" {
+		feed.description = page.Title + " status and incident history"
+	}
+	for _, inc := range incidents {
+		if inc.UpdatedAt.After(feed.updated) {
+			feed.updated = inc.UpdatedAt
+		}
+		feed.items = append(feed.items, statusFeedItem{
+			id:        inc.ID,
+			title:     inc.Title,
+			url:       pageURL + "#incident-" + inc.ID,
+			html:      incidentTimelineHTML(&inc),
+			published: inc.CreatedAt,
+			updated:   inc.UpdatedAt,
+		})
+	}
+	return feed, nil
+}
+
+// incidentTimelineHTML renders an incident's updates, newest first
+func incidentTimelineHTML(inc *StatusPageIncident) string {
+	var b strings.Builder
+	for _, u := range inc.Updates {
+		label := incidentStatusLabels[u.Status]
+		if label == "" {
+			label = u.Status
+		}
+		fmt.Fprintf(&b, "<p><small>%s</small><br><strong>%s</strong> - %s</p>",
+			u.CreatedAt.UTC().Format("Jan 2, 15:04 MST"), html.EscapeString(label), html.EscapeString(u.Message))
+	}
+	return b.String()
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Icon    string      `xml:"icon,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// jsonFeed follows JSON Feed 1.1, https://jsonfeed.org/version/1.1
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	Icon        string         `json:"icon,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Title         string    `json:"title"`
+	ContentHTML   string    `json:"content_html"`
+	DatePublished time.Time `json:"date_published"`
+	DateModified  time.Time `json:"date_modified"`
+}
+
+// getStatusPageFeed serves a status page's incidents as RSS, Atom or a JSON feed
+func getStatusPageFeed(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	page, ok := loadPublicStatusPage(w, r, db)
+	if !ok {
+		return
+	}
+	format := mux.Vars(r)["format"]
+
+	feed, err := loadStatusFeed(db, page, format)
+	if err != nil {
+		log.Printf("Error building status feed for %s: %v", page.Slug, err)
+		http.Error(w, "Failed to load feed", http.StatusInternalServerError)
+		return
+	}
+
+	switch format {
+	case "rss":
+		out := rssFeed{Version: "2.0", Channel: rssChannel{
+			Title:         feed.title,
+			Link:          feed.pageURL,
+			Description:   feed.description,
+			LastBuildDate: feed.updated.UTC().Format(time.RFC1123Z),
+			Items:         []rssItem{},
+		}}
+		for _, item := range feed.items {
+			out.Channel.Items = append(out.Channel.Items, rssItem{
+				Title:       item.title,
+				Link:        item.url,
+				Description: item.html,
+				GUID:        rssGUID{Value: item.id},
+				PubDate:     item.published.UTC().Format(time.RFC1123Z),
+			})
+		}
+		writeXMLFeed(w, "application/rss+xml; charset=utf-8", out)
+
+	case "atom":
+		out := atomFeed{
+			ID:      "urn:uuid:" + page.ID,
+			Title:   feed.title,
+			Updated: feed.updated.UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Href: feed.pageURL}, {Href: feed.feedURL, Rel: "self"}},
+			Icon:    feed.iconURL,
+			Entries: []atomEntry{},
+		}
+		for _, item := range feed.items {
+			out.Entries = append(out.Entries, atomEntry{
+				ID:        "urn:uuid:" + item.id,
+				Title:     item.title,
+				Published: item.published.UTC().Format(time.RFC3339),
+				Updated:   item.updated.UTC().Format(time.RFC3339),
+				Link:      atomLink{Href: item.url},
+				Content:   atomContent{Type: "html", Body: item.html},
+			})
+		}
+		writeXMLFeed(w, "application/atom+xml; charset=utf-8", out)
+
+	case "json":
+		out := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       feed.title,
+			HomePageURL: feed.pageURL,
+			FeedURL:     feed.feedURL,
+			Description: feed.description,
+			Icon:        feed.iconURL,
+			Items:       []jsonFeedItem{},
+		}
+		for _, item := range feed.items {
+			out.Items = append(out.Items, jsonFeedItem{
+				ID:            item.id,
+				URL:           item.url,
+				Title:         item.title,
+				ContentHTML:   item.html,
+				DatePublished: item.published.UTC(),
+				DateModified:  item.updated.UTC(),
+			})
+		}
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		json.NewEncoder(w).Encode(out)
+
+	default:
+		http.Error(w, "Unknown feed format", http.StatusNotFound)
+	}
+}
+
+func writeXMLFeed(w http.ResponseWriter, contentType string, feed interface{}) {
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to encode feed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
+
+// getStatusPageBadge serves an SVG badge of a component's uptime, over the last 30 days
+// or the period given as 24h, 7d or 30d
+func getStatusPageBadge(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	page, ok := loadPublicStatusPage(w, r, db)
+	if !ok {
+		return
+	}
+	component := page.component(mux.Vars(r)["componentId"])
+	if component == nil {
+		http.Error(w, "Component not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	uptime, _ := statusPageBadges.get(page.ID+"/"+component.ID, now, func() (uptimeStats, error) {
+		var stats []uptimeStats
+		for _, ref := range component.Monitors {
+			if m, err := GetMonitor(db, ref.MonitorID); err == nil {
+				stats = append(stats, monitorUptimeStats(db, m, now))
+			}
+		}
+		return averageUptime(stats), nil
+	})
+
+	var percent float64
+	switch period := r.URL.Query().Get("period"); period {
+	case "24h":
+		percent = uptime.Uptime24h
+	case "7d":
+		percent = uptime.Uptime7d
+	case "", "30d":
+		percent = uptime.Uptime30d
+	default:
+		http.Error(w, "period must be 24h, 7d or 30d", http.StatusBadRequest)
+		return
+	}
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = component.Name
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write([]byte(uptimeBadge(label, fmt.Sprintf("%.2f%%", percent), uptimeBadgeColor(percent))))
+}
+
+func uptimeBadgeColor(percent float64) string {
+	switch {
+	case percent >= 99.9:
+		return "#4c1"
+	case percent >= 99:
+		return "#97ca00"
+	case percent >= 95:
+		return "#dfb317"
+	case percent >= 90:
+		return "#fe7d37"
+	}
+	return "#e05d44"
+}
+
+// uptimeBadge draws a flat two-part badge. Text widths are estimated from the character
+// count, as fonts aren't available to measure with.
+func uptimeBadge(label, message, color string) string {
+	textWidth := func(s string) int { return len([]rune(s))*7 + 10 }
+	lw, mw := textWidth(label), textWidth(message)
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[3]s: %[4]s">
+<title>%[3]s: %[4]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[6]d" height="20" fill="%[5]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="14">%[3]s</text><text x="%[8]d" y="14">%[4]s</text>
+</g>
+</svg>`, lw+mw, lw, label, message, color, mw, lw/2, lw+mw/2)
+}
@@ -0,0 +1,1077 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Status pages show resolved incidents this long after they end
+const resolvedIncidentHorizon = 7 * 24 * time.Hour
+
+// Public pages and badges are built at most this often per page, however many visitors
+// they have. Edits to the page or its incidents show right away.
+const statusPageCacheTTL = 30 * time.Second
+
+var (
+	statusPageViews  = &ttlCache[*publicStatusPage]{ttl: statusPageCacheTTL}
+	statusPageBadges = &ttlCache[uptimeStats]{ttl: statusPageCacheTTL}
+)
+
+// ttlCache keeps values for ttl. Keys are prefixed with a status page ID so a page's
+// entries can be dropped together.
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]ttlCacheEntry[V]
+}
+
+type ttlCacheEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// get returns the value cached for key, or builds and caches it
+func (c *ttlCache[V]) get(key string, now time.Time, build func() (V, error)) (V, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e.value, nil
+	}
+	c.mu.Unlock()
+
+	value, err := build()
+	if err != nil {
+		return value, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]ttlCacheEntry[V])
+	}
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = ttlCacheEntry[V]{value: value, expires: now.Add(c.ttl)}
+	return value, nil
+}
+
+// forget drops the entries of keys starting with prefix
+func (c *ttlCache[V]) forget(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// forgetStatusPage drops the cached view and badges of a page after it changes
+func forgetStatusPage(pageID string) {
+	statusPageViews.forget(pageID)
+	statusPageBadges.forget(pageID + "/")
+}
+
+var statusPageSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,62}[a-z0-9])?$`)
+
+// StatusPage is a public page at /status/{slug} showing a chosen set of a project's
+// monitors, grouped into components, along with incidents posted by hand
+type StatusPage struct {
+	ID          string                `json:"id"`
+	ProjectID   string                `json:"project_id"`
+	Slug        string                `json:"slug"`
+	Title       string                `json:"title"`
+	Description string                `json:"description"`
+	LogoURL     string                `json:"logo_url"`
+	Components  []StatusPageComponent `json:"components"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+}
+
+// StatusPageComponent is a named group of monitors. Its ID is kept across edits so
+// badge URLs stay valid.
+type StatusPageComponent struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Monitors    []StatusPageMonitor `json:"monitors"`
+}
+
+// StatusPageMonitor puts a monitor on a page. DisplayName replaces the monitor's own
+// name, which may be internal.
+type StatusPageMonitor struct {
+	MonitorID   string `json:"monitor_id"`
+	DisplayName string `json:"display_name"`
+}
+
+// StatusPageIncident is an incident posted to a status page. Its status follows the
+// latest update.
+type StatusPageIncident struct {
+	ID           string                     `json:"id"`
+	StatusPageID string                     `json:"status_page_id"`
+	Title        string                     `json:"title"`
+	Status       string                     `json:"status"` // investigating, identified, monitoring, resolved
+	Impact       string                     `json:"impact"` // none, minor, major, critical
+	ComponentIDs []string                   `json:"component_ids"`
+	CreatedAt    time.Time                  `json:"created_at"`
+	UpdatedAt    time.Time                  `json:"updated_at"`
+	ResolvedAt   *time.Time                 `json:"resolved_at,omitempty"`
+	Updates      []StatusPageIncidentUpdate `json:"updates"`
+}
+
+type StatusPageIncidentUpdate struct {
+	ID         string    `json:"id"`
+	IncidentID string    `json:"incident_id"`
+	Status     string    `json:"status"`
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var (
+	incidentStatuses = []string{"investigating", "identified", "monitoring", "resolved"}
+	incidentImpacts  = []string{"none", "minor", "major", "critical"}
+)
+
+func (p *StatusPage) validate() error {
+	p.Slug = strings.ToLower(strings.TrimSpace(p.Slug))
+	if !statusPageSlugPattern.MatchString(p.Slug) {
+		return fmt.Errorf("slug must be 1-64 lowercase letters, digits or dashes, not starting or ending with a dash")
+	}
+	if _, err := uuid.Parse(p.Slug); err == nil {
+		// UUIDs are reserved for the project status pages at /status/{projectId}
+		return fmt.Errorf("slug can't be a UUID")
+	}
+	p.Title = strings.TrimSpace(p.Title)
+	if p.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	p.LogoURL = strings.TrimSpace(p.LogoURL)
+	if p.LogoURL != "" {
+		u, err := url.Parse(p.LogoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("logo_url must be an http or https URL")
+		}
+	}
+
+	if p.Components == nil {
+		p.Components = []StatusPageComponent{}
+	}
+	seen := map[string]bool{}
+	for i := range p.Components {
+		c := &p.Components[i]
+		c.Name = strings.TrimSpace(c.Name)
+		if c.Name == "" {
+			return fmt.Errorf("component %d needs a name", i+1)
+		}
+		if c.ID == "" {
+			c.ID = uuid.New().String()
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("component id %s is used twice", c.ID)
+		}
+		seen[c.ID] = true
+		if c.Monitors == nil {
+			c.Monitors = []StatusPageMonitor{}
+		}
+		for j := range c.Monitors {
+			c.Monitors[j].DisplayName = strings.TrimSpace(c.Monitors[j].DisplayName)
+		}
+	}
+	return nil
+}
+
+func (p *StatusPage) component(id string) *StatusPageComponent {
+	for i := range p.Components {
+		if p.Components[i].ID == id {
+			return &p.Components[i]
+		}
+	}
+	return nil
+}
+
+// validateStatusPageMonitors checks the page only shows monitors of its project
+func validateStatusPageMonitors(db *sql.DB, page *StatusPage) error {
+	for _, c := range page.Components {
+		for _, ref := range c.Monitors {
+			m, err := GetMonitor(db, ref.MonitorID)
+			if err != nil || m.ProjectID != page.ProjectID {
+				return fmt.Errorf("monitor %s not found in this project", ref.MonitorID)
+			}
+		}
+	}
+	return nil
+}
+
+func (i *StatusPageIncident) validate(page *StatusPage) error {
+	i.Title = strings.TrimSpace(i.Title)
+	if i.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if i.Impact == "" {
+		i.Impact = "minor"
+	}
+	if !containsString(incidentImpacts, i.Impact) {
+		return fmt.Errorf("impact must be one of %s", strings.Join(incidentImpacts, ", "))
+	}
+	if i.ComponentIDs == nil {
+		i.ComponentIDs = []string{}
+	}
+	for _, id := range i.ComponentIDs {
+		if page.component(id) == nil {
+			return fmt.Errorf("component %s not found on this status page", id)
+		}
+	}
+	return nil
+}
+
+// setStatus moves the incident to status, stamping when it was resolved
+func (i *StatusPageIncident) setStatus(status string, at time.Time) {
+	i.Status = status
+	i.UpdatedAt = at
+	if status == "resolved" {
+		if i.ResolvedAt == nil {
+			i.ResolvedAt = &at
+		}
+	} else {
+		i.ResolvedAt = nil
+	}
+}
+
+// Status rollup
+
+var statusSeverity = map[string]int{"operational": 0, "maintenance": 1, "degraded": 2, "down": 3}
+
+// worseStatus returns the more severe of two page statuses. Monitor statuses that
+// aren't page statuses, such as up, pending and paused, count as operational.
+func worseStatus(a, b string) string {
+	if statusSeverity[b] > statusSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// impactStatus is the page status an open incident of the given impact implies
+func impactStatus(impact string) string {
+	switch impact {
+	case "minor":
+		return "degraded"
+	case "major", "critical":
+		return "down"
+	}
+	return "operational"
+}
+
+// uptimeStats are a monitor's uptime and share of time degraded over the last day, week
+// and month. Uptime comes from confirmed incidents, so it covers the whole window however
+// many checks were made. Degraded time counts as up and is reported on its own, and
+// maintenance isn't counted at all.
+type uptimeStats struct {
+	Uptime24h   float64 `json:"uptime_24h"`
+	Uptime7d    float64 `json:"uptime_7d"`
+	Uptime30d   float64 `json:"uptime_30d"`
+	Degraded24h float64 `json:"degraded_24h"`
+	Degraded7d  float64 `json:"degraded_7d"`
+	Degraded30d float64 `json:"degraded_30d"`
+}
+
+func monitorUptimeStats(db *sql.DB, m *Monitor, now time.Time) uptimeStats {
+	uptimeSince := func(since time.Time) float64 {
+		if m.CreatedAt.After(since) {
+			since = m.CreatedAt
+		}
+		maintenance := monitorMaintenance(db, m, since, now)
+		_, downtime, _, _ := monitorIncidentStats(db, m.ID, since, now, maintenance)
+		return uptimePercent(now.Sub(since)-overlapDuration(since, now, maintenance), downtime)
+	}
+	// The degraded share is of checks, from the hourly rollups
+	degradedSince := func(since time.Time) float64 {
+		_, degraded, _ := rollupUptime(db, m.ID, since)
+		return degraded
+	}
+
+	return uptimeStats{
+		Uptime24h:   uptimeSince(now.Add(-24 * time.Hour)),
+		Uptime7d:    uptimeSince(now.Add(-7 * 24 * time.Hour)),
+		Uptime30d:   uptimeSince(now.Add(-30 * 24 * time.Hour)),
+		Degraded24h: degradedSince(now.Add(-24 * time.Hour)),
+		Degraded7d:  degradedSince(now.Add(-7 * 24 * time.Hour)),
+		Degraded30d: degradedSince(now.Add(-30 * 24 * time.Hour)),
+	}
+}
+
+// averageUptime combines the stats of a component's monitors
+func averageUptime(stats []uptimeStats) uptimeStats {
+	var avg uptimeStats
+	if len(stats) == 0 {
+		return uptimeStats{Uptime24h: 100, Uptime7d: 100, Uptime30d: 100}
+	}
+	for _, s := range stats {
+		avg.Uptime24h += s.Uptime24h
+		avg.Uptime7d += s.Uptime7d
+		avg.Uptime30d += s.Uptime30d
+		avg.Degraded24h += s.Degraded24h
+		avg.Degraded7d += s.Degraded7d
+		avg.Degraded30d += s.Degraded30d
+	}
+	n := float64(len(stats))
+	avg.Uptime24h /= n
+	avg.Uptime7d /= n
+	avg.Uptime30d /= n
+	avg.Degraded24h /= n
+	avg.Degraded7d /= n
+	avg.Degraded30d /= n
+	return avg
+}
+
+// Public views of a status page. They show display names and check results only, never
+// monitor URLs or settings.
+
+type publicStatusPage struct {
+	Page        publicStatusPageInfo `json:"page"`
+	Status      string               `json:"status"`
+	Components  []publicComponent    `json:"components"`
+	Incidents   []StatusPageIncident `json:"incidents"`
+	Maintenance []MaintenanceWindow  `json:"maintenance"`
+	GeneratedAt time.Time            `json:"generated_at"`
+}
+
+type publicStatusPageInfo struct {
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	LogoURL     string    `json:"logo_url"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type publicComponent struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	uptimeStats
+	Monitors []publicMonitor `json:"monitors"`
+}
+
+type publicMonitor struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	uptimeStats
+	History      []DailyUptime `json:"history"`
+	RecentChecks []publicCheck `json:"recent_checks"`
+}
+
+type publicCheck struct {
+	Status       string    `json:"status"`
+	ResponseTime int       `json:"response_time"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// buildStatusPage gathers what a status page shows as of now. Component stats are
+// left out when withStats is false, for callers that only need statuses.
+func buildStatusPage(db *sql.DB, page *StatusPage, now time.Time, withStats bool) (*publicStatusPage, error) {
+	incidents, err := GetStatusPageIncidents(db, page.ID, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open incidents raise the status of the components they affect, or of the whole
+	// page when they don't name any
+	incidentStatus := map[string]string{}
+	pageStatus := "operational"
+	shown := []StatusPageIncident{}
+	for _, inc := range incidents {
+		if inc.ResolvedAt == nil {
+			status := impactStatus(inc.Impact)
+			pageStatus = worseStatus(pageStatus, status)
+			for _, id := range inc.ComponentIDs {
+				incidentStatus[id] = worseStatus(incidentStatus[id], status)
+			}
+		}
+		if inc.ResolvedAt == nil || now.Sub(*inc.ResolvedAt) < resolvedIncidentHorizon {
+			shown = append(shown, inc)
+		}
+	}
+
+	monitorIDs := map[string]bool{}
+	components := make([]publicComponent, 0, len(page.Components))
+	for _, c := range page.Components {
+		pc := publicComponent{
+			ID:          c.ID,
+			Name:        c.Name,
+			Description: c.Description,
+			Status:      worseStatus("operational", incidentStatus[c.ID]),
+			Monitors:    []publicMonitor{},
+		}
+		var stats []uptimeStats
+		for _, ref := range c.Monitors {
+			m, err := GetMonitor(db, ref.MonitorID)
+			if err != nil {
+				// Deleted since the page was saved
+				continue
+			}
+			monitorIDs[m.ID] = true
+			pc.Status = worseStatus(pc.Status, m.Status)
+
+			pm := publicMonitor{ID: m.ID, Name: ref.DisplayName, Status: m.Status, RecentChecks: []publicCheck{}}
+			if pm.Name == "" {
+				pm.Name = m.Name
+			}
+			if withStats {
+				pm.uptimeStats = monitorUptimeStats(db, m, now)
+				stats = append(stats, pm.uptimeStats)
+				pm.History = dailyUptimeHistory(db, m.ID, uptimeHistoryDays, now)
+				checks, _ := GetMonitorChecks(db, m.ID, 50)
+				for _, check := range checks {
+					pm.RecentChecks = append(pm.RecentChecks, publicCheck{
+						Status:       check.Status,
+						ResponseTime: check.ResponseTime,
+						CreatedAt:    check.CreatedAt,
+					})
+				}
+			}
+			pc.Monitors = append(pc.Monitors, pm)
+		}
+		if withStats {
+			pc.uptimeStats = averageUptime(stats)
+		}
+		pageStatus = worseStatus(pageStatus, pc.Status)
+		components = append(components, pc)
+	}
+
+	// Maintenance of the page's monitors in progress or starting soon. Windows naming
+	// other monitors only are left out, and monitors not on the page aren't listed.
+	maintenance := []MaintenanceWindow{}
+	windows, _ := GetMaintenanceWindows(db, page.ProjectID)
+	for _, window := range windows {
+		if len(window.MonitorIDs) > 0 {
+			var ids []string
+			for _, id := range window.MonitorIDs {
+				if monitorIDs[id] {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			window.MonitorIDs = ids
+		}
+		window.describe(now)
+		if window.Occurrence != nil && window.Occurrence.StartsAt.Before(now.Add(upcomingMaintenanceHorizon)) {
+			window.ProjectID = ""
+			maintenance = append(maintenance, window)
+		}
+	}
+	sort.Slice(maintenance, func(i, j int) bool {
+		return maintenance[i].Occurrence.StartsAt.Before(maintenance[j].Occurrence.StartsAt)
+	})
+
+	return &publicStatusPage{
+		Page: publicStatusPageInfo{
+			Slug:        page.Slug,
+			Title:       page.Title,
+			Description: page.Description,
+			LogoURL:     page.LogoURL,
+			UpdatedAt:   page.UpdatedAt,
+		},
+		Status:      pageStatus,
+		Components:  components,
+		Incidents:   shown,
+		Maintenance: maintenance,
+		GeneratedAt: now,
+	}, nil
+}
+
+// Status page storage
+
+const statusPageColumns = `id, project_id, slug, title, description, logo_url, components, created_at, updated_at`
+
+func scanStatusPage(row interface{ Scan(...interface{}) error }) (*StatusPage, error) {
+	var p StatusPage
+	var components string
+	err := row.Scan(&p.ID, &p.ProjectID, &p.Slug, &p.Title, &p.Description, &p.LogoURL, &components,
+		&p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(components), &p.Components)
+	if p.Components == nil {
+		p.Components = []StatusPageComponent{}
+	}
+	return &p, nil
+}
+
+func GetStatusPages(db *sql.DB, projectID string) ([]StatusPage, error) {
+	rows, err := db.Query("SELECT "+statusPageColumns+" FROM status_pages WHERE project_id = ? ORDER BY title", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []StatusPage
+	for rows.Next() {
+		p, err := scanStatusPage(rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, *p)
+	}
+	return pages, rows.Err()
+}
+
+func GetStatusPage(db *sql.DB, projectID, id string) (*StatusPage, error) {
+	return scanStatusPage(db.QueryRow("SELECT "+statusPageColumns+" FROM status_pages WHERE project_id = ? AND id = ?",
+		projectID, id))
+}
+
+func GetStatusPageBySlug(db *sql.DB, slug string) (*StatusPage, error) {
+	return scanStatusPage(db.QueryRow("SELECT "+statusPageColumns+" FROM status_pages WHERE slug = ?", slug))
+}
+
+// SaveStatusPage upserts rather than replaces, which would delete the page's incidents
+func SaveStatusPage(db *sql.DB, p *StatusPage) error {
+	components, _ := json.Marshal(p.Components)
+	_, err := db.Exec(`
+		INSERT INTO status_pages (id, project_id, slug, title, description, logo_url, components, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET slug = excluded.slug, title = excluded.title, description = excluded.description,
+			logo_url = excluded.logo_url, components = excluded.components, updated_at = excluded.updated_at`,
+		p.ID, p.ProjectID, p.Slug, p.Title, p.Description, p.LogoURL, string(components), p.CreatedAt, p.UpdatedAt,
+	)
+	forgetStatusPage(p.ID)
+	return err
+}
+
+func DeleteStatusPage(db *sql.DB, projectID, id string) error {
+	res, err := db.Exec("DELETE FROM status_pages WHERE project_id = ? AND id = ?", projectID, id)
+	if err != nil {
+		return err
+	}
+	forgetStatusPage(id)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const statusPageIncidentColumns = `id, status_page_id, title, status, impact, component_ids, created_at, updated_at, resolved_at`
+
+func scanStatusPageIncident(row interface{ Scan(...interface{}) error }) (*StatusPageIncident, error) {
+	var i StatusPageIncident
+	var componentIDs string
+	var resolvedAt sql.NullTime
+	err := row.Scan(&i.ID, &i.StatusPageID, &i.Title, &i.Status, &i.Impact, &componentIDs,
+		&i.CreatedAt, &i.UpdatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(componentIDs), &i.ComponentIDs)
+	if i.ComponentIDs == nil {
+		i.ComponentIDs = []string{}
+	}
+	if resolvedAt.Valid {
+		i.ResolvedAt = &resolvedAt.Time
+	}
+	i.Updates = []StatusPageIncidentUpdate{}
+	return &i, nil
+}
+
+// GetStatusPageIncidents returns a page's latest incidents with their updates, newest first
+func GetStatusPageIncidents(db *sql.DB, statusPageID string, limit int) ([]StatusPageIncident, error) {
+	rows, err := db.Query("SELECT "+statusPageIncidentColumns+" FROM status_page_incidents WHERE status_page_id = ? ORDER BY created_at DESC LIMIT ?",
+		statusPageID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []StatusPageIncident{}
+	for rows.Next() {
+		i, err := scanStatusPageIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, *i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range incidents {
+		if incidents[i].Updates, err = getStatusPageIncidentUpdates(db, incidents[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return incidents, nil
+}
+
+func GetStatusPageIncident(db *sql.DB, statusPageID, id string) (*StatusPageIncident, error) {
+	i, err := scanStatusPageIncident(db.QueryRow("SELECT "+statusPageIncidentColumns+" FROM status_page_incidents WHERE status_page_id = ? AND id = ?",
+		statusPageID, id))
+	if err != nil {
+		return nil, err
+	}
+	if i.Updates, err = getStatusPageIncidentUpdates(db, i.ID); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// getStatusPageIncidentUpdates returns an incident's timeline, newest first
+func getStatusPageIncidentUpdates(db *sql.DB, incidentID string) ([]StatusPageIncidentUpdate, error) {
+	rows, err := db.Query("SELECT id, incident_id, status, message, created_at FROM status_page_incident_updates WHERE incident_id = ? ORDER BY created_at DESC",
+		incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	updates := []StatusPageIncidentUpdate{}
+	for rows.Next() {
+		var u StatusPageIncidentUpdate
+		if err := rows.Scan(&u.ID, &u.IncidentID, &u.Status, &u.Message, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		updates = append(updates, u)
+	}
+	return updates, rows.Err()
+}
+
+// SaveStatusPageIncident stores the incident along with update, if there is one
+func SaveStatusPageIncident(db *sql.DB, i *StatusPageIncident, update *StatusPageIncidentUpdate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	componentIDs, _ := json.Marshal(i.ComponentIDs)
+	_, err = tx.Exec(`
+		INSERT INTO status_page_incidents (id, status_page_id, title, status, impact, component_ids, created_at, updated_at, resolved_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET title = excluded.title, status = excluded.status, impact = excluded.impact,
+			component_ids = excluded.component_ids, updated_at = excluded.updated_at, resolved_at = excluded.resolved_at`,
+		i.ID, i.StatusPageID, i.Title, i.Status, i.Impact, string(componentIDs), i.CreatedAt, i.UpdatedAt, i.ResolvedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if update != nil {
+		_, err = tx.Exec("INSERT INTO status_page_incident_updates (id, incident_id, status, message, created_at) VALUES (?, ?, ?, ?, ?)",
+			update.ID, update.IncidentID, update.Status, update.Message, update.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	forgetStatusPage(i.StatusPageID)
+	return nil
+}
+
+func DeleteStatusPageIncident(db *sql.DB, statusPageID, id string) error {
+	res, err := db.Exec("DELETE FROM status_page_incidents WHERE status_page_id = ? AND id = ?", statusPageID, id)
+	if err != nil {
+		return err
+	}
+	forgetStatusPage(statusPageID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Status page handlers
+
+func getStatusPages(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+
+	pages, err := GetStatusPages(db, projectID)
+	if err != nil {
+		log.Printf("Error fetching status pages: %v", err)
+		http.Error(w, "Failed to fetch status pages", http.StatusInternalServerError)
+		return
+	}
+	if pages == nil {
+		pages = []StatusPage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pages)
+}
+
+// loadStatusPage fetches the page named in the route, writing the error response if
+// there isn't one
+func loadStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) (*StatusPage, bool) {
+	vars := mux.Vars(r)
+	page, err := GetStatusPage(db, vars["id"], vars["pageId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Status page not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch status page", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return page, true
+}
+
+func getStatusPageConfig(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	page, ok := loadStatusPage(w, r, db)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// saveStatusPageRequest validates and stores a created or edited page, reporting
+// problems to the client
+func saveStatusPageRequest(w http.ResponseWriter, db *sql.DB, page *StatusPage) bool {
+	if err := page.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := validateStatusPageMonitors(db, page); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if other, err := GetStatusPageBySlug(db, page.Slug); err == nil && other.ID != page.ID {
+		http.Error(w, "Slug is already taken", http.StatusConflict)
+		return false
+	}
+
+	if err := SaveStatusPage(db, page); err != nil {
+		log.Printf("Error saving status page: %v", err)
+		http.Error(w, "Failed to save status page", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func createStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	projectID := mux.Vars(r)["id"]
+
+	if _, err := GetProject(db, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var page StatusPage
+	if err := json.NewDecoder(r.Body).Decode(&page); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	page.ID = uuid.New().String()
+	page.ProjectID = projectID
+	page.CreatedAt = time.Now()
+	page.UpdatedAt = page.CreatedAt
+	if !saveStatusPageRequest(w, db, &page) {
+		return
+	}
+
+	recordAudit(db, r, "status_page.create", "status_page", page.ID, nil, &page)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(page)
+}
+
+func updateStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	existing, ok := loadStatusPage(w, r, db)
+	if !ok {
+		return
+	}
+
+	page := *existing
+	if err := json.NewDecoder(r.Body).Decode(&page); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	page.ID = existing.ID
+	page.ProjectID = existing.ProjectID
+	page.CreatedAt = existing.CreatedAt
+	page.UpdatedAt = time.Now()
+	if !saveStatusPageRequest(w, db, &page) {
+		return
+	}
+
+	recordAudit(db, r, "status_page.update", "status_page", page.ID, existing, &page)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func deleteStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	pageID := vars["pageId"]
+
+	existing, _ := GetStatusPage(db, projectID, pageID)
+
+	if err := DeleteStatusPage(db, projectID, pageID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Status page not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete status page", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(db, r, "status_page.delete", "status_page", pageID, existing, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getStatusPageIncidents(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	page, ok := loadStatusPage(w, r, db)
+	if !ok {
+		return
+	}
+
+	incidents, err := GetStatusPageIncidents(db, page.ID, 100)
+	if err != nil {
+		log.Printf("Error fetching status page incidents: %v", err)
+		http.Error(w, "Failed to fetch incidents", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incidents)
+}
+
+// incidentUpdateRequest is the status and message of a new timeline entry
+type incidentUpdateRequest struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (u *incidentUpdateRequest) validate() error {
+	u.Message = strings.TrimSpace(u.Message)
+	if u.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+	if !containsString(incidentStatuses, u.Status) {
+		return fmt.Errorf("status must be one of %s", strings.Join(incidentStatuses, ", "))
+	}
+	return nil
+}
+
+// createStatusPageIncident posts an incident with its first update
+func createStatusPageIncident(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	page, ok := loadStatusPage(w, r, db)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		StatusPageIncident
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	incident := req.StatusPageIncident
+	if err := incident.validate(page); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	update := incidentUpdateRequest{Status: incident.Status, Message: req.Message}
+	if update.Status == "" {
+		update.Status = "investigating"
+	}
+	if err := update.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	incident.ID = uuid.New().String()
+	incident.StatusPageID = page.ID
+	incident.CreatedAt = now
+	incident.ResolvedAt = nil
+	incident.setStatus(update.Status, now)
+	first := StatusPageIncidentUpdate{
+		ID:         uuid.New().String(),
+		IncidentID: incident.ID,
+		Status:     update.Status,
+		Message:    update.Message,
+		CreatedAt:  now,
+	}
+	if err := SaveStatusPageIncident(db, &incident, &first); err != nil {
+		log.Printf("Error creating status page incident: %v", err)
+		http.Error(w, "Failed to create incident", http.StatusInternalServerError)
+		return
+	}
+	incident.Updates = []StatusPageIncidentUpdate{first}
+
+	recordAudit(db, r, "status_page.incident.create", "status_page_incident", incident.ID, nil, &incident)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(incident)
+}
+
+// loadStatusPageIncident fetches the page and incident named in the route, writing the
+// error response if either is missing
+func loadStatusPageIncident(w http.ResponseWriter, r *http.Request, db *sql.DB) (*StatusPage, *StatusPageIncident, bool) {
+	page, ok := loadStatusPage(w, r, db)
+	if !ok {
+		return nil, nil, false
+	}
+	incident, err := GetStatusPageIncident(db, page.ID, mux.Vars(r)["incidentId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Incident not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch incident", http.StatusInternalServerError)
+		}
+		return nil, nil, false
+	}
+	return page, incident, true
+}
+
+// updateStatusPageIncident edits an incident's title, impact and components. Its status
+// changes through updates.
+func updateStatusPageIncident(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	page, existing, ok := loadStatusPageIncident(w, r, db)
+	if !ok {
+		return
+	}
+
+	incident := *existing
+	if err := json.NewDecoder(r.Body).Decode(&incident); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	incident.ID = existing.ID
+	incident.StatusPageID = existing.StatusPageID
+	incident.Status = existing.Status
+	incident.CreatedAt = existing.CreatedAt
+	incident.ResolvedAt = existing.ResolvedAt
+	incident.Updates = existing.Updates
+	incident.UpdatedAt = time.Now()
+	if err := incident.validate(page); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SaveStatusPageIncident(db, &incident, nil); err != nil {
+		log.Printf("Error updating status page incident: %v", err)
+		http.Error(w, "Failed to update incident", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "status_page.incident.update", "status_page_incident", incident.ID, existing, &incident)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incident)
+}
+
+// addStatusPageIncidentUpdate adds to an incident's timeline, moving it to the update's
+// status
+func addStatusPageIncidentUpdate(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	_, existing, ok := loadStatusPageIncident(w, r, db)
+	if !ok {
+		return
+	}
+
+	req := incidentUpdateRequest{Status: existing.Status}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	incident := *existing
+	incident.setStatus(req.Status, now)
+	update := StatusPageIncidentUpdate{
+		ID:         uuid.New().String(),
+		IncidentID: incident.ID,
+		Status:     req.Status,
+		Message:    req.Message,
+		CreatedAt:  now,
+	}
+	if err := SaveStatusPageIncident(db, &incident, &update); err != nil {
+		log.Printf("Error updating status page incident: %v", err)
+		http.Error(w, "Failed to update incident", http.StatusInternalServerError)
+		return
+	}
+	incident.Updates = append([]StatusPageIncidentUpdate{update}, existing.Updates...)
+
+	recordAudit(db, r, "status_page.incident.update", "status_page_incident", incident.ID, existing, &incident)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(incident)
+}
+
+func deleteStatusPageIncident(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	page, existing, ok := loadStatusPageIncident(w, r, db)
+	if !ok {
+		return
+	}
+
+	if err := DeleteStatusPageIncident(db, page.ID, existing.ID); err != nil {
+		http.Error(w, "Failed to delete incident", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, "status_page.incident.delete", "status_page_incident", existing.ID, existing, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Public status page handlers
+
+// servePublicStatusPage writes the JSON a status page is rendered from
+func servePublicStatusPage(w http.ResponseWriter, db *sql.DB, page *StatusPage) {
+	view, err := statusPageViews.get(page.ID, time.Now(), func() (*publicStatusPage, error) {
+		return buildStatusPage(db, page, time.Now(), true)
+	})
+	if err != nil {
+		log.Printf("Error building status page %s: %v", page.Slug, err)
+		http.Error(w, "Failed to load status page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// loadPublicStatusPage fetches the page named by slug in the route, writing a 404 if there
+// isn't one
+func loadPublicStatusPage(w http.ResponseWriter, r *http.Request, db *sql.DB) (*StatusPage, bool) {
+	page, err := GetStatusPageBySlug(db, mux.Vars(r)["page"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Status page not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch status page", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return page, true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func newTestMonitor(t *testing.T, db *sql.DB, projectID, name, target string) *Monitor {
+	t.Helper()
+	m := &Monitor{
+		ID:               uuid.New().String(),
+		ProjectID:        projectID,
+		Name:             name,
+		Type:             "http",
+		URL:              target,
+		Interval:         60,
+		Timeout:          10,
+		Status:           "down",
+		CreatedAt:        time.Now().Add(-time.Hour),
+		FailureThreshold: 1,
+	}
+	if err := CreateMonitor(db, m); err != nil {
+		t.Fatalf("CreateMonitor: %v", err)
+	}
+	check := &MonitorCheck{ID: uuid.New().String(), MonitorID: m.ID, Status: "down", StatusCode: 500,
+		ErrorMessage: "GET " + target + ": connection refused", CreatedAt: time.Now().Add(-time.Minute)}
+	if err := InsertMonitorCheck(db, check); err != nil {
+		t.Fatalf("InsertMonitorCheck: %v", err)
+	}
+	return m
+}
+
+func getPublicStatus(t *testing.T, db *sql.DB, page string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/status/"+page, nil), map[string]string{"page": page})
+	rec := httptest.NewRecorder()
+	getStatusPage(rec, req, db)
+	return rec
+}
+
+func TestProjectStatusPageIsOptIn(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	newTestMonitor(t, db, project.ID, "API", "https://internal.example.test/health?token=s3cret")
+
+	if rec := getPublicStatus(t, db, project.ID); rec.Code != http.StatusNotFound {
+		t.Fatalf("without the setting: %d %s", rec.Code, rec.Body.String())
+	}
+
+	mustSetting(t, db, "project_status_pages", "true")
+	rec := getPublicStatus(t, db, project.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with the setting: %d %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `"name":"API"`) || !strings.Contains(body, `"status":"down"`) {
+		t.Errorf("page lacks the monitor: %s", body)
+	}
+	for _, private := range []string{"internal.example.test", "s3cret", "connection refused", "status_code", "error_message"} {
+		if strings.Contains(body, private) {
+			t.Errorf("page exposes %q: %s", private, body)
+		}
+	}
+}
+
+func TestStatusPageCached(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	m := newTestMonitor(t, db, project.ID, "API", "https://api.example.test")
+	page := &StatusPage{
+		ID: uuid.New().String(), ProjectID: project.ID, Slug: "acme-" + uuid.New().String()[:8], Title: "Acme",
+		Components: []StatusPageComponent{{ID: "api", Name: "API", Monitors: []StatusPageMonitor{{MonitorID: m.ID}}}},
+		CreatedAt:  time.Now(), UpdatedAt: time.Now(),
+	}
+	if err := SaveStatusPage(db, page); err != nil {
+		t.Fatal(err)
+	}
+	badge := func() string {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"page": page.Slug, "componentId": "api"})
+		rec := httptest.NewRecorder()
+		getStatusPageBadge(rec, req, db)
+		return rec.Body.String()
+	}
+
+	if body := getPublicStatus(t, db, page.Slug).Body.String(); !strings.Contains(body, `"status":"down"`) {
+		t.Fatalf("page = %s", body)
+	}
+	firstBadge := badge()
+
+	// Monitor changes show once the cached copy expires
+	db.Exec("UPDATE monitors SET status = 'up' WHERE id = ?", m.ID)
+	db.Exec("DELETE FROM monitor_checks WHERE monitor_id = ?", m.ID)
+	if body := getPublicStatus(t, db, page.Slug).Body.String(); strings.Contains(body, `"status":"operational"`) {
+		t.Errorf("page was rebuilt within the cache TTL: %s", body)
+	}
+	if badge() != firstBadge {
+		t.Error("badge was rebuilt within the cache TTL")
+	}
+
+	// Posting an incident shows right away
+	incident := &StatusPageIncident{ID: uuid.New().String(), StatusPageID: page.ID, Title: "Degraded API", Status: "investigating",
+		Impact: "minor", ComponentIDs: []string{}, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := SaveStatusPageIncident(db, incident, nil); err != nil {
+		t.Fatal(err)
+	}
+	if body := getPublicStatus(t, db, page.Slug).Body.String(); !strings.Contains(body, "Degraded API") || !strings.Contains(body, `"status":"degraded"`) {
+		t.Errorf("page after posting an incident = %s", body)
+	}
+}
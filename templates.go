@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationTemplate is a project's custom text/template for one notification channel
+type NotificationTemplate struct {
+	ProjectID string    `json:"project_id"`
+	Channel   string    `json:"channel"`
+	Template  string    `json:"template"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TemplateData is the documented variable set available to notification templates
+type TemplateData struct {
+	Issue    TemplateIssue     `json:"issue"`
+	Event    TemplateEvent     `json:"event"`
+	Project  TemplateProject   `json:"project"`
+	Counts   TemplateCounts    `json:"counts"`
+	Links    TemplateLinks     `json:"links"`
+	Tags     map[string]string `json:"tags"`
+	Triggers []string          `json:"triggers"`
+	Rule     string            `json:"rule"`
+}
+
+type TemplateIssue struct {
+	Fingerprint string    `json:"fingerprint"`
+	Title       string    `json:"title"`
+	Level       string    `json:"level"`
+	Status      string    `json:"status"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+type TemplateEvent struct {
+	ID          string                 `json:"id"`
+	Message     string                 `json:"message"`
+	Level       string                 `json:"level"`
+	Environment string                 `json:"environment"`
+	Release     string                 `json:"release"`
+	Platform    string                 `json:"platform"`
+	TraceID     string                 `json:"trace_id"`
+	Timestamp   time.Time              `json:"timestamp"`
+	User        map[string]interface{} `json:"user"`
+	Frames      []string               `json:"frames"`
+}
+
+type TemplateProject struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type TemplateCounts struct {
+	Events int `json:"events"`
+	Users  int `json:"users"`
+}
+
+type TemplateLinks struct {
+	Issue   string `json:"issue"`
+	Project string `json:"project"`
+}
+
+const templateMaxOutput = 64 * 1024
+
+// defaultNotificationTemplates are used for channels without a custom template, and
+// whenever a custom template fails to render. The webhook channel has no default
+// template: without one the structured JSON payload is sent.
+var defaultNotificationTemplates = map[string]string{
+	"slack": "*Pulse Alert:* New {{.Issue.Level}} error in project *{{.Project.Name}}*" +
+		"{{if gt .Counts.Events 1}} (occurred {{.Counts.Events}} times){{end}}\n> {{.Issue.Title}}",
+	"discord": "New {{.Issue.Level}} error in **{{.Project.Name}}**" +
+		"{{if gt .Counts.Events 1}} (occurred {{.Counts.Events}} times){{end}}",
+	"teams": "New {{.Issue.Level}} error in **{{.Project.Name}}**" +
+		"{{if gt .Counts.Events 1}} (occurred {{.Counts.Events}} times){{end}}",
+	"email_subject": "[Pulse] [{{.Project.Name}}] {{upper .Issue.Level}}: {{truncate 120 .Issue.Title}}",
+	"email_text": `{{.Event.Message}}
+
+Project:     {{.Project.Name}}
+Level:       {{.Event.Level}}
+Environment: {{default "-" .Event.Environment}}
+Release:     {{default "-" .Event.Release}}
+Events:      {{.Counts.Events}}
+{{- if .Triggers}}
+Triggered:   {{join .Triggers ", "}}
+{{- end}}
+{{- if .Event.Frames}}
+
+Top frames:
+{{- range .Event.Frames}}
+  at {{.}}
+{{- end}}
+{{- end}}
+
+View issue: {{.Links.Issue}}
+`,
+	"webhook":   "",
+	"pagerduty": "[{{.Project.Name}}] {{.Issue.Title}}",
+	"opsgenie":  "[{{.Project.Name}}] {{.Issue.Title}}",
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	"truncate": func(n int, s string) string {
+		if n <= 1 {
+			return s
+		}
+		return truncateRunes(s, n)
+	},
+	"default": func(fallback string, s string) string {
+		if strings.TrimSpace(s) == "" {
+			return fallback
+		}
+		return s
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"date": func(layout string, t time.Time) string {
+		return t.UTC().Format(layout)
+	},
+}
+
+// limitedBuffer stops templates from producing unbounded output (e.g. a runaway range)
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > templateMaxOutput {
+		return 0, fmt.Errorf("template output exceeds %d bytes", templateMaxOutput)
+	}
+	return b.Buffer.Write(p)
+}
+
+func isTemplateChannel(channel string) bool {
+	_, ok := defaultNotificationTemplates[channel]
+	return ok
+}
+
+// executeTemplate parses and renders text against data. Webhook templates must render valid JSON.
+func executeTemplate(channel, text string, data *TemplateData) (string, error) {
+	tmpl, err := template.New(channel).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out limitedBuffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	rendered := out.String()
+	if channel == "webhook" && !json.Valid([]byte(rendered)) {
+		return "", errors.New("webhook template must render valid JSON")
+	}
+	return rendered, nil
+}
+
+// renderNotification renders the project's template for channel, falling back to the
+// default template when there is no custom one or it fails. It returns "" for the
+// webhook channel when the built-in payload should be sent.
+func renderNotification(db *sql.DB, channel string, n *AlertNotification) string {
+	data := buildTemplateData(db, n)
+	if custom, err := GetNotificationTemplate(db, n.Project.ID, channel); err == nil {
+		rendered, err := executeTemplate(channel, custom.Template, data)
+		if err == nil {
+			return rendered
+		}
+		log.Printf("[Templates] %s template for project %s failed, using default: %v", channel, n.Project.ID, err)
+	}
+
+	text := defaultNotificationTemplates[channel]
+	if text == "" {
+		// No default (webhook): the caller sends its built-in payload. The event
+		// message isn't a valid fallback there since it isn't JSON.
+		return ""
+	}
+	rendered, err := executeTemplate(channel, text, data)
+	if err != nil {
+		log.Printf("[Templates] Default %s template failed: %v", channel, err)
+		return n.Event.Message
+	}
+	return rendered
+}
+
+// buildTemplateData flattens an alert into the variables exposed to templates
+func buildTemplateData(db *sql.DB, n *AlertNotification) *TemplateData {
+	publicURL := getPublicURL(db)
+	e := n.Event
+
+	data := &TemplateData{
+		Issue: TemplateIssue{
+			Fingerprint: e.Fingerprint,
+			Title:       e.Message,
+			Level:       e.Level,
+			Status:      e.Status,
+			FirstSeen:   e.CreatedAt,
+			LastSeen:    e.CreatedAt,
+		},
+		Event: TemplateEvent{
+			ID:          e.ID,
+			Message:     e.Message,
+			Level:       e.Level,
+			Environment: e.Environment,
+			Release:     e.Release,
+			Platform:    e.Platform,
+			TraceID:     e.TraceID,
+			Timestamp:   e.Timestamp,
+			Frames:      topFrames(e.Stacktrace, 5),
+		},
+		Project:  TemplateProject{ID: n.Project.ID, Name: n.Project.Name},
+		Counts:   TemplateCounts{Events: n.EventCount, Users: n.UserCount},
+		Links:    TemplateLinks{Issue: publicURL + "/errors/" + e.ID, Project: publicURL + "/projects/" + n.Project.ID},
+		Tags:     map[string]string{},
+		Triggers: n.Triggers,
+	}
+	if data.Triggers == nil {
+		data.Triggers = []string{}
+	}
+	if n.Rule != nil {
+		data.Rule = n.Rule.Name
+	}
+	if data.Issue.Status == "" {
+		data.Issue.Status = "unresolved"
+	}
+
+	var tags map[string]interface{}
+	json.Unmarshal([]byte(e.Tags), &tags)
+	for k, v := range tags {
+		data.Tags[k] = fmt.Sprint(v)
+	}
+	json.Unmarshal([]byte(e.User), &data.Event.User)
+	if data.Event.User == nil {
+		data.Event.User = map[string]interface{}{}
+	}
+
+	if e.Fingerprint != "" {
+		var firstSeen, lastSeen sql.NullString
+		err := db.QueryRow("SELECT MIN(created_at), MAX(created_at) FROM errors WHERE project_id = ? AND fingerprint = ?",
+			n.Project.ID, e.Fingerprint).Scan(&firstSeen, &lastSeen)
+		if err == nil && firstSeen.Valid {
+			data.Issue.FirstSeen = parseSQLiteTime(firstSeen.String)
+			data.Issue.LastSeen = parseSQLiteTime(lastSeen.String)
+		}
+	}
+	return data
+}
+
+// Notification template database functions
+
+func GetNotificationTemplates(db *sql.DB, projectID string) ([]NotificationTemplate, error) {
+	rows, err := db.Query("SELECT project_id, channel, template, updated_at FROM notification_templates WHERE project_id = ?", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []NotificationTemplate
+	for rows.Next() {
+		var t NotificationTemplate
+		if err := rows.Scan(&t.ProjectID, &t.Channel, &t.Template, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+func GetNotificationTemplate(db *sql.DB, projectID, channel string) (*NotificationTemplate, error) {
+	var t NotificationTemplate
+	err := db.QueryRow("SELECT project_id, channel, template, updated_at FROM notification_templates WHERE project_id = ? AND channel = ?",
+		projectID, channel).Scan(&t.ProjectID, &t.Channel, &t.Template, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func SaveNotificationTemplate(db *sql.DB, t *NotificationTemplate) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO notification_templates (project_id, channel, template, updated_at) VALUES (?, ?, ?, ?)",
+		t.ProjectID, t.Channel, t.Template, t.UpdatedAt)
+	return err
+}
+
+func DeleteNotificationTemplate(db *sql.DB, projectID, channel string) error {
+	res, err := db.Exec("DELETE FROM notification_templates WHERE project_id = ? AND channel = ?", projectID, channel)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Notification template handlers
+
+func getNotificationTemplates(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	custom, err := GetNotificationTemplates(db, vars["id"])
+	if err != nil {
+		log.Printf("Error fetching notification templates: %v", err)
+		http.Error(w, "Failed to fetch notification templates", http.StatusInternalServerError)
+		return
+	}
+	byChannel := make(map[string]NotificationTemplate, len(custom))
+	for _, t := range custom {
+		byChannel[t.Channel] = t
+	}
+
+	channels := make([]string, 0, len(defaultNotificationTemplates))
+	for channel := range defaultNotificationTemplates {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	result := make([]map[string]interface{}, 0, len(channels))
+	for _, channel := range channels {
+		entry := map[string]interface{}{
+			"channel":  channel,
+			"default":  defaultNotificationTemplates[channel],
+			"custom":   false,
+			"template": "",
+		}
+		if t, ok := byChannel[channel]; ok {
+			entry["custom"] = true
+			entry["template"] = t.Template
+			entry["updated_at"] = t.UpdatedAt
+		}
+		result = append(result, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func updateNotificationTemplate(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	channel := vars["channel"]
+
+	if !isTemplateChannel(channel) {
+		http.Error(w, "Unknown notification channel", http.StatusNotFound)
+		return
+	}
+	project, err := GetProject(db, projectID)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Template string `json:"template"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Template) == "" {
+		http.Error(w, "template is required", http.StatusBadRequest)
+		return
+	}
+
+	// Render against a sample before saving so broken templates are rejected up front
+	if _, err := executeTemplate(channel, req.Template, buildTemplateData(db, sampleAlertNotification(db, project))); err != nil {
+		http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, _ := GetNotificationTemplate(db, projectID, channel)
+	t := &NotificationTemplate{
+		ProjectID: projectID,
+		Channel:   channel,
+		Template:  req.Template,
+		UpdatedAt: time.Now(),
+	}
+	if err := SaveNotificationTemplate(db, t); err != nil {
+		log.Printf("Error saving notification template: %v", err)
+		http.Error(w, "Failed to save notification template", http.StatusInternalServerError)
+		return
+	}
+
+	var beforeValue interface{}
+	if before != nil {
+		beforeValue = before
+	}
+	recordAudit(db, r, "notification_template.update", "project", projectID, beforeValue, t)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+func deleteNotificationTemplate(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	channel := vars["channel"]
+
+	before, _ := GetNotificationTemplate(db, projectID, channel)
+	if err := DeleteNotificationTemplate(db, projectID, channel); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Notification template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete notification template", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(db, r, "notification_template.delete", "project", projectID, before, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// previewNotificationTemplate renders a template (or the saved/default one) against a
+// real recent event of the project without sending anything
+func previewNotificationTemplate(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	project, err := GetProject(db, projectID)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Channel  string `json:"channel"`
+		Template string `json:"template"`
+		EventID  string `json:"event_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !isTemplateChannel(req.Channel) {
+		http.Error(w, "Unknown notification channel", http.StatusBadRequest)
+		return
+	}
+
+	n := sampleAlertNotification(db, project)
+	if req.EventID != "" {
+		event, err := GetError(db, req.EventID)
+		if err != nil || event.ProjectID != projectID {
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		}
+		n.Event = event
+		n.EventCount, _ = countIssueEvents(db, event, 0)
+		n.UserCount, _ = countIssueUsers(db, event, 0)
+	}
+
+	source := "custom"
+	text := req.Template
+	if text == "" {
+		if saved, err := GetNotificationTemplate(db, projectID, req.Channel); err == nil {
+			text, source = saved.Template, "saved"
+		} else {
+			text, source = defaultNotificationTemplates[req.Channel], "default"
+		}
+	}
+
+	data := buildTemplateData(db, n)
+	result := map[string]interface{}{
+		"channel":  req.Channel,
+		"source":   source,
+		"event_id": n.Event.ID,
+		"data":     data,
+	}
+	if text == "" {
+		result["output"] = ""
+	} else if output, err := executeTemplate(req.Channel, text, data); err != nil {
+		result["error"] = err.Error()
+		result["output"] = renderNotification(db, req.Channel, n)
+		result["fallback"] = true
+	} else {
+		result["output"] = output
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -18,7 +18,7 @@ if [ -f .env ]; then
 fi
 
 ADMIN_EMAIL="${ADMIN_EMAIL:-admin@example.com}"
-ADMIN_PASSWORD="${ADMIN_PASSWORD:-admin}"
+ADMIN_PASSWORD="${ADMIN_PASSWORD:-admin123}"
 
 STORE_ENDPOINT="$BASE_URL/api/$PROJECT_ID/store/"
 COVERAGE_ENDPOINT="$BASE_URL/api/$PROJECT_ID/coverage"
@@ -226,6 +226,18 @@ test_endpoint "Login with invalid credentials" "POST" "$BASE_URL/api/auth/login"
 test_endpoint "Get current user (auth/me)" "GET" "$BASE_URL/api/auth/me" \
   "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
 
+test_endpoint "Change password with wrong current password" "POST" "$BASE_URL/api/auth/password/change" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"current_password\":\"wrong\",\"new_password\":\"another-long-password\"}" "401"
+
+test_endpoint "Request password reset" "POST" "$BASE_URL/api/auth/password/forgot" \
+  "Content-Type: application/json" "" \
+  "{\"email\":\"nobody@example.com\"}" "204"
+
+test_endpoint "Reset password with invalid token" "POST" "$BASE_URL/api/auth/password/reset" \
+  "Content-Type: application/json" "" \
+  "{\"token\":\"invalid\",\"password\":\"another-long-password\"}" "400"
+
 echo ""
 
 # =============================================================================
@@ -473,6 +485,44 @@ if [ -n "$ERROR_DETAIL_ID" ]; then
     "{\"status\":\"ignored\"}" "204"
 fi
 
+# Releases
+test_endpoint "Get releases" "GET" "$BASE_URL/api/projects/$PROJECT_ID/releases" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+test_endpoint "Get release created by an event" "GET" "$BASE_URL/api/projects/$PROJECT_ID/releases/pipeops-core@3.2.1" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+test_endpoint "Reject sentry-cli with the project API key" "POST" "$BASE_URL/api/0/organizations/pipeops/releases/" \
+  "Authorization: Bearer $SENTRY_KEY" "Content-Type: application/json" \
+  "{\"version\": \"pipeops-core@3.3.0\", \"projects\": [\"core\"]}" "401"
+
+# sentry-cli authenticates with a project auth token, never the DSN key
+SENTRY_AUTH_TOKEN=$(curl -s -X POST "$BASE_URL/api/projects/$PROJECT_ID/auth-tokens" \
+  -H "Authorization: Bearer $AUTH_TOKEN" -H "Content-Type: application/json" \
+  -d '{"name": "test.sh"}' | grep -o '"token":"[^"]*' | cut -d'"' -f4)
+
+test_endpoint "sentry-cli releases new" "POST" "$BASE_URL/api/0/organizations/pipeops/releases/" \
+  "Authorization: Bearer $SENTRY_AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"version\": \"pipeops-core@3.3.0\", \"projects\": [\"core\"]}" "201"
+
+test_endpoint "sentry-cli releases finalize" "PUT" "$BASE_URL/api/0/organizations/pipeops/releases/pipeops-core@3.3.0/" \
+  "Authorization: Bearer $SENTRY_AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"projects\": [\"core\"], \"dateReleased\": \"$NOW\"}" "200"
+
+test_endpoint "sentry-cli releases deploys new" "POST" "$BASE_URL/api/0/organizations/pipeops/releases/pipeops-core@3.3.0/deploys/" \
+  "Authorization: Bearer $SENTRY_AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"environment\": \"production\", \"projects\": [\"core\"]}" "201"
+
+test_endpoint "Reject sentry-cli without auth token" "GET" "$BASE_URL/api/0/organizations/pipeops/releases/" \
+  "" "" "" "401"
+
+test_endpoint "Compare releases" "GET" "$BASE_URL/api/projects/$PROJECT_ID/releases/compare?base=pipeops-core@3.2.1&head=pipeops-core@3.3.0" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+test_endpoint "Reject release version with slash" "POST" "$BASE_URL/api/projects/$PROJECT_ID/releases" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"version\": \"feature/x\"}" "400"
+
 echo ""
 
 # =============================================================================
@@ -626,15 +676,164 @@ NEW_MONITOR_ID=$(echo "$MONITOR_RESPONSE" | grep -o '"id":"[^"]*' | cut -d'"' -f
 test_endpoint "Get project monitors" "GET" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
   "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
 
+test_endpoint "Create sub-minute monitor" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Fast health\", \"url\": \"$BASE_URL/api/health\", \"interval\": 15}" "200"
+
+test_endpoint "Create monitor with assertions" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"API health\", \"url\": \"$BASE_URL/api/health\", \"http\": {\"expected_status\": [\"200\"], \"assertions\": [{\"source\": \"body\", \"operator\": \"contains\", \"value\": \"ok\"}, {\"source\": \"response_time\", \"value\": \"2000\"}]}}" "200"
+
+test_endpoint "Reject invalid assertion regex" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Bad\", \"url\": \"$BASE_URL/api/health\", \"http\": {\"assertions\": [{\"source\": \"body\", \"operator\": \"matches\", \"value\": \"(\"}]}}" "400"
+
+test_endpoint "Create SSL certificate monitor" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Certificate\", \"type\": \"ssl\", \"url\": \"example.com\", \"ssl_alert_days\": [21, 7]}" "200"
+
+test_endpoint "Reject invalid SSL alert days" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Certificate\", \"type\": \"ssl\", \"url\": \"example.com\", \"ssl_alert_days\": [0]}" "400"
+
+test_endpoint "Create DNS record monitor" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Mail DNS\", \"type\": \"dns\", \"url\": \"example.com\", \"dns\": {\"record_type\": \"MX\", \"resolver\": \"1.1.1.1\", \"match\": \"contains\", \"expected\": [\"0 .\"]}}" "200"
+
+test_endpoint "Reject unknown DNS record type" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Bad DNS\", \"type\": \"dns\", \"url\": \"example.com\", \"dns\": {\"record_type\": \"PTR\"}}" "400"
+
+HEARTBEAT_RESPONSE=$(curl -s -X POST "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  -H "Authorization: Bearer $AUTH_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"name\": \"Nightly job\", \"type\": \"heartbeat\", \"heartbeat\": {\"schedule\": \"0 3 * * *\", \"timezone\": \"Europe/Berlin\"}}")
+HEARTBEAT_ID=$(echo "$HEARTBEAT_RESPONSE" | grep -o '"id":"[^"]*' | head -1 | cut -d'"' -f4)
+HEARTBEAT_TOKEN=$(echo "$HEARTBEAT_RESPONSE" | grep -o '"heartbeat_token":"[^"]*"' | cut -d'"' -f4)
+
+if [ -n "$HEARTBEAT_TOKEN" ]; then
+  test_endpoint "Heartbeat start" "GET" "$BASE_URL/api/heartbeat/$HEARTBEAT_TOKEN/start" "" "" "" "200"
+  test_endpoint "Heartbeat ok" "POST" "$BASE_URL/api/heartbeat/$HEARTBEAT_TOKEN" "" "" "" "200"
+  test_endpoint "Reject unknown heartbeat" "GET" "$BASE_URL/api/heartbeat/unknown" "" "" "" "404"
+  test_endpoint "Get heartbeat check-ins" "GET" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$HEARTBEAT_ID/checkins" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+fi
+
+test_endpoint "Reject postgres monitor without username" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"DB\", \"type\": \"postgres\", \"url\": \"localhost:5432\"}" "400"
+
+test_endpoint "Reject invalid redis database" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Cache\", \"type\": \"redis\", \"url\": \"localhost\", \"connection\": {\"database\": \"main\"}}" "400"
+
+test_endpoint "Reject reserved gRPC metadata" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Orders\", \"type\": \"grpc\", \"url\": \"localhost:50051\", \"grpc\": {\"metadata\": {\"grpc-timeout\": \"1S\"}}}" "400"
+
+test_endpoint "Reject WebSocket monitor without ws URL" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Gateway\", \"type\": \"websocket\", \"url\": \"ftp://localhost/ws\"}" "400"
+
+test_endpoint "Reject multi-step monitor with undefined variable" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Checkout\", \"type\": \"multistep\", \"url\": \"https://example.com\", \"multistep\": {\"steps\": [{\"url\": \"/orders\", \"headers\": {\"Authorization\": \"Bearer {{token}}\"}}]}}" "400"
+
+test_endpoint "Reject invalid heartbeat schedule" "POST" "$BASE_URL/api/projects/$PROJECT_ID/monitors" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Bad\", \"type\": \"heartbeat\", \"heartbeat\": {\"schedule\": \"61 * * * *\"}}" "400"
+
 # Clean up test monitor
 if [ -n "$NEW_MONITOR_ID" ]; then
+  test_endpoint "Update monitor alerting" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"failure_threshold\": 3, \"realert_minutes\": 60}" "200"
+
+  test_endpoint "Reject invalid failure threshold" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"failure_threshold\": 0}" "400"
+
+  test_endpoint "Update monitor retries and degraded threshold" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"retries\": 2, \"retry_interval\": 5, \"degraded_response_time\": 1500}" "200"
+
+  test_endpoint "Reject invalid retries" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"retries\": 11}" "400"
+
+  test_endpoint "Create maintenance window" "POST" "$BASE_URL/api/projects/$PROJECT_ID/maintenance" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"title\": \"Weekly deploy\", \"monitor_ids\": [\"$NEW_MONITOR_ID\"], \"starts_at\": \"2030-01-06T02:00:00Z\", \"ends_at\": \"2030-01-06T03:00:00Z\", \"recurrence\": \"FREQ=WEEKLY;BYDAY=SU\", \"timezone\": \"Europe/Berlin\"}" "201"
+
+  test_endpoint "Reject invalid maintenance recurrence" "POST" "$BASE_URL/api/projects/$PROJECT_ID/maintenance" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"title\": \"Broken\", \"starts_at\": \"2030-01-06T02:00:00Z\", \"ends_at\": \"2030-01-06T03:00:00Z\", \"recurrence\": \"FREQ=YEARLY\"}" "400"
+
+  test_endpoint "List maintenance windows" "GET" "$BASE_URL/api/projects/$PROJECT_ID/maintenance" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+  test_endpoint "Get monitor uptime stats" "GET" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID/stats?range=90d" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+  test_endpoint "Reject invalid stats range" "GET" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID/stats?range=1y" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "400"
+
+  test_endpoint "Reject invalid ping count" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"ping_count\": 50}" "400"
+
+  test_endpoint "Switch monitor to ICMP" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"type\": \"icmp\", \"url\": \"127.0.0.1\", \"ping_count\": 5, \"packet_loss_threshold\": 40}" "200"
+
+  test_endpoint "Get monitor incidents" "GET" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID/incidents" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
   test_endpoint "Delete monitor" "DELETE" "$BASE_URL/api/projects/$PROJECT_ID/monitors/$NEW_MONITOR_ID" \
     "Authorization: Bearer $AUTH_TOKEN" "" "" "204"
 fi
 
+test_endpoint "Get project incidents" "GET" "$BASE_URL/api/projects/$PROJECT_ID/incidents" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+test_endpoint "Get incident stats" "GET" "$BASE_URL/api/projects/$PROJECT_ID/incidents/stats?days=7" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+test_endpoint "Get unknown incident" "GET" "$BASE_URL/api/projects/$PROJECT_ID/incidents/00000000-0000-0000-0000-000000000000" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "404"
+
 test_endpoint "Public status page" "GET" "$BASE_URL/status/$PROJECT_ID" \
   "" "" "" "200"
 
+STATUS_SLUG="test-status-$(date +%s)"
+STATUS_PAGE_RESPONSE=$(curl -s -X POST "$BASE_URL/api/projects/$PROJECT_ID/status-pages" \
+  -H "Authorization: Bearer $AUTH_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"slug\": \"$STATUS_SLUG\", \"title\": \"Test Status\", \"components\": [{\"name\": \"API\"}]}")
+STATUS_PAGE_ID=$(echo "$STATUS_PAGE_RESPONSE" | grep -o '"id":"[^"]*' | head -1 | cut -d'"' -f4)
+STATUS_COMPONENT_ID=$(echo "$STATUS_PAGE_RESPONSE" | grep -o '"id":"[^"]*' | sed -n 2p | cut -d'"' -f4)
+
+test_endpoint "Reject status page slug" "POST" "$BASE_URL/api/projects/$PROJECT_ID/status-pages" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"slug\": \"Not A Slug\", \"title\": \"Test\"}" "400"
+
+if [ -n "$STATUS_PAGE_ID" ]; then
+  test_endpoint "Post status page incident" "POST" "$BASE_URL/api/projects/$PROJECT_ID/status-pages/$STATUS_PAGE_ID/incidents" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"title\": \"API errors\", \"impact\": \"minor\", \"component_ids\": [\"$STATUS_COMPONENT_ID\"], \"message\": \"Investigating\"}" "201"
+
+  test_endpoint "Public status page by slug" "GET" "$BASE_URL/api/status/$STATUS_SLUG" \
+    "" "" "" "200"
+
+  test_endpoint "Status page RSS feed" "GET" "$BASE_URL/api/status/$STATUS_SLUG/feed.rss" \
+    "" "" "" "200"
+
+  test_endpoint "Status page uptime badge" "GET" "$BASE_URL/api/status/$STATUS_SLUG/components/$STATUS_COMPONENT_ID/badge.svg" \
+    "" "" "" "200"
+
+  test_endpoint "Delete status page" "DELETE" "$BASE_URL/api/projects/$PROJECT_ID/status-pages/$STATUS_PAGE_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "204"
+fi
+
 echo ""
 
 # =============================================================================
@@ -657,12 +856,106 @@ test_endpoint "Update settings" "POST" "$BASE_URL/api/settings" \
   \"smtp_port\": \"587\",
   \"smtp_user\": \"test@example.com\",
   \"smtp_password\": \"testpass\",
+  \"smtp_security\": \"starttls\",
+  \"smtp_from\": \"pulse@example.com\",
   \"retention_days\": \"90\"
 }" "204"
 
+# smtp.example.com is not reachable, so the send fails; go test delivers to a local
+# SMTP server
+test_endpoint "Send test email" "POST" "$BASE_URL/api/settings/test-email" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"to\": \"test@example.com\"}" "502"
+
 test_endpoint "Run system cleanup" "POST" "$BASE_URL/api/system/cleanup" \
   "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
 
+test_endpoint "Get audit log" "GET" "$BASE_URL/api/audit-log?action=settings.*&limit=10" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
+
+test_endpoint "Export audit log (JSON Lines)" "GET" "$BASE_URL/api/audit-log/export" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+# Alert rules
+test_endpoint "Reject invalid alert rule" "POST" "$BASE_URL/api/projects/$PROJECT_ID/alert-rules" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"name\": \"Invalid\", \"conditions\": [{\"type\": \"unknown\"}], \"actions\": [{\"type\": \"slack\"}]}" "400"
+
+ALERT_RULE_RESPONSE=$(curl -s -X POST "$BASE_URL/api/projects/$PROJECT_ID/alert-rules" \
+  -H "Authorization: Bearer $AUTH_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"name":"Frequent errors","conditions":[{"type":"new_issue"},{"type":"event_frequency","value":10,"interval_minutes":5}],"filters":{"levels":["error","fatal"]},"actions":[{"type":"webhook","target":"https://example.com/webhook"}],"frequency_minutes":30}')
+ALERT_RULE_ID=$(echo "$ALERT_RULE_RESPONSE" | grep -o '"id":"[^"]*' | head -1 | cut -d'"' -f4)
+
+test_endpoint "Get alert rules" "GET" "$BASE_URL/api/projects/$PROJECT_ID/alert-rules" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
+
+test_endpoint "Get alert history" "GET" "$BASE_URL/api/projects/$PROJECT_ID/alert-history?limit=10" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
+
+test_endpoint "Get webhook endpoints" "GET" "$BASE_URL/api/projects/$PROJECT_ID/webhooks" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
+
+test_endpoint "Get webhook deliveries" "GET" "$BASE_URL/api/projects/$PROJECT_ID/webhook-deliveries?limit=10" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
+
+test_endpoint "Redeliver unknown webhook delivery" "POST" "$BASE_URL/api/projects/$PROJECT_ID/webhook-deliveries/does-not-exist/redeliver" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "404"
+
+if [ -n "$ALERT_RULE_ID" ]; then
+  test_endpoint "Update alert rule" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/alert-rules/$ALERT_RULE_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"enabled\": false}" "200"
+
+  test_endpoint "Delete alert rule" "DELETE" "$BASE_URL/api/projects/$PROJECT_ID/alert-rules/$ALERT_RULE_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "204"
+fi
+
+# Chat and incident integrations
+test_endpoint "Reject incomplete integration" "POST" "$BASE_URL/api/projects/$PROJECT_ID/integrations" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"type\": \"pagerduty\", \"config\": {}}" "400"
+
+INTEGRATION_RESPONSE=$(curl -s -X POST "$BASE_URL/api/projects/$PROJECT_ID/integrations" \
+  -H "Authorization: Bearer $AUTH_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"type":"discord","name":"Ops channel","config":{"webhook_url":"https://example.com/discord"}}')
+INTEGRATION_ID=$(echo "$INTEGRATION_RESPONSE" | grep -o '"id":"[^"]*' | head -1 | cut -d'"' -f4)
+
+test_endpoint "Get integrations" "GET" "$BASE_URL/api/projects/$PROJECT_ID/integrations" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
+
+if [ -n "$INTEGRATION_ID" ]; then
+  test_endpoint "Send test integration notification" "POST" "$BASE_URL/api/projects/$PROJECT_ID/integrations/$INTEGRATION_ID/test" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "202"
+
+  test_endpoint "Disable integration" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/integrations/$INTEGRATION_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+    "{\"enabled\": false}" "200"
+
+  test_endpoint "Delete integration" "DELETE" "$BASE_URL/api/projects/$PROJECT_ID/integrations/$INTEGRATION_ID" \
+    "Authorization: Bearer $AUTH_TOKEN" "" "" "204"
+fi
+
+# Notification templates
+test_endpoint "Get notification templates" "GET" "$BASE_URL/api/projects/$PROJECT_ID/notification-templates" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" "" "200"
+
+test_endpoint "Preview notification template" "POST" "$BASE_URL/api/projects/$PROJECT_ID/notification-templates/preview" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"channel\": \"slack\", \"template\": \"{{.Issue.Title}} ({{.Counts.Events}} events)\"}" "200"
+
+test_endpoint "Reject invalid notification template" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/notification-templates/webhook" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"template\": \"not json {{.Issue.Title}}\"}" "400"
+
+test_endpoint "Save notification template" "PUT" "$BASE_URL/api/projects/$PROJECT_ID/notification-templates/email_subject" \
+  "Authorization: Bearer $AUTH_TOKEN" "Content-Type: application/json" \
+  "{\"template\": \"[{{.Project.Name}}] {{.Issue.Title}}\"}" "200"
+
+test_endpoint "Reset notification template" "DELETE" "$BASE_URL/api/projects/$PROJECT_ID/notification-templates/email_subject" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "204"
+
 echo ""
 
 # =============================================================================
@@ -756,6 +1049,35 @@ else
   TESTS_FAILED=$((TESTS_FAILED + 1))
 fi
 
+# Session item without a length, as the JavaScript SDK sends it
+SESSION_BODY="$ENVELOPE_HEADER
+{\"type\":\"session\"}
+{\"sid\":\"$(generate_id)\",\"did\":\"user-42\",\"init\":true,\"started\":\"$NOW\",\"status\":\"exited\",\"errors\":0,\"attrs\":{\"release\":\"pipeops-core@3.2.1\",\"environment\":\"production\"}}"
+
+TOTAL_TESTS=$((TOTAL_TESTS + 1))
+echo "🧪 [$TOTAL_TESTS] Envelope session..."
+response=$(curl -s -w "%{http_code}" -X POST "$ENVELOPE_ENDPOINT" \
+  -H "X-Sentry-Auth: Sentry sentry_key=$SENTRY_KEY, sentry_version=7" \
+  -H "Content-Type: application/x-sentry-envelope" \
+  --data-binary "$SESSION_BODY")
+http_code=$(echo "$response" | tail -c 4 | grep -o '[0-9]\{3\}' || echo "000")
+if [ "$http_code" = "202" ] || [ "$http_code" = "200" ]; then
+  echo "    ✅ Status: $http_code"
+  TESTS_PASSED=$((TESTS_PASSED + 1))
+else
+  echo "    ❌ Expected: 202, Got: $http_code"
+  TESTS_FAILED=$((TESTS_FAILED + 1))
+fi
+
+test_endpoint "Get release health by release" "GET" "$BASE_URL/api/projects/$PROJECT_ID/sessions?range=7d" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+test_endpoint "Get release health" "GET" "$BASE_URL/api/projects/$PROJECT_ID/releases/pipeops-core@3.2.1/health?range=30d&environment=production" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "200"
+
+test_endpoint "Reject invalid release health range" "GET" "$BASE_URL/api/projects/$PROJECT_ID/sessions?range=1y" \
+  "Authorization: Bearer $AUTH_TOKEN" "" "" "400"
+
 echo ""
 
 # =============================================================================
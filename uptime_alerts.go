@@ -0,0 +1,471 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MonitorAlert is a monitor state transition to notify about
+type MonitorAlert struct {
+	Kind      string        `json:"kind"` // down, still_down, recovered, cert_expiring, cert_renewed
+	Project   *Project      `json:"project"`
+	Monitor   *Monitor      `json:"monitor"`
+	Check     *MonitorCheck `json:"check"`
+	DownSince time.Time     `json:"down_since"`
+	Failures  int           `json:"consecutive_failures"`
+}
+
+// evaluateMonitorAlert tracks consecutive failures and notifies when a monitor goes
+// down, stays down past its re-alert interval, or recovers
+func evaluateMonitorAlert(db *sql.DB, m *Monitor, check *MonitorCheck) {
+	now := check.CreatedAt
+
+	if check.Status == "down" {
+		db.Exec(`UPDATE monitors SET consecutive_failures = consecutive_failures + 1,
+			down_since = COALESCE(down_since, ?) WHERE id = ?`, now, m.ID)
+
+		var failures int
+		var alertState string
+		var downSince time.Time
+		var lastAlerted sql.NullTime
+		err := db.QueryRow("SELECT consecutive_failures, COALESCE(alert_state, 'up'), down_since, last_alerted_at FROM monitors WHERE id = ?", m.ID).
+			Scan(&failures, &alertState, &downSince, &lastAlerted)
+		if err != nil {
+			log.Printf("[Uptime] Failed to load alert state for monitor %s: %v", m.ID, err)
+			return
+		}
+
+		kind := ""
+		if alertState != "down" && failures >= m.FailureThreshold {
+			// Claim the transition so an overlapping check can't alert twice
+			res, _ := db.Exec("UPDATE monitors SET alert_state = 'down', last_alerted_at = ? WHERE id = ? AND COALESCE(alert_state, 'up') != 'down'", now, m.ID)
+			if n, _ := res.RowsAffected(); n > 0 {
+				kind = "down"
+				openMonitorIncident(db, m, check, downSince)
+			}
+		} else if alertState == "down" && m.RealertMinutes > 0 && lastAlerted.Valid &&
+			now.Sub(lastAlerted.Time) >= time.Duration(m.RealertMinutes)*time.Minute {
+			db.Exec("UPDATE monitors SET last_alerted_at = ? WHERE id = ?", now, m.ID)
+			kind = "still_down"
+		}
+		if kind != "" {
+			notifyMonitorAlert(db, &MonitorAlert{Kind: kind, Monitor: m, Check: check, DownSince: downSince, Failures: failures})
+		}
+		return
+	}
+
+	var alertState string
+	var downSince sql.NullTime
+	db.QueryRow("SELECT COALESCE(alert_state, 'up'), down_since FROM monitors WHERE id = ?", m.ID).Scan(&alertState, &downSince)
+
+	res, err := db.Exec(`UPDATE monitors SET consecutive_failures = 0, alert_state = 'up', down_since = NULL, last_alerted_at = NULL
+		WHERE id = ? AND (consecutive_failures > 0 OR COALESCE(alert_state, 'up') != 'up')`, m.ID)
+	if err != nil {
+		log.Printf("[Uptime] Failed to reset alert state for monitor %s: %v", m.ID, err)
+		return
+	}
+	// Only confirmed outages get an incident and a recovery notice; shorter blips pass silently
+	if n, _ := res.RowsAffected(); n > 0 && alertState == "down" {
+		resolveMonitorIncident(db, m.ID, check.CreatedAt)
+		alert := &MonitorAlert{Kind: "recovered", Monitor: m, Check: check}
+		if downSince.Valid {
+			alert.DownSince = downSince.Time
+		}
+		notifyMonitorAlert(db, alert)
+	}
+}
+
+// notifyMonitorAlert sends the alert through the project's notification channels
+func notifyMonitorAlert(db *sql.DB, a *MonitorAlert) {
+	project, err := GetProject(db, a.Monitor.ProjectID)
+	if err != nil {
+		return
+	}
+	a.Project = project
+
+	if activeMaintenance(db, a.Monitor, time.Now()) != nil {
+		log.Printf("[Uptime] Monitor '%s' is in maintenance, not sending %s", a.Monitor.Name, a.Kind)
+		return
+	}
+
+	settings, err := GetProjectSettings(db, project.ID)
+	if err != nil || !settings.NotificationEnabled {
+		return
+	}
+
+	log.Printf("[Uptime] Monitor '%s' in project '%s': %s", a.Monitor.Name, project.Name, a.Kind)
+
+	var sent, digested []AlertAction
+	var failures []string
+	for _, action := range projectNotificationActions(db, project.ID, settings) {
+		// Digest projects see outages in their digest; only incident tools are paged right away
+		if isDigestFrequency(settings.NotificationFrequency) && !isIncidentAction(db, project.ID, action) {
+			digested = append(digested, action)
+			continue
+		}
+		sent = append(sent, action)
+		if err := sendMonitorAlertAction(db, action, a); err != nil {
+			log.Printf("[Uptime] %s action failed for monitor %s: %v", action.Type, a.Monitor.ID, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", action.Type, err))
+		}
+	}
+	// Going down and recovering are buffered so the digest is sent for outage-only periods
+	if len(digested) > 0 && (a.Kind == "down" || a.Kind == "recovered") {
+		if err := bufferMonitorDigestItems(db, digested, a); err != nil {
+			log.Printf("[Uptime] Failed to buffer digest items for monitor %s: %v", a.Monitor.ID, err)
+		}
+	}
+	if len(sent) == 0 {
+		return
+	}
+
+	status := "sent"
+	if len(failures) == len(sent) {
+		status = "failed"
+	} else if len(failures) > 0 {
+		status = "partial"
+	}
+	entry := &AlertHistoryEntry{
+		ID:        uuid.New().String(),
+		RuleID:    "uptime:" + a.Monitor.ID,
+		RuleName:  "Uptime: " + a.Monitor.Name,
+		ProjectID: project.ID,
+		Triggers:  []string{"monitor_" + a.Kind},
+		Actions:   sent,
+		Status:    status,
+		Error:     strings.Join(failures, "; "),
+		CreatedAt: time.Now(),
+	}
+	if err := InsertAlertHistory(db, entry); err != nil {
+		log.Printf("[Uptime] Failed to record alert history: %v", err)
+	}
+}
+
+func (a *MonitorAlert) title() string {
+	switch a.Kind {
+	case "recovered":
+		return fmt.Sprintf("%s is back up", a.Monitor.Name)
+	case "still_down":
+		return fmt.Sprintf("%s is still down", a.Monitor.Name)
+	case "cert_expiring":
+		return fmt.Sprintf("Certificate for %s expires in %s", a.Monitor.Name, pluralDays(a.Check.Certificate.DaysRemaining))
+	case "cert_renewed":
+		return fmt.Sprintf("Certificate for %s was renewed", a.Monitor.Name)
+	}
+	return fmt.Sprintf("%s is down", a.Monitor.Name)
+}
+
+// resolves reports whether the alert ends an earlier one
+func (a *MonitorAlert) resolves() bool {
+	return a.Kind == "recovered" || a.Kind == "cert_renewed"
+}
+
+func (a *MonitorAlert) isCertificate() bool {
+	return a.Kind == "cert_expiring" || a.Kind == "cert_renewed"
+}
+
+func (a *MonitorAlert) state() string {
+	switch {
+	case a.resolves():
+		return "UP"
+	case a.isCertificate():
+		return "WARNING"
+	}
+	return "DOWN"
+}
+
+func (a *MonitorAlert) emoji() string {
+	switch a.state() {
+	case "UP":
+		return ":large_green_circle:"
+	case "WARNING":
+		return ":warning:"
+	}
+	return ":red_circle:"
+}
+
+func (a *MonitorAlert) color() int {
+	switch a.state() {
+	case "UP":
+		return 0x22c55e
+	case "WARNING":
+		return 0xf59e0b
+	}
+	return 0xef4444
+}
+
+func (a *MonitorAlert) downtime() time.Duration {
+	if a.DownSince.IsZero() {
+		return 0
+	}
+	return a.Check.CreatedAt.Sub(a.DownSince).Round(time.Second)
+}
+
+func (a *MonitorAlert) facts() [][2]string {
+	facts := [][2]string{
+		{"Project", a.Project.Name},
+		{"Target", a.Monitor.URL},
+		{"Type", a.Monitor.Type},
+		{"Response time", fmt.Sprintf("%d ms", a.Check.ResponseTime)},
+	}
+	if a.Check.StatusCode > 0 {
+		facts = append(facts, [2]string{"Status code", fmt.Sprintf("%d", a.Check.StatusCode)})
+	}
+	if cert := a.Check.Certificate; a.isCertificate() && cert != nil {
+		facts = append(facts,
+			[2]string{"Expires", cert.NotAfter.UTC().Format("2006-01-02 15:04:05 UTC")},
+			[2]string{"Days left", fmt.Sprintf("%d", cert.DaysRemaining)},
+			[2]string{"Issuer", cert.Issuer},
+		)
+		return facts
+	}
+	if a.Kind == "recovered" {
+		facts = append(facts, [2]string{"Downtime", a.downtime().String()})
+	} else {
+		facts = append(facts,
+			[2]string{"Error", valueOrDash(a.Check.ErrorMessage)},
+			[2]string{"Failed checks", fmt.Sprintf("%d", a.Failures)},
+		)
+		if !a.DownSince.IsZero() {
+			facts = append(facts, [2]string{"Down since", a.DownSince.UTC().Format("2006-01-02 15:04:05 UTC")})
+		}
+	}
+	return facts
+}
+
+func (a *MonitorAlert) text() string {
+	var b strings.Builder
+	b.WriteString(a.title() + "\n\n")
+	for _, f := range a.facts() {
+		fmt.Fprintf(&b, "%s: %s\n", f[0], f[1])
+	}
+	return b.String()
+}
+
+// dedupKey identifies the alert in incident tools; certificate warnings are tracked
+// apart from outages
+func (a *MonitorAlert) dedupKey() string {
+	if a.isCertificate() {
+		return "pulse:monitor:" + a.Monitor.ID + ":cert"
+	}
+	return "pulse:monitor:" + a.Monitor.ID
+}
+
+// sendMonitorAlertAction delivers a monitor alert through a single channel
+func sendMonitorAlertAction(db *sql.DB, action AlertAction, a *MonitorAlert) error {
+	link := fmt.Sprintf("%s/projects/%s", getPublicURL(db), a.Project.ID)
+	emoji := a.emoji()
+
+	switch action.Type {
+	case "slack":
+		target := action.Target
+		if target == "" {
+			target, _ = GetSetting(db, "slack_webhook")
+		}
+		if target == "" {
+			return errors.New("no Slack webhook configured")
+		}
+		_, err := enqueueWebhook(db, a.Project.ID, target, "uptime", slackMonitorPayload(a, emoji, link))
+		return err
+	case "webhook":
+		target := action.Target
+		if target == "" {
+			if settings, err := GetProjectSettings(db, a.Project.ID); err == nil {
+				target = settings.NotificationWebhookURL
+			}
+		}
+		if target == "" {
+			return errors.New("no webhook URL configured")
+		}
+		monitor := a.Monitor.masked()
+		_, err := enqueueWebhook(db, a.Project.ID, target, "uptime", map[string]interface{}{
+			"type":             "monitor." + a.Kind,
+			"monitor":          monitor,
+			"check":            a.Check,
+			"project":          a.Project,
+			"down_since":       a.DownSince,
+			"downtime_seconds": int(a.downtime().Seconds()),
+			"timestamp":        time.Now(),
+		})
+		return err
+	case "email":
+		target := action.Target
+		if target == "" {
+			if settings, err := GetProjectSettings(db, a.Project.ID); err == nil {
+				target = settings.NotificationEmail
+			}
+		}
+		to := splitEmailList(target)
+		if len(to) == 0 {
+			return errors.New("no notification email configured")
+		}
+		return sendEmailMessage(db, buildMonitorAlertEmail(a, to, link))
+	case "integration":
+		integ, err := GetProjectIntegration(db, a.Project.ID, action.Target)
+		if err != nil {
+			return fmt.Errorf("integration %s not found", action.Target)
+		}
+		if !integ.Enabled {
+			return nil
+		}
+		return sendIntegrationMonitorAlert(db, integ, a, emoji, link)
+	}
+	return fmt.Errorf("unknown action type %q", action.Type)
+}
+
+func slackMonitorPayload(a *MonitorAlert, emoji, link string) map[string]interface{} {
+	var fields []interface{}
+	for _, f := range a.facts() {
+		fields = append(fields, slackText("mrkdwn", fmt.Sprintf("*%s*\n%s", f[0], truncateRunes(f[1], 500))))
+	}
+	return map[string]interface{}{
+		"text": fmt.Sprintf("%s *Pulse Uptime:* %s", emoji, a.title()),
+		"blocks": []interface{}{
+			map[string]interface{}{"type": "section", "text": slackText("mrkdwn", fmt.Sprintf("%s *%s*", emoji, a.title()))},
+			map[string]interface{}{"type": "section", "fields": fields},
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{map[string]interface{}{
+					"type":      "button",
+					"text":      slackText("plain_text", "Open project"),
+					"url":       link,
+					"action_id": "pulse_open_project",
+				}},
+			},
+		},
+	}
+}
+
+func buildMonitorAlertEmail(a *MonitorAlert, to []string, link string) *EmailMessage {
+	state := a.state()
+
+	var body strings.Builder
+	body.WriteString(`<!DOCTYPE html><html><body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;color:#0f172a;background:#f8fafc;padding:24px">`)
+	body.WriteString(`<div style="max-width:640px;margin:0 auto;background:#ffffff;border:1px solid #e2e8f0;border-radius:8px;padding:24px">`)
+	fmt.Fprintf(&body, `<h2 style="margin:0 0 16px;font-size:18px">%s</h2>`, html.EscapeString(a.title()))
+	body.WriteString(`<table style="border-collapse:collapse;font-size:14px;margin-bottom:16px">`)
+	for _, f := range a.facts() {
+		fmt.Fprintf(&body, `<tr><td style="padding:2px 16px 2px 0;color:#64748b">%s</td><td>%s</td></tr>`,
+			f[0], html.EscapeString(f[1]))
+	}
+	body.WriteString(`</table>`)
+	fmt.Fprintf(&body, `<a href="%s" style="display:inline-block;background:#6366f1;color:#ffffff;text-decoration:none;padding:8px 16px;border-radius:6px;font-size:14px">Open project</a>`,
+		html.EscapeString(link))
+	body.WriteString(`</div></body></html>`)
+
+	return &EmailMessage{
+		To:      to,
+		Subject: truncateSubject(fmt.Sprintf("[Pulse] [%s] %s: %s", a.Project.Name, state, a.title()), 200),
+		Text:    a.text() + "\n" + link + "\n",
+		HTML:    body.String(),
+	}
+}
+
+// sendIntegrationMonitorAlert formats a monitor alert for the integration. Incident
+// tools get a trigger per outage and a resolve on recovery.
+func sendIntegrationMonitorAlert(db *sql.DB, integ *ProjectIntegration, a *MonitorAlert, emoji, link string) error {
+	color := a.color()
+
+	var err error
+	switch integ.Type {
+	case "slack":
+		_, err = enqueueWebhook(db, a.Project.ID, integ.Config["webhook_url"], "uptime", slackMonitorPayload(a, emoji, link))
+	case "discord":
+		var fields []interface{}
+		for _, f := range a.facts() {
+			fields = append(fields, map[string]interface{}{"name": f[0], "value": truncateRunes(f[1], 1024), "inline": true})
+		}
+		_, err = enqueueWebhook(db, a.Project.ID, integ.Config["webhook_url"], "uptime", map[string]interface{}{
+			"username": "Pulse",
+			"embeds": []interface{}{map[string]interface{}{
+				"title":     a.title(),
+				"url":       link,
+				"color":     color,
+				"fields":    fields,
+				"timestamp": a.Check.CreatedAt.UTC().Format(time.RFC3339),
+			}},
+		})
+	case "teams":
+		var facts []interface{}
+		for _, f := range a.facts() {
+			facts = append(facts, map[string]interface{}{"title": f[0], "value": f[1]})
+		}
+		textColor := "Attention"
+		switch a.state() {
+		case "UP":
+			textColor = "Good"
+		case "WARNING":
+			textColor = "Warning"
+		}
+		_, err = enqueueWebhook(db, a.Project.ID, integ.Config["webhook_url"], "uptime", teamsCard([]interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": a.title(), "weight": "Bolder", "size": "Medium", "color": textColor, "wrap": true},
+			map[string]interface{}{"type": "FactSet", "facts": facts},
+		}, "Open project", link))
+	case "pagerduty":
+		event := map[string]interface{}{
+			"routing_key": integ.Config["routing_key"],
+			"dedup_key":   a.dedupKey(),
+		}
+		severity, class := "critical", "uptime"
+		if a.isCertificate() {
+			severity, class = "warning", "certificate"
+		}
+		if a.resolves() {
+			event["event_action"] = "resolve"
+		} else {
+			details := map[string]interface{}{}
+			for _, f := range a.facts() {
+				details[strings.ToLower(strings.ReplaceAll(f[0], " ", "_"))] = f[1]
+			}
+			event["event_action"] = "trigger"
+			event["payload"] = map[string]interface{}{
+				"summary":        truncateRunes(fmt.Sprintf("[%s] %s", a.Project.Name, a.title()), 1024),
+				"source":         a.Monitor.URL,
+				"severity":       severity,
+				"timestamp":      a.Check.CreatedAt.UTC().Format(time.RFC3339),
+				"component":      a.Monitor.Name,
+				"class":          class,
+				"custom_details": details,
+			}
+			event["links"] = []interface{}{map[string]string{"href": link, "text": "Open project in Pulse"}}
+		}
+		_, err = enqueueWebhook(db, a.Project.ID, pagerDutyURL(integ), "uptime", event)
+	case "opsgenie":
+		if a.resolves() {
+			_, err = enqueueWebhookWithHeaders(db, a.Project.ID,
+				opsgenieBaseURL(integ)+"/v2/alerts/"+url.PathEscape(a.dedupKey())+"/close?identifierType=alias", "uptime",
+				opsgenieHeaders(integ), map[string]interface{}{"source": "Pulse", "note": a.title()})
+		} else {
+			details := map[string]string{}
+			priority := "P1"
+			if a.isCertificate() {
+				priority = "P3"
+			}
+			for _, f := range a.facts() {
+				details[strings.ToLower(strings.ReplaceAll(f[0], " ", "_"))] = f[1]
+			}
+			_, err = enqueueWebhookWithHeaders(db, a.Project.ID, opsgenieBaseURL(integ)+"/v2/alerts", "uptime",
+				opsgenieHeaders(integ), map[string]interface{}{
+					"message":     truncateRunes(fmt.Sprintf("[%s] %s", a.Project.Name, a.title()), 130),
+					"alias":       a.dedupKey(),
+					"description": a.text() + "\n" + link,
+					"priority":    priority,
+					"source":      "Pulse",
+					"entity":      a.Monitor.Name,
+					"tags":        []string{"pulse", "uptime"},
+					"details":     details,
+				})
+		}
+	default:
+		return fmt.Errorf("unknown integration type %q", integ.Type)
+	}
+	return err
+}
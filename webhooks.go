@@ -0,0 +1,757 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// WebhookEndpoint is an outbound URL with the secret used to sign its deliveries.
+// Endpoints with an empty ProjectID are global (e.g. the generic webhook setting).
+type WebhookEndpoint struct {
+	ID        string    `json:"id"`
+	ProjectID string    `json:"project_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one queued outbound request and its retry state
+type WebhookDelivery struct {
+	ID              string                   `json:"id"`
+	EndpointID      string                   `json:"endpoint_id"`
+	ProjectID       string                   `json:"project_id"`
+	URL             string                   `json:"url"`
+	EventType       string                   `json:"event_type"`
+	Payload         json.RawMessage          `json:"payload,omitempty"`
+	Status          string                   `json:"status"` // pending, delivering, succeeded, failed
+	Attempts        int                      `json:"attempts"`
+	MaxAttempts     int                      `json:"max_attempts"`
+	NextAttemptAt   *time.Time               `json:"next_attempt_at,omitempty"`
+	LastStatusCode  int                      `json:"last_status_code"`
+	LastError       string                   `json:"last_error,omitempty"`
+	ResponseSnippet string                   `json:"response_snippet,omitempty"`
+	RedeliveryOf    string                   `json:"redelivery_of,omitempty"`
+	CreatedAt       time.Time                `json:"created_at"`
+	UpdatedAt       time.Time                `json:"updated_at"`
+	DeliveredAt     *time.Time               `json:"delivered_at,omitempty"`
+	AttemptLog      []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt records the outcome of a single HTTP request
+type WebhookDeliveryAttempt struct {
+	ID              string    `json:"id"`
+	DeliveryID      string    `json:"delivery_id"`
+	Attempt         int       `json:"attempt"`
+	StatusCode      int       `json:"status_code"`
+	Error           string    `json:"error,omitempty"`
+	ResponseSnippet string    `json:"response_snippet,omitempty"`
+	DurationMs      int64     `json:"duration_ms"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+const (
+	webhookMaxAttempts     = 8
+	webhookBaseBackoff     = 30 * time.Second
+	webhookMaxBackoff      = time.Hour
+	webhookSnippetSize     = 1024
+	webhookWorkerCount     = 4
+	webhookDeliveryTimeout = 10 * time.Second
+	webhookRetention       = 30 * 24 * time.Hour
+)
+
+var (
+	webhookHTTPClient = &http.Client{Timeout: webhookDeliveryTimeout}
+	webhookWake       = make(chan struct{}, 1)
+)
+
+// enqueueWebhook persists a signed JSON delivery to url. It returns as soon as the
+// delivery is stored; the webhook worker sends it and retries with backoff.
+func enqueueWebhook(db *sql.DB, projectID, url, eventType string, payload interface{}) (*WebhookDelivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := ensureWebhookEndpoint(db, webhookEndpointScope(db, projectID, url), url)
+	if err != nil {
+		return nil, err
+	}
+	return insertWebhookDelivery(db, endpoint.ID, projectID, url, eventType, body, nil, "")
+}
+
+// enqueueWebhookWithHeaders is enqueueWebhook for receivers that authenticate
+// requests with their own headers (e.g. an API key) on top of the signature
+func enqueueWebhookWithHeaders(db *sql.DB, projectID, url, eventType string, headers map[string]string, payload interface{}) (*WebhookDelivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := ensureWebhookEndpoint(db, webhookEndpointScope(db, projectID, url), url)
+	if err != nil {
+		return nil, err
+	}
+	return insertWebhookDelivery(db, endpoint.ID, projectID, url, eventType, body, headers, "")
+}
+
+func insertWebhookDelivery(db *sql.DB, endpointID, projectID, url, eventType string, body []byte, headers map[string]string, redeliveryOf string) (*WebhookDelivery, error) {
+	now := time.Now()
+	d := &WebhookDelivery{
+		ID:            uuid.New().String(),
+		EndpointID:    endpointID,
+		ProjectID:     projectID,
+		URL:           url,
+		EventType:     eventType,
+		Payload:       body,
+		Status:        "pending",
+		MaxAttempts:   webhookMaxAttempts,
+		NextAttemptAt: &now,
+		RedeliveryOf:  redeliveryOf,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	// Headers carry receiver credentials such as an Opsgenie API key, so they're stored sealed
+	headersJSON := ""
+	if len(headers) > 0 {
+		b, _ := json.Marshal(headers)
+		sealed, err := sealSecret(string(b))
+		if err != nil {
+			return nil, err
+		}
+		headersJSON = sealed
+	}
+	_, err := db.Exec(`
+		INSERT INTO webhook_deliveries (id, endpoint_id, project_id, url, event_type, payload, headers, status, attempts, max_attempts, next_attempt_at, redelivery_of, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?, ?)`,
+		d.ID, d.EndpointID, d.ProjectID, d.URL, d.EventType, string(body), headersJSON, d.Status, d.MaxAttempts, now, d.RedeliveryOf, now, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+	return d, nil
+}
+
+// webhookEndpointScope keeps one secret per globally configured URL and one per
+// project otherwise
+func webhookEndpointScope(db *sql.DB, projectID, url string) string {
+	settings, _ := GetAllSettings(db)
+	if url == settings["generic_webhook"] || url == settings["slack_webhook"] {
+		return ""
+	}
+	return projectID
+}
+
+// ensureWebhookEndpoint returns the endpoint for url, creating it with a fresh secret
+func ensureWebhookEndpoint(db *sql.DB, projectID, url string) (*WebhookEndpoint, error) {
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`INSERT OR IGNORE INTO webhook_endpoints (id, project_id, url, secret, created_at) VALUES (?, ?, ?, ?, ?)`,
+		uuid.New().String(), projectID, url, secret, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var e WebhookEndpoint
+	err = db.QueryRow(`SELECT id, project_id, url, secret, created_at FROM webhook_endpoints WHERE project_id = ? AND url = ?`,
+		projectID, url).Scan(&e.ID, &e.ProjectID, &e.URL, &e.Secret, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// signWebhook returns the X-Pulse-Signature header value: "t=<unix>,v1=<hex>"
+// where v1 is HMAC-SHA256(secret, "<unix>.<body>")
+func signWebhook(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before the next attempt after `attempts` failures
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return delay
+}
+
+// StartWebhookWorker sends due deliveries from the queue until the process exits
+func StartWebhookWorker(db *sql.DB) {
+	log.Println("Starting webhook delivery worker...")
+
+	// Deliveries claimed by a previous process that never finished are retried
+	db.Exec("UPDATE webhook_deliveries SET status = 'pending' WHERE status = 'delivering'")
+
+	jobs := make(chan string, webhookWorkerCount)
+	for i := 0; i < webhookWorkerCount; i++ {
+		go func() {
+			for id := range jobs {
+				attemptWebhookDelivery(db, id)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		for _, id := range claimDueWebhookDeliveries(db, webhookWorkerCount*4) {
+			jobs <- id
+		}
+
+		if time.Since(lastPrune) > time.Hour {
+			pruneWebhookDeliveries(db)
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// claimDueWebhookDeliveries marks up to limit due deliveries as delivering and returns their IDs
+func claimDueWebhookDeliveries(db *sql.DB, limit int) []string {
+	rows, err := db.Query(`SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC LIMIT ?`, time.Now(), limit)
+	if err != nil {
+		log.Printf("[Webhooks] Failed to query due deliveries: %v", err)
+		return nil
+	}
+	var candidates []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			candidates = append(candidates, id)
+		}
+	}
+	rows.Close()
+
+	var claimed []string
+	for _, id := range candidates {
+		res, err := db.Exec("UPDATE webhook_deliveries SET status = 'delivering', updated_at = ? WHERE id = ? AND status = 'pending'", time.Now(), id)
+		if err != nil {
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			claimed = append(claimed, id)
+		}
+	}
+	return claimed
+}
+
+func attemptWebhookDelivery(db *sql.DB, id string) {
+	var d WebhookDelivery
+	var payload, headersJSON, secret string
+	err := db.QueryRow(`
+		SELECT d.id, d.url, d.event_type, d.payload, COALESCE(d.headers, ''), d.attempts, d.max_attempts, e.secret
+		FROM webhook_deliveries d JOIN webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE d.id = ?`, id).Scan(&d.ID, &d.URL, &d.EventType, &payload, &headersJSON, &d.Attempts, &d.MaxAttempts, &secret)
+	if err != nil {
+		// Put it back in the queue rather than leave it claimed until a restart
+		log.Printf("[Webhooks] Failed to load delivery %s: %v", id, err)
+		db.Exec("UPDATE webhook_deliveries SET status = 'pending', next_attempt_at = ?, updated_at = ? WHERE id = ? AND status = 'delivering'",
+			time.Now().Add(webhookBaseBackoff), time.Now(), id)
+		return
+	}
+	headers, err := openWebhookHeaders(headersJSON)
+	if err != nil {
+		log.Printf("[Webhooks] Failed to read headers of delivery %s: %v", id, err)
+	}
+
+	body := []byte(payload)
+	attempt := d.Attempts + 1
+	start := time.Now()
+
+	statusCode, snippet, sendErr := sendWebhookRequest(d.URL, d.ID, d.EventType, secret, headers, body)
+	duration := time.Since(start)
+
+	errMsg := ""
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	}
+	db.Exec(`INSERT INTO webhook_delivery_attempts (id, delivery_id, attempt, status_code, error, response_snippet, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), d.ID, attempt, statusCode, errMsg, snippet, duration.Milliseconds(), time.Now())
+
+	now := time.Now()
+	switch {
+	case sendErr == nil && statusCode >= 200 && statusCode < 300:
+		db.Exec(`UPDATE webhook_deliveries SET status = 'succeeded', attempts = ?, last_status_code = ?, last_error = '',
+			response_snippet = ?, next_attempt_at = NULL, delivered_at = ?, updated_at = ? WHERE id = ?`,
+			attempt, statusCode, snippet, now, now, d.ID)
+		return
+	case sendErr == nil && !isRetryableWebhookStatus(statusCode):
+		errMsg = fmt.Sprintf("receiver returned %d", statusCode)
+		attempt = d.MaxAttempts // no point retrying a request the receiver rejects
+	case sendErr == nil:
+		errMsg = fmt.Sprintf("receiver returned %d", statusCode)
+	}
+
+	if attempt >= d.MaxAttempts {
+		log.Printf("[Webhooks] Delivery %s to %s failed permanently: %s", d.ID, d.URL, errMsg)
+		db.Exec(`UPDATE webhook_deliveries SET status = 'failed', attempts = ?, last_status_code = ?, last_error = ?,
+			response_snippet = ?, next_attempt_at = NULL, updated_at = ? WHERE id = ?`,
+			d.Attempts+1, statusCode, errMsg, snippet, now, d.ID)
+		return
+	}
+
+	next := now.Add(webhookBackoff(attempt))
+	log.Printf("[Webhooks] Delivery %s to %s failed (attempt %d/%d): %s; retrying at %s",
+		d.ID, d.URL, attempt, d.MaxAttempts, errMsg, next.Format(time.RFC3339))
+	db.Exec(`UPDATE webhook_deliveries SET status = 'pending', attempts = ?, last_status_code = ?, last_error = ?,
+		response_snippet = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+		attempt, statusCode, errMsg, snippet, next, now, d.ID)
+}
+
+// openWebhookHeaders reads the sealed headers column of a delivery
+func openWebhookHeaders(stored string) (map[string]string, error) {
+	if stored == "" {
+		return nil, nil
+	}
+	plain, err := openSecret(stored)
+	if err != nil {
+		return nil, err
+	}
+	var headers map[string]string
+	err = json.Unmarshal([]byte(plain), &headers)
+	return headers, err
+}
+
+func isRetryableWebhookStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+func sendWebhookRequest(url, deliveryID, eventType, secret string, headers map[string]string, body []byte) (int, string, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Pulse-Webhooks/1.0")
+	req.Header.Set("X-Pulse-Delivery", deliveryID)
+	req.Header.Set("X-Pulse-Event", eventType)
+	req.Header.Set("X-Pulse-Signature", signWebhook(secret, time.Now(), body))
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookSnippetSize))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, string(snippet), nil
+}
+
+func pruneWebhookDeliveries(db *sql.DB) {
+	cutoff := time.Now().Add(-webhookRetention)
+	res, err := db.Exec("DELETE FROM webhook_deliveries WHERE status IN ('succeeded', 'failed') AND updated_at < ?", cutoff)
+	if err != nil {
+		log.Printf("[Webhooks] Failed to prune old deliveries: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[Webhooks] Pruned %d old deliveries", n)
+	}
+
+	// Attempts of deliveries deleted while foreign keys were only enabled on one
+	// connection of the pool
+	db.Exec("DELETE FROM webhook_delivery_attempts WHERE delivery_id NOT IN (SELECT id FROM webhook_deliveries)")
+}
+
+// maskWebhookURL hides the parts of a webhook URL that act as credentials, such as the
+// token in a Slack or Discord URL: everything after the first path segment, query
+// values and user info
+func maskWebhookURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return maskSecret(raw)
+	}
+	masked := u.Scheme + "://" + u.Host
+	segments := strings.SplitN(strings.TrimPrefix(u.EscapedPath(), "/"), "/", 2)
+	if segments[0] != "" {
+		masked += "/" + segments[0]
+	}
+	if len(segments) == 2 && segments[1] != "" {
+		masked += "/" + maskSecret(segments[1])
+	}
+	if query := u.Query(); len(query) > 0 {
+		keys := make([]string, 0, len(query))
+		for k := range query {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var params []string
+		for _, k := range keys {
+			for _, v := range query[k] {
+				params = append(params, url.QueryEscape(k)+"="+maskSecret(v))
+			}
+		}
+		masked += "?" + strings.Join(params, "&")
+	}
+	return masked
+}
+
+// isWebhookSecretField reports whether a payload field holds a credential
+func isWebhookSecretField(key string) bool {
+	return integrationSecretKeys[strings.ToLower(key)] || isSensitiveAuditKey(key)
+}
+
+// maskWebhookPayload hides credential fields anywhere in a JSON payload, such as a
+// PagerDuty routing_key
+func maskWebhookPayload(payload json.RawMessage) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return payload
+	}
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if s, ok := child.(string); ok && isWebhookSecretField(k) {
+					v[k] = maskSecret(s)
+				} else {
+					v[k] = walk(child)
+				}
+			}
+		case []interface{}:
+			for i, child := range v {
+				v[i] = walk(child)
+			}
+		}
+		return v
+	}
+	masked, err := json.Marshal(walk(v))
+	if err != nil {
+		return payload
+	}
+	return masked
+}
+
+// masked returns a copy safe to send to clients, with credentials in the URL and
+// payload hidden
+func (d WebhookDelivery) masked() WebhookDelivery {
+	raw := d.URL
+	d.URL = maskWebhookURL(raw)
+	if len(d.Payload) > 0 {
+		d.Payload = maskWebhookPayload(d.Payload)
+	}
+	// Request errors quote the URL
+	d.LastError = strings.ReplaceAll(d.LastError, raw, d.URL)
+	if d.AttemptLog != nil {
+		attempts := make([]WebhookDeliveryAttempt, len(d.AttemptLog))
+		for i, a := range d.AttemptLog {
+			a.Error = strings.ReplaceAll(a.Error, raw, d.URL)
+			attempts[i] = a
+		}
+		d.AttemptLog = attempts
+	}
+	return d
+}
+
+// Webhook database functions
+
+func GetWebhookDeliveries(db *sql.DB, projectID, status string, limit, offset int) ([]WebhookDelivery, int, error) {
+	where := " WHERE project_id = ?"
+	args := []interface{}{projectID}
+	if status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webhook_deliveries"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`SELECT id, endpoint_id, project_id, url, event_type, '', status, attempts, max_attempts, next_attempt_at,
+		last_status_code, last_error, response_snippet, redelivery_of, created_at, updated_at, delivered_at
+		FROM webhook_deliveries`+where+" ORDER BY created_at DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, total, rows.Err()
+}
+
+func GetWebhookDelivery(db *sql.DB, projectID, id string) (*WebhookDelivery, error) {
+	rows, err := db.Query(`SELECT id, endpoint_id, project_id, url, event_type, payload, status, attempts, max_attempts, next_attempt_at,
+		last_status_code, last_error, response_snippet, redelivery_of, created_at, updated_at, delivered_at
+		FROM webhook_deliveries WHERE project_id = ? AND id = ?`, projectID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	d, err := scanWebhookDelivery(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	attemptRows, err := db.Query(`SELECT id, delivery_id, attempt, status_code, error, response_snippet, duration_ms, created_at
+		FROM webhook_delivery_attempts WHERE delivery_id = ? ORDER BY attempt ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer attemptRows.Close()
+	for attemptRows.Next() {
+		var a WebhookDeliveryAttempt
+		if err := attemptRows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.ResponseSnippet, &a.DurationMs, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return d, attemptRows.Err()
+}
+
+func scanWebhookDelivery(rows *sql.Rows) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload string
+	var nextAttempt, deliveredAt sql.NullTime
+	err := rows.Scan(&d.ID, &d.EndpointID, &d.ProjectID, &d.URL, &d.EventType, &payload, &d.Status, &d.Attempts, &d.MaxAttempts,
+		&nextAttempt, &d.LastStatusCode, &d.LastError, &d.ResponseSnippet, &d.RedeliveryOf, &d.CreatedAt, &d.UpdatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if payload != "" {
+		d.Payload = json.RawMessage(payload)
+	}
+	if nextAttempt.Valid {
+		d.NextAttemptAt = &nextAttempt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+func GetWebhookEndpoints(db *sql.DB, projectID string) ([]WebhookEndpoint, error) {
+	rows, err := db.Query(`SELECT id, project_id, url, secret, created_at FROM webhook_endpoints
+		WHERE project_id = ? OR project_id = '' ORDER BY created_at ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []WebhookEndpoint
+	for rows.Next() {
+		var e WebhookEndpoint
+		if err := rows.Scan(&e.ID, &e.ProjectID, &e.URL, &e.Secret, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
+
+// Webhook handlers
+
+func getWebhookEndpoints(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	// Make sure every configured webhook has a secret before it first fires, so
+	// receivers can be set up ahead of time
+	if settings, err := GetProjectSettings(db, projectID); err == nil && settings.NotificationWebhookURL != "" {
+		ensureWebhookEndpoint(db, projectID, settings.NotificationWebhookURL)
+	}
+	if url, _ := GetSetting(db, "generic_webhook"); url != "" {
+		ensureWebhookEndpoint(db, "", url)
+	}
+
+	endpoints, err := GetWebhookEndpoints(db, projectID)
+	if err != nil {
+		log.Printf("Error fetching webhook endpoints: %v", err)
+		http.Error(w, "Failed to fetch webhooks", http.StatusInternalServerError)
+		return
+	}
+	if endpoints == nil {
+		endpoints = []WebhookEndpoint{}
+	}
+	for i := range endpoints {
+		endpoints[i].URL = maskWebhookURL(endpoints[i].URL)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpoints)
+}
+
+func rotateWebhookSecret(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+	webhookID := vars["webhookId"]
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := db.Exec("UPDATE webhook_endpoints SET secret = ? WHERE id = ? AND (project_id = ? OR project_id = '')", secret, webhookID, projectID)
+	if err != nil {
+		http.Error(w, "Failed to rotate secret", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	recordAudit(db, r, "webhook.rotate_secret", "webhook", webhookID, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": webhookID, "secret": secret})
+}
+
+func getWebhookDeliveries(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	deliveries, total, err := GetWebhookDeliveries(db, projectID, strings.TrimSpace(r.URL.Query().Get("status")), limit, offset)
+	if err != nil {
+		log.Printf("Error fetching webhook deliveries: %v", err)
+		http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []WebhookDelivery{}
+	}
+	for i := range deliveries {
+		deliveries[i] = deliveries[i].masked()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+func getWebhookDelivery(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+
+	d, err := GetWebhookDelivery(db, vars["id"], vars["deliveryId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch delivery", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.masked())
+}
+
+// redeliverWebhook queues a fresh copy of a past delivery, signed with the current secret
+func redeliverWebhook(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	vars := mux.Vars(r)
+	projectID := vars["id"]
+
+	original, err := GetWebhookDelivery(db, projectID, vars["deliveryId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch delivery", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var headersJSON string
+	db.QueryRow("SELECT COALESCE(headers, '') FROM webhook_deliveries WHERE id = ?", original.ID).Scan(&headersJSON)
+	headers, err := openWebhookHeaders(headersJSON)
+	if err != nil {
+		log.Printf("Error reading headers of webhook delivery %s: %v", original.ID, err)
+		http.Error(w, "Failed to queue redelivery", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := insertWebhookDelivery(db, original.EndpointID, projectID, original.URL, original.EventType, original.Payload, headers, original.ID)
+	if err != nil {
+		log.Printf("Error redelivering webhook %s: %v", original.ID, err)
+		http.Error(w, "Failed to queue redelivery", http.StatusInternalServerError)
+		return
+	}
+	d.Payload = nil
+
+	recordAudit(db, r, "webhook.redeliver", "webhook_delivery", original.ID, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(d.masked())
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebSocket monitors complete the upgrade handshake and, when configured, send a text
+// message and assert on the reply. Assertions use the HTTP sources: body and json see
+// the reply, header sees the handshake response and response_time covers the exchange.
+// The frame code works on any io.ReadWriter, so it runs the same against a stub.
+
+const websocketAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// Handshake headers the monitor sets itself
+var websocketReservedHeaders = map[string]bool{
+	"upgrade": true, "connection": true, "sec-websocket-key": true, "sec-websocket-version": true,
+	"sec-websocket-extensions": true,
+}
+
+// WebSocketMonitorConfig holds the handshake headers, message and assertions of a
+// WebSocket monitor. The zero value only checks that the upgrade succeeds.
+type WebSocketMonitorConfig struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	// Message is sent as a text frame once connected
+	Message       string          `json:"message,omitempty"`
+	Assertions    []HTTPAssertion `json:"assertions,omitempty"`
+	SkipTLSVerify bool            `json:"skip_tls_verify,omitempty"`
+
+	// openErr is set when stored headers can't be decrypted
+	openErr error
+}
+
+// validate rejects headers the handshake owns and assertions that can't be evaluated
+func (c *WebSocketMonitorConfig) validate() error {
+	for k := range c.Headers {
+		if websocketReservedHeaders[strings.ToLower(k)] {
+			return fmt.Errorf("header %q is set by the handshake", k)
+		}
+	}
+	if len(c.Message) > maxMonitorBody {
+		return fmt.Errorf("message must be at most %d bytes", maxMonitorBody)
+	}
+	return validateAssertions(c.Assertions, assertionOperators)
+}
+
+// masked returns a copy safe to send to clients, hiding credentials in headers
+func (c *WebSocketMonitorConfig) masked() *WebSocketMonitorConfig {
+	if c == nil {
+		return nil
+	}
+	out := *c
+	out.Headers = maskedHeaders(c.Headers)
+	return &out
+}
+
+// sealed returns a copy for storage with sensitive header values encrypted
+func (c *WebSocketMonitorConfig) sealed() (*WebSocketMonitorConfig, error) {
+	if c == nil {
+		return nil, nil
+	}
+	out := *c
+	headers, err := sealedHeaders(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+	out.Headers = headers
+	return &out, nil
+}
+
+// open decrypts the stored headers in place
+func (c *WebSocketMonitorConfig) open() {
+	if c != nil {
+		c.openErr = openHeaders(c.Headers)
+	}
+}
+
+// keepMaskedSecrets restores headers that a client echoed back masked
+func (c *WebSocketMonitorConfig) keepMaskedSecrets(existing *WebSocketMonitorConfig) {
+	if existing != nil {
+		keepMaskedHeaders(c.Headers, existing.Headers)
+	}
+}
+
+// waitsForReply reports whether the check reads a message after the handshake
+func (c *WebSocketMonitorConfig) waitsForReply() bool {
+	if c.Message != "" {
+		return true
+	}
+	for _, a := range c.Assertions {
+		if a.Source == "body" || a.Source == "json" {
+			return true
+		}
+	}
+	return false
+}
+
+// websocketHTTPURL maps a ws:// or wss:// URL to the http(s) URL the handshake requests
+func websocketHTTPURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", errors.New("URL must start with ws:// or wss://")
+	}
+	if u.Host == "" {
+		return "", errors.New("URL has no host")
+	}
+	return u.String(), nil
+}
+
+// checkWebSocket opens a WebSocket to the monitor's URL, exchanges the configured
+// message and evaluates the assertions. Every failure is listed in errMsg.
+func checkWebSocket(m *Monitor, timeout time.Duration) (status string, statusCode int, errMsg string, timings *HTTPTimings) {
+	cfg := m.WebSocket
+	if cfg == nil {
+		cfg = &WebSocketMonitorConfig{}
+	}
+	if cfg.openErr != nil {
+		return "down", 0, cfg.openErr.Error(), nil
+	}
+	target, err := websocketHTTPURL(m.URL)
+	if err != nil {
+		return "down", 0, err.Error(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return "down", 0, err.Error(), nil
+	}
+	for k, v := range cfg.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	req, snapshot := traceHTTPTimings(req)
+
+	// A custom TLS config keeps the transport on HTTP/1.1, which the upgrade needs
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	client := http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return "down", 0, err.Error(), snapshot()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return "down", resp.StatusCode, fmt.Sprintf("handshake got %s, expected 101 Switching Protocols", resp.Status), snapshot()
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return "down", resp.StatusCode, "handshake response doesn't upgrade to websocket", snapshot()
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return "down", resp.StatusCode, "handshake response has the wrong Sec-WebSocket-Accept", snapshot()
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return "down", resp.StatusCode, "upgraded connection isn't writable", snapshot()
+	}
+	// The request context stops bounding the connection once it's upgraded
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var reply []byte
+	if cfg.Message != "" {
+		err = writeWebSocketFrame(conn, wsOpText, []byte(cfg.Message))
+	}
+	if err == nil && cfg.waitsForReply() {
+		reply, err = readWebSocketMessage(conn)
+	}
+	elapsed := time.Since(start)
+	timings = snapshot()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = errors.New("timed out waiting for a reply")
+		}
+		return "down", resp.StatusCode, err.Error(), timings
+	}
+	// Normal closure; the server's answer isn't waited for
+	writeWebSocketFrame(conn, wsOpClose, binary.BigEndian.AppendUint16(nil, 1000))
+
+	var failures []string
+	for _, a := range cfg.Assertions {
+		if msg := a.evaluate(resp, reply, elapsed); msg != "" {
+			failures = append(failures, msg)
+		}
+	}
+	if len(failures) > 0 {
+		return "down", resp.StatusCode, strings.Join(failures, "; "), timings
+	}
+	return "up", resp.StatusCode, "", timings
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept answer to a handshake key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// writeWebSocketFrame sends one final frame, masked as clients must
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// readWebSocketFrame reads one frame, unmasking it if needed
+func readWebSocketFrame(r io.Reader) (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		return
+	}
+	if head[0]&0x70 != 0 {
+		err = errors.New("server used a WebSocket extension that wasn't negotiated")
+		return
+	}
+	fin, opcode = head[0]&0x80 != 0, head[0]&0x0F
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxMonitorBody {
+		err = fmt.Errorf("frame of %d bytes is too large", n)
+		return
+	}
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err = io.ReadFull(r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// readWebSocketMessage reads the next text or binary message, joining fragments and
+// answering pings on the way
+func readWebSocketMessage(rw io.ReadWriter) ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := readWebSocketFrame(rw)
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := writeWebSocketFrame(rw, wsOpPong, payload); err != nil {
+				return nil, err
+			}
+		case wsOpPong:
+		case wsOpClose:
+			return nil, websocketCloseError(payload)
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			if len(message)+len(payload) > maxMonitorBody {
+				return nil, errors.New("message is too large")
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %d", opcode)
+		}
+	}
+}
+
+// websocketCloseError describes a close frame the server sent instead of a reply
+func websocketCloseError(payload []byte) error {
+	if len(payload) < 2 {
+		return errors.New("server closed the connection")
+	}
+	code := binary.BigEndian.Uint16(payload)
+	if reason := string(payload[2:]); reason != "" {
+		return fmt.Errorf("server closed the connection (%d: %s)", code, truncateRunes(reason, 200))
+	}
+	return fmt.Errorf("server closed the connection (%d)", code)
+}
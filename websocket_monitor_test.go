@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// websocketEchoStub upgrades requests that carry a valid handshake and the expected
+// Authorization header, then echoes each text message back. Without the header it
+// closes with 1008, and a bad handshake gets 400.
+type websocketEchoStub struct {
+	*httptest.Server
+	token string
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func newWebSocketEchoStub(t *testing.T, token string) *websocketEchoStub {
+	t.Helper()
+	s := &websocketEchoStub{token: token}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *websocketEchoStub) serve(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || !strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return
+	}
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"X-Echo: yes\r\nSec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	buf.Flush()
+
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		writeServerFrame(buf.Writer, wsOpClose, append(binary.BigEndian.AppendUint16(nil, 1008), "unauthorized"...))
+		return
+	}
+	for {
+		_, opcode, payload, err := readWebSocketFrame(buf.Reader)
+		if err != nil || opcode == wsOpClose {
+			return
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, string(payload))
+		s.mu.Unlock()
+		writeServerFrame(buf.Writer, wsOpText, payload)
+	}
+}
+
+// writeServerFrame sends an unmasked frame, as servers do
+func writeServerFrame(w *bufio.Writer, opcode byte, payload []byte) {
+	w.Write([]byte{0x80 | opcode, byte(len(payload))})
+	w.Write(payload)
+	w.Flush()
+}
+
+func TestWebSocketMonitorAgainstEchoStub(t *testing.T) {
+	stub := newWebSocketEchoStub(t, "ws-t0ken")
+	wsURL := "ws" + strings.TrimPrefix(stub.URL, "http")
+	auth := map[string]string{"Authorization": "Bearer ws-t0ken"}
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		cfg         WebSocketMonitorConfig
+		wantStatus  string
+		wantCode    int
+		wantError   string
+		wantMessage string
+	}{
+		{"handshake only", wsURL, WebSocketMonitorConfig{Headers: auth}, "up", 101, "", ""},
+		{"echo matches", wsURL, WebSocketMonitorConfig{Headers: auth, Message: `{"type":"ping"}`, Assertions: []HTTPAssertion{
+			{Source: "json", Property: "type", Operator: "equals", Value: "ping"},
+			{Source: "header", Property: "X-Echo", Operator: "equals", Value: "yes"},
+		}}, "up", 101, "", `{"type":"ping"}`},
+		{"echo doesn't match", wsURL, WebSocketMonitorConfig{Headers: auth, Message: "hello", Assertions: []HTTPAssertion{
+			{Source: "body", Operator: "contains", Value: "pong"},
+		}}, "down", 101, "body", "hello"},
+		{"closed by the server", wsURL, WebSocketMonitorConfig{Message: "hello"}, "down", 101,
+			"server closed the connection (1008: unauthorized)", ""},
+		{"not a websocket server", "ws" + strings.TrimPrefix(plain.URL, "http"), WebSocketMonitorConfig{}, "down", 200,
+			"handshake got 200 OK, expected 101 Switching Protocols", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if err := cfg.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			stub.mu.Lock()
+			before := len(stub.messages)
+			stub.mu.Unlock()
+
+			status, code, errMsg, timings := checkWebSocket(&Monitor{URL: tt.url, WebSocket: &cfg}, 2*time.Second)
+			if status != tt.wantStatus || code != tt.wantCode || !strings.Contains(errMsg, tt.wantError) || (tt.wantStatus == "up") != (errMsg == "") {
+				t.Fatalf("checkWebSocket = %s %d %q", status, code, errMsg)
+			}
+			if timings == nil {
+				t.Error("no timings")
+			}
+
+			stub.mu.Lock()
+			defer stub.mu.Unlock()
+			if tt.wantMessage != "" && (len(stub.messages) != before+1 || stub.messages[before] != tt.wantMessage) {
+				t.Errorf("stub received %q, want %q", stub.messages[before:], tt.wantMessage)
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"math"
 	"net"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -12,16 +13,6 @@ import (
 	"github.com/google/uuid"
 )
 
-// Notification throttling cache
-type NotificationCache struct {
-	mu                sync.RWMutex
-	lastNotifications map[string]time.Time // key: "projectID:errorMessage"
-}
-
-var notificationCache = &NotificationCache{
-	lastNotifications: make(map[string]time.Time),
-}
-
 // Batch inserter for errors
 type ErrorBatch struct {
 	Event   *ErrorEvent
@@ -86,10 +77,7 @@ func flushErrorBatch(db *sql.DB) {
 	tx, err := db.Begin()
 	if err != nil {
 		log.Printf("Failed to begin batch transaction: %v", err)
-		// Fallback to individual inserts
-		for _, eb := range errorsToInsert {
-			InsertError(db, eb.Event)
-		}
+		insertErrorsIndividually(db, errorsToInsert)
 		return
 	}
 
@@ -97,15 +85,13 @@ func flushErrorBatch(db *sql.DB) {
 	if err != nil {
 		tx.Rollback()
 		log.Printf("Failed to prepare batch statement: %v", err)
-		// Fallback to individual inserts
-		for _, eb := range errorsToInsert {
-			InsertError(db, eb.Event)
-		}
+		insertErrorsIndividually(db, errorsToInsert)
 		return
 	}
 	defer stmt.Close()
 
 	projectCounts := make(map[string]int)
+	var inserted []ErrorBatch
 	for _, eb := range errorsToInsert {
 		// Generate fingerprint if not set
 		if eb.Event.Fingerprint == "" {
@@ -121,12 +107,11 @@ func flushErrorBatch(db *sql.DB) {
 			log.Printf("Failed to insert error in batch: %v", err)
 			continue
 		}
-		projectCounts[eb.Event.ProjectID]++
-
-		// Trigger notifications asynchronously with throttling
-		if eb.Project != nil {
-			go triggerNotificationsThrottled(db, eb.Project, eb.Event)
+		if err := recordReleaseEvent(tx, eb.Event); err != nil {
+			log.Printf("Failed to record release %q of error %s: %v", eb.Event.Release, eb.Event.ID, err)
 		}
+		projectCounts[eb.Event.ProjectID]++
+		inserted = append(inserted, eb)
 	}
 
 	// Batch update project counters
@@ -139,50 +124,59 @@ func flushErrorBatch(db *sql.DB) {
 
 	if err := tx.Commit(); err != nil {
 		log.Printf("Failed to commit batch transaction: %v", err)
-		// Fallback to individual inserts
-		for _, eb := range errorsToInsert {
-			InsertError(db, eb.Event)
-		}
+		insertErrorsIndividually(db, errorsToInsert)
 		return
 	}
 
 	log.Printf("Batch inserted %d errors for %d projects", len(errorsToInsert), len(projectCounts))
-}
-
-func StartMonitorWorker(db *sql.DB) {
-	log.Println("Starting uptime monitor worker...")
-	// Check every 30 seconds for monitors that need checking (optimized from 10s to reduce CPU usage)
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
 
-	for range ticker.C {
-		checkMonitors(db)
-	}
+	// Evaluate alert rules once the batch is visible, in order, so that
+	// new-issue and regression checks see earlier events from the same batch
+	go evaluateBatchAlertRules(db, inserted)
 }
 
-func checkMonitors(db *sql.DB) {
-	monitors, err := GetAllActiveMonitors(db)
-	if err != nil {
-		log.Printf("Error fetching monitors: %v", err)
-		return
+// insertErrorsIndividually is the fallback when the batch transaction fails. Events
+// that are stored still go through alert rules.
+func insertErrorsIndividually(db *sql.DB, batch []ErrorBatch) {
+	var inserted []ErrorBatch
+	for _, eb := range batch {
+		if err := InsertError(db, eb.Event); err != nil {
+			log.Printf("Failed to insert error %s: %v", eb.Event.ID, err)
+			continue
+		}
+		inserted = append(inserted, eb)
 	}
+	go evaluateBatchAlertRules(db, inserted)
+}
 
-	for _, m := range monitors {
-		// Run checks concurrently
-		go processMonitor(db, m)
+func evaluateBatchAlertRules(db *sql.DB, inserted []ErrorBatch) {
+	for _, eb := range inserted {
+		evaluateAlertRules(db, eb.Project, eb.Event)
 	}
 }
 
-func processMonitor(db *sql.DB, m Monitor) {
-	// Check if due: if LastCheckedAt exists and time since check < interval, skip
-	if m.LastCheckedAt != nil && time.Since(*m.LastCheckedAt).Seconds() < float64(m.Interval) {
-		return
+// processMonitor runs one check of m and records it; the scheduler decides when. A
+// failed attempt with retries left isn't recorded, and asks the scheduler to try again
+// after the monitor's retry interval instead.
+func processMonitor(db *sql.DB, m Monitor, attempt int) (retry bool) {
+	window := activeMaintenance(db, &m, time.Now())
+
+	// Heartbeats are pushed to; the worker only looks for missed and overrunning runs
+	if m.Type == "heartbeat" {
+		syncHeartbeatMaintenance(db, &m, window)
+		processHeartbeat(db, m)
+		return false
 	}
 
 	start := time.Now()
 	var status string
 	var statusCode int
 	var errMsg string
+	var pingResult *PingResult
+	var timings *HTTPTimings
+	var cert *CertificateInfo
+	var dnsResult *DNSResult
+	var steps []StepResult
 
 	timeout := time.Duration(m.Timeout) * time.Second
 	if timeout == 0 {
@@ -192,19 +186,48 @@ func processMonitor(db *sql.DB, m Monitor) {
 	// Route to appropriate check based on monitor type
 	switch strings.ToLower(m.Type) {
 	case "http", "https":
-		status, statusCode, errMsg = checkHTTP(m.URL, timeout)
+		status, statusCode, errMsg, timings = checkHTTP(&m, timeout)
 	case "tcp":
 		status, statusCode, errMsg = checkTCP(m.URL, timeout)
 	case "icmp":
-		status, statusCode, errMsg = checkICMP(m.URL, timeout)
+		status, errMsg, pingResult = checkICMP(m.URL, m.PingCount, m.PacketLossThreshold, timeout)
+	case "ssl":
+		status, errMsg, cert = checkSSL(m.URL, m.SSLAlertDays, timeout)
 	case "dns":
-		status, statusCode, errMsg = checkDNS(m.URL, timeout)
+		status, errMsg, dnsResult = checkDNS(&m, timeout)
+	case "postgres", "mysql", "redis":
+		status, errMsg = checkConnection(&m, timeout)
+	case "grpc":
+		status, statusCode, errMsg, timings = checkGRPC(&m, timeout)
+	case "websocket":
+		status, statusCode, errMsg, timings = checkWebSocket(&m, timeout)
+	case "multistep":
+		status, statusCode, errMsg, steps = checkMultiStep(&m, timeout)
 	default:
 		// Default to HTTP for backward compatibility
-		status, statusCode, errMsg = checkHTTP(m.URL, timeout)
+		status, statusCode, errMsg, timings = checkHTTP(&m, timeout)
 	}
 
 	duration := time.Since(start).Milliseconds()
+	if pingResult != nil && pingResult.Received > 0 {
+		// A check spans several probes; report the round trip instead
+		duration = int64(math.Round(pingResult.RTTAvg))
+	}
+	if dnsResult != nil {
+		duration = int64(math.Round(dnsResult.ResolutionTime))
+	}
+
+	if window != nil {
+		// Planned downtime: keep the result but don't retry, alert or count it as down
+		status = "maintenance"
+	} else if status == "down" && attempt <= m.Retries {
+		log.Printf("Monitor %s failed attempt %d of %d, retrying in %ds: %s", m.ID, attempt, m.Retries+1, m.RetryInterval, errMsg)
+		return true
+	}
+	if status == "up" && m.DegradedResponseTime > 0 && duration > int64(m.DegradedResponseTime) {
+		status = "degraded"
+		errMsg = fmt.Sprintf("response time %dms exceeds %dms", duration, m.DegradedResponseTime)
+	}
 
 	check := &MonitorCheck{
 		ID:           uuid.New().String(),
@@ -214,11 +237,17 @@ func processMonitor(db *sql.DB, m Monitor) {
 		StatusCode:   statusCode,
 		ErrorMessage: errMsg,
 		CreatedAt:    time.Now(),
+		Attempts:     attempt,
+		Ping:         pingResult,
+		Timings:      timings,
+		Certificate:  cert,
+		DNS:          dnsResult,
+		Steps:        steps,
 	}
 
 	if err := InsertMonitorCheck(db, check); err != nil {
 		log.Printf("Failed to insert check for monitor %s: %v", m.ID, err)
-		return
+		return false
 	}
 
 	// Update monitor status
@@ -226,24 +255,12 @@ func processMonitor(db *sql.DB, m Monitor) {
 	if err != nil {
 		log.Printf("Failed to update monitor status for %s: %v", m.ID, err)
 	}
-}
-
-func checkHTTP(url string, timeout time.Duration) (status string, statusCode int, errMsg string) {
-	client := http.Client{
-		Timeout: timeout,
-	}
-
-	resp, err := client.Get(url)
-	if err != nil {
-		return "down", 0, err.Error()
-	}
-	defer resp.Body.Close()
 
-	statusCode = resp.StatusCode
-	if statusCode >= 200 && statusCode < 300 {
-		return "up", statusCode, ""
+	if window == nil {
+		evaluateMonitorAlert(db, &m, check)
+		evaluateCertificateAlert(db, &m, check)
 	}
-	return "down", statusCode, resp.Status
+	return false
 }
 
 func checkTCP(target string, timeout time.Duration) (status string, statusCode int, errMsg string) {
@@ -254,32 +271,3 @@ func checkTCP(target string, timeout time.Duration) (status string, statusCode i
 	defer conn.Close()
 	return "up", 0, ""
 }
-
-func checkICMP(hostname string, timeout time.Duration) (status string, statusCode int, errMsg string) {
-	// ICMP requires root privileges on most systems, so we'll do a TCP connection check instead
-	// This is a simplified check - for true ICMP, you'd need to use raw sockets
-	conn, err := net.DialTimeout("tcp", hostname+":80", timeout)
-	if err != nil {
-		// Try common ports
-		ports := []string{"443", "22", "8080"}
-		for _, port := range ports {
-			conn, err = net.DialTimeout("tcp", hostname+":"+port, timeout)
-			if err == nil {
-				conn.Close()
-				return "up", 0, ""
-			}
-		}
-		return "down", 0, "Host unreachable"
-	}
-	defer conn.Close()
-	return "up", 0, ""
-}
-
-func checkDNS(hostname string, timeout time.Duration) (status string, statusCode int, errMsg string) {
-	// Check DNS resolution
-	_, err := net.LookupHost(hostname)
-	if err != nil {
-		return "down", 0, err.Error()
-	}
-	return "up", 0, ""
-}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFallbackInsertsEvaluateAlertRules(t *testing.T) {
+	db := newTestDB(t)
+	project := newTestProject(t, db)
+	rule := &AlertRule{
+		ID: uuid.New().String(), ProjectID: project.ID, Name: "Every event", Enabled: true, ActionMatch: "any",
+		Conditions: []AlertCondition{{Type: "every_event"}},
+		Actions:    []AlertAction{{Type: "webhook", Target: "https://hooks.example.test/pulse"}},
+		CreatedAt:  time.Now(), UpdatedAt: time.Now(),
+	}
+	if err := SaveAlertRule(db, rule); err != nil {
+		t.Fatalf("SaveAlertRule: %v", err)
+	}
+
+	event := newTestNotification(project).Event
+	insertErrorsIndividually(db, []ErrorBatch{{Event: event, Project: project}})
+
+	if _, err := GetError(db, event.ID); err != nil {
+		t.Fatalf("event not stored: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var queued int
+		db.QueryRow("SELECT COUNT(*) FROM webhook_deliveries WHERE event_type = 'alert'").Scan(&queued)
+		if queued == 1 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("no alert queued for an event stored by the fallback insert")
+}